@@ -2,7 +2,9 @@
 
 import { handlers, message, connSM, connEvent } from './connection'
 import { posts, page } from './state'
-import { Post, FormModel, PostView, postEvent, postSM } from './posts'
+import {
+	Post, FormModel, PostView, postEvent, postSM, postState,
+} from './posts'
 import { PostLink, Command, PostData, ImageData } from "./common"
 import { postAdded } from "./ui"
 import { incrementPostCount } from "./page"
@@ -26,6 +28,13 @@ type CloseMessage = {
 // Message for inserting images into an open post
 interface ImageMessage extends ImageData {
 	id: number
+	index?: number // Position in the post's attachments, if not the first
+}
+
+// Navigates the client to a board or, if set, a thread on it
+type RedirectMessage = {
+	board: string
+	thread?: number
 }
 
 // Run a function on a model, if it exists
@@ -90,16 +99,23 @@ export default () => {
 
 	handlers[message.insertImage] = (msg: ImageMessage) =>
 		handle(msg.id, m => {
+			const { index } = msg
 			delete msg.id
+			delete msg.index
+			if (index) {
+				incrementPostCount(false, true)
+				m.insertExtraImage(msg)
+				return
+			}
 			if (!("image" in m)) {
 				incrementPostCount(false, true)
 			}
 			m.insertImage(msg)
 		})
 
-	handlers[message.spoiler] = (id: number) =>
+	handlers[message.spoiler] = ([id, category]: [number, number]) =>
 		handle(id, m =>
-			m.spoilerImage())
+			m.spoilerImage(category))
 
 	handlers[message.append] = ([id, char]: [number, number]) =>
 		handle(id, m =>
@@ -133,13 +149,23 @@ export default () => {
 		handle(id, m =>
 			m.removeImage())
 
+	// Sent, when a thread reaches its board's post limit
+	handlers[message.lockThread] = (id: number) =>
+		handle(id, m => {
+			m.locked = true
+			m.view.renderLocked()
+			if (postSM.state === postState.ready) {
+				postSM.state = postState.threadLocked
+			}
+		})
+
 	handlers[message.banned] = (id: number) =>
 		handle(id, m =>
 			m.setBanned())
 
-	handlers[message.redirect] = (board: string) => {
+	handlers[message.redirect] = ({ board, thread }: RedirectMessage) => {
 		postSM.feed(postEvent.reset)
-		location.href = `/${board}/`
+		location.href = `/${board}/${thread || ""}`
 	}
 
 	handlers[message.notification] = (text: string) =>
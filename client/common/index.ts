@@ -18,6 +18,7 @@ export interface PostData {
 	sticky: boolean
 	locked: boolean
 	image?: ImageData
+	images?: ImageData[] // Additional images past the first one
 	time: number
 	id: number
 	op: number
@@ -32,6 +33,42 @@ export interface PostData {
 	commands?: Command[]
 }
 
+// Lexer definition of a programming language for syntax highlighting
+export type Language = {
+	// Highlight lines as a unified diff instead of lexing
+	diff?: boolean
+
+	// Highlight number literals
+	numbers?: boolean
+
+	// Keywords and types are matched case-insensitively
+	caseInsensitive?: boolean
+
+	// Characters that open and close a string literal. Those in
+	// multilineQuotes may span multiple lines.
+	quotes?: string
+	multilineQuotes?: string
+
+	// Prefixes that start a comment, that spans the rest of the line
+	lineComments?: string[]
+
+	// Opening and closing delimiters of a block comment
+	blockComment?: [string, string]
+
+	keywords?: { [word: string]: boolean }
+	types?: { [word: string]: boolean }
+}
+
+// Lexer state carried between the lines of a multiline code block
+export type CodeState = {
+	// Closing delimiter of an unterminated string or comment
+	closer: string
+
+	// Unterminated token is a comment or a string, that can span lines
+	comment: boolean
+	multiline: boolean
+}
+
 // State of a post's text. Used for adding enclosing tags to the HTML while
 // parsing.
 export type TextState = {
@@ -41,6 +78,23 @@ export type TextState = {
 	haveSyncwatch: boolean
 	newlines: number
 	iDice: number // Index of the next dice array item to use
+
+	// Language of a fenced code block, if a hint was provided
+	codeLang?: Language | null
+
+	// Line number of the current line in a fenced code block and, if it has
+	// already been written
+	codeLine?: number
+	codeNumbered?: boolean
+
+	// Lexer state between lines of a code block
+	codeState?: CodeState
+
+	// Bitmask of markup types disabled for this post, currently open inline
+	// markup tags, outermost first, and if the line is a heading
+	disabledMarkup?: number
+	markup?: number[]
+	heading?: boolean
 }
 
 // Types of hash command entries
@@ -70,6 +124,7 @@ export interface ImageData {
 	audio: boolean
 	video: boolean
 	spoiler: boolean
+	spoilerCategory?: spoilerCategories
 	fileType: fileTypes
 	thumbType: fileTypes
 	length?: number
@@ -78,9 +133,15 @@ export interface ImageData {
 	size: number
 	// [width, height, thumbnail_width, thumbnail_height]
 	dims: [number, number, number, number]
+	// Dimensions of the double resolution and catalog thumbnails. Zero, if
+	// the image has none.
+	dims2x?: [number, number]
+	catalogDims?: [number, number]
 	MD5: string
 	SHA1: string
 	name: string
+	contents?: ArchiveContents
+	transcoded?: boolean // Has a browser-safe transcoded rendition
 
 	// Added client-side
 	large: boolean              // Render larger thumbnails
@@ -89,8 +150,23 @@ export interface ImageData {
 	revealed: boolean           // Revealing a hidden image with [Show]
 }
 
+// Listing of files inside an uploaded archive
+export interface ArchiveContents {
+	truncated?: boolean
+	files: { name: string, size: number }[]
+}
+
+// Prepended to the names of board-specific custom flags in PostData.flag to
+// differentiate them from country codes
+export const customFlagPrefix = "custom:"
+
+// Spoiler categories of images
+export const enum spoilerCategories {
+	none, spoiler, nsfw, gore,
+}
+
 // Possible file types of a post image
 export enum fileTypes {
 	jpg, png, gif, webm, pdf, svg, mp4, mp3, ogg, zip, "7z", "tar.gz", "tar.xz",
-	flac, noFile, txt
+	flac, noFile, txt, webp, avif, opus, m4a
 }
@@ -15,6 +15,7 @@ export const enum message {
 	deletePost,
 	banned,
 	deleteImage,
+	lockThread,
 
 	// >= 30 are miscellaneous and do not write to post models
 	synchronise = 30,
@@ -44,6 +45,9 @@ export const enum message {
 
 	// Notification about needing a captcha on the next post allocation
 	captcha,
+
+	// Progress of an asynchronous thumbnailing job of an uploaded file
+	uploadProgress,
 }
 
 export type MessageHandler = (msg: {}) => void
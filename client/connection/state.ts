@@ -4,9 +4,17 @@ import { message, handlers } from "./messages"
 import { renderStatus } from "./ui"
 import { synchronise } from "./synchronization"
 
+// Random ID of this tab's connection. Passed with uploads, so the server sends
+// thumbnailing progress reports only to this tab.
+export const clientID = (() => {
+	const b = new Uint8Array(16)
+	crypto.getRandomValues(b)
+	return Array.from(b, n => (n < 16 ? "0" : "") + n.toString(16)).join("")
+})()
+
 const path =
 	(location.protocol === 'https:' ? 'wss' : 'ws')
-	+ `://${location.host}/api/socket`
+	+ `://${location.host}/api/socket?id=${clientID}`
 
 let socket: WebSocket,
 	attempts: number,
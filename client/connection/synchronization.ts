@@ -22,6 +22,8 @@ type SyncData = {
 type OpenPost = {
 	hasImage?: boolean
 	spoilered?: boolean
+	spoilerCategory?: number
+	extraImages?: number
 	body: string
 }
 
@@ -53,7 +55,7 @@ export function synchronise() {
 // dispatcher
 async function syncOpenPost(
 	id: number,
-	{ hasImage, body, spoilered }: OpenPost,
+	{ hasImage, body, spoilered, spoilerCategory, extraImages }: OpenPost,
 ) {
 	let model = posts.get(id)
 
@@ -73,8 +75,15 @@ async function syncOpenPost(
 	}
 	if (spoilered && !model.image.spoiler) {
 		model.image.spoiler = true
+		model.image.spoilerCategory = spoilerCategory
 		model.view.renderImage(false)
 	}
+	if (extraImages
+		&& (!model.images || model.images.length < extraImages)
+	) {
+		model.images = (await fetchPost(id)).images
+		model.view.renderGallery()
+	}
 	if (body) {
 		model.body = body
 	}
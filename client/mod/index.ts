@@ -57,6 +57,8 @@ class AccountPanel extends TabbedModal {
 				new FormDataForm("/html/set-banners", "/api/set-banners")),
 			"#setLoading": this.loadConditional(() =>
 				new FormDataForm("/html/set-loading", "/api/set-loading")),
+			"#setSpoilers": this.loadConditional(() =>
+				new FormDataForm("/html/set-spoilers", "/api/set-spoilers")),
 		})
 
 		if (position > ModerationLevel.notStaff) {
@@ -2,6 +2,14 @@ import { View } from "../base"
 import { postJSON, toggleHeadStyle } from "../util"
 import { Post } from "../posts"
 import { getModel } from "../state"
+import { spoilerCategories } from "../common"
+
+// Spoiler categories applied by the image spoilering actions
+const spoilerActions: { [action: string]: spoilerCategories } = {
+	spoilerImage: spoilerCategories.spoiler,
+	nsfwImage: spoilerCategories.nsfw,
+	goreImage: spoilerCategories.gore,
+}
 
 let panel: ModPanel,
 	displayCheckboxes = localStorage.getItem("hideModCheckboxes") !== "true",
@@ -18,6 +26,7 @@ export default class ModPanel extends View<null> {
 		super({ el: document.getElementById("moderation-panel") })
 		panel = this
 		new BanForm()
+		new BlockImageForm()
 		new NotificationForm()
 
 		this.el.querySelector("form").addEventListener("submit", e =>
@@ -68,8 +77,13 @@ export default class ModPanel extends View<null> {
 				}
 				break
 			case "spoilerImage":
+			case "nsfwImage":
+			case "goreImage":
 				if (checked.length) {
-					await this.postJSON("/api/spoiler-image", mapToIDs(models))
+					await this.postJSON("/api/spoiler-image", {
+						ids: mapToIDs(models),
+						category: spoilerActions[this.getMode()],
+					})
 				}
 				break
 			case "deleteImage":
@@ -80,6 +94,21 @@ export default class ModPanel extends View<null> {
 					)
 				}
 				break
+			case "blockImage":
+				if (checked.length) {
+					const args = HidableForm.forms["blockImage"].vals()
+					args["ids"] = mapToIDs(models.filter(m => !!m.image))
+					await this.postJSON("/api/block-image", args)
+				}
+				break
+			case "banFile":
+				if (checked.length) {
+					await this.postJSON(
+						"/api/ban-file",
+						mapToIDs(models.filter(m => !!m.image)),
+					)
+				}
+				break
 			case "ban":
 				if (checked.length) {
 					const args = HidableForm.forms["ban"].vals()
@@ -208,6 +237,19 @@ class BanForm extends HidableForm {
 	}
 }
 
+// Options for adding images to the blocklist. Only rendered for the admin
+// account.
+class BlockImageForm extends HidableForm {
+	constructor() {
+		super("blockImage")
+	}
+
+	public vals(): { [key: string]: any } {
+		const g = this.inputElement("global")
+		return g ? { global: g.checked } : {}
+	}
+}
+
 // Form for sending notifications to all connected clients
 class NotificationForm extends HidableForm {
 	constructor() {
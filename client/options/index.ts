@@ -20,6 +20,9 @@ interface Options extends ChangeEmitter {
 	webmHover: boolean
 	autogif: boolean
 	spoilers: boolean
+	nsfwSpoilers: boolean
+	goreSpoilers: boolean
+	blurSpoilers: boolean
 	notification: boolean
 	anonymise: boolean
 	postInlineExpand: boolean
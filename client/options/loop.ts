@@ -14,6 +14,9 @@ export default () => {
 		workModeToggle: renderImages,
 		hideThumbs: renderImages,
 		spoilers: toggleSpoilers,
+		nsfwSpoilers: toggleSpoilers,
+		goreSpoilers: toggleSpoilers,
+		blurSpoilers: toggleSpoilers,
 		autogif: toggleAutoGIF,
 		anonymise: toggleAnonymisation,
 		relativeTime: renderTime,
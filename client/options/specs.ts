@@ -60,6 +60,16 @@ export const specs: { [id: string]: OptionSpec } = {
 	spoilers: {
 		default: true,
 	},
+	// Enable thumbnail spoilers of NSFW images
+	nsfwSpoilers: {
+		default: true,
+	},
+	// Enable thumbnail spoilers of gore images
+	goreSpoilers: {
+		default: true,
+	},
+	// Blur spoilered thumbnails instead of replacing them
+	blurSpoilers: {},
 	// Desktop Notifications
 	notification: {
 		default: true,
@@ -2,33 +2,17 @@ import { on, fetchBoard } from '../util'
 import lang from '../lang'
 import { page, posts, loadFromDB, displayLoading } from '../state'
 import options from '../options'
-import { relativeTime, Post, findSyncwatches } from "../posts"
+import { relativeTime, findSyncwatches } from "../posts"
 import {
 	extractConfigs, extractPost, reparseOpenPosts, extractPageData, hidePosts,
 } from "./common"
 import { ThreadData } from "../common"
 
-type SortFunction = (a: Post, b: Post) => number
-
-// Thread sort functions
-const sorts: { [name: string]: SortFunction } = {
-	bump: subtract("bumpTime"),
-	lastReply: subtract("replyTime"),
-	creation: subtract("time"),
-	replyCount: subtract("postCtr"),
-	fileCount: subtract("imageCtr"),
-}
 const threads = document.getElementById("threads")
 
 // Unix time of last board page render. Used for automatic refreshes.
 let lastFetchTime = Date.now() / 1000
 
-// Sort threads by embedded data
-function subtract(attr: string): (a: Post, b: Post) => number {
-	return (a, b) =>
-		b[attr] - a[attr]
-}
-
 // Render a fresh board page
 export function renderFresh(html: string) {
 	lastFetchTime = Math.floor(Date.now() / 1000)
@@ -94,49 +78,41 @@ export async function render() {
 	if (!page.catalog) {
 		findSyncwatches(threads)
 	} else {
-		(threads.querySelector("select[name=sortMode]") as HTMLSelectElement)
-			.value = localStorage.getItem("catalogSort") || "bump"
-		sortThreads(true)
+		hideCatalogThumbs()
+
+		// Catalog pages are sorted on the server. Apply the persisted sort
+		// mode, if the page was requested without one.
+		const sort = new URLSearchParams(location.search).get("sort"),
+			stored = localStorage.getItem("catalogSort") || "bump",
+			sel = threads
+				.querySelector("select[name=sortMode]") as HTMLSelectElement
+		sel.value = sort || stored
+		if (!sort && stored !== "bump") {
+			setSortMode(stored)
+			await refreshBoard()
+			return
+		}
 	}
 	displayLoading(false)
 }
 
-// Sort all threads on a board
-export function sortThreads(initial: boolean) {
-	// Index pages are paginated, so it does not make a lot of sense to sort
-	// them
-	if (!page.catalog) {
+// Hide catalog thumbnails, if disabled in the options
+function hideCatalogThumbs() {
+	if (!options.hideThumbs && !options.workModeToggle) {
 		return
 	}
-
-	const [cont, threads] = getThreads()
-
-	// Index board pages use the same localization functions as threads
-	if (page.catalog && (options.hideThumbs || options.workModeToggle)) {
-		for (let el of cont.querySelectorAll("img.catalog")) {
-			el.style.display = "none"
-		}
-	}
-
-	const sortMode = localStorage.getItem("catalogSort") || "bump"
-	// Already sorted as needed
-	if (initial && sortMode === "bump") {
-		return
+	const [cont] = getThreads()
+	for (let el of cont.querySelectorAll("img.catalog")) {
+		el.style.display = "none"
 	}
+}
 
-	// Sort threads by model properties
-	const els: { [id: number]: HTMLElement } = {}
-	cont.append(...threads
-		.map(el => {
-			const id = el.getAttribute("data-id")
-			els[id] = el
-			el.remove()
-			return posts.get(parseInt(id))
-		})
-		.sort(sorts[sortMode])
-		.map(({ id }) =>
-			els[id])
-	)
+// Set the thread sort mode of the page URL and return to the first page, as
+// the order of all pages changes
+function setSortMode(sort: string) {
+	page.page = 0
+	const query = `?sort=${encodeURIComponent(sort)}`
+	history.replaceState(history.state, "", query)
 }
 
 // Retrieves the thread container and the threads within depending on page type
@@ -166,10 +142,13 @@ function renderRefreshButton(el: Element) {
 	el.textContent = text
 }
 
-// Persist thread sort order mode to localStorage and rerender threads
+// Persist thread sort order mode to localStorage and fetch the catalog sorted
+// by it
 function onSortChange(e: Event) {
-	localStorage.setItem("catalogSort", (e.target as HTMLInputElement).value)
-	sortThreads(false)
+	const sort = (e.target as HTMLInputElement).value
+	localStorage.setItem("catalogSort", sort)
+	setSortMode(sort)
+	refreshBoard()
 }
 
 function onSearchChange(e: Event) {
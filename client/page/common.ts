@@ -1,7 +1,7 @@
 import { setBoardConfig, hidden, mine, posts, page } from "../state"
 import options from "../options"
 import { PostData, fileTypes } from "../common"
-import { Post, PostView, hideRecursively } from "../posts"
+import { Post, PostView, hideRecursively, isSpoilered } from "../posts"
 import lang from "../lang"
 import { postAdded, notifyAboutReply } from "../ui"
 import { extractJSON } from "../util"
@@ -61,7 +61,8 @@ export function extractPost(
 	if (image) {
 		if (options.hideThumbs
 			|| options.workModeToggle
-			|| (image.spoiler && !options.spoilers)
+			|| (image.spoiler
+				&& (!isSpoilered(image) || options.blurSpoilers))
 			|| (image.fileType === fileTypes.gif && options.autogif)
 		) {
 			view.renderImage(false)
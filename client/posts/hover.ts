@@ -199,6 +199,8 @@ function renderImagePreview(event: MouseEvent) {
 		case fileTypes.pdf: // Nothing to preview for these
 		case fileTypes.mp3:
 		case fileTypes.flac:
+		case fileTypes.opus:
+		case fileTypes.m4a:
 		case fileTypes.zip:
 		case fileTypes["7z"]:
 		case fileTypes["tar.gz"]:
@@ -1,5 +1,5 @@
 import { Post } from "./model"
-import { fileTypes } from "../common"
+import { fileTypes, ImageData, spoilerCategories } from "../common"
 import { View } from "../base"
 import {
 	setAttrs, on, trigger, firstChild, importTemplate, escape, pad
@@ -11,6 +11,20 @@ import lang from "../lang"
 // Expand all image thumbnails automatically
 export let expandAll = false
 
+// Factor, by which reply thumbnails are rendered smaller than OP thumbnails
+const replyThumbScale = 0.8333
+
+// Returns the bounding box of rendered thumbnails. large is set for thread OPs.
+// Mirrors templates/article.go thumbBounds.
+function thumbBounds(large: boolean): [number, number] {
+	let { thumbWidth: w, thumbHeight: h } = config
+	if (!large) {
+		w = Math.round(w * replyThumbScale)
+		h = Math.round(h * replyThumbScale)
+	}
+	return [w, h]
+}
+
 // Mixin for image expansion and related functionality
 export default class ImageHandler extends View<Post> {
 	// Render the figure and figcaption of a post. Set reveal to true, if in
@@ -46,12 +60,53 @@ export default class ImageHandler extends View<Post> {
 			ch.tagName === "FIGCAPTION")
 	}
 
+	// Render any additional images past the first one as a gallery of
+	// thumbnails linking to their source files
+	public renderGallery() {
+		const container = this.el.querySelector(".post-container"),
+			{ images } = this.model
+		let el = this.getGallery()
+		if (!images || !images.length) {
+			if (el) {
+				el.remove()
+			}
+			return
+		}
+		if (!el) {
+			el = document.createElement("div")
+			el.classList.add("gallery")
+			const fig = this.getFigure()
+			if (fig) {
+				fig.after(el)
+			} else {
+				container.prepend(el)
+			}
+		}
+
+		const hide = options.hideThumbs || options.workModeToggle
+		let html = ""
+		for (let img of images) {
+			html += renderGalleryItem(img, this.model.board, hide)
+		}
+		el.innerHTML = html
+	}
+
+	// Need to find direct descendant, otherwise inlined posts might match
+	private getGallery(): HTMLElement {
+		return firstChild(this.el.querySelector(".post-container"), ch =>
+			ch.classList.contains("gallery"))
+	}
+
 	public removeImage() {
 		this.el.classList.remove("media")
 		let el = this.getFigure()
 		if (el) {
 			el.remove()
 		}
+		el = this.getGallery()
+		if (el) {
+			el.remove()
+		}
 		el = this.getFigcaption()
 		if (el) {
 			el.remove()
@@ -72,32 +127,37 @@ export default class ImageHandler extends View<Post> {
 	// Render the actual thumbnail image
 	private renderThumbnail() {
 		const el = this.el.querySelector("figure a"),
-			{ SHA1, fileType, thumbType, dims, large, spoiler, apng } = this
+			{ SHA1, fileType, thumbType, dims, large, apng } = this
 				.model
 				.image,
-			src = sourcePath(SHA1, fileType)
+			src = sourcePath(SHA1, fileType),
+			spoilered = isSpoilered(this.model.image)
 		let thumb: string,
-			[, , thumbWidth, thumbHeight] = dims
+			[, , thumbWidth, thumbHeight] = dims,
+			cls = "", // Remove any existing classes
+			srcset = ""
 
 		if (thumbType === fileTypes.noFile) {
 			// No thumbnail exists
+			[thumbWidth, thumbHeight] = thumbBounds(false)
 			let file: string
 			switch (fileType) {
 				case fileTypes.mp4:
 				case fileTypes.mp3:
 				case fileTypes.ogg:
 				case fileTypes.flac:
+				case fileTypes.opus:
+				case fileTypes.m4a:
 					file = "audio"
 					break
 				default:
 					file = "file"
 			}
 			thumb = `/assets/${file}.png`
-			thumbHeight = thumbWidth = 150
-		} else if (spoiler && options.spoilers) {
+		} else if (spoilered && !options.blurSpoilers) {
 			// Spoilered and spoilers enabled
-			thumb = '/assets/spoil/default.jpg'
-			thumbHeight = thumbWidth = 150
+			[thumbWidth, thumbHeight] = thumbBounds(large)
+			thumb = spoilerPath(this.model.board, this.model.image)
 		} else if (options.autogif
 			&& (
 				fileType === fileTypes.gif
@@ -108,20 +168,30 @@ export default class ImageHandler extends View<Post> {
 			thumb = src
 		} else {
 			thumb = thumbPath(SHA1, thumbType)
+			srcset = thumbSrcset(this.model.image)
+		}
+		if (spoilered && options.blurSpoilers) {
+			cls = "spoiler-blur"
 		}
 
 		// Downscale thumbnail for higher DPI, unless specified not to
-		if (!large && (thumbWidth > 125 || thumbHeight > 125)) {
-			thumbWidth *= 0.8333
-			thumbHeight *= 0.8333
+		if (!large) {
+			const [w, h] = thumbBounds(false)
+			if (thumbWidth > w || thumbHeight > h) {
+				thumbWidth *= replyThumbScale
+				thumbHeight *= replyThumbScale
+			}
 		}
 
-		el.setAttribute("href", src)
+		el.setAttribute("href", fileType === fileTypes.txt
+			? textViewerPath(SHA1, this.model.image.name)
+			: src)
 		setAttrs(el.firstElementChild, {
 			src: thumb,
+			srcset,
 			width: thumbWidth.toString(),
 			height: thumbHeight.toString(),
-			class: "", // Remove any existing classes
+			class: cls,
 		})
 	}
 
@@ -171,18 +241,7 @@ export default class ImageHandler extends View<Post> {
 					el.hidden = !data.apng
 					break
 				case "filesize":
-					const { size } = data
-					let s: string
-					if (size < (1 << 10)) {
-						s = size + ' B'
-					} else if (size < (1 << 20)) {
-						s = Math.round(size / (1 << 10)) + ' KB'
-					} else {
-						const text = Math.round(size / (1 << 20) * 10)
-							.toString()
-						s = `${text.slice(0, -1)}.${text.slice(-1)} MB`
-					}
-					el.textContent = s
+					el.textContent = readableFileSize(data.size)
 					break
 				case "dims":
 					const [w, h] = data.dims
@@ -198,17 +257,46 @@ export default class ImageHandler extends View<Post> {
 		// Render a name + download link of an image
 		const ext = fileTypes[data.fileType],
 			name = `${escape(data.name)}.${ext}`
-		setAttrs(el.lastElementChild, {
+		setAttrs(link, {
 			href: `/assets/images/src/${data.SHA1}.${ext}`,
 			download: name,
 		})
 		link.innerHTML = name
 
 		this.renderImageSearch(el)
+		this.renderArchiveContents(el)
 
 		el.hidden = false
 	}
 
+	// Render the file listing of an archive
+	private renderArchiveContents(figcaption: Element) {
+		const old = figcaption.querySelector(".archive-contents")
+		if (old) {
+			old.remove()
+		}
+		const { contents } = this.model.image
+		if (!contents) {
+			return
+		}
+
+		const { files, truncated } = contents,
+			plural = files.length !== 1 || truncated,
+			word = lang.plurals["file"][plural ? 1 : 0]
+		let html = `<summary>${files.length}${truncated ? "+" : ""} ${word}`
+			+ `</summary><ul>`
+		for (let { name, size } of files) {
+			html += `<li>${escape(name)} <span class="filesize">`
+				+ `${readableFileSize(size)}</span></li>`
+		}
+		html += "</ul>"
+
+		const el = document.createElement("details")
+		el.classList.add("archive-contents")
+		el.innerHTML = html
+		figcaption.append(el)
+	}
+
 	// Assign URLs to image search links
 	private renderImageSearch(figcaption: Element) {
 		const { fileType, thumbType, SHA1, MD5, size } = this.model.image,
@@ -303,11 +391,15 @@ export default class ImageHandler extends View<Post> {
 			case fileTypes["7z"]:
 			case fileTypes["tar.gz"]:
 			case fileTypes["tar.xz"]:
-			case fileTypes.txt:
 				event.preventDefault()
 				return this.el.querySelector("figcaption a[download]").click()
+			// Open the text viewer
+			case fileTypes.txt:
+				return
 			case fileTypes.mp3:
 			case fileTypes.flac:
+			case fileTypes.opus:
+			case fileTypes.m4a:
 				event.preventDefault()
 				return this.renderAudio()
 			case fileTypes.mp4:
@@ -339,6 +431,8 @@ export default class ImageHandler extends View<Post> {
 			case fileTypes.ogg:
 			case fileTypes.mp3:
 			case fileTypes.flac:
+			case fileTypes.opus:
+			case fileTypes.m4a:
 			case fileTypes.mp4:
 			case fileTypes.webm:
 				// Firefox provides no way of detecting, if the controls where
@@ -412,7 +506,7 @@ export default class ImageHandler extends View<Post> {
 			case fileTypes.webm:
 				const video = document.createElement("video")
 				setAttrs(video, {
-					src,
+					src: img.transcoded ? transcodedPath(img) : src,
 					class: cls,
 					autoplay: "",
 					controls: "",
@@ -446,6 +540,77 @@ export default class ImageHandler extends View<Post> {
 	}
 }
 
+// Render the caption and thumbnail of an additional image in a post's gallery
+function renderGalleryItem(
+	img: ImageData,
+	board: string,
+	hideThumb: boolean,
+): string {
+	const { SHA1, fileType, thumbType } = img,
+		src = sourcePath(SHA1, fileType),
+		name = `${escape(img.name)}.${fileTypes[fileType]}`,
+		spoilered = isSpoilered(img)
+	let thumb: string,
+		cls = "",
+		srcset = "",
+		[, , w, h] = img.dims
+
+	if (thumbType === fileTypes.noFile) {
+		[w, h] = thumbBounds(false)
+		thumb = "/assets/file.png"
+	} else if (spoilered && !options.blurSpoilers) {
+		[w, h] = thumbBounds(false)
+		thumb = spoilerPath(board, img)
+	} else {
+		thumb = thumbPath(SHA1, thumbType)
+		const set = thumbSrcset(img)
+		if (set) {
+			srcset = ` srcset="${set}"`
+		}
+		const [bw, bh] = thumbBounds(false)
+		if (w > bw || h > bh) {
+			w *= replyThumbScale
+			h *= replyThumbScale
+		}
+		if (spoilered) {
+			cls = ` class="spoiler-blur"`
+		}
+	}
+
+	return `<div class="gallery-item">`
+		+ `<figcaption class="spaced">`
+		+ `<a href="${src}" download="${name}">${name}</a>`
+		+ `</figcaption>`
+		+ `<figure${hideThumb ? " hidden" : ""}>`
+		+ `<a target="_blank" href="${src}">`
+		+ `<img src="${thumb}"${srcset} width="${w}" height="${h}"${cls}>`
+		+ `</a>`
+		+ `</figure>`
+		+ `</div>`
+}
+
+// Returns, if the thumbnail of an image should be hidden according to its
+// spoiler category and the user's preferences
+export function isSpoilered(img: ImageData): boolean {
+	if (!img.spoiler) {
+		return false
+	}
+	switch (img.spoilerCategory) {
+		case spoilerCategories.nsfw:
+			return options.nsfwSpoilers
+		case spoilerCategories.gore:
+			return options.goreSpoilers
+		default:
+			return options.spoilers
+	}
+}
+
+// Get the path to the board's spoiler image for the image's spoiler category
+export function spoilerPath(board: string, img: ImageData): string {
+	const category = img.spoilerCategory || spoilerCategories.spoiler
+	return `/assets/spoilers/${board}/${category}`
+}
+
 function imageRoot(): string {
 	return config.imageRootOverride || "/assets/images"
 }
@@ -456,11 +621,32 @@ export function thumbPath(SHA1: string, thumbType: fileTypes): string {
 	return `${imageRoot()}/thumb/${SHA1}.${fileTypes[thumbType]}`
 }
 
+// Get the srcset attribute value for the double resolution thumbnail of an
+// image or an empty string, if it has none
+export function thumbSrcset({ SHA1, thumbType, dims2x }: ImageData): string {
+	if (!dims2x || !dims2x[0]) {
+		return ""
+	}
+	return `${imageRoot()}/thumb2x/${SHA1}.${fileTypes[thumbType]} 2x`
+}
+
+// Resolve the path to the browser-safe transcoded rendition of a video. MP4
+// files are transcoded to MP4 and all other video to WebM.
+function transcodedPath({ SHA1, fileType }: ImageData): string {
+	const ext = fileType === fileTypes.mp4 ? "mp4" : "webm"
+	return `${imageRoot()}/transcoded/${SHA1}.${ext}`
+}
+
 // Resolve the path to the source file of an upload
 export function sourcePath(SHA1: string, fileType: fileTypes): string {
 	return `${imageRoot()}/src/${SHA1}.${fileTypes[fileType]}`
 }
 
+// Path to the syntax highlighted viewer of a text file
+function textViewerPath(SHA1: string, name: string): string {
+	return `/assets/text/${SHA1}?name=${encodeURIComponent(name + ".txt")}`
+}
+
 // Delegate image clicks to views. More performant than dedicated listeners for
 // each view.
 function handleImageClick(event: MouseEvent) {
@@ -468,6 +654,7 @@ function handleImageClick(event: MouseEvent) {
 	if (options.inlineFit === "none"
 		|| event.which !== 1
 		|| el.classList.contains("catalog")
+		|| el.closest(".gallery") // Gallery images open in a new tab
 	) {
 		return
 	}
@@ -526,6 +713,8 @@ function shouldAutoExpand(model: Post): boolean {
 		case fileTypes.jpg:
 		case fileTypes.png:
 		case fileTypes.gif:
+		case fileTypes.webp:
+		case fileTypes.avif:
 			return true
 		default:
 			return false
@@ -543,3 +732,15 @@ on(document, "click", toggleExpandAll, {
 	passive: true,
 	selector: "#expand-images a",
 })
+
+// Formats a human-readable representation of file size
+function readableFileSize(size: number): string {
+	if (size < (1 << 10)) {
+		return size + ' B'
+	}
+	if (size < (1 << 20)) {
+		return Math.round(size / (1 << 10)) + ' KB'
+	}
+	const text = Math.round(size / (1 << 20) * 10).toString()
+	return `${text.slice(0, -1)}.${text.slice(-1)} MB`
+}
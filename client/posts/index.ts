@@ -1,7 +1,10 @@
 export { Post } from "./model"
 export { default as PostView } from "./view"
 export { postEvent, postSM, postState, FormModel, identity } from "./posting"
-export { default as ImageHandler, toggleExpandAll, thumbPath } from "./images"
+export {
+	default as ImageHandler, toggleExpandAll, thumbPath, isSpoilered,
+	spoilerPath,
+} from "./images"
 export { clearHidden, hideRecursively } from "./hide"
 export { toggleGallery } from "./filter"
 export * from "./render"
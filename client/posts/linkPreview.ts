@@ -0,0 +1,118 @@
+// Previews of external URLs, generated and stored by the server
+
+import { config } from "../state"
+import { escape, makeAttrs, fetchJSON } from "../util"
+
+type LinkPreview = {
+	thumbnail: boolean
+	id: string
+	title: string
+	description: string
+}
+
+// Previews are fetched by the server in the background. Retry this many
+// times, before giving up on a URL.
+const maxRetries = 3,
+	retryDelay = 5000
+
+// Fetched previews by URL. null, if no preview is available.
+const previews = new Map<string, LinkPreview | null>(),
+	pending = new Set<string>()
+
+// Returns, if url is an HTTP(S) URL on one of the domains previews are enabled
+// for, or their subdomains
+function isAllowed(url: string): boolean {
+	const domains = config.previewDomains
+	if (!domains || !domains.length) {
+		return false
+	}
+
+	let host: string
+	try {
+		const u = new URL(url)
+		if (u.protocol !== "http:" && u.protocol !== "https:") {
+			return false
+		}
+		host = u.hostname.toLowerCase()
+	} catch (e) {
+		return false
+	}
+	for (let d of domains) {
+		d = d.toLowerCase()
+		if (host === d || host.endsWith("." + d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render a preview of an external URL. If not fetched yet, renders a
+// placeholder, that is replaced once the preview is fetched.
+export default function renderLinkPreview(url: string): string {
+	if (!isAllowed(url)) {
+		return ""
+	}
+	if (previews.has(url)) {
+		const p = previews.get(url)
+		return p ? formatPreview(url, p) : ""
+	}
+
+	fetchPreview(url, 0)
+	const attrs = {
+		class: "link-preview-pending",
+		"data-url": escape(url),
+	}
+	return `<span ${makeAttrs(attrs)}></span>`
+}
+
+// Mirrors templates/body.go linkPreview
+function formatPreview(url: string, p: LinkPreview): string {
+	const attrs = {
+		rel: "noreferrer",
+		class: "link-preview",
+		href: escape(url),
+		target: "_blank",
+	}
+	let html = `<a ${makeAttrs(attrs)}>`
+	if (p.thumbnail) {
+		html += `<img src="/assets/link-previews/${p.id}" loading="lazy">`
+	}
+	html += `<strong>${escape(p.title)}</strong>`
+	if (p.description) {
+		html += `<span>${escape(p.description)}</span>`
+	}
+	return html + "</a>"
+}
+
+// Fetch a preview from the server and replace any rendered placeholders
+async function fetchPreview(url: string, retries: number) {
+	if (pending.has(url) && !retries) {
+		return
+	}
+	pending.add(url)
+
+	const [p, err] = await fetchJSON<LinkPreview>(
+		"/json/link-preview?url=" + encodeURIComponent(url))
+	if (err) {
+		// Possibly still being fetched by the server
+		if (retries < maxRetries) {
+			setTimeout(() => fetchPreview(url, retries + 1), retryDelay)
+			return
+		}
+		previews.set(url, null)
+	} else {
+		previews.set(url, p)
+	}
+	pending.delete(url)
+
+	for (let el of document.querySelectorAll(".link-preview-pending")) {
+		if (el.getAttribute("data-url") !== url) {
+			continue
+		}
+		if (p) {
+			el.outerHTML = formatPreview(url, p)
+		} else {
+			el.remove()
+		}
+	}
+}
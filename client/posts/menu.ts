@@ -64,6 +64,15 @@ const actions: { [key: string]: ItemSpec } = {
 			}
 		},
 	},
+	viewImagePosts: {
+		text: lang.posts["viewImagePosts"],
+		shouldRender(m) {
+			return position >= ModerationLevel.janitor && !!m.image
+		},
+		handler(m) {
+			window.open(`/html/image-posts/${m.image.SHA1}`, "_blank")
+		},
+	},
 	toggleSticky: {
 		text: lang.posts["toggleSticky"],
 		shouldRender(m) {
@@ -5,7 +5,9 @@ import PostView from './view'
 import { SpliceResponse } from '../client'
 import { mine, seenPosts, storeSeenPost, posts, hidden } from "../state"
 import { notifyAboutReply } from "../ui"
-import { PostData, TextState, PostLink, Command, ImageData } from "../common"
+import {
+	PostData, TextState, PostLink, Command, ImageData, spoilerCategories,
+} from "../common"
 import { hideRecursively } from "./hide"
 
 // Generic post model
@@ -23,6 +25,7 @@ export class Post extends Model implements PostData {
 	public seenOnce: boolean
 	public hidden: boolean
 	public image: ImageData
+	public images: ImageData[]
 	public time: number
 	public body: string
 	public name: string
@@ -175,9 +178,19 @@ export class Post extends Model implements PostData {
 		this.view.autoExpandImage()
 	}
 
+	// Insert an additional image into a post, that already has one
+	public insertExtraImage(img: ImageData) {
+		if (!this.images) {
+			this.images = []
+		}
+		this.images.push(img)
+		this.view.renderGallery()
+	}
+
 	// Spoiler an already allocated imageThreadData
-	public spoilerImage() {
+	public spoilerImage(category: spoilerCategories) {
 		this.image.spoiler = true
+		this.image.spoilerCategory = category
 		this.view.renderImage(false)
 	}
 
@@ -204,6 +217,7 @@ export class Post extends Model implements PostData {
 
 	public removeImage() {
 		this.image = null
+		this.images = null
 		this.view.removeImage()
 	}
 
@@ -9,6 +9,7 @@ import identity, { initIdentity } from "./identity"
 import { boardConfig, page } from "../../state"
 import initDrop from "./drop"
 import initThreads from "./threads"
+import { receiveJobProgress } from "./upload"
 import options from "../../options"
 
 export { default as FormModel } from "./model"
@@ -193,6 +194,9 @@ export default () => {
 	handlers[message.captcha] = () =>
 		needCaptcha = true
 
+	// Progress of this client's asynchronous thumbnailing jobs
+	handlers[message.uploadProgress] = receiveJobProgress
+
 	// Initial synchronization
 	postSM.act(postState.none, postEvent.sync, () =>
 		postState.ready)
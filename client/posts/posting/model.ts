@@ -1,8 +1,10 @@
 import { message, send, handlers } from "../../connection"
 import { Post } from "../model"
-import { ImageData, PostData } from "../../common"
+import { ImageData, PostData, spoilerCategories } from "../../common"
 import FormView from "./view"
-import { posts, storeMine, page, storeSeenPost } from "../../state"
+import {
+	posts, storeMine, page, storeSeenPost, boardConfig
+} from "../../state"
 import { postSM, postEvent, postState } from "."
 import { extend } from "../../util"
 import { SpliceResponse } from "../../client"
@@ -234,7 +236,7 @@ export default class FormModel extends Post {
 
 		this.sentAllocRequest = true
 
-		const req = newAllocRequest()
+		const req = this.newAllocRequest()
 		if (this.bufferedFile) {
 			req["image"] = await this.view.upload.uploadFile(this.bufferedFile)
 		}
@@ -246,6 +248,17 @@ export default class FormModel extends Post {
 		handlers[message.postID] = this.receiveID(false)
 	}
 
+	// Generate a new post allocation request with the selected custom board
+	// flag, if any
+	private newAllocRequest(): { [key: string]: any } {
+		const req = newAllocRequest(),
+			flag = this.view.selectedFlag()
+		if (flag) {
+			req["flag"] = flag
+		}
+		return req
+	}
+
 	// Returns a function, that handles a message from the server, containing
 	// the ID of the allocated post.
 	// alloc specifies, if an alloc event should be fired on the state machine.
@@ -266,7 +279,7 @@ export default class FormModel extends Post {
 
 	// Request allocation of a draft post to the server
 	private requestAlloc(body: string | null, image: FileData | null) {
-		const req = newAllocRequest()
+		const req = this.newAllocRequest()
 
 		this.view.setEditing(true)
 		this.nonLive = false
@@ -321,15 +334,15 @@ export default class FormModel extends Post {
 			return
 		}
 
-		// Already have image or not in live mode
-		if (this.image) {
+		// Already have the maximum number of files
+		if (!this.canUpload()) {
 			return
 		}
 
 		const data = await this.view.upload.uploadFile(file)
-		// Upload failed, canceled, image added while thumbnailing or post
-		// closed
-		if (!data || this.image || !this.editing) {
+		// Upload failed, canceled, last allowed image added while thumbnailing
+		// or post closed
+		if (!data || !this.canUpload() || !this.editing) {
 			return
 		}
 
@@ -346,9 +359,24 @@ export default class FormModel extends Post {
 		this.view.insertImage()
 	}
 
-	// Spoiler an already allocated image
-	public commitSpoiler() {
-		this.send(message.spoiler, null)
+	// Insert an additional uploaded image into the model
+	public insertExtraImage(img: ImageData) {
+		super.insertExtraImage(img)
+		this.view.onExtraImage()
+	}
+
+	// Returns, if another file can still be attached to the post
+	public canUpload(): boolean {
+		if (!this.image) {
+			return true
+		}
+		const max = boardConfig.maxFiles || 1
+		return 1 + (this.images ? this.images.length : 0) < max
+	}
+
+	// Spoiler an already allocated image with the specified category
+	public commitSpoiler(category: spoilerCategories) {
+		this.send(message.spoiler, category)
 	}
 }
 
@@ -1,8 +1,10 @@
 import lang from '../../lang'
 import { load, postText } from '../../util'
 import { Post } from "../model"
+import { spoilerCategories } from "../../common"
 import { View } from "../../base"
-import { config } from "../../state"
+import { config, boardConfig, page } from "../../state"
+import { clientID } from "../../connection"
 
 // Precompute 00 - ff strings for conversion to hexadecimal strings
 const precomputedHex = new Array(256)
@@ -15,7 +17,7 @@ for (let i = 0; i < 256; i++) {
 export type FileData = {
     token: string
     name: string
-    spoiler?: boolean
+    spoilerCategory?: spoilerCategories
 }
 
 interface LoadProgress {
@@ -23,6 +25,45 @@ interface LoadProgress {
     loaded: number
 }
 
+// Files larger than this are uploaded in resumable chunks of this size
+const chunkSize = 1 << 20
+
+// Number of consecutive failed chunk transfers, after which an upload is
+// aborted
+const maxChunkRetries = 8
+
+// Stages of an asynchronous thumbnailing job on the server
+const enum jobStatus { queued, processing, done, failed }
+
+// Progress report of a thumbnailing job. The token is only set on success.
+type JobProgress = {
+    status: jobStatus
+    position?: number
+    id: string
+    token?: string
+    error?: string
+}
+
+// Handlers for progress reports of this tab's thumbnailing jobs by job ID
+const jobHandlers: { [id: string]: (p: JobProgress) => void } = {}
+
+// Reports received, before the upload request returned the job ID
+let pendingReports: JobProgress[] = []
+
+// Number of uploads still awaiting a server response
+let awaitingJobID = 0
+
+// Receive a thumbnailing job progress report from the server. Reports are
+// only sent to the tab, that passed its client ID with the upload.
+export function receiveJobProgress(p: JobProgress) {
+    const fn = jobHandlers[p.id]
+    if (fn) {
+        fn(p)
+    } else if (awaitingJobID) {
+        pendingReports.push(p)
+    }
+}
+
 // Mixin for handling file uploads
 export default class UploadForm extends View<Post> {
     public spoiler: HTMLElement
@@ -36,7 +77,7 @@ export default class UploadForm extends View<Post> {
         el.hidden = false
         super({ el, model })
         this.spoiler = el
-            .querySelector(`span[data-id="spoiler"]`) as HTMLInputElement
+            .querySelector(`span[data-id="spoiler"]`) as HTMLElement
         this.status = el.querySelector(".upload-status")
         this.input = el.querySelector("input[name=image]") as HTMLInputElement
     }
@@ -49,7 +90,8 @@ export default class UploadForm extends View<Post> {
         if (!navigator.onLine || this.isUploading) {
             return null
         }
-        if (file.size > (config.maxSize << 20)) {
+        const maxSize = boardConfig.maxSize || config.maxSize
+        if (file.size > (maxSize << 20)) {
             this.status.textContent = "file too large"
             return null
         }
@@ -61,7 +103,8 @@ export default class UploadForm extends View<Post> {
             loaded: 0,
         })
 
-        let token: string
+        let token: string,
+            sha1: string
         // Detect, if the crypto API can be used
         if (location.protocol === "https:"
             || location.hostname === "localhost"
@@ -71,11 +114,12 @@ export default class UploadForm extends View<Post> {
             const r = new FileReader()
             r.readAsArrayBuffer(file)
             const { target: { result } } = await load(r) as ArrayBufferLoadEvent,
-                hash = await crypto.subtle.digest("SHA-1", result),
-                [res, err] = await postText(
-                    "/api/upload-hash",
-                    bufferToHex(hash),
-                )
+                hash = await crypto.subtle.digest("SHA-1", result)
+            sha1 = bufferToHex(hash)
+            const [res, err] = await postText(
+                `/api/upload-hash?board=${page.board}`,
+                sha1,
+            )
             if (err) {
                 this.isUploading = false
                 throw err
@@ -86,7 +130,10 @@ export default class UploadForm extends View<Post> {
         }
 
         if (!token) {
-            token = await this.upload(file)
+            // Chunked uploads require the hash to be known in advance
+            token = sha1 && file.size > chunkSize
+                ? await this.uploadChunked(file, sha1)
+                : await this.upload(file)
             if (!token) {
                 this.isUploading = false
                 return null
@@ -97,11 +144,11 @@ export default class UploadForm extends View<Post> {
             token,
             name: file.name,
         }
-        const spoiler = (this.el
-            .querySelector("input[name=spoiler]") as HTMLInputElement)
-            .checked
-        if (spoiler) {
-            img.spoiler = true
+        // Spoiler selection is removed after spoilering the first image
+        const spoiler = this.el
+            .querySelector("select[name=spoiler]") as HTMLSelectElement
+        if (spoiler && spoiler.value !== "0") {
+            img.spoilerCategory = parseInt(spoiler.value)
         }
         this.isUploading = false
         return img
@@ -114,15 +161,29 @@ export default class UploadForm extends View<Post> {
 
         // Not using fetch, because no ProgressEvent support
         this.xhr = new XMLHttpRequest()
-        this.xhr.open("POST", "/api/upload")
+        this.xhr.open(
+            "POST",
+            `/api/upload?board=${page.board}&client=${clientID}`,
+        )
         this.xhr.upload.onprogress = e =>
             this.renderProgress(e)
         this.xhr.send(formData)
-        await load(this.xhr)
+        awaitingJobID++
+        try {
+            await load(this.xhr)
+        } finally {
+            awaitingJobID--
+        }
 
         if (!this.isUploading) { // Cancelled
             return ""
         }
+        if (this.xhr.status === 202) {
+            // File is thumbnailed asynchronously. Wait for the result.
+            const id = this.xhr.responseText
+            this.xhr = null
+            return this.awaitThumbnail(id)
+        }
         if (this.xhr.status !== 200) {
             this.status.textContent = this.xhr.response
             this.cancel()
@@ -135,6 +196,177 @@ export default class UploadForm extends View<Post> {
         return text
     }
 
+    // Upload a file in chunks and return the file allocation token. Transfers
+    // interrupted by network failures are resumed from the last chunk
+    // received by the server.
+    private async uploadChunked(file: File, sha1: string): Promise<string> {
+        const [id, err] = await postText(
+            `/api/chunked-upload?board=${page.board}`,
+            JSON.stringify({ size: file.size, sha1 }),
+        )
+        if (err) {
+            return this.failUpload(err)
+        }
+
+        const url = `/api/chunked-upload/${id}`
+        let offset = 0,
+            failures = 0,
+            resync = false
+        while (true) {
+            if (!this.isUploading) { // Cancelled
+                return ""
+            }
+            try {
+                if (resync) {
+                    const res = await fetch(url),
+                        text = await res.text()
+                    if (res.status !== 200) {
+                        return this.failUpload(text)
+                    }
+                    offset = parseInt(text)
+                    resync = false
+                }
+                if (offset >= file.size) {
+                    break
+                }
+
+                this.renderProgress({
+                    total: file.size,
+                    loaded: offset,
+                })
+                const res = await fetch(`${url}?offset=${offset}`, {
+                    method: "PUT",
+                    body: file.slice(offset, offset + chunkSize),
+                })
+                const text = await res.text()
+                switch (res.status) {
+                    case 200:
+                        offset = parseInt(text)
+                        failures = 0
+                        break
+                    case 409: // Out of sync with the server
+                        resync = true
+                        break
+                    default:
+                        return this.failUpload(text)
+                }
+            } catch (e) {
+                if (++failures > maxChunkRetries) {
+                    return this.failUpload(e.message)
+                }
+                resync = true
+                await new Promise(resolve =>
+                    setTimeout(resolve, Math.min(1000 << failures, 30000)))
+            }
+        }
+
+        this.renderProgress({
+            total: 1,
+            loaded: 1,
+        })
+        awaitingJobID++
+        let res: Response
+        try {
+            res = await fetch(`${url}/finalize?client=${clientID}`, {
+                method: "POST",
+            })
+        } finally {
+            awaitingJobID--
+        }
+        const text = await res.text()
+        if (!this.isUploading) {
+            return ""
+        }
+        switch (res.status) {
+            case 200:
+                this.isUploading = false
+                return text
+            case 202:
+                return this.awaitThumbnail(text)
+            default:
+                return this.failUpload(text)
+        }
+    }
+
+    // Display an upload error and reset the form
+    private failUpload(err: string): string {
+        this.status.textContent = err
+        this.cancel()
+        return ""
+    }
+
+    // Wait for the result of a thumbnailing job and return the file
+    // allocation token. The result is retrieved over HTTP, while progress is
+    // reported through the websocket connection.
+    private async awaitThumbnail(id: string): Promise<string> {
+        const done = this.awaitJobProgress(id)
+        while (this.isUploading) {
+            let res: Response
+            try {
+                res = await fetch(`/api/upload-job/${id}`)
+            } catch (e) {
+                // Result might still arrive through the websocket connection
+                return done
+            }
+            const text = await res.text()
+            switch (res.status) {
+                case 200:
+                    delete jobHandlers[id]
+                    this.isUploading = false
+                    return text
+                case 202: // Still processing
+                    break
+                default:
+                    delete jobHandlers[id]
+                    return this.failUpload(text)
+            }
+        }
+        delete jobHandlers[id]
+        return ""
+    }
+
+    // Render progress reports of a thumbnailing job and return the file
+    // allocation token, if reported
+    private awaitJobProgress(id: string): Promise<string> {
+        return new Promise<string>(resolve => {
+            const handle = (p: JobProgress) => {
+                if (!this.isUploading) { // Cancelled
+                    delete jobHandlers[id]
+                    resolve("")
+                    return
+                }
+                switch (p.status) {
+                    case jobStatus.queued:
+                        this.status.textContent =
+                            `${lang.ui["queued"]} (${p.position})`
+                        break
+                    case jobStatus.processing:
+                        this.status.textContent = lang.ui["thumbnailing"]
+                        break
+                    case jobStatus.done:
+                        delete jobHandlers[id]
+                        this.isUploading = false
+                        resolve(p.token)
+                        break
+                    case jobStatus.failed:
+                        delete jobHandlers[id]
+                        this.status.textContent = p.error
+                        this.cancel()
+                        resolve("")
+                        break
+                }
+            }
+            jobHandlers[id] = handle
+
+            // Replay reports received before the job ID was known
+            const early = pendingReports.filter(p => p.id === id)
+            pendingReports = pendingReports.filter(p => p.id !== id)
+            for (let p of early) {
+                handle(p)
+            }
+        })
+    }
+
     // Cancel any current uploads and reset form
     public cancel() {
         this.isUploading = false
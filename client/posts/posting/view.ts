@@ -10,6 +10,7 @@ import UploadForm from "./upload"
 import identity from "./identity"
 import { CaptchaView } from "../../ui"
 import { message, send } from "../../connection"
+import { spoilerCategories } from "../../common"
 
 // Element at the bottom of the thread to keep the fixed reply form from
 // overlapping any other posts, when scrolled till bottom
@@ -59,6 +60,13 @@ export default class FormView extends PostView {
         }
         this.inputElement("done").hidden = !this.model.nonLive
 
+        // Allow selecting one of the board's custom flags, if any. The options
+        // are copied from the server-rendered reply form.
+        const flags = document.querySelector("#new-reply-form .flag-selection")
+        if (flags) {
+            this.inputElement("done").before(flags.cloneNode(true))
+        }
+
         const bq = this.el.querySelector("blockquote")
         bq.innerHTML = ""
         bq.append(this.input)
@@ -189,6 +197,24 @@ export default class FormView extends PostView {
         this.upload.status.remove()
     }
 
+    // Remove the upload form, if the post can not have any more files
+    // attached, or reset it for the next upload
+    private resetUploadForm() {
+        if (!this.model.canUpload()) {
+            this.removeUploadForm()
+            return
+        }
+        this.upload.input.value = ""
+        this.upload.status.textContent = ""
+        this.upload.cancel()
+    }
+
+    // Handle insertion of an additional image into an open post
+    public onExtraImage() {
+        this.resizeInput()
+        this.resetUploadForm()
+    }
+
     // Handle input events on this.input
     public onInput() {
         if (!this.input) {
@@ -275,34 +301,50 @@ export default class FormView extends PostView {
         this.input.setAttribute("contenteditable", "false")
     }
 
+    // Returns the name of the selected custom board flag, if any
+    public selectedFlag(): string {
+        const el = this.el
+            .querySelector("#post-controls .flag-selection") as HTMLSelectElement
+        return el ? el.value : ""
+    }
+
     // Transition into allocated post
     public renderAlloc() {
         this.id = this.el.id = "p" + this.model.id
         this.el.querySelector("header").classList.remove("temporary")
+
+        // The flag can not be changed after allocation
+        const flags = this.el.querySelector("#post-controls .flag-selection")
+        if (flags) {
+            flags.remove()
+        }
         this.renderHeader()
         this.showDone()
     }
 
-    // Toggle the spoiler input checkbox
+    // Toggle the spoiler category selection. Spoilers the image with the
+    // selected category, if it has already been inserted.
     public toggleSpoiler() {
+        const el = this
+            .upload
+            .spoiler
+            .querySelector("select") as HTMLSelectElement
         if (this.model.image && postSM.state !== postState.halted) {
             this.upload.spoiler.remove()
-            this.model.commitSpoiler()
+            this.model.commitSpoiler(
+                parseInt(el.value) || spoilerCategories.spoiler,
+            )
             return
         }
 
-        const el = this
-            .upload
-            .spoiler
-            .querySelector("input") as HTMLInputElement
-        el.checked = !el.checked
+        el.value = el.value === "0" ? "1" : "0"
     }
 
     // Insert image into an open post
     public insertImage() {
         this.renderImage(false)
         this.resizeInput()
-        this.removeUploadForm()
+        this.resetUploadForm()
 
         const { spoiler } = this.upload
         if (this.model.image.spoiler) {
@@ -1,9 +1,15 @@
-import { config, boards, posts } from '../../state'
+import { config, boards, posts, boardConfig } from '../../state'
 import { renderPostLink, renderTempLink } from './etc'
 import { PostData, PostLink, TextState } from '../../common'
 import { escape, makeAttrs } from '../../util'
 import { parseEmbeds } from "../embed"
-import highlightSyntax from "./code"
+import renderLinkPreview from "../linkPreview"
+import highlightSyntax, { newCodeState } from "./code"
+import { languages } from "./languages"
+import {
+    markup, allMarkupDisabled, disabledMarkup, markupEnabled, formatWord,
+    closeMarkup, reopenMarkup,
+} from "./markup"
 
 // URLs supported for linkification
 const urlPrefixes = {
@@ -14,6 +20,10 @@ const urlPrefixes = {
     'b': "bitcoin",
 }
 
+// Hash commands
+const commandRegexp =
+    /^#(flip|\d*d\d+|8ball|pyu|pcount|sw(?:\d+:)?\d+:\d+(?:[+-]\d+)?)$/
+
 // Render the text body of a post
 export default function renderBody(data: PostData): string {
     const state: TextState = data.state = {
@@ -23,12 +33,28 @@ export default function renderBody(data: PostData): string {
         haveSyncwatch: false,
         newlines: 0,
         iDice: 0,
+        codeLang: null,
+        codeLine: 0,
+        codeNumbered: false,
+        codeState: newCodeState(),
+        disabledMarkup: disabledMarkup(boardConfig.disabledMarkup),
+        markup: [],
+        heading: false,
+    }
+    if (data.time < boardConfig.markupSince) {
+        // Keep posts created before markup was introduced rendering as they
+        // were written
+        state.disabledMarkup = allMarkupDisabled
     }
     let html = ""
 
     const fn = data.editing ? parseOpenLine : parseTerminatedLine
     for (let l of data.body.split("\n")) {
         state.quote = false
+        if (state.codeLang) {
+            state.codeLine++
+            state.codeNumbered = false
+        }
 
         // Prevent successive empty lines
         if (html && state.newlines < 2) {
@@ -43,6 +69,12 @@ export default function renderBody(data: PostData): string {
         if (l[0] === ">") {
             state.quote = true
             html += "<em>"
+        } else if (!state.code && markupEnabled(state, markup.heading)
+            && l.startsWith("# ")
+        ) {
+            html += `<span class="heading">`
+            state.heading = true
+            l = l.slice(2)
         }
         if (state.spoiler) {
             html += "<del>"
@@ -50,12 +82,20 @@ export default function renderBody(data: PostData): string {
 
         html += fn(l, data)
 
+        // Inline markup does not span lines
+        html += closeMarkup(state)
+        state.markup = []
+
         if (state.spoiler) {
             html += "</del>"
         }
         if (state.quote) {
             html += "</em>"
         }
+        if (state.heading) {
+            html += "</span>"
+            state.heading = false
+        }
     }
 
     return html
@@ -68,7 +108,7 @@ function parseTerminatedLine(line: string, data: PostData): string {
         parseFragment(frag, data))
 }
 
-// Detect code tags
+// Detect code tags. Fences with three backticks are accepted as well.
 function parseCode(
     frag: string,
     state: TextState,
@@ -80,7 +120,16 @@ function parseCode(
         if (i !== -1) {
             html += formatCode(frag.slice(0, i), state, fn)
             frag = frag.substring(i + 2)
+            if (frag[0] === "`") {
+                frag = frag.slice(1)
+            }
             state.code = !state.code
+            state.codeState = newCodeState()
+            if (state.code) {
+                frag = parseLanguageHint(frag, state)
+            } else {
+                state.codeLang = null
+            }
         } else {
             html += formatCode(frag, state, fn)
             break
@@ -89,23 +138,45 @@ function parseCode(
     return html
 }
 
+// Detect a language hint, that takes up the rest of the line after an opening
+// code tag, and start a fenced code block. Returns the remaining fragment to
+// parse.
+function parseLanguageHint(frag: string, state: TextState): string {
+    const lang = languages[frag.trim().toLowerCase()]
+    if (!lang) {
+        return frag
+    }
+    state.codeLang = lang
+    state.codeLine = 0
+    return ""
+}
+
 function formatCode(
     frag: string,
     state: TextState,
     fn: (frag: string) => string,
 ): string {
+    if (!state.code) {
+        return parseSpoilers(frag, state, fn)
+    }
+
     let html = ""
-    if (state.code) {
-        // Strip quotes
-        while (frag[0] === '>') {
-            html += "&gt;"
-            frag = frag.slice(1)
+    if (state.codeLang) {
+        if (!frag) {
+            return ""
+        }
+        if (!state.codeNumbered) {
+            html += `<span class="ms-line">${state.codeLine}</span>`
+            state.codeNumbered = true
         }
-        html += highlightSyntax(frag)
-    } else {
-        html += parseSpoilers(frag, state, fn)
     }
-    return html
+
+    // Strip quotes
+    while (frag[0] === '>') {
+        html += "&gt;"
+        frag = frag.slice(1)
+    }
+    return html + highlightSyntax(frag, state.codeLang, state.codeState)
 }
 
 // Injects spoiler tags and calls fn on the remaining parts
@@ -118,7 +189,7 @@ function parseSpoilers(
     while (true) {
         const i = frag.indexOf("**")
         if (i !== -1) {
-            html += fn(frag.slice(0, i))
+            html += fn(frag.slice(0, i)) + closeMarkup(state)
             if (state.quote) {
                 html += "</em>"
             }
@@ -126,6 +197,7 @@ function parseSpoilers(
             if (state.quote) {
                 html += "<em>"
             }
+            html += reopenMarkup(state)
 
             state.spoiler = !state.spoiler
             frag = frag.substring(i + 2)
@@ -139,11 +211,13 @@ function parseSpoilers(
 
 // Parse a line that is still being edited
 function parseOpenLine(line: string, { state }: PostData): string {
-    return parseCode(line, state, parseOpenLinks)
+    return parseCode(line, state, frag =>
+        parseOpenLinks(frag, state))
 }
 
-// Parse temporary links, that still may be edited
-function parseOpenLinks(frag: string): string {
+// Parse temporary links, that still may be edited. Inline markup is rendered
+// the same as in parseFragment().
+function parseOpenLinks(frag: string, state: TextState): string {
     let html = ""
     const words = frag.split(" ")
     for (let i = 0; i < words.length; i++) {
@@ -169,7 +243,9 @@ function parseOpenLinks(frag: string): string {
             }
         }
         if (!matched) {
-            html += escape(word)
+            html += isSpecialWord(word)
+                ? escape(word)
+                : formatWord(word, state)
         }
         if (trailPunct) {
             html += trailPunct
@@ -220,7 +296,7 @@ function parseFragment(frag: string, data: PostData): string {
                 }
                 break
             case "#": // Hash commands
-                m = word.match(/^#(flip|\d*d\d+|8ball|pyu|pcount|sw(?:\d+:)?\d+:\d+(?:[+-]\d+)?)$/)
+                m = word.match(commandRegexp)
                 if (m) {
                     html += parseCommand(m[1], data)
                     matched = true
@@ -245,7 +321,7 @@ function parseFragment(frag: string, data: PostData): string {
                     ? "Privilege"
                     : "privilege"
             }
-            html += escape(word)
+            html += formatWord(word, data.state)
         }
         if (trailPunct) {
             html += trailPunct
@@ -255,6 +331,24 @@ function parseFragment(frag: string, data: PostData): string {
     return html
 }
 
+// Returns, if word is a link, URL or hash command. These are not subject to
+// inline markup.
+function isSpecialWord(word: string): boolean {
+    if (!word) {
+        return false
+    }
+    switch (word[0]) {
+        case ">":
+            return /^>>(>*)(\d+)$/.test(word)
+                || /^>>>(>*)\/(\w+)\/$/.test(word)
+        case "#":
+            return commandRegexp.test(word)
+        default:
+            const pre = urlPrefixes[word[0]]
+            return !!pre && word.startsWith(pre)
+    }
+}
+
 // Verify and render a link to other posts
 function parsePostLink(m: string[], links: PostLink[]): string {
     if (!links) {
@@ -310,7 +404,7 @@ function parseURL(bit: string): string {
             bit = escape(bit)
             return bit.link(bit)
         }
-        return newTabLink(bit, bit)
+        return newTabLink(bit, bit) + renderLinkPreview(bit)
     } catch (e) {
         return escape(bit)
     }
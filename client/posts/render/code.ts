@@ -1,16 +1,25 @@
 import { escape } from "../../util"
-
-const enum type { unmatched, word, quoted, doubleQuoted, comment }
+import { Language, CodeState } from "../../common"
 
 const headers = {
 	operator: "<span class=\"ms-operator\">",
 	function: "<span class=\"ms-function\">",
 	string: "<span class=\"ms-string\">",
 	comment: "<span class=\"ms-comment\">",
+	number: "<span class=\"ms-number\">",
+	type: "<span class=\"ms-type\">",
+	inserted: "<span class=\"ms-inserted\">",
+	deleted: "<span class=\"ms-deleted\">",
+	hunk: "<span class=\"ms-hunk\">",
 }
 
 const close = "</span>"
 
+// Returns a lexer state with no unterminated tokens
+export function newCodeState(): CodeState {
+	return { closer: "", comment: false, multiline: false }
+}
+
 const keywords = {
 	"NULL": true,
 	"NaN": true,
@@ -199,93 +208,153 @@ const operators = {
 	'/': true,
 }
 
-export default function highlightSyntax(text: string): string {
-	let html = `<code class="code-tag">`,
-		token = "",
-		typ = type.unmatched
+// Used for code tags without a language hint
+const genericLanguage: Language = {
+	quotes: `'"`,
+	lineComments: ["//", "#"],
+	keywords,
+}
+
+// Highlight a single line of code. lang specifies the language to use for
+// lexing. null selects the generic lexer. st carries multiline comments and
+// strings between consecutive lines.
+export default function highlightSyntax(
+	text: string,
+	lang: Language | null,
+	st: CodeState,
+): string {
+	let html = `<code class="code-tag">`
+
+	if (!lang) {
+		lang = genericLanguage
+	} else if (lang.diff) {
+		return html + highlightDiff(text) + "</code>"
+	}
+
+	let i = 0
+	if (st.closer) {
+		// Resume comment or string from the previous line
+		html += st.comment ? headers.comment : headers.string
+		const [frag, end] = delimited(text, 0, st)
+		html += frag
+		i = end
+	}
+
+	while (i < text.length) {
+		const b = text[i],
+			rest = text.slice(i)
+		if (isLineComment(lang, rest)) {
+			html += headers.comment + escape(rest) + close
+			i = text.length
+		} else if (isBlockComment(lang, rest)) {
+			const [open, closer] = lang.blockComment
+			html += headers.comment + escape(open)
+			st.closer = closer
+			st.comment = true
+			st.multiline = false
+			const [frag, end] = delimited(text, i + open.length, st)
+			html += frag
+			i = end
+		} else if (lang.quotes && lang.quotes.includes(b)) {
+			html += headers.string + escape(b)
+			st.closer = b
+			st.comment = false
+			st.multiline = !!lang.multilineQuotes
+				&& lang.multilineQuotes.includes(b)
+			const [frag, end] = delimited(text, i + 1, st)
+			html += frag
+			i = end
+		} else if (operators[b]) {
+			html += wrapOperator(b)
+			i++
+		} else if (isWordByte(b)) {
+			let j = i + 1
+			while (j < text.length && isWordByte(text[j])) {
+				j++
+			}
+			html += formatWord(text.slice(i, j), lang, text[j] === "(")
+			i = j
+		} else {
+			html += escape(b)
+			i++
+		}
+	}
 
-	for (let i = 0; i < text.length; i++) {
-		const prev = text[i - 1] || "",
-			b = text[i],
-			next = text[i + 1] || ""
+	return html + "</code>"
+}
 
-		switch (typ) {
-			case type.unmatched:
-				switch (b) {
-					case "/":
-						if (next === "/") {
-							typ = type.comment
-							html += headers.comment + "//"
-							i++
-						} else {
-							html += wrapOperator(b)
-						}
-						break
-					case "#":
-						typ = type.comment
-						html += headers.comment + b
-						break
-					case "'":
-						typ = type.quoted
-						html += headers.string + "&#39;"
-						break
-					case "\"":
-						typ = type.doubleQuoted
-						html += headers.string + "&#34;"
-						break
-					default:
-						if (operators[b]) {
-							html += wrapOperator(b)
-						} else if (isWordByte(b)) {
-							typ = type.word
-							token += b
-						} else {
-							html += escape(b)
-						}
-				}
-				break
-			case type.word:
-				token += b
-				if (!isWordByte(next)) {
-					if (next === "(") {
-						html += headers.function + escape(token) + close
-					} else if (keywords[token]) {
-						html += headers.operator + token + close
-					} else {
-						html += escape(token)
-					}
-					typ = type.unmatched
-					token = ""
-				}
-				break
-			case type.quoted:
-				html += escape(b)
-				if (b === "'" && prev != "\\") {
-					html += close
-					typ = type.unmatched
-				}
-				break
-			case type.doubleQuoted:
-				html += escape(b)
-				if (b === "\"" && prev != "\\") {
-					html += close
-					typ = type.unmatched
-				}
-				break
-			case type.comment:
-				html += escape(b)
-				break
+// Format a string or comment body starting at i up to and including the
+// closing delimiter in st. Returns the HTML and the position after the
+// delimiter. If the closing delimiter is not found, the rest of the line is
+// consumed.
+function delimited(
+	text: string,
+	i: number,
+	st: CodeState,
+): [string, number] {
+	for (let j = i; j < text.length; j++) {
+		if (!text.startsWith(st.closer, j)) {
+			continue
+		}
+		// Strings can escape their closing quote
+		if (!st.comment && j !== 0 && text[j - 1] === "\\") {
+			continue
 		}
+
+		const end = j + st.closer.length
+		st.closer = ""
+		st.comment = st.multiline = false
+		return [escape(text.slice(i, end)) + close, end]
 	}
 
-	if (typ === type.word) {
-		html += escape(token)
+	if (!st.comment && !st.multiline) {
+		st.closer = ""
+	}
+	return [escape(text.slice(i)) + close, text.length]
+}
+
+// Format a word token, wrapping it according to its class
+function formatWord(word: string, lang: Language, isCall: boolean): string {
+	const key = lang.caseInsensitive ? word.toLowerCase() : word
+	let header: string
+	if (isCall) {
+		header = headers.function
+	} else if (lang.keywords && lang.keywords[key]) {
+		header = headers.operator
+	} else if (lang.types && lang.types[key]) {
+		header = headers.type
+	} else if (lang.numbers && word[0] >= "0" && word[0] <= "9") {
+		header = headers.number
+	} else {
+		return escape(word)
 	}
-	if (typ !== type.unmatched) {
-		html += close
+	return header + escape(word) + close
+}
+
+// Highlight a line of a unified diff
+function highlightDiff(text: string): string {
+	let header: string
+	if (text.startsWith("@@")) {
+		header = headers.hunk
+	} else if (text.startsWith("+")) {
+		header = headers.inserted
+	} else if (text.startsWith("-")) {
+		header = headers.deleted
+	} else {
+		return escape(text)
 	}
-	html += "</code>"
-	return html
+	return header + escape(text) + close
+}
+
+// Returns, if s starts with a line comment
+function isLineComment(lang: Language, s: string): boolean {
+	return !!lang.lineComments
+		&& lang.lineComments.some(p => s.startsWith(p))
+}
+
+// Returns, if s starts with a block comment
+function isBlockComment(lang: Language, s: string): boolean {
+	return !!lang.blockComment && s.startsWith(lang.blockComment[0])
 }
 
 function wrapOperator(b: string): string {
@@ -0,0 +1,171 @@
+// Language definitions for syntax highlighting of fenced code blocks. Keep in
+// sync with templates/languages.go.
+
+import { Language } from "../../common"
+
+// Create a set from a list of strings
+function toSet(...words: string[]): { [word: string]: boolean } {
+	const set: { [word: string]: boolean } = {}
+	for (let w of words) {
+		set[w] = true
+	}
+	return set
+}
+
+const goLanguage: Language = {
+	numbers: true,
+	quotes: "'\"`",
+	multilineQuotes: "`",
+	lineComments: ["//"],
+	blockComment: ["/*", "*/"],
+	keywords: toSet(
+		"break", "case", "chan", "const", "continue", "default", "defer",
+		"else", "fallthrough", "for", "func", "go", "goto", "if", "import",
+		"interface", "map", "package", "range", "return", "select", "struct",
+		"switch", "type", "var", "nil", "true", "false", "iota",
+	),
+	types: toSet(
+		"bool", "byte", "complex64", "complex128", "error", "float32",
+		"float64", "int", "int8", "int16", "int32", "int64", "rune", "string",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+	),
+}
+
+const pythonLanguage: Language = {
+	numbers: true,
+	quotes: `'"`,
+	lineComments: ["#"],
+	keywords: toSet(
+		"False", "None", "True", "and", "as", "assert", "async", "await",
+		"break", "class", "continue", "def", "del", "elif", "else", "except",
+		"finally", "for", "from", "global", "if", "import", "in", "is",
+		"lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try",
+		"while", "with", "yield", "self",
+	),
+	types: toSet(
+		"bool", "bytearray", "bytes", "complex", "dict", "float", "frozenset",
+		"int", "list", "object", "set", "str", "tuple",
+	),
+}
+
+const jsLanguage: Language = {
+	numbers: true,
+	quotes: "'\"`",
+	multilineQuotes: "`",
+	lineComments: ["//"],
+	blockComment: ["/*", "*/"],
+	keywords: toSet(
+		"async", "await", "break", "case", "catch", "class", "const",
+		"continue", "debugger", "default", "delete", "do", "else", "export",
+		"extends", "false", "finally", "for", "function", "if", "import", "in",
+		"instanceof", "let", "new", "null", "of", "return", "static", "super",
+		"switch", "this", "throw", "true", "try", "typeof", "undefined", "var",
+		"void", "while", "with", "yield", "NaN", "Infinity",
+	),
+	types: toSet(
+		"Array", "ArrayBuffer", "Boolean", "Date", "Error", "Function", "Map",
+		"Number", "Object", "Promise", "RegExp", "Set", "String", "Symbol",
+		"WeakMap", "WeakSet",
+	),
+}
+
+const cLanguage: Language = {
+	numbers: true,
+	quotes: `'"`,
+	lineComments: ["//"],
+	blockComment: ["/*", "*/"],
+	keywords: toSet(
+		"auto", "break", "case", "const", "continue", "default", "do", "else",
+		"enum", "extern", "for", "goto", "if", "inline", "register", "restrict",
+		"return", "sizeof", "static", "struct", "switch", "typedef", "union",
+		"volatile", "while", "NULL", "true", "false",
+	),
+	types: toSet(
+		"bool", "char", "double", "float", "int", "long", "short", "signed",
+		"unsigned", "void", "size_t", "ssize_t", "int8_t", "int16_t", "int32_t",
+		"int64_t", "uint8_t", "uint16_t", "uint32_t", "uint64_t", "intptr_t",
+		"uintptr_t", "FILE",
+	),
+}
+
+// Single quotes are not strings in Rust, as they are also used for
+// lifetimes
+const rustLanguage: Language = {
+	numbers: true,
+	quotes: `"`,
+	multilineQuotes: `"`,
+	lineComments: ["//"],
+	blockComment: ["/*", "*/"],
+	keywords: toSet(
+		"as", "async", "await", "break", "const", "continue", "crate", "dyn",
+		"else", "enum", "extern", "false", "fn", "for", "if", "impl", "in",
+		"let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return",
+		"self", "Self", "static", "struct", "super", "trait", "true", "type",
+		"unsafe", "use", "where", "while",
+	),
+	types: toSet(
+		"bool", "char", "f32", "f64", "i8", "i16", "i32", "i64", "i128",
+		"isize", "str", "u8", "u16", "u32", "u64", "u128", "usize", "Box",
+		"Option", "Result", "String", "Vec",
+	),
+}
+
+const shellLanguage: Language = {
+	numbers: true,
+	quotes: `'"`,
+	multilineQuotes: `'"`,
+	lineComments: ["#"],
+	keywords: toSet(
+		"case", "do", "done", "elif", "else", "esac", "fi", "for", "function",
+		"if", "in", "select", "then", "until", "while", "break", "continue",
+		"export", "local", "readonly", "return", "shift", "source", "unset",
+	),
+}
+
+const sqlLanguage: Language = {
+	numbers: true,
+	caseInsensitive: true,
+	quotes: `'"`,
+	lineComments: ["--"],
+	blockComment: ["/*", "*/"],
+	keywords: toSet(
+		"add", "all", "alter", "and", "as", "asc", "begin", "between", "by",
+		"case", "check", "column", "commit", "constraint", "create", "default",
+		"delete", "desc", "distinct", "drop", "else", "end", "exists",
+		"foreign", "from", "full", "group", "having", "if", "in", "index",
+		"inner", "insert", "into", "is", "join", "key", "left", "like", "limit",
+		"not", "null", "offset", "on", "or", "order", "outer", "primary",
+		"references", "returning", "right", "rollback", "select", "set",
+		"table", "then", "union", "unique", "update", "values", "view", "when",
+		"where", "with", "true", "false",
+	),
+	types: toSet(
+		"bigint", "bool", "boolean", "bytea", "char", "date", "decimal",
+		"float", "inet", "int", "integer", "json", "jsonb", "numeric", "real",
+		"serial", "smallint", "text", "time", "timestamp", "varchar",
+	),
+}
+
+const diffLanguage: Language = {
+	diff: true,
+}
+
+// Languages by name and alias, that can be specified as a hint right after an
+// opening code tag
+export const languages: { [name: string]: Language } = {
+	go: goLanguage,
+	golang: goLanguage,
+	python: pythonLanguage,
+	py: pythonLanguage,
+	js: jsLanguage,
+	javascript: jsLanguage,
+	c: cLanguage,
+	rust: rustLanguage,
+	rs: rustLanguage,
+	sh: shellLanguage,
+	bash: shellLanguage,
+	shell: shellLanguage,
+	sql: sqlLanguage,
+	diff: diffLanguage,
+	patch: diffLanguage,
+}
@@ -0,0 +1,115 @@
+// Inline post body formatting. Mirrors templates/markup.go.
+
+import { escape } from "../../util"
+import { TextState } from "../../common"
+
+// Post body formatting types, that can be disabled by board owners, in the
+// same order as common.MarkupTypes on the server
+export const enum markup {
+	bold, italic, strikethrough, underline, heavy, heading,
+}
+
+const markupTypes = [
+	"bold", "italic", "strikethrough", "underline", "heavy", "heading",
+]
+
+// Bitmask with all markup types disabled
+export const allMarkupDisabled = (1 << markupTypes.length) - 1
+
+// Inline markup types are toggled by a doubled marker character
+const inlineMarkup: [string, string, string][] = [
+	["_", "<b>", "</b>"],
+	["/", "<i>", "</i>"],
+	["~", "<s>", "</s>"],
+	["%", "<u>", "</u>"],
+	["=", `<span class="heavy">`, "</span>"],
+]
+
+// Returns a bitmask of the disabled markup types
+export function disabledMarkup(disabled: string[]): number {
+	let mask = 0
+	for (let m of disabled || []) {
+		const i = markupTypes.indexOf(m)
+		if (i !== -1) {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// Returns, if the markup type is enabled for this post
+export function markupEnabled(state: TextState, t: markup): boolean {
+	return (state.disabledMarkup & (1 << t)) === 0
+}
+
+// Find the first enabled inline markup marker in s. Returns -1 as the index,
+// if none found.
+function nextMarker(s: string, state: TextState): [number, markup] {
+	for (let i = 0; i < s.length - 1; i++) {
+		if (s[i] !== s[i + 1]) {
+			continue
+		}
+		for (let t = 0; t < inlineMarkup.length; t++) {
+			if (inlineMarkup[t][0] === s[i] && markupEnabled(state, t)) {
+				return [i, t]
+			}
+		}
+	}
+	return [-1, 0]
+}
+
+// Escape a word, converting inline markup markers into tags
+export function formatWord(word: string, state: TextState): string {
+	let html = ""
+	while (true) {
+		const [i, t] = nextMarker(word, state)
+		if (i === -1) {
+			return html + escape(word)
+		}
+		html += escape(word.slice(0, i)) + toggleMarkup(t, state)
+		word = word.slice(i + 2)
+	}
+}
+
+// Open or close an inline markup tag. Tags are always kept properly nested:
+// closing a tag, that is not the innermost one, closes the tags opened after
+// it and reopens them after.
+function toggleMarkup(t: markup, state: TextState): string {
+	const open = state.markup
+	for (let i = open.length - 1; i >= 0; i--) {
+		if (open[i] !== t) {
+			continue
+		}
+
+		let html = ""
+		for (let j = open.length - 1; j >= i; j--) {
+			html += inlineMarkup[open[j]][2]
+		}
+		for (let t of open.slice(i + 1)) {
+			html += inlineMarkup[t][1]
+		}
+		open.splice(i, 1)
+		return html
+	}
+
+	open.push(t)
+	return inlineMarkup[t][1]
+}
+
+// Close all open inline markup tags, innermost first
+export function closeMarkup(state: TextState): string {
+	let html = ""
+	for (let i = state.markup.length - 1; i >= 0; i--) {
+		html += inlineMarkup[state.markup[i]][2]
+	}
+	return html
+}
+
+// Reopen inline markup tags closed with closeMarkup()
+export function reopenMarkup(state: TextState): string {
+	let html = ""
+	for (let t of state.markup) {
+		html += inlineMarkup[t][1]
+	}
+	return html
+}
@@ -10,6 +10,7 @@ import lang from "../lang"
 import { page, mine } from "../state"
 import options from "../options"
 import countries from "./countries"
+import { customFlagPrefix } from "../common"
 
 // Base post view class
 export default class PostView extends ImageHandler {
@@ -57,6 +58,9 @@ export default class PostView extends ImageHandler {
         if (this.model.image) {
             this.renderImage(false)
         }
+        if (this.model.images) {
+            this.renderGallery()
+        }
     }
 
     // Get the current Element for text to be written to
@@ -156,11 +160,18 @@ export default class PostView extends ImageHandler {
         quote.href = link.href = url
         quote.textContent = id.toString()
 
-        // Render country flag, if any
+        // Render custom board flag or country flag, if any
         if (flag) {
             const el = this.el.querySelector(".flag")
-            el.setAttribute("src", `/assets/flags/${flag}.svg`)
-            el.setAttribute("title", countries[flag] || flag)
+            if (flag.startsWith(customFlagPrefix)) {
+                const name = flag.slice(customFlagPrefix.length),
+                    board = this.model.board || page.board
+                el.setAttribute("src", `/assets/custom-flags/${board}/${name}`)
+                el.setAttribute("title", name)
+            } else {
+                el.setAttribute("src", `/assets/flags/${flag}.svg`)
+                el.setAttribute("title", countries[flag] || flag)
+            }
             el.hidden = false
         }
     }
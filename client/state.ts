@@ -18,6 +18,11 @@ interface Configs {
 	defaultCSS: string
 	imageRootOverride: string
 	links: { [key: string]: string }
+	previewDomains: string[]
+	thumbWidth: number
+	thumbHeight: number
+	catalogThumbWidth: number
+	catalogThumbHeight: number
 }
 
 // Board-specific configurations
@@ -28,6 +33,8 @@ export interface BoardConfigs {
 	title: string
 	notice: string
 	rules: string
+	disabledMarkup: string[]
+	markupSince: number
 	[index: string]: any
 }
 
@@ -1,7 +1,7 @@
 import { storeSeenReply, seenReplies } from "../state"
 import options from "../options"
 import lang from "../lang"
-import { thumbPath, Post } from "../posts"
+import { thumbPath, Post, isSpoilered, spoilerPath } from "../posts"
 import { repliedToMe } from "./tab"
 import { scrollToAnchor, importTemplate } from "../util"
 import { View } from "../base"
@@ -31,8 +31,8 @@ export default function notifyAboutReply(post: Post) {
 	if (!options.hideThumbs && !options.workModeToggle) {
 		if (post.image) {
 			const { SHA1, thumbType } = post.image
-			if (post.image.spoiler) {
-				icon = '/assets/spoil/default.jpg'
+			if (isSpoilered(post.image)) {
+				icon = spoilerPath(post.board, post.image)
 			} else {
 				icon = thumbPath(SHA1, thumbType)
 			}
@@ -45,12 +45,17 @@ export async function uncachedGET(url: string): Promise<Response> {
 	})
 }
 
-// Fetch HTML of a board page
+// Fetch HTML of a board page. Preserves the thread sort mode of the current
+// page.
 export async function fetchBoard(
 	board: string,
 	page: number,
 	catalog: boolean,
 ): Promise<Response> {
-	const u = `/${board}/${catalog ? "catalog" : ""}?minimal=true&page=${page}`
+	let u = `/${board}/${catalog ? "catalog" : ""}?minimal=true&page=${page}`
+	const sort = new URLSearchParams(location.search).get("sort")
+	if (sort) {
+		u += `&sort=${encodeURIComponent(sort)}`
+	}
 	return uncachedGET(u)
 }
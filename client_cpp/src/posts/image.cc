@@ -204,6 +204,8 @@ Node PostView::render_image(const Image& img)
         case FileType::mp3:
         case FileType::ogg:
         case FileType::flac:
+        case FileType::opus:
+        case FileType::m4a:
             file = "audio";
             break;
         default:
@@ -26,6 +26,10 @@ enum class FileType : uint8_t {
     flac,
     no_file,
     txt,
+    webp,
+    avif,
+    opus,
+    m4a,
 };
 
 // Maps file_type to the appropriate file extension
@@ -37,6 +41,8 @@ const std::unordered_map<FileType, std::string> file_extentions = {
     { FileType::ogg, "ogg" }, { FileType::zip, "zip" }, { FileType::_7z, "7z" },
     { FileType::targz, "tar.gz" }, { FileType::tarxz, "tar.xz" },
     { FileType::flac, "flac" }, { FileType::txt, "txt" },
+    { FileType::webp, "webp" }, { FileType::avif, "avif" },
+    { FileType::opus, "opus" }, { FileType::m4a, "m4a" },
 };
 
 class Image {
@@ -0,0 +1,23 @@
+package assets
+
+import (
+	"meguca/util"
+)
+
+var (
+	// Board-specific custom stylesheets
+	CSS = FileStore{
+		m: make(map[string]File, 64),
+		def: File{
+			Data: []byte{},
+			Hash: util.HashBuffer(nil),
+			Mime: "text/css; charset=utf-8",
+		},
+	}
+
+	// Custom themes uploaded by the admin account. Retrieving a non-existent
+	// theme returns a file with nil Data.
+	Themes = FileStore{
+		m: make(map[string]File, 8),
+	}
+)
@@ -0,0 +1,67 @@
+package assets
+
+import (
+	"meguca/util"
+	"sync"
+)
+
+var (
+	// Custom flag sets by board stored in memory
+	Flags = FlagStore{
+		m: make(map[string][]Flag, 64),
+	}
+)
+
+// Flag is a named board-specific custom flag image
+type Flag struct {
+	File
+	Name string
+}
+
+// Stores named flag images by board in memory
+type FlagStore struct {
+	mu sync.RWMutex
+	m  map[string][]Flag
+}
+
+// Set flags stored for a certain board
+func (s *FlagStore) Set(board string, flags []Flag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(flags) == 0 {
+		delete(s.m, board)
+		return
+	}
+	for i := range flags {
+		flags[i].Hash = util.HashBuffer(flags[i].Data)
+	}
+	s.m[board] = flags
+}
+
+// Returns the flag specified by board and name. If none found, ok == false.
+// file should not be mutted.
+func (s *FlagStore) Get(board, name string) (file File, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, f := range s.m[board] {
+		if f.Name == name {
+			return f.File, true
+		}
+	}
+	return
+}
+
+// Returns the names of all flags set for the board
+func (s *FlagStore) Names(board string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flags := s.m[board]
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = f.Name
+	}
+	return names
+}
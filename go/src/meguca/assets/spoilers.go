@@ -0,0 +1,46 @@
+package assets
+
+import (
+	"meguca/util"
+	"sync"
+)
+
+var (
+	// Custom spoiler images by board and spoiler category stored in memory
+	Spoilers = SpoilerStore{
+		m: make(map[string]map[uint8]File, 64),
+	}
+)
+
+// Stores board-specific files by spoiler category in memory
+type SpoilerStore struct {
+	mu sync.RWMutex
+	m  map[string]map[uint8]File
+}
+
+// Set files stored for a certain board. Categories missing from files use the
+// default spoiler image.
+func (s *SpoilerStore) Set(board string, files map[uint8]File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(files) == 0 {
+		delete(s.m, board)
+		return
+	}
+	for c, f := range files {
+		f.Hash = util.HashBuffer(f.Data)
+		files[c] = f
+	}
+	s.m[board] = files
+}
+
+// Returns the spoiler image of a board for the category. If none found,
+// ok == false. file should not be mutted.
+func (s *SpoilerStore) Get(board string, category uint8) (file File, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok = s.m[board][category]
+	return
+}
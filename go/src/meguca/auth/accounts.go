@@ -1,6 +1,11 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"meguca/config"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,3 +18,17 @@ type SessionCreds struct {
 func BcryptCompare(password string, hash []byte) error {
 	return bcrypt.CompareHashAndPassword(hash, []byte(password))
 }
+
+// CSRFToken derives a token from a login session, that is embedded in HTML
+// forms submitted with only the session cookies as authentication. Other sites
+// can not read the session and thus can not forge the token.
+func CSRFToken(session string) string {
+	mac := hmac.New(sha256.New, []byte(config.Get().Salt))
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCSRFToken returns, if token is the CSRF token of the login session
+func CheckCSRFToken(session, token string) bool {
+	return hmac.Equal([]byte(CSRFToken(session)), []byte(token))
+}
@@ -119,3 +119,17 @@ func TestRandomID(t *testing.T) {
 		t.Fatalf("unexpected hash string length: %d", l)
 	}
 }
+
+func TestCSRFToken(t *testing.T) {
+	t.Parallel()
+
+	token := CSRFToken("session1")
+	if !CheckCSRFToken("session1", token) {
+		t.Fatal("token not accepted")
+	}
+	for _, forged := range [...]string{"", CSRFToken("session2")} {
+		if CheckCSRFToken("session1", forged) {
+			t.Fatalf("forged token accepted: %s", forged)
+		}
+	}
+}
@@ -67,6 +67,11 @@ const (
 	DeleteImage
 	SpoilerImage
 	LockThread
+	MoveThread
+	MergeThread
+	CyclicalThread
+	BlockImage
+	BanFile
 )
 
 // Single entry in the moderation log
@@ -21,9 +21,11 @@ var (
 	Size float64 = 1 << 7
 )
 
-// Key stores the ID of either a thread or board page
+// Key stores the ID of either a thread or board page. Sort is the thread sort
+// mode of board pages.
 type Key struct {
 	LastN uint8
+	Sort  uint8
 	Board string
 	ID    uint64
 	Page  int64
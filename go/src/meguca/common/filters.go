@@ -0,0 +1,22 @@
+package common
+
+// Limits of filter profile entries
+const (
+	MaxNumFilters  = 100 // Of each type
+	MaxLenFilter   = 100
+	LenFilterToken = 43
+)
+
+// FilterProfile contains a user's server-side post filters. Threads and posts
+// matching any of them are omitted from rendered HTML pages.
+type FilterProfile struct {
+	// IDs of hidden threads
+	Threads []uint64 `json:"threads"`
+
+	// Posts with any of these poster names, tripcodes, poster IDs or image
+	// SHA1 hashes are hidden
+	Names     []string `json:"names"`
+	Tripcodes []string `json:"tripcodes"`
+	PosterIDs []string `json:"posterIDs"`
+	Images    []string `json:"images"`
+}
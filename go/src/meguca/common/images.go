@@ -20,8 +20,43 @@ const (
 	FLAC
 	NoFile
 	TXT
+	WEBP
+	AVIF
+	OPUS
+	M4A
 )
 
+// Limits of archive content listings
+const (
+	MaxArchiveFiles       = 100
+	MaxLenArchiveFileName = 255
+)
+
+// Spoiler categories of images. Images of any category other than NoSpoiler
+// have their thumbnails hidden behind the board's spoiler image for the
+// category.
+const (
+	NoSpoiler uint8 = iota
+	SpoilerGeneric
+	SpoilerNSFW
+	SpoilerGore
+)
+
+// SpoilerCategories contains the names of spoiler categories indexed by
+// category
+var SpoilerCategories = [...]string{
+	NoSpoiler:      "none",
+	SpoilerGeneric: "spoiler",
+	SpoilerNSFW:    "nsfw",
+	SpoilerGore:    "gore",
+}
+
+// IsValidSpoiler returns, if category is a valid spoiler category, including
+// NoSpoiler
+func IsValidSpoiler(category uint8) bool {
+	return int(category) < len(SpoilerCategories)
+}
+
 // Extensions maps internal file types to their canonical file extensions
 var Extensions = map[uint8]string{
 	JPEG:     "jpg",
@@ -38,15 +73,42 @@ var Extensions = map[uint8]string{
 	TXZ:      "tar.xz",
 	FLAC:     "flac",
 	TXT:      "txt",
+	WEBP:     "webp",
+	AVIF:     "avif",
+	OPUS:     "opus",
+	M4A:      "m4a",
+}
+
+// IsAllowedFileType returns, if the file type is in a board's list of allowed
+// file extensions. An empty list allows all types.
+func IsAllowedFileType(allowed []string, typ uint8) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ext := Extensions[typ]
+	for _, a := range allowed {
+		if a == ext {
+			return true
+		}
+	}
+	return false
 }
 
 // Image contains a post's image and thumbnail data
 type Image struct {
 	Spoiler bool `json:"spoiler,omitempty"`
+	// Category of the spoiler. NoSpoiler, if Spoiler is false.
+	SpoilerCategory uint8 `json:"spoilerCategory,omitempty"`
 	ImageCommon
 	Name string `json:"name"`
 }
 
+// SetSpoiler sets the spoiler category of the image
+func (i *Image) SetSpoiler(category uint8) {
+	i.Spoiler = category != NoSpoiler
+	i.SpoilerCategory = category
+}
+
 // ImageCommon contains the common data shared between multiple post referencing
 // the same image
 type ImageCommon struct {
@@ -64,4 +126,83 @@ type ImageCommon struct {
 	Title     string    `json:"title,omitempty"`
 	MD5       string
 	SHA1      string
+
+	// Dimensions of the double resolution and catalog thumbnail renditions.
+	// Zero, if the file has no such rendition.
+	Dims2x      [2]uint16 `json:"dims2x"`
+	CatalogDims [2]uint16 `json:"catalogDims"`
+
+	// Perceptual hash of the thumbnail. Zero, if the file has no thumbnail.
+	PHash uint64 `json:"-"`
+
+	// Listing of files inside an archive. Nil for other file types.
+	Contents *ArchiveContents `json:"contents,omitempty"`
+
+	// A browser-safe transcoded rendition of the video exists. Its file type
+	// is returned by TranscodeType.
+	Transcoded bool `json:"transcoded,omitempty"`
+}
+
+// TranscodeType returns the file type videos of the passed type are
+// transcoded to. MP4 files are transcoded to H.264 MP4 and all other video to
+// VP9 WebM.
+func TranscodeType(fileType uint8) uint8 {
+	if fileType == MP4 {
+		return MP4
+	}
+	return WEBM
+}
+
+// ArchiveContents lists the files inside an uploaded archive
+type ArchiveContents struct {
+	// Not all files are listed, because the archive exceeds
+	// MaxArchiveFiles or the amount of data, that can be safely decompressed
+	Truncated bool          `json:"truncated,omitempty"`
+	Files     []ArchiveFile `json:"files"`
+}
+
+// ArchiveFile is a file inside an uploaded archive
+type ArchiveFile struct {
+	Size int64  `json:"size"`
+	Name string `json:"name"`
+}
+
+// ImageBoardPosts contains the posts of a board, that reference a file,
+// grouped by thread
+type ImageBoardPosts struct {
+	Board   string             `json:"board"`
+	Threads []ImageThreadPosts `json:"threads"`
+}
+
+// ImageThreadPosts contains the IDs of posts in a thread, that reference a
+// file
+type ImageThreadPosts struct {
+	ID    uint64   `json:"id"`
+	Posts []uint64 `json:"posts"`
+}
+
+// StorageUsage contains the disk space used by the files referenced by the
+// posts of a board or the entire server
+type StorageUsage struct {
+	Board string `json:"board,omitempty"`
+
+	// Number of unique files and of references to them by posts
+	Files      uint64 `json:"files"`
+	References uint64 `json:"references"`
+
+	// Combined size of the source files, including transcoded renditions of
+	// videos, and of their thumbnails in bytes
+	SourceSize uint64 `json:"sourceSize"`
+	ThumbSize  uint64 `json:"thumbSize"`
+
+	// Bytes saved by storing files referenced multiple times only once
+	DedupSavings uint64 `json:"dedupSavings"`
+}
+
+// StorageReport contains the disk space used by each board and the server in
+// total. Files posted on multiple boards count towards each board, but only
+// once towards the total.
+type StorageReport struct {
+	Boards []StorageUsage `json:"boards"`
+	Total  StorageUsage   `json:"total"`
 }
@@ -33,6 +33,7 @@ type Thread struct {
 	Sticky    bool   `json:"sticky,omitempty"`
 	NonLive   bool   `json:"nonLive,omitempty"`
 	Locked    bool   `json:"locked,omitempty"`
+	Cyclical  bool   `json:"cyclical,omitempty"`
 	PostCtr   uint32 `json:"postCtr"`
 	ImageCtr  uint32 `json:"imageCtr"`
 	ReplyTime int64  `json:"replyTime"`
@@ -61,6 +62,10 @@ type Post struct {
 	Links    [][2]uint64 `json:"links,omitempty"`
 	Commands []Command   `json:"commands,omitempty"`
 	Image    *Image      `json:"image,omitempty"`
+
+	// Files attached after the first one on boards, that allow multiple
+	// files per post
+	Images []Image `json:"images,omitempty"`
 }
 
 // StandalonePost is a post view that includes the "op" and "board" fields,
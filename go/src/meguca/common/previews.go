@@ -0,0 +1,28 @@
+package common
+
+// Maximum lengths of link preview fields
+const (
+	MaxLenPreviewTitle       = 200
+	MaxLenPreviewDescription = 500
+)
+
+// LinkPreview contains metadata of an external URL linked in a post body
+type LinkPreview struct {
+	// Thumbnail image is available
+	Thumbnail bool `json:"thumbnail"`
+
+	// Hex-encoded SHA1 hash of the URL. Used for serving the thumbnail.
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// GetLinkPreview forwards unfurl.Get to avoid cyclic imports in templates.
+// Retrieves a preview of a URL linked in a thread. Returns false, if no
+// preview is available yet.
+var GetLinkPreview func(url string, op uint64, board string) (LinkPreview, bool)
+
+// PrefetchLinkPreviews forwards unfurl.Prefetch to avoid cyclic imports in
+// templates. Loads the previews of the passed URLs into memory, so that
+// GetLinkPreview does not query the database during rendering.
+var PrefetchLinkPreviews func(urls []string)
@@ -2,6 +2,7 @@ package common
 
 import (
 	"regexp"
+	"sync"
 )
 
 // Maximum lengths of various input fields
@@ -21,9 +22,21 @@ const (
 	MaxLenEightball    = 2000
 	MaxLenReason       = 100
 	MaxLenCustomJS     = 5000
+	MaxLenCustomCSS    = 10000
 	MaxNumBanners      = 20
+	MaxNumFlags        = 50
+	MaxLenFlagName     = 20
 	MaxAssetSize       = 100 << 10
 	MaxDiceSides       = 10000
+	MaxNumFiles        = 10   // Per post
+	MaxBoardFileSize   = 1024 // Board upload size limit in MB
+	MinThumbSize       = 16   // Thumbnail bounding box dimensions in pixels
+)
+
+// Reply caps of cyclical threads
+const (
+	DefaultCyclicalCap = 500
+	MaxCyclicalCap     = 5000
 )
 
 // Various cryptographic token exact lengths
@@ -32,7 +45,18 @@ const (
 	LenImageToken = 86
 )
 
-// Available language packs and themes. Change this, when adding any new ones.
+// CustomFlagPrefix is prepended to the names of board-specific custom flags,
+// when stored in Post.Flag, to differentiate them from GeoIP country codes
+const CustomFlagPrefix = "custom:"
+
+// MarkupTypes are the post body formatting types, that can be disabled by
+// board owners
+var MarkupTypes = [...]string{
+	"bold", "italic", "strikethrough", "underline", "heavy", "heading",
+}
+
+// Available language packs and built-in themes. Change this, when adding any
+// new ones.
 var (
 	Langs = []string{
 		"en_GB", "es_ES", "pl_PL", "pt_BR", "sk_SK", "tr_TR", "uk_UA", "ya_AR",
@@ -44,6 +68,59 @@ var (
 	}
 )
 
+// Custom themes uploaded by the admin account
+var (
+	customThemes   []string
+	customThemesMu sync.RWMutex
+)
+
+// SetCustomThemes sets the custom themes available in addition to the
+// built-in ones
+func SetCustomThemes(themes []string) {
+	customThemesMu.Lock()
+	defer customThemesMu.Unlock()
+	customThemes = themes
+}
+
+// GetThemes returns all built-in and custom themes
+func GetThemes() []string {
+	customThemesMu.RLock()
+	defer customThemesMu.RUnlock()
+
+	themes := make([]string, 0, len(Themes)+len(customThemes))
+	themes = append(themes, Themes...)
+	return append(themes, customThemes...)
+}
+
+// IsTheme returns, if the passed string is the name of a built-in or custom
+// theme
+func IsTheme(s string) bool {
+	for _, t := range GetThemes() {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SortMode is the order, in which threads are listed on a board index
+type SortMode uint8
+
+// All supported thread sort modes
+const (
+	SortByBump SortMode = iota
+	SortByLastReply
+	SortByCreation
+	SortByReplyCount
+	SortByFileCount
+)
+
+// SortModes contains the string representations of thread sort modes, indexed
+// by SortMode
+var SortModes = [...]string{
+	"bump", "lastReply", "creation", "replyCount", "fileCount",
+}
+
 // Common Regex expressions
 var (
 	CommandRegexp = regexp.MustCompile(`^#(flip|\d*d\d+|8ball|pyu|pcount|sw(?:\d+:)?\d+:\d+(?:[+-]\d+)?)$`)
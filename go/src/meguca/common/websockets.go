@@ -24,6 +24,7 @@ const (
 	MessageDeletePost
 	MessageBanned
 	MessageDeleteImage
+	MessageLockThread
 )
 
 // >= 30 are miscellaneous and do not write to post models
@@ -56,6 +57,9 @@ const (
 
 	// Notify the client, he needs a captcha solved
 	MessageCaptcha
+
+	// Report the progress of an asynchronous thumbnailing job to the uploader
+	MessageUploadProgress
 )
 
 // Forwarded functions from "meguca/websockets/feeds" to avoid circular imports
@@ -63,6 +67,10 @@ var (
 	// GetByIPAndBoard retrieves all Clients that match the passed IP on a board
 	GetByIPAndBoard func(ip, board string) []Client
 
+	// GetByIPAndID retrieves a Client by its IP and the random ID it passed on
+	// connection, if any
+	GetByIPAndID func(ip, id string) Client
+
 	// SendTo sends a message to a feed, if it exists
 	SendTo func(id uint64, msg []byte)
 
@@ -79,15 +87,16 @@ var (
 	DeleteImage func(id, op uint64) error
 
 	// Propagate a message about an image being spoilered
-	SpoilerImage func(id, op uint64) error
+	SpoilerImage func(id, op uint64, category uint8) error
 )
 
 // Client exposes some globally accessible websocket client functionality
 // without causing circular imports
 type Client interface {
 	Send([]byte)
-	Redirect(board string)
+	Redirect(board string, thread uint64)
 	IP() string
+	ID() string
 	Close(error)
 }
 
@@ -59,7 +59,17 @@ var (
 			ThreadExpiryMax: 14,
 			MaxSize:         5,
 			Links:           map[string]string{"4chan": "http://www.4chan.org/"},
+
+			ThumbWidth:         150,
+			ThumbHeight:        150,
+			CatalogThumbWidth:  100,
+			CatalogThumbHeight: 100,
 		},
+		BlockedImageDistance: 6,
+		StripMetadata:        true,
+		MaxTranscodeLength:   600,
+		MaxTranscodeSize:     50,
+		TranscodeWorkers:     1,
 	}
 
 	// EightballDefaults contains the default eightball answer set
@@ -73,6 +83,24 @@ var (
 	}
 )
 
+// DefaultBumpLimit is the number of posts in a thread, after which new posts
+// no longer bump it, on newly created boards
+const DefaultBumpLimit = 3000
+
+// DefaultThreadsPerPage is the number of threads on a board index page, if not
+// set by the board
+const DefaultThreadsPerPage = 15
+
+// ThreadsPerCatalogPage is the number of threads on a board catalog page
+const ThreadsPerCatalogPage = 150
+
+// Board metadata stripping settings
+const (
+	MetadataDefault = "default" // Use the global setting
+	MetadataStrip   = "strip"
+	MetadataKeep    = "keep"
+)
+
 // Default string for the FAQ panel
 const defaultFAQ = `Supported upload file types are JPEG, PNG, APNG, WEBM, MP3, MP4, OGG, PDF, ZIP, 7Z, TAR.GZ, TAR.XZ, TXT .
 Encase text in ** to spoiler and in ` + "``" + ` to highlight programing code syntax.
@@ -145,6 +173,41 @@ func GetBoardConfigs(b string) BoardConfContainer {
 	return boardConfigs[b]
 }
 
+// MaxUploadSize returns the maximum size of files uploaded to a board in bytes.
+// Boards without a limit of their own use the global one.
+func MaxUploadSize(board string) int64 {
+	if size := GetBoardConfigs(board).MaxSize; size != 0 {
+		return int64(size) << 20
+	}
+	return int64(Get().MaxSize) << 20
+}
+
+// StripMetadata returns, if identifying metadata should be removed from files
+// uploaded to a board
+func StripMetadata(board string) bool {
+	switch GetBoardConfigs(board).StripMetadata {
+	case MetadataStrip:
+		return true
+	case MetadataKeep:
+		return false
+	default:
+		return Get().StripMetadata
+	}
+}
+
+// LargestUploadSize returns the largest file size limit of any board in bytes
+func LargestUploadSize() int64 {
+	max := int64(Get().MaxSize) << 20
+	boardMu.RLock()
+	defer boardMu.RUnlock()
+	for _, c := range boardConfigs {
+		if size := int64(c.MaxSize) << 20; size > max {
+			max = size
+		}
+	}
+	return max
+}
+
 // GetAllBoardConfigs returns board-specific configurations for all boards. Do
 // not modify the retrieved structs.
 func GetAllBoardConfigs() map[string]BoardConfContainer {
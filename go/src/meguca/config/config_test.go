@@ -182,3 +182,62 @@ func TestGetBoardTitles(t *testing.T) {
 		},
 	})
 }
+
+func TestMaxUploadSize(t *testing.T) {
+	Clear()
+	if err := Set(Configs{Public: Public{MaxSize: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [...]BoardConfigs{
+		{ID: "a"},
+		{ID: "f", BoardPublic: BoardPublic{MaxSize: 50}},
+	} {
+		if _, err := SetBoardConfigs(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	AssertDeepEquals(t, MaxUploadSize("a"), int64(5<<20))
+	AssertDeepEquals(t, MaxUploadSize("f"), int64(50<<20))
+	AssertDeepEquals(t, MaxUploadSize("all"), int64(5<<20))
+	AssertDeepEquals(t, LargestUploadSize(), int64(50<<20))
+}
+
+func TestStripMetadata(t *testing.T) {
+	Clear()
+	if err := Set(Configs{StripMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [...]BoardConfigs{
+		{ID: "a"},
+		{ID: "b", StripMetadata: MetadataDefault},
+		{ID: "c", StripMetadata: MetadataKeep},
+		{ID: "d", StripMetadata: MetadataStrip},
+	} {
+		if _, err := SetBoardConfigs(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := [...]struct {
+		board string
+		strip bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+		{"d", true},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.board, func(t *testing.T) {
+			AssertDeepEquals(t, StripMetadata(c.board), c.strip)
+		})
+	}
+
+	if err := Set(Configs{}); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, StripMetadata("a"), false)
+	AssertDeepEquals(t, StripMetadata("d"), true)
+}
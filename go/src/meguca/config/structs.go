@@ -17,6 +17,32 @@ type Configs struct {
 	Salt          string `json:"salt"`
 	FeedbackEmail string `json:"feedbackEmail"`
 	FAQ           string
+
+	// Maximum Hamming distance between the perceptual hashes of an uploaded
+	// and a blocked image for the upload to be rejected
+	BlockedImageDistance uint8 `json:"blockedImageDistance"`
+
+	// Maximum number of files thumbnailed concurrently. 0 means the number of
+	// CPU cores.
+	ThumbnailWorkers uint `json:"thumbnailWorkers"`
+
+	// Remove location, device and other identifying metadata from uploaded
+	// files
+	StripMetadata bool `json:"stripMetadata"`
+
+	// Convert uploaded video, that can not be played by most browsers, to
+	// H.264 MP4 or VP9 WebM. Requires ffmpeg.
+	Transcode bool `json:"transcode"`
+
+	// Videos longer than this many seconds are not transcoded
+	MaxTranscodeLength uint `json:"maxTranscodeLength"`
+
+	// Transcoded files larger than this many MB are discarded
+	MaxTranscodeSize uint `json:"maxTranscodeSize"`
+
+	// Maximum number of videos transcoded concurrently. Changes take effect
+	// after a server restart.
+	TranscodeWorkers uint `json:"transcodeWorkers"`
 }
 
 // Public contains configurations exposeable through public availability APIs
@@ -32,15 +58,39 @@ type Public struct {
 	DefaultCSS        string            `json:"defaultCSS"`
 	ImageRootOverride string            `json:"imageRootOverride"`
 	Links             map[string]string `json:"links"`
+
+	// Domains, that linked URLs are fetched from to generate previews
+	PreviewDomains []string `json:"previewDomains"`
+
+	// Bounding boxes of generated thumbnails and catalog thumbnails. A double
+	// resolution rendition of the thumbnail is also generated for high DPI
+	// displays.
+	ThumbWidth         uint16 `json:"thumbWidth"`
+	ThumbHeight        uint16 `json:"thumbHeight"`
+	CatalogThumbWidth  uint16 `json:"catalogThumbWidth"`
+	CatalogThumbHeight uint16 `json:"catalogThumbHeight"`
 }
 
 // BoardConfigs stores board-specific configuration
 type BoardConfigs struct {
 	BoardPublic
-	DisableRobots bool     `json:"disableRobots"`
-	ID            string   `json:"id"`
-	Js            string   `json:"js"`
-	Eightball     []string `json:"eightball"`
+	DisableRobots  bool     `json:"disableRobots"`
+	ThreadsPerPage uint     `json:"threadsPerPage"`
+	ID             string   `json:"id"`
+	Js             string   `json:"js"`
+	CSS            string   `json:"css"`
+	Eightball      []string `json:"eightball"`
+
+	// Overrides the global metadata stripping setting. One of
+	// MetadataDefault, MetadataStrip or MetadataKeep.
+	StripMetadata string `json:"stripMetadata"`
+
+	// Replace the original names of uploaded files with the upload time
+	HideFileNames bool `json:"hideFileNames"`
+
+	// Maximum disk space in MB used by the source files and thumbnails
+	// referenced by posts on this board. 0 means unlimited.
+	StorageQuota uint `json:"storageQuota"`
 }
 
 // BoardPublic contains publically accessible board-specific configurations
@@ -52,10 +102,31 @@ type BoardPublic struct {
 	NonLive    bool `json:"nonLive"`
 	NSFW       bool
 	PosterIDs  bool   `json:"posterIDs"`
+	Math       bool   `json:"math"`
+	BumpLimit  uint   `json:"bumpLimit"`
+	ImageLimit uint   `json:"imageLimit"`
+	PostLimit  uint   `json:"postLimit"`
+	MaxFiles   uint   `json:"maxFiles"`
 	DefaultCSS string `json:"defaultCSS"`
 	Title      string `json:"title"`
 	Notice     string `json:"notice"`
 	Rules      string `json:"rules"`
+
+	// Post body markup types from common.MarkupTypes, that are not rendered
+	// on this board
+	DisabledMarkup []string `json:"disabledMarkup"`
+
+	// Posts created before this Unix time are rendered without any markup
+	// from common.MarkupTypes, so that introducing it does not change how
+	// existing posts render. Not settable by board owners.
+	MarkupSince int64 `json:"markupSince"`
+
+	// File extensions from common.Extensions, that can be uploaded to this
+	// board. Empty means all types are allowed.
+	AllowedTypes []string `json:"allowedTypes"`
+
+	// Maximum size of uploaded files in MB. 0 means the global limit applies.
+	MaxSize uint `json:"maxSize"`
 }
 
 // BoardConfContainer contains configurations for an individual board as well
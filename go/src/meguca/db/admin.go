@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"meguca/auth"
 	"meguca/common"
+	"meguca/imager/assets"
 	"time"
 )
 
@@ -142,9 +143,139 @@ func DeleteImage(id uint64, by string) error {
 	return moderatePost(id, by, "delete_image", common.DeleteImage)
 }
 
-// Spoiler image as a moderator
-func ModSpoilerImage(id uint64, by string) (err error) {
-	return moderatePost(id, by, "mod_spoiler_image", common.SpoilerImage)
+// BanFile removes the images of a post from all posts they are used in on
+// any board, deletes their files and bans the files from being uploaded again
+func BanFile(id uint64, by string) (err error) {
+	tx, err := StartTransaction()
+	if err != nil {
+		return
+	}
+	defer RollbackOnError(tx, &err)
+
+	var imgs []common.ImageCommon
+	r, err := tx.Stmt(prepared["get_post_files"]).Query(id)
+	if err != nil {
+		return
+	}
+	for r.Next() {
+		var img common.ImageCommon
+		img, err = scanImage(r)
+		if err != nil {
+			r.Close()
+			return
+		}
+		imgs = append(imgs, img)
+	}
+	err = r.Err()
+	if err != nil {
+		return
+	}
+	if len(imgs) == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Stmt(prepared["log_file_ban"]).Exec(id, by)
+	if err != nil {
+		return
+	}
+
+	// Detach the images from all posts, that use them. main is set, if it
+	// was the post's first image.
+	type post struct {
+		id, op uint64
+		main   bool
+	}
+	var posts []post
+	for _, img := range imgs {
+		_, err = tx.Stmt(prepared["ban_file"]).Exec(img.SHA1, img.MD5, by)
+		if err != nil {
+			return
+		}
+
+		r, err = tx.Stmt(prepared["detach_image"]).Query(img.SHA1)
+		if err != nil {
+			return
+		}
+		for r.Next() {
+			var p post
+			err = r.Scan(&p.id, &p.op, &p.main)
+			if err != nil {
+				r.Close()
+				return
+			}
+			posts = append(posts, p)
+		}
+		err = r.Err()
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Stmt(prepared["delete_image_record"]).Exec(img.SHA1)
+		if err != nil {
+			return
+		}
+	}
+
+	// Update thread counters to invalidate any caches
+	touched := make(map[uint64]bool, len(posts))
+	q := tx.Stmt(prepared["touch_thread"])
+	for _, p := range posts {
+		if touched[p.op] {
+			continue
+		}
+		touched[p.op] = true
+		_, err = q.Exec(p.op)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	for _, img := range imgs {
+		err = assets.Delete(img.SHA1, img.FileType, img.ThumbType)
+		if err != nil {
+			return
+		}
+	}
+	if !IsTest {
+		for _, p := range posts {
+			if !p.main {
+				continue
+			}
+			err = common.DeleteImage(p.id, p.op)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// BlockImage adds all images of a post to the blocklist of a board. Pass "all"
+// to block the images globally.
+func BlockImage(board string, id uint64, by string) error {
+	return execPrepared("block_image", id, board, by)
+}
+
+// Spoiler image as a moderator with the specified spoiler category
+func ModSpoilerImage(id uint64, category uint8, by string) (err error) {
+	err = execPrepared("mod_spoiler_image", id, by, category)
+	if err != nil {
+		return
+	}
+
+	op, err := GetPostOP(id)
+	if err != nil {
+		return
+	}
+	if !IsTest {
+		err = common.SpoilerImage(id, op, category)
+	}
+	return
 }
 
 // WriteStaff writes staff positions of a specific board. Old rows are
@@ -249,6 +380,41 @@ func GetSameIPPosts(id uint64, board string) (
 	return
 }
 
+// GetImagePosts returns all not deleted posts on any board, that reference
+// the file with the passed SHA1 hash, grouped by board and thread
+func GetImagePosts(SHA1 string) (posts []common.ImageBoardPosts, err error) {
+	r, err := prepared["get_image_posts"].Query(SHA1)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	var (
+		board  string
+		op, id uint64
+	)
+	for r.Next() {
+		err = r.Scan(&board, &op, &id)
+		if err != nil {
+			return
+		}
+
+		// Rows are sorted by board and thread, so only the last group needs
+		// to be checked
+		if len(posts) == 0 || posts[len(posts)-1].Board != board {
+			posts = append(posts, common.ImageBoardPosts{Board: board})
+		}
+		b := &posts[len(posts)-1]
+		if len(b.Threads) == 0 || b.Threads[len(b.Threads)-1].ID != op {
+			b.Threads = append(b.Threads, common.ImageThreadPosts{ID: op})
+		}
+		t := &b.Threads[len(b.Threads)-1]
+		t.Posts = append(t.Posts, id)
+	}
+	err = r.Err()
+	return
+}
+
 // Set the sticky field on a thread
 func SetThreadSticky(id uint64, sticky bool) error {
 	return execPrepared("set_sticky", id, sticky)
@@ -259,6 +425,36 @@ func SetThreadLock(id uint64, locked bool, by string) error {
 	return execPrepared("set_locked", id, locked, by)
 }
 
+// MoveThread moves a thread and all of its posts to a different board
+func MoveThread(id uint64, board, by string) error {
+	return execPrepared("move_thread", id, board, by)
+}
+
+// MergeThread moves all posts of thread src into thread dst and deletes src
+func MergeThread(src, dst uint64, by string) (err error) {
+	tx, err := StartTransaction()
+	if err != nil {
+		return
+	}
+	defer RollbackOnError(tx, &err)
+
+	_, err = tx.Stmt(prepared["merge_thread"]).Exec(src, dst, by)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(prepared["delete_thread"]).Exec(src)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Set a thread to delete its oldest replies, once it has more than cap
+// replies, instead of expiring
+func SetThreadCyclical(id uint64, cyclical bool, cap uint, by string) error {
+	return execPrepared("set_cyclical", id, cyclical, cap, by)
+}
+
 // Retrieve moderation log for a specific board
 func GetModLog(board string) (log []auth.ModLogEntry, err error) {
 	r, err := prepared["get_mod_log"].Query(board)
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"meguca/assets"
 	"meguca/common"
+	"meguca/config"
 )
 
 // Overwrite list of banners in the DB, for a specific board
@@ -113,6 +114,176 @@ func updateBanners(board string) (err error) {
 	return
 }
 
+// Overwrite the custom flag set of a specific board
+func SetFlags(board string, flags []assets.Flag) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer RollbackOnError(tx, &err)
+
+	_, err = tx.Stmt(prepared["clear_flags"]).Exec(board)
+	if err != nil {
+		return
+	}
+
+	q := tx.Stmt(prepared["set_flag"])
+	for i, f := range flags {
+		_, err = q.Exec(board, i, f.Name, f.Data, f.Mime)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Exec("select pg_notify('flags_updated', $1)", board)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func loadFlags() (err error) {
+	r, err := prepared["load_all_flags"].Query()
+	if err != nil {
+		return
+	}
+	byBoard, err := scanFlags(r)
+	if err != nil {
+		return
+	}
+	for board, flags := range byBoard {
+		assets.Flags.Set(board, flags)
+	}
+
+	return Listen("flags_updated", updateFlags)
+}
+
+// Scan flags and group them by board
+func scanFlags(r *sql.Rows) (byBoard map[string][]assets.Flag, err error) {
+	defer r.Close()
+
+	byBoard = make(map[string][]assets.Flag, 64)
+	for r.Next() {
+		var (
+			board string
+			f     assets.Flag
+		)
+		err = r.Scan(&board, &f.Name, &f.Data, &f.Mime)
+		if err != nil {
+			return
+		}
+		byBoard[board] = append(byBoard[board], f)
+	}
+	err = r.Err()
+	return
+}
+
+func updateFlags(board string) (err error) {
+	r, err := prepared["load_flags"].Query(board)
+	if err != nil {
+		return
+	}
+	byBoard, err := scanFlags(r)
+	if err != nil {
+		return
+	}
+
+	assets.Flags.Set(board, byBoard[board])
+	return
+}
+
+// Overwrite the custom spoiler images of a specific board. Categories missing
+// from files use the default spoiler image.
+func SetSpoilers(board string, files map[uint8]assets.File) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer RollbackOnError(tx, &err)
+
+	_, err = tx.Stmt(prepared["clear_spoilers"]).Exec(board)
+	if err != nil {
+		return
+	}
+
+	q := tx.Stmt(prepared["set_spoiler"])
+	for c, f := range files {
+		_, err = q.Exec(board, c, f.Data, f.Mime)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Exec("select pg_notify('spoilers_updated', $1)", board)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func loadSpoilers() (err error) {
+	r, err := prepared["load_all_spoilers"].Query()
+	if err != nil {
+		return
+	}
+	byBoard, err := scanSpoilers(r)
+	if err != nil {
+		return
+	}
+	for board, files := range byBoard {
+		assets.Spoilers.Set(board, files)
+	}
+
+	return Listen("spoilers_updated", updateSpoilers)
+}
+
+// Scan spoiler images and group them by board and category
+func scanSpoilers(r *sql.Rows) (
+	byBoard map[string]map[uint8]assets.File,
+	err error,
+) {
+	defer r.Close()
+
+	byBoard = make(map[string]map[uint8]assets.File, 64)
+	for r.Next() {
+		var (
+			board    string
+			category uint8
+			f        assets.File
+		)
+		err = r.Scan(&board, &category, &f.Data, &f.Mime)
+		if err != nil {
+			return
+		}
+		files := byBoard[board]
+		if files == nil {
+			files = make(map[uint8]assets.File, len(common.SpoilerCategories))
+			byBoard[board] = files
+		}
+		files[category] = f
+	}
+	err = r.Err()
+	return
+}
+
+func updateSpoilers(board string) (err error) {
+	r, err := prepared["load_spoilers"].Query(board)
+	if err != nil {
+		return
+	}
+	byBoard, err := scanSpoilers(r)
+	if err != nil {
+		return
+	}
+
+	assets.Spoilers.Set(board, byBoard[board])
+	return
+}
+
 // Set loading animation for specific board. Nil file.Data means the default
 // animation should be used.
 func SetLoadingAnimation(board string, file assets.File) (err error) {
@@ -165,3 +336,93 @@ func updateLoadingAnimation(board string) (err error) {
 	}
 	return
 }
+
+// SetTheme creates or overwrites a custom theme stylesheet
+func SetTheme(name string, data []byte) error {
+	return execPrepared("set_theme", name, data)
+}
+
+// DeleteTheme deletes a custom theme and resets the default theme of any boards
+// using it to the global default. Returns sql.ErrNoRows, if no such theme
+// exists.
+func DeleteTheme(name string) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer RollbackOnError(tx, &err)
+
+	var s string
+	err = tx.Stmt(prepared["delete_theme"]).QueryRow(name).Scan(&s)
+	if err != nil {
+		return
+	}
+
+	def := config.Get().DefaultCSS
+	if def == name {
+		def = config.Defaults.DefaultCSS
+	}
+	_, err = tx.Stmt(prepared["reset_board_themes"]).Exec(name, def)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func loadThemes() (err error) {
+	err = reloadThemes()
+	if err != nil {
+		return
+	}
+	return Listen("themes_updated", func(string) error {
+		if err := reloadThemes(); err != nil {
+			return err
+		}
+		return recompileTemplates()
+	})
+}
+
+// Reload all custom themes from the database. As there are very few of them,
+// this is simpler than tracking individual changes.
+func reloadThemes() (err error) {
+	r, err := prepared["load_themes"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	files := make(map[string][]byte, 8)
+	names := make([]string, 0, 8)
+	for r.Next() {
+		var (
+			name string
+			data []byte
+		)
+		err = r.Scan(&name, &data)
+		if err != nil {
+			return
+		}
+		files[name] = data
+		names = append(names, name)
+	}
+	err = r.Err()
+	if err != nil {
+		return
+	}
+
+	// Clear deleted themes
+	for _, t := range common.GetThemes()[len(common.Themes):] {
+		if _, ok := files[t]; !ok {
+			assets.Themes.Set(t, assets.File{})
+		}
+	}
+	for name, data := range files {
+		assets.Themes.Set(name, assets.File{
+			Data: data,
+			Mime: "text/css; charset=utf-8",
+		})
+	}
+	common.SetCustomThemes(names)
+	return
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"meguca/config"
+	. "meguca/test"
+)
+
+func TestDeleteTheme(t *testing.T) {
+	assertTableClear(t, "boards", "themes")
+	config.Set(config.Configs{
+		Public: config.Public{
+			DefaultCSS: "moe",
+		},
+	})
+
+	if err := SetTheme("custom", []byte("body{}")); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range [...]string{"a", "c"} {
+		b := BoardConfigs{
+			BoardConfigs: config.BoardConfigs{
+				ID: id,
+				BoardPublic: config.BoardPublic{
+					DefaultCSS: "custom",
+				},
+				Eightball: []string{"yes"},
+			},
+		}
+		if id == "c" {
+			b.DefaultCSS = "ashita"
+		}
+		if err := WriteBoard(nil, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := DeleteTheme("custom"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("board themes", func(t *testing.T) {
+		for id, theme := range map[string]string{"a": "moe", "c": "ashita"} {
+			conf, err := GetBoardConfigs(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, conf.DefaultCSS, theme)
+		}
+	})
+
+	t.Run("nonexistent theme", func(t *testing.T) {
+		if err := DeleteTheme("custom"); err != sql.ErrNoRows {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -108,6 +108,15 @@ func ChangePassword(account string, hash []byte) error {
 	return execPrepared("change_password", account, hash)
 }
 
+// IsStaff returns, if the account holds any staff position on any board
+func IsStaff(account string) (is bool, err error) {
+	if account == "admin" {
+		return true, nil
+	}
+	err = prepared["is_staff"].QueryRow(account).Scan(&is)
+	return
+}
+
 // GetOwnedBoards returns boards the account holder owns
 func GetOwnedBoards(account string) (boards []string, err error) {
 	// admin account can perform actions on any board
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"meguca/assets"
 	"meguca/config"
 	"meguca/templates"
 	"meguca/util"
@@ -59,6 +60,7 @@ func loadBoardConfigs() error {
 		if _, err := config.SetBoardConfigs(c); err != nil {
 			return err
 		}
+		setBoardCSS(c)
 	}
 	if err := r.Err(); err != nil {
 		return err
@@ -68,13 +70,19 @@ func loadBoardConfigs() error {
 }
 
 func scanBoardConfigs(r rowScanner) (c config.BoardConfigs, err error) {
-	var eightball pq.StringArray
+	var eightball, disabledMarkup, allowedTypes pq.StringArray
 	err = r.Scan(
 		&c.ReadOnly, &c.TextOnly, &c.ForcedAnon, &c.DisableRobots, &c.Flags,
-		&c.NSFW, &c.NonLive, &c.PosterIDs,
+		&c.NSFW, &c.NonLive, &c.PosterIDs, &c.BumpLimit, &c.ImageLimit,
+		&c.PostLimit, &c.ThreadsPerPage,
 		&c.ID, &c.DefaultCSS, &c.Title, &c.Notice, &c.Rules, &eightball, &c.Js,
+		&c.CSS, &disabledMarkup, &c.Math, &c.MaxFiles, &allowedTypes,
+		&c.MaxSize, &c.StripMetadata, &c.HideFileNames, &c.StorageQuota,
+		&c.MarkupSince,
 	)
 	c.Eightball = []string(eightball)
+	c.DisabledMarkup = []string(disabledMarkup)
+	c.AllowedTypes = []string(allowedTypes)
 	return
 }
 
@@ -85,6 +93,10 @@ func WriteBoard(tx *sql.Tx, c BoardConfigs) error {
 		c.NSFW, c.NonLive, c.PosterIDs,
 		c.Created, c.DefaultCSS, c.Title, c.Notice, c.Rules,
 		pq.StringArray(c.Eightball), c.Js,
+		c.BumpLimit, c.ImageLimit, c.PostLimit, c.ThreadsPerPage, c.CSS,
+		pq.StringArray(c.DisabledMarkup), c.Math, c.MaxFiles,
+		pq.StringArray(c.AllowedTypes), c.MaxSize, c.StripMetadata,
+		c.HideFileNames, c.StorageQuota,
 	)
 	return err
 }
@@ -97,6 +109,10 @@ func UpdateBoard(c config.BoardConfigs) error {
 		c.NSFW, c.NonLive, c.PosterIDs,
 		c.DefaultCSS, c.Title, c.Notice, c.Rules,
 		pq.StringArray(c.Eightball), c.Js,
+		c.BumpLimit, c.ImageLimit, c.PostLimit, c.ThreadsPerPage, c.CSS,
+		pq.StringArray(c.DisabledMarkup), c.Math, c.MaxFiles,
+		pq.StringArray(c.AllowedTypes), c.MaxSize, c.StripMetadata,
+		c.HideFileNames, c.StorageQuota,
 	)
 }
 
@@ -116,11 +132,13 @@ func updateBoardConfigs(board string) error {
 	case nil:
 	case sql.ErrNoRows:
 		config.RemoveBoard(board)
+		assets.CSS.Set(board, assets.File{})
 		return recompileTemplates()
 	default:
 		return err
 	}
 
+	setBoardCSS(conf)
 	changed, err := config.SetBoardConfigs(conf)
 	switch {
 	case err != nil:
@@ -132,6 +150,18 @@ func updateBoardConfigs(board string) error {
 	}
 }
 
+// Store a board's custom stylesheet in memory for serving
+func setBoardCSS(c config.BoardConfigs) {
+	var f assets.File
+	if c.CSS != "" {
+		f = assets.File{
+			Data: []byte(c.CSS),
+			Mime: "text/css; charset=utf-8",
+		}
+	}
+	assets.CSS.Set(c.ID, f)
+}
+
 // GetBoardConfigs retrives the configurations of a specific board
 func GetBoardConfigs(board string) (config.BoardConfigs, error) {
 	return scanBoardConfigs(prepared["get_board_configs"].QueryRow(board))
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"encoding/json"
+	"meguca/common"
+)
+
+// GetFilterProfile retrieves a user's post filters by token
+func GetFilterProfile(token string) (f common.FilterProfile, err error) {
+	var buf []byte
+	err = prepared["get_filter_profile"].QueryRow(token).Scan(&buf)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(buf, &f)
+	return
+}
+
+// WriteFilterProfile creates or overwrites a user's post filters. Profiles
+// expire after a year without updates.
+func WriteFilterProfile(token string, f common.FilterProfile) error {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return execPrepared("write_filter_profile", token, string(buf))
+}
+
+// DeleteFilterProfile deletes a user's post filters
+func DeleteFilterProfile(token string) error {
+	return execPrepared("delete_filter_profile", token)
+}
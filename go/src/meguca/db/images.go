@@ -2,14 +2,18 @@ package db
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"fmt"
 	"meguca/auth"
 	"meguca/common"
+	"meguca/config"
 	"meguca/imager/assets"
 	"meguca/util"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/mailru/easyjson"
 )
 
 const (
@@ -26,19 +30,173 @@ var (
 
 // WriteImage writes a processed image record to the DB
 func WriteImage(tx *sql.Tx, i common.ImageCommon) error {
+	return writeImage(tx, i, 0)
+}
+
+// Write a processed image record with the combined size of its thumbnails in
+// bytes to the DB
+func writeImage(tx *sql.Tx, i common.ImageCommon, thumbSize int64) error {
 	dims := pq.GenericArray{A: i.Dims}
 	_, err := getStatement(tx, "write_image").Exec(
 		i.APNG, i.Audio, i.Video, i.FileType, i.ThumbType, dims, i.Length,
-		i.Size, i.MD5, i.SHA1, i.Title, i.Artist,
+		i.Size, i.MD5, i.SHA1, i.Title, i.Artist, phashArg(i.PHash),
+		contentsRow{i.Contents}, pq.GenericArray{A: i.Dims2x},
+		pq.GenericArray{A: i.CatalogDims}, i.Transcoded, thumbSize,
 	)
 	return err
 }
 
+// SetTranscoded records, that a browser-safe transcoded rendition of a video
+// with the passed size in bytes has been stored
+func SetTranscoded(SHA1 string, size int64) error {
+	return execPrepared("set_transcoded", SHA1, size)
+}
+
+// SetStorageSizes records the combined size in bytes of the thumbnails of an
+// image and of its transcoded rendition
+func SetStorageSizes(SHA1 string, thumbSize, transcodedSize int64) error {
+	return execPrepared("set_storage_sizes", SHA1, thumbSize, transcodedSize)
+}
+
+// QueueTranscode persists a video in the transcoding queue, so it is retried
+// after a restart, if not processed by then
+func QueueTranscode(SHA1 string) error {
+	return execPrepared("queue_transcode", SHA1)
+}
+
+// QueueUntranscoded persists all stored videos of the file types, that are not
+// transcoded yet, in the transcoding queue and returns their number
+func QueueUntranscoded(fileTypes []uint8) (n int64, err error) {
+	types := make(pq.Int64Array, len(fileTypes))
+	for i, t := range fileTypes {
+		types[i] = int64(t)
+	}
+	res, err := prepared["queue_untranscoded"].Exec(types)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+// DequeueTranscode removes a processed video from the transcoding queue
+func DequeueTranscode(SHA1 string) error {
+	return execPrepared("dequeue_transcode", SHA1)
+}
+
+// GetQueuedTranscodes returns all videos in the transcoding queue
+func GetQueuedTranscodes() (images []common.ImageCommon, err error) {
+	r, err := prepared["get_queued_transcodes"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var img common.ImageCommon
+		img, err = scanImage(r)
+		if err != nil {
+			return
+		}
+		images = append(images, img)
+	}
+	err = r.Err()
+	return
+}
+
+// UpdateThumbnails writes the type, dimensions, perceptual hash and combined
+// size in bytes of regenerated thumbnails of an image to the DB
+func UpdateThumbnails(i common.ImageCommon, thumbSize int64) error {
+	return execPrepared(
+		"update_thumbnails",
+		i.SHA1, i.ThumbType, pq.GenericArray{A: i.Dims},
+		pq.GenericArray{A: i.Dims2x}, pq.GenericArray{A: i.CatalogDims},
+		phashArg(i.PHash), thumbSize,
+	)
+}
+
+// ForEachImage calls fn with every image stored on the server. Iteration stops
+// on the first error returned by fn.
+func ForEachImage(fn func(common.ImageCommon) error) (err error) {
+	r, err := prepared["get_all_images"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var img common.ImageCommon
+		img, err = scanImage(r)
+		if err != nil {
+			return
+		}
+		err = fn(img)
+		if err != nil {
+			return
+		}
+	}
+	return r.Err()
+}
+
+// Archive content listing stored as JSON. Nil for other file types.
+type contentsRow struct {
+	*common.ArchiveContents
+}
+
+func (c *contentsRow) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	case nil:
+		c.ArchiveContents = nil
+		return nil
+	default:
+		return fmt.Errorf(
+			"db: cannot convert %T to common.ArchiveContents",
+			src,
+		)
+	}
+
+	c.ArchiveContents = new(common.ArchiveContents)
+	return easyjson.Unmarshal(data, c.ArchiveContents)
+}
+
+func (c contentsRow) Value() (driver.Value, error) {
+	if c.ArchiveContents == nil {
+		return nil, nil
+	}
+	return easyjson.Marshal(*c.ArchiveContents)
+}
+
+// Perceptual hashes are stored as signed integers. Files without thumbnails
+// have no hash.
+func phashArg(h uint64) sql.NullInt64 {
+	return sql.NullInt64{
+		Int64: int64(h),
+		Valid: h != 0,
+	}
+}
+
 // GetImage retrieves a thumbnailed image record from the DB
 func GetImage(SHA1 string) (common.ImageCommon, error) {
 	return scanImage(prepared["get_image"].QueryRow(SHA1))
 }
 
+// GetImageByUploadHash retrieves a thumbnailed image record by the SHA1 hash of
+// an uploaded file. Files stored with their metadata stripped are also found by
+// the hash of the original file.
+func GetImageByUploadHash(SHA1 string) (common.ImageCommon, error) {
+	return scanImage(prepared["get_image_by_upload_hash"].QueryRow(SHA1))
+}
+
+// WriteImageAlias records, that an uploaded file with the SHA1 hash is stored
+// as the image with the image hash
+func WriteImageAlias(SHA1, image string) error {
+	return execPrepared("write_image_alias", SHA1, image)
+}
+
 func scanImage(rs rowScanner) (img common.ImageCommon, err error) {
 	var scanner imageScanner
 	err = rs.Scan(scanner.ScanArgs()...)
@@ -93,13 +251,17 @@ func UseImageToken(tx *sql.Tx, token string) (
 
 // AllocateImage allocates an image's file resources to their respective served
 // directories and write its data to the database
-func AllocateImage(src, thumb []byte, img common.ImageCommon) error {
-	err := assets.Write(img.SHA1, img.FileType, img.ThumbType, src, thumb)
+func AllocateImage(
+	src []byte,
+	thumbs assets.Thumbnails,
+	img common.ImageCommon,
+) error {
+	err := assets.Write(img.SHA1, img.FileType, img.ThumbType, src, thumbs)
 	if err != nil {
 		return cleanUpFailedAllocation(img, err)
 	}
 
-	err = WriteImage(nil, img)
+	err = writeImage(nil, img, thumbs.Size())
 	if err != nil {
 		return cleanUpFailedAllocation(img, err)
 	}
@@ -115,6 +277,60 @@ func cleanUpFailedAllocation(img common.ImageCommon, err error) error {
 	return err
 }
 
+// GetStorageUsage returns the disk space used by the files referenced by the
+// posts of each board and the server in total
+func GetStorageUsage() (rep common.StorageReport, err error) {
+	r, err := prepared["get_storage_usage"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	rep.Boards = make([]common.StorageUsage, 0, 16)
+	for r.Next() {
+		var u common.StorageUsage
+		err = r.Scan(
+			&u.Board, &u.Files, &u.References, &u.SourceSize, &u.ThumbSize,
+			&u.DedupSavings,
+		)
+		if err != nil {
+			return
+		}
+		rep.Boards = append(rep.Boards, u)
+	}
+	err = r.Err()
+	if err != nil {
+		return
+	}
+
+	t := &rep.Total
+	err = prepared["get_total_storage_usage"].
+		QueryRow().
+		Scan(
+			&t.Files, &t.References, &t.SourceSize, &t.ThumbSize,
+			&t.DedupSavings,
+		)
+	return
+}
+
+// BoardStorageWithFile returns the disk space in bytes, that the files
+// referenced by the posts of a board would use, if the file with the passed
+// SHA1 hash was posted on the board. The board is locked for further quota
+// checks until tx is committed, so concurrent posts can not exceed the quota
+// together.
+func BoardStorageWithFile(tx *sql.Tx, board, SHA1 string) (
+	size uint64, err error,
+) {
+	_, err = getStatement(tx, "lock_board_storage").Exec(board)
+	if err != nil {
+		return
+	}
+	err = getStatement(tx, "get_board_storage_with_file").
+		QueryRow(board, SHA1).
+		Scan(&size)
+	return
+}
+
 // HasImage returns, if the post has an image allocated. Only used in tests.
 func HasImage(id uint64) (has bool, err error) {
 	err = db.
@@ -132,11 +348,45 @@ func HasImage(id uint64) (has bool, err error) {
 
 // InsertImage insert and image into and existing open post
 func InsertImage(tx *sql.Tx, id uint64, img common.Image) error {
-	_, err := getStatement(tx, "insert_image").Exec(id, img.SHA1, img.Name)
+	_, err := getStatement(tx, "insert_image").
+		Exec(id, img.SHA1, img.Name, img.SpoilerCategory)
 	return err
 }
 
-// SpoilerImage spoilers an already allocated image
-func SpoilerImage(id uint64) error {
-	return execPrepared("spoiler_image", id)
+// InsertPostImage inserts an additional image into an existing open post.
+// index is the position of the image in the post's attachments, starting at 1.
+func InsertPostImage(tx *sql.Tx, id uint64, index int, img common.Image) error {
+	_, err := getStatement(tx, "insert_post_image").
+		Exec(id, index, img.SHA1, img.Name, img.SpoilerCategory)
+	return err
+}
+
+// SpoilerImage spoilers an already allocated image with the specified spoiler
+// category
+func SpoilerImage(id uint64, category uint8) error {
+	return execPrepared("spoiler_image", id, category)
+}
+
+// IsBannedFile returns, if a file has been banned by its SHA1 or MD5 hash
+func IsBannedFile(SHA1, MD5 string) (banned bool, err error) {
+	err = prepared["is_banned_file"].QueryRow(SHA1, MD5).Scan(&banned)
+	return
+}
+
+// IsBlockedImage returns, if an image is on the blocklist of the board or the
+// global blocklist. Images match either by exact SHA1 hash or, if they have a
+// perceptual hash, when it is within the configured Hamming distance of a
+// blocked one. The distance is computed by the database. Images stored before
+// perceptual hashing was introduced have no hash and only match exactly. Pass
+// "all" to check only the global blocklist.
+func IsBlockedImage(board string, img common.ImageCommon) (
+	blocked bool, err error,
+) {
+	err = prepared["is_blocked_image"].
+		QueryRow(
+			board, img.SHA1, phashArg(img.PHash),
+			config.Get().BlockedImageDistance,
+		).
+		Scan(&blocked)
+	return
 }
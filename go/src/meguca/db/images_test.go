@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"io/ioutil"
 	"meguca/common"
+	"meguca/config"
 	"meguca/imager/assets"
 	. "meguca/test"
 	"testing"
+	"time"
 )
 
 func TestGetImage(t *testing.T) {
@@ -32,6 +34,161 @@ func TestGetImage(t *testing.T) {
 	})
 }
 
+func TestImageAliases(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	std := assets.StdJPEG.ImageCommon
+	alias := GenString(40)
+	if err := WriteImageAlias(alias, std.SHA1); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name, SHA1 string
+		err        error
+	}{
+		{"stored hash", std.SHA1, nil},
+		{"alias", alias, nil},
+		{"nonexistent", GenString(40), sql.ErrNoRows},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := GetImageByUploadHash(c.SHA1)
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+			if c.err == nil {
+				AssertDeepEquals(t, img, std)
+			}
+		})
+	}
+}
+
+func TestUpdateThumbnails(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	std := assets.StdJPEG.ImageCommon
+	std.ThumbType = common.PNG
+	std.Dims = [4]uint16{0x43c, 0x371, 0xc8, 0xa1}
+	std.Dims2x = [2]uint16{0x190, 0x142}
+	std.CatalogDims = [2]uint16{0x64, 0x50}
+	std.PHash = 1 << 40
+	if err := UpdateThumbnails(std, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	var images []common.ImageCommon
+	err := ForEachImage(func(img common.ImageCommon) error {
+		images = append(images, img)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, images, []common.ImageCommon{std})
+}
+
+func TestSetTranscoded(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	if err := SetTranscoded(assets.StdJPEG.SHA1, 1024); err != nil {
+		t.Fatal(err)
+	}
+	img, err := GetImage(assets.StdJPEG.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, img.Transcoded, true)
+}
+
+func TestTranscodeQueue(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	// Queueing twice is a no-op
+	for i := 0; i < 2; i++ {
+		if err := QueueTranscode(assets.StdJPEG.SHA1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := GetQueuedTranscodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, images, []common.ImageCommon{assets.StdJPEG.ImageCommon})
+
+	if err := DequeueTranscode(assets.StdJPEG.SHA1); err != nil {
+		t.Fatal(err)
+	}
+	images, err = GetQueuedTranscodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, len(images), 0)
+}
+
+func TestQueueUntranscoded(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	video := assets.StdJPEG.ImageCommon
+	video.SHA1 = GenString(40)
+	video.MD5 = GenString(22)
+	video.FileType = common.WEBM
+	video.Video = true
+	if err := WriteImage(nil, video); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := QueueUntranscoded([]uint8{common.WEBM, common.MP4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, n, int64(1))
+	images, err := GetQueuedTranscodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, images, []common.ImageCommon{video})
+}
+
+func TestArchiveContents(t *testing.T) {
+	assertTableClear(t, "images")
+
+	std := common.ImageCommon{
+		FileType:  common.ZIP,
+		ThumbType: common.NoFile,
+		Size:      1 << 10,
+		MD5:       GenString(22),
+		SHA1:      GenString(40),
+		Contents: &common.ArchiveContents{
+			Truncated: true,
+			Files: []common.ArchiveFile{
+				{
+					Name: "a/b.txt",
+					Size: 3,
+				},
+			},
+		},
+	}
+	if err := WriteImage(nil, std); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := GetImage(std.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, img, std)
+}
+
 func writeSampleImage(t *testing.T) {
 	t.Helper()
 	if err := WriteImage(nil, assets.StdJPEG.ImageCommon); err != nil {
@@ -66,7 +223,8 @@ func TestAllocateImage(t *testing.T) {
 		FileType: common.JPEG,
 	}
 
-	if err := AllocateImage(files[0], files[1], std); err != nil {
+	err := AllocateImage(files[0], assets.Thumbnails{files[1]}, std)
+	if err != nil {
 		t.Fatal(err)
 	}
 
@@ -125,3 +283,479 @@ func TestImageTokens(t *testing.T) {
 		LogUnexpected(t, img, std)
 	}
 }
+
+func TestBanFile(t *testing.T) {
+	assertTableClear(t, "boards", "images", "banned_files")
+	defer setupImageDirs(t)()
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	thread := Thread{
+		ID:       1,
+		Board:    "a",
+		ImageCtr: 2,
+	}
+	posts := [...]Post{
+		{
+			StandalonePost: common.StandalonePost{
+				Post: common.Post{
+					ID:    1,
+					Image: &assets.StdJPEG,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+		{
+			StandalonePost: common.StandalonePost{
+				Post: common.Post{
+					ID:    2,
+					Image: &assets.StdJPEG,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+	}
+	if err := WriteThread(nil, thread, posts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePost(nil, posts[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BanFile(2, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range [...]uint64{1, 2} {
+		has, err := HasImage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			t.Fatalf("post %d still has image", id)
+		}
+	}
+	if _, err := GetImage(assets.StdJPEG.SHA1); err != sql.ErrNoRows {
+		UnexpectedError(t, err)
+	}
+	_, imageCtr, err := GetThreadCounters(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, imageCtr, uint(0))
+
+	cases := [...]struct {
+		name, SHA1, MD5 string
+		banned          bool
+	}{
+		{"by SHA1", assets.StdJPEG.SHA1, "", true},
+		{"by MD5", GenString(40), assets.StdJPEG.MD5, true},
+		{"not banned", GenString(40), GenString(22), false},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			banned, err := IsBannedFile(c.SHA1, c.MD5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, banned, c.banned)
+		})
+	}
+}
+
+func TestInsertPostImage(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	thread := Thread{
+		ID:    1,
+		Board: "a",
+	}
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:      1,
+				Editing: true,
+				Image:   &assets.StdJPEG,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	}
+	if err := WriteThread(nil, thread, op); err != nil {
+		t.Fatal(err)
+	}
+
+	_, before, err := GetThreadCounters(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extra := assets.StdJPEG
+	extra.Name = "second.jpg"
+	extra.SetSpoiler(common.SpoilerNSFW)
+	if err := InsertPostImage(nil, 1, 1, extra); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := GetPost(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, p.Images, []common.Image{extra})
+
+	_, after, err := GetThreadCounters(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, after, before+1)
+
+	t.Run("mod spoiler", func(t *testing.T) {
+		err := ModSpoilerImage(1, common.SpoilerGore, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := GetPost(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, p.Image.SpoilerCategory, common.SpoilerGore)
+		AssertDeepEquals(t, p.Images[0].SpoilerCategory, common.SpoilerGore)
+	})
+	t.Run("mod delete", func(t *testing.T) {
+		if err := DeleteImage(1, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := GetPost(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, len(p.Images), 0)
+	})
+}
+
+func TestGetImagePosts(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	thread := Thread{
+		ID:    1,
+		Board: "a",
+	}
+	posts := [...]Post{
+		{
+			StandalonePost: common.StandalonePost{
+				Post: common.Post{
+					ID:    1,
+					Image: &assets.StdJPEG,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+		{
+			StandalonePost: common.StandalonePost{
+				Post: common.Post{
+					ID: 2,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+		{
+			StandalonePost: common.StandalonePost{
+				Post: common.Post{
+					ID: 3,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+	}
+	if err := WriteThread(nil, thread, posts[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range posts[1:] {
+		if err := WritePost(nil, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only referenced in the additional images of a post
+	if err := InsertPostImage(nil, 2, 1, assets.StdJPEG); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := GetImagePosts(assets.StdJPEG.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []common.ImageBoardPosts{
+		{
+			Board: "a",
+			Threads: []common.ImageThreadPosts{
+				{
+					ID:    1,
+					Posts: []uint64{1, 2},
+				},
+			},
+		},
+	}
+	AssertDeepEquals(t, res, std)
+
+	t.Run("deleted posts excluded", func(t *testing.T) {
+		if err := DeletePost(1, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		res, err := GetImagePosts(assets.StdJPEG.SHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		std[0].Threads[0].Posts = []uint64{2}
+		AssertDeepEquals(t, res, std)
+	})
+
+	t.Run("no posts", func(t *testing.T) {
+		res, err := GetImagePosts(GenString(40))
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, len(res), 0)
+	})
+}
+
+func TestStorageUsage(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	const (
+		thumbSize      = 100
+		transcodedSize = 1000
+	)
+	err := UpdateThumbnails(assets.StdJPEG.ImageCommon, thumbSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetTranscoded(assets.StdJPEG.SHA1, transcodedSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thread := Thread{
+		ID:    1,
+		Board: "a",
+	}
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:    1,
+				Image: &assets.StdJPEG,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	}
+	if err := WriteThread(nil, thread, op); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same file posted twice
+	if err := InsertPostImage(nil, 1, 1, assets.StdJPEG); err != nil {
+		t.Fatal(err)
+	}
+
+	size := uint64(assets.StdJPEG.Size) + transcodedSize
+	total := common.StorageUsage{
+		Files:        1,
+		References:   2,
+		SourceSize:   size,
+		ThumbSize:    thumbSize,
+		DedupSavings: size + thumbSize,
+	}
+	board := total
+	board.Board = "a"
+
+	rep, err := GetStorageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, rep, common.StorageReport{
+		Boards: []common.StorageUsage{board},
+		Total:  total,
+	})
+
+	cases := [...]struct {
+		name, board, SHA1 string
+		size              uint64
+	}{
+		{"file on board", "a", assets.StdJPEG.SHA1, size + thumbSize},
+		{"unknown file", "a", GenString(40), size + thumbSize},
+		{"empty board", "c", assets.StdJPEG.SHA1, size + thumbSize},
+		{"empty board and unknown file", "c", GenString(40), 0},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := BoardStorageWithFile(nil, c.board, c.SHA1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, res, c.size)
+		})
+	}
+}
+
+func TestSetStorageSizes(t *testing.T) {
+	assertTableClear(t, "images")
+	writeSampleImage(t)
+
+	err := SetStorageSizes(assets.StdJPEG.SHA1, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := BoardStorageWithFile(nil, "a", assets.StdJPEG.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, size, uint64(assets.StdJPEG.Size)+1100)
+}
+
+func TestBlockImage(t *testing.T) {
+	assertTableClear(t, "boards", "images", "blocked_images")
+	writeSampleBoard(t)
+	config.Set(config.Configs{
+		BlockedImageDistance: 2,
+	})
+	defer config.Set(config.Configs{})
+
+	img := assets.StdJPEG
+	img.PHash = 0xff
+	if err := WriteImage(nil, img.ImageCommon); err != nil {
+		t.Fatal(err)
+	}
+	thread := Thread{
+		ID:    1,
+		Board: "a",
+	}
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:    1,
+				Time:  time.Now().Unix(),
+				Image: &img,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	}
+	if err := WriteThread(nil, thread, op); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BlockImage("a", 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	// Blocking twice is a no-op
+	if err := BlockImage("a", 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := GenString(40)
+	cases := [...]struct {
+		name, board, SHA1 string
+		phash             uint64
+		blocked           bool
+	}{
+		{"same SHA1", "a", img.SHA1, 0, true},
+		{"other board", "c", img.SHA1, 0xff, false},
+		{"similar phash", "a", other, 0xfc, true},
+		{"distant phash", "a", other, 0xf0, false},
+		{"no phash", "a", other, 0, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			blocked, err := IsBlockedImage(c.board, common.ImageCommon{
+				SHA1:  c.SHA1,
+				PHash: c.phash,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, blocked, c.blocked)
+		})
+	}
+
+	t.Run("global", func(t *testing.T) {
+		if err := BlockImage("all", 1, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		blocked, err := IsBlockedImage("c", img.ImageCommon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, blocked, true)
+	})
+}
+
+func TestBlockSecondImage(t *testing.T) {
+	assertTableClear(t, "boards", "images", "blocked_images")
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	second := assets.StdJPEG
+	second.SHA1 = GenString(40)
+	second.MD5 = GenString(22)
+	second.PHash = 0xff
+	if err := WriteImage(nil, second.ImageCommon); err != nil {
+		t.Fatal(err)
+	}
+	thread := Thread{
+		ID:    1,
+		Board: "a",
+	}
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:    1,
+				Time:  time.Now().Unix(),
+				Image: &assets.StdJPEG,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	}
+	if err := WriteThread(nil, thread, op); err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertPostImage(nil, 1, 1, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BlockImage("a", 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, SHA1 := range [...]string{assets.StdJPEG.SHA1, second.SHA1} {
+		blocked, err := IsBlockedImage("a", common.ImageCommon{
+			SHA1: SHA1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blocked {
+			t.Fatalf("image not blocked: %s", SHA1)
+		}
+	}
+}
@@ -293,6 +293,343 @@ var upgrades = []func(*sql.Tx) error{
 		)
 		return
 	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE threads
+				ADD COLUMN cyclical bool default false,
+				ADD COLUMN cyclicalCap bigint not null default 0`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN bumpLimit bigint not null default 3000,
+				ADD COLUMN imageLimit bigint not null default 0,
+				ADD COLUMN postLimit bigint not null default 0`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN threadsPerPage bigint not null default 15`,
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`ALTER TABLE boards
+				ADD COLUMN css varchar(10000) default ''`,
+			`create table themes (
+				id text primary key,
+				data bytea not null
+			)`,
+		)
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`create table flags (
+				board text not null references boards on delete cascade,
+				id smallint not null,
+				name varchar(20) not null,
+				data bytea not null,
+				mime text not null
+			)`,
+			`ALTER TABLE posts
+				ALTER COLUMN flag TYPE varchar(30)`,
+
+			// Parameter type changed. Recreated on server start.
+			`DROP FUNCTION IF EXISTS insert_thread(
+				varchar, bool, bigint, bool, bool, bigint, text, bigint, bigint,
+				varchar, char, text, varchar, char, varchar, bytea, inet, char,
+				varchar, bigint[], json[]
+			)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN disabledMarkup text[] not null default '{}'`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN math bool default false`,
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`create table link_previews (
+				id char(40) primary key,
+				url text not null,
+				title varchar(200) not null,
+				description varchar(500) not null,
+				thumbnail bytea,
+				thumbnailMime text,
+				expires timestamp not null
+			)`,
+			`create index link_previews_expires on link_previews (expires)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`create table filter_profiles (
+				token char(43) primary key,
+				data json not null,
+				expires timestamp not null
+			)`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		err = execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN phash bigint`,
+			`create table blocked_images (
+				board text not null,
+				SHA1 char(40) not null,
+				phash bigint,
+				by varchar(20) not null,
+				created timestamp default (now() at time zone 'utc'),
+				primary key (board, SHA1)
+			)`,
+		)
+		if err != nil {
+			return
+		}
+
+		// Set default blocked image distance
+		var s string
+		err = tx.QueryRow("SELECT val FROM main WHERE id = 'config'").Scan(&s)
+		if err != nil {
+			return
+		}
+		conf, err := decodeConfigs(s)
+		if err != nil {
+			return
+		}
+		conf.BlockedImageDistance = config.Defaults.BlockedImageDistance
+		buf, err := json.Marshal(conf)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(
+			`UPDATE main
+				SET val = $1
+				WHERE id = 'config'`,
+			string(buf),
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`create table banned_files (
+				SHA1 char(40) primary key,
+				MD5 char(22) not null,
+				by varchar(20) not null,
+				created timestamp default (now() at time zone 'utc')
+			)`,
+			`create index banned_files_MD5 on banned_files (MD5)`,
+		)
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`ALTER TABLE boards
+				ADD COLUMN maxFiles bigint not null default 1`,
+			`create table post_images (
+				id bigint not null references posts on delete cascade,
+				index smallint not null,
+				SHA1 char(40) not null references images on delete cascade,
+				name varchar(200) not null,
+				spoiler bool not null default false,
+				primary key (id, index)
+			)`,
+			`create index post_images_SHA1 on post_images (SHA1)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN allowedTypes text[] not null default '{}'`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN maxSize bigint not null default 0`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`create table chunked_uploads (
+				id char(32) primary key,
+				board text not null,
+				SHA1 char(40) not null,
+				size bigint not null,
+				received bigint not null default 0,
+				expires timestamp not null
+			)`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE boards
+				ADD COLUMN stripMetadata text not null default 'default',
+				ADD COLUMN hideFileNames bool not null default false`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE images
+				ADD COLUMN contents json`,
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`ALTER TABLE posts
+				ALTER COLUMN spoiler TYPE smallint
+					USING CASE WHEN spoiler THEN 1 ELSE 0 END`,
+			`ALTER TABLE post_images
+				ALTER COLUMN spoiler DROP DEFAULT,
+				ALTER COLUMN spoiler TYPE smallint
+					USING CASE WHEN spoiler THEN 1 ELSE 0 END,
+				ALTER COLUMN spoiler SET DEFAULT 0`,
+			`create table spoilers (
+				board text not null references boards on delete cascade,
+				category smallint not null,
+				data bytea not null,
+				mime text not null,
+				primary key (board, category)
+			)`,
+
+			// Parameter type changed. Recreated on server start.
+			`DROP FUNCTION IF EXISTS insert_thread(
+				varchar, bool, bigint, bool, bool, bigint, text, bigint, bigint,
+				varchar, varchar, text, varchar, char, varchar, bytea, inet,
+				char, varchar, bigint[], json[]
+			)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		err = execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN dims2x smallint[2],
+				ADD COLUMN catalogDims smallint[2]`,
+		)
+		if err != nil {
+			return
+		}
+
+		// Set default thumbnail dimensions
+		var s string
+		err = tx.QueryRow("SELECT val FROM main WHERE id = 'config'").Scan(&s)
+		if err != nil {
+			return
+		}
+		conf, err := decodeConfigs(s)
+		if err != nil {
+			return
+		}
+		conf.ThumbWidth = config.Defaults.ThumbWidth
+		conf.ThumbHeight = config.Defaults.ThumbHeight
+		conf.CatalogThumbWidth = config.Defaults.CatalogThumbWidth
+		conf.CatalogThumbHeight = config.Defaults.CatalogThumbHeight
+		buf, err := json.Marshal(conf)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(
+			`UPDATE main
+				SET val = $1
+				WHERE id = 'config'`,
+			string(buf),
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(
+			`ALTER TABLE images
+				ADD COLUMN transcoded bool not null default false`,
+		)
+		return
+	},
+	func(tx *sql.Tx) (err error) {
+		err = execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN thumbSize bigint not null default 0`,
+			`ALTER TABLE boards
+				ADD COLUMN storageQuota bigint not null default 0`,
+		)
+		if err != nil {
+			return
+		}
+
+		// Reading file sizes from disk inside the migration transaction would
+		// lock the images table for the duration and depend on the working
+		// directory. Done by a separate command instead.
+		log.Println(
+			"storage usage of existing files not recorded: " +
+				"run `meguca recount-storage` with the server stopped",
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		// Existing posts are rendered without the markup types introduced
+		// with disabledMarkup
+		return execAll(tx,
+			`ALTER TABLE boards
+				ADD COLUMN markupSince bigint not null default 0`,
+			`UPDATE boards
+				SET markupSince = floor(extract(epoch from now()))`,
+		)
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`ALTER TABLE chunked_uploads
+				ADD COLUMN ip inet`,
+			`create index chunked_uploads_ip on chunked_uploads (ip)`,
+		)
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`create table image_aliases (
+				SHA1 char(40) primary key,
+				image char(40) not null references images on delete cascade
+			)`,
+			`create index image_aliases_image on image_aliases (image)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		err = execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN transcodedSize bigint not null default 0`,
+			`create table transcode_queue (
+				SHA1 char(40) primary key references images on delete cascade
+			)`,
+		)
+
+		// Transcoding all existing videos on the next start could take a long
+		// time. Done by a separate command instead, if wanted.
+		log.Println(
+			"existing videos not queued for transcoding: " +
+				"run `meguca queue-transcodes` to transcode them",
+		)
+		return
+	},
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			`create index posts_board on posts (board)`,
+		)
+	},
 }
 
 // LoadDB establishes connections to RethinkDB and Redis and bootstraps both
@@ -323,7 +660,8 @@ func LoadDB() (err error) {
 		func() error {
 			tasks := []func() error{
 				openBoltDB, loadConfigs, loadBoardConfigs, loadBans,
-				loadBanners, loadLoadingAnimations,
+				loadBanners, loadLoadingAnimations, loadThemes, loadFlags,
+				loadSpoilers,
 			}
 			if !exists {
 				tasks = append(tasks, CreateAdminAccount)
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"meguca/common"
+	"meguca/config"
 	"strconv"
 
 	"github.com/lib/pq"
@@ -209,10 +210,12 @@ func NewPostID(tx *sql.Tx) (id uint64, err error) {
 	return id, err
 }
 
-// InsertPost inserts a post into an existing thread.
+// InsertPost inserts a post into an existing thread. The thread is not bumped,
+// if the post is saged or the board's bump limit has been reached.
 func InsertPost(tx *sql.Tx, p Post, sage bool) error {
+	bumpLimit := config.GetBoardConfigs(p.Board).BumpLimit
 	_, err := getStatement(tx, "insert_post").
-		Exec(append(genPostCreationArgs(p), sage)...)
+		Exec(append(genPostCreationArgs(p), sage, bumpLimit)...)
 	return err
 }
 
@@ -220,7 +223,7 @@ func genPostCreationArgs(p Post) []interface{} {
 	// Don't store empty strings in the database. Zero value != NULL.
 	var (
 		name, trip, auth, img, imgName, ip, flag, posterID *string
-		spoiler                                            bool
+		spoiler                                            uint8
 	)
 	if p.Name != "" {
 		name = &p.Name
@@ -243,7 +246,7 @@ func genPostCreationArgs(p Post) []interface{} {
 	if p.Image != nil {
 		img = &p.Image.SHA1
 		imgName = &p.Image.Name
-		spoiler = p.Image.Spoiler
+		spoiler = p.Image.SpoilerCategory
 	}
 
 	return []interface{}{
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"meguca/assets"
+	"meguca/common"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetLinkPreview retrieves an unexpired link preview by the hex-encoded SHA1
+// hash of its URL
+func GetLinkPreview(id string) (p common.LinkPreview, err error) {
+	err = prepared["get_link_preview"].
+		QueryRow(id).
+		Scan(&p.Title, &p.Description, &p.Thumbnail)
+	p.ID = id
+	return
+}
+
+// GetLinkPreviews retrieves all unexpired link previews with the passed
+// hex-encoded SHA1 hashes of their URLs in one query
+func GetLinkPreviews(ids []string) (p []common.LinkPreview, err error) {
+	r, err := prepared["get_link_previews"].Query(pq.StringArray(ids))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	var lp common.LinkPreview
+	for r.Next() {
+		err = r.Scan(&lp.ID, &lp.Title, &lp.Description, &lp.Thumbnail)
+		if err != nil {
+			return
+		}
+		p = append(p, lp)
+	}
+	err = r.Err()
+	return
+}
+
+// WriteLinkPreview writes or overwrites a link preview and its optional
+// thumbnail, that expires after ttl
+func WriteLinkPreview(
+	url string,
+	p common.LinkPreview,
+	thumb assets.File,
+	ttl time.Duration,
+) error {
+	var data, mime interface{}
+	if thumb.Data != nil {
+		data = thumb.Data
+		mime = thumb.Mime
+	}
+	return execPrepared(
+		"write_link_preview",
+		p.ID, url, p.Title, p.Description, data, mime, time.Now().Add(ttl),
+	)
+}
+
+// GetLinkPreviewThumbnail retrieves the thumbnail of a link preview
+func GetLinkPreviewThumbnail(id string) (f assets.File, err error) {
+	err = prepared["get_link_preview_thumbnail"].
+		QueryRow(id).
+		Scan(&f.Data, &f.Mime)
+	return
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"meguca/assets"
+	"meguca/common"
+	. "meguca/test"
+)
+
+func TestGetLinkPreviews(t *testing.T) {
+	assertTableClear(t, "link_previews")
+
+	std := common.LinkPreview{
+		ID:    "a",
+		Title: "foo",
+	}
+	err := WriteLinkPreview("https://a.com", std, assets.File{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := common.LinkPreview{
+		ID:    "b",
+		Title: "bar",
+	}
+	err = WriteLinkPreview("https://b.com", expired, assets.File{}, -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := GetLinkPreviews([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, res, []common.LinkPreview{std})
+}
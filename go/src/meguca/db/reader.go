@@ -11,10 +11,17 @@ import (
 )
 
 type imageScanner struct {
-	APNG, Audio, Video, Spoiler       sql.NullBool
+	APNG, Audio, Video                sql.NullBool
 	FileType, ThumbType, Length, Size sql.NullInt64
 	Name, SHA1, MD5, Title, Artist    sql.NullString
 	Dims                              pq.Int64Array
+	PHash                             sql.NullInt64
+	Contents                          contentsRow
+	Dims2x, CatalogDims               pq.Int64Array
+	Transcoded                        sql.NullBool
+
+	// Only used for storage accounting and not part of common.Image
+	ThumbSize, TranscodedSize sql.NullInt64
 }
 
 // Returns and array of pointers to the struct fields for passing to
@@ -22,7 +29,9 @@ type imageScanner struct {
 func (i *imageScanner) ScanArgs() []interface{} {
 	return []interface{}{
 		&i.APNG, &i.Audio, &i.Video, &i.FileType, &i.ThumbType, &i.Dims,
-		&i.Length, &i.Size, &i.MD5, &i.SHA1, &i.Title, &i.Artist,
+		&i.Length, &i.Size, &i.MD5, &i.SHA1, &i.Title, &i.Artist, &i.PHash,
+		&i.Contents, &i.Dims2x, &i.CatalogDims, &i.Transcoded, &i.ThumbSize,
+		&i.TranscodedSize,
 	}
 }
 
@@ -38,28 +47,44 @@ func (i *imageScanner) Val() *common.Image {
 	}
 
 	return &common.Image{
-		Spoiler: i.Spoiler.Bool,
 		ImageCommon: common.ImageCommon{
-			APNG:      i.APNG.Bool,
-			Audio:     i.Audio.Bool,
-			Video:     i.Video.Bool,
-			FileType:  uint8(i.FileType.Int64),
-			ThumbType: uint8(i.ThumbType.Int64),
-			Length:    uint32(i.Length.Int64),
-			Dims:      dims,
-			Size:      int(i.Size.Int64),
-			MD5:       i.MD5.String,
-			SHA1:      i.SHA1.String,
-			Title:     i.Title.String,
-			Artist:    i.Artist.String,
+			APNG:        i.APNG.Bool,
+			Audio:       i.Audio.Bool,
+			Video:       i.Video.Bool,
+			FileType:    uint8(i.FileType.Int64),
+			ThumbType:   uint8(i.ThumbType.Int64),
+			Length:      uint32(i.Length.Int64),
+			Dims:        dims,
+			Dims2x:      renditionDims(i.Dims2x),
+			CatalogDims: renditionDims(i.CatalogDims),
+			Size:        int(i.Size.Int64),
+			MD5:         i.MD5.String,
+			SHA1:        i.SHA1.String,
+			Title:       i.Title.String,
+			Artist:      i.Artist.String,
+			PHash:       uint64(i.PHash.Int64),
+			Contents:    i.Contents.ArchiveContents,
+			Transcoded:  i.Transcoded.Bool,
 		},
 		Name: i.Name.String,
 	}
 }
 
+// Convert the dimensions of a thumbnail rendition. NULL for images thumbnailed
+// before renditions were introduced.
+func renditionDims(arr pq.Int64Array) (dims [2]uint16) {
+	if len(arr) == len(dims) {
+		for i := range dims {
+			dims[i] = uint16(arr[i])
+		}
+	}
+	return
+}
+
 type postScanner struct {
 	common.Post
-	banned, spoiler, deleted, sage              sql.NullBool
+	banned, deleted, sage                       sql.NullBool
+	spoiler                                     sql.NullInt64
 	name, trip, auth, imageName, flag, posterID sql.NullString
 	links                                       linkRow
 	commands                                    commandRow
@@ -88,17 +113,20 @@ func (p postScanner) Val() (common.Post, error) {
 	return p.Post, nil
 }
 
-// Returns if image is spoiled and it's assigned name, if any
-func (p postScanner) Image() (bool, string) {
-	return p.spoiler.Bool, p.imageName.String
+// Sets the spoiler category and assigned name of the post's image
+func (p postScanner) setImage(img *common.Image) {
+	img.SetSpoiler(uint8(p.spoiler.Int64))
+	img.Name = p.imageName.String
 }
 
 // PostStats contains post open status, body and creation time
 type PostStats struct {
-	Editing, HasImage, Spoilered bool
-	ID                           uint64
-	Time                         int64
-	Body                         []byte
+	Editing, HasImage bool
+	Spoiler           uint8
+	ExtraImages       int
+	ID                uint64
+	Time              int64
+	Body              []byte
 }
 
 // GetThread retrieves public thread data from the database
@@ -161,14 +189,21 @@ func GetThread(id uint64, lastN int) (t common.Thread, err error) {
 		return
 	}
 
+	all := make([]*common.Post, 0, len(t.Posts)+1)
+	all = append(all, &t.Post)
+	for i := range t.Posts {
+		all = append(all, &t.Posts[i])
+	}
+	err = injectExtraImages(tx, all)
+	if err != nil {
+		return
+	}
+
 	// Inject bodies into open posts
 	open := make([]*common.Post, 0, 32)
-	if t.Editing {
-		open = append(open, &t.Post)
-	}
-	for i := range t.Posts {
-		if t.Posts[i].Editing {
-			open = append(open, &t.Posts[i])
+	for _, p := range all {
+		if p.Editing {
+			open = append(open, p)
 		}
 	}
 	err = injectOpenBodies(open)
@@ -182,10 +217,10 @@ func scanOP(r rowScanner) (t common.Thread, err error) {
 		img  imageScanner
 	)
 
-	args := make([]interface{}, 0, 37)
+	args := make([]interface{}, 0, 38)
 	args = append(args,
 		&t.Sticky, &t.Board, &t.PostCtr, &t.ImageCtr, &t.ReplyTime, &t.BumpTime,
-		&t.Subject, &t.NonLive, &t.Locked,
+		&t.Subject, &t.NonLive, &t.Locked, &t.Cyclical,
 	)
 	args = append(args, post.ScanArgs()...)
 	args = append(args, img.ScanArgs()...)
@@ -205,7 +240,7 @@ func extractPost(ps postScanner, is imageScanner) (p common.Post, err error) {
 	}
 	p.Image = is.Val()
 	if p.Image != nil {
-		p.Image.Spoiler, p.Image.Name = ps.Image()
+		ps.setImage(p.Image)
 	}
 	return
 }
@@ -232,7 +267,11 @@ func GetPost(id uint64) (res common.StandalonePost, err error) {
 	}
 	res.Image = img.Val()
 	if res.Image != nil {
-		res.Image.Spoiler, res.Image.Name = post.Image()
+		post.setImage(res.Image)
+	}
+	err = injectExtraImages(nil, []*common.Post{&res.Post})
+	if err != nil {
+		return
 	}
 
 	if res.Editing {
@@ -258,9 +297,10 @@ func GetBoardCatalog(board string) (b common.Board, err error) {
 	return
 }
 
-// Retrieves all threads IDs on the board in bump order with stickies first
-func GetThreadIDs(board string) ([]uint64, error) {
-	r, err := prepared["get_board_thread_ids"].Query(board)
+// Retrieves all threads IDs on the board in the specified order with stickies
+// first
+func GetThreadIDs(board string, sort common.SortMode) ([]uint64, error) {
+	r, err := prepared["get_board_thread_ids"].Query(board, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -290,9 +330,9 @@ func GetAllBoardCatalog() (threads common.Board, err error) {
 	return
 }
 
-// Retrieves all threads IDs in bump order
-func GetAllThreadsIDs() ([]uint64, error) {
-	r, err := prepared["get_all_thread_ids"].Query()
+// Retrieves all threads IDs in the specified order
+func GetAllThreadsIDs(sort common.SortMode) ([]uint64, error) {
+	r, err := prepared["get_all_thread_ids"].Query(sort)
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +351,10 @@ func GetRecentPosts(op uint64) (posts []PostStats, err error) {
 	posts = make([]PostStats, 0, 64)
 	var p PostStats
 	for r.Next() {
-		err = r.Scan(&p.ID, &p.Time, &p.Editing, &p.HasImage, &p.Spoilered)
+		err = r.Scan(
+			&p.ID, &p.Time, &p.Editing, &p.HasImage, &p.Spoiler,
+			&p.ExtraImages,
+		)
 		if err != nil {
 			return
 		}
@@ -421,6 +464,48 @@ func scanThreadIDs(table tableScanner) (ids []uint64, err error) {
 	return
 }
 
+// Inject any additional images past the first one into posts
+func injectExtraImages(tx *sql.Tx, posts []*common.Post) (err error) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make(pq.Int64Array, len(posts))
+	byID := make(map[uint64]*common.Post, len(posts))
+	for i, p := range posts {
+		ids[i] = int64(p.ID)
+		byID[p.ID] = p
+	}
+
+	r, err := getStatement(tx, "get_post_images").Query(ids)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	var (
+		id      uint64
+		spoiler uint8
+		name    string
+		img     imageScanner
+		args    = append([]interface{}{&id, &spoiler, &name}, img.ScanArgs()...)
+	)
+	for r.Next() {
+		err = r.Scan(args...)
+		if err != nil {
+			return
+		}
+		p := byID[id]
+		if p == nil {
+			continue
+		}
+		i := img.Val()
+		i.SetSpoiler(spoiler)
+		i.Name = name
+		p.Images = append(p.Images, *i)
+	}
+	return r.Err()
+}
+
 // Inject open post bodies from the embedded database into the posts
 func injectOpenBodies(posts []*common.Post) error {
 	if len(posts) == 0 {
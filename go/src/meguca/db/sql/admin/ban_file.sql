@@ -0,0 +1,3 @@
+insert into banned_files (SHA1, MD5, by)
+	values ($1, $2, $3)
+	on conflict do nothing
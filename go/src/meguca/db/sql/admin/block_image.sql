@@ -0,0 +1,19 @@
+with files as (
+	select SHA1
+		from posts
+		where id = $1 and SHA1 is not null
+	union
+	select SHA1
+		from post_images
+		where id = $1
+)
+insert into blocked_images (board, SHA1, phash, by)
+	select $2, i.SHA1, i.phash, $3
+		from files as f
+		inner join images as i
+			on i.SHA1 = f.SHA1
+	on conflict do nothing
+	returning log_moderation(
+		9::smallint, (select board from posts where id = $1), $1,
+		$3::varchar(20)
+	)
@@ -1,3 +1,7 @@
+with extra as (
+	delete from post_images
+		where id = $1
+)
 update posts
 	set SHA1 = null
 	where id = $1
@@ -0,0 +1,29 @@
+with extra as (
+	delete from post_images
+		where SHA1 = $1
+		returning id
+),
+main as (
+	update posts
+		set SHA1 = null,
+			imageName = null,
+			spoiler = null
+		where SHA1 = $1
+		returning id, op
+),
+counters as (
+	update threads as t
+		set imageCtr = greatest(t.imageCtr - m.count, 0)
+		from (
+			select op, count(*) as count
+				from main
+				group by op
+		) as m
+		where t.id = m.op
+)
+select id, op, true from main
+union all
+select p.id, p.op, false
+	from extra
+	inner join posts as p
+		on p.id = extra.id
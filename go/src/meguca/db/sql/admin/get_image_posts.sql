@@ -0,0 +1,11 @@
+select p.board, p.op, p.id
+	from posts as p
+	where p.deleted is not true
+		and (
+			p.SHA1 = $1
+			or exists (
+				select 1 from post_images as pi
+					where pi.id = p.id and pi.SHA1 = $1
+			)
+		)
+	order by p.board, p.op, p.id
@@ -0,0 +1,7 @@
+select *
+	from images
+	where SHA1 in (
+		select SHA1 from posts where id = $1
+		union
+		select SHA1 from post_images where id = $1
+	)
@@ -0,0 +1,23 @@
+with refs as (
+	select board, SHA1
+		from posts
+		where SHA1 is not null
+	union all
+	select p.board, pi.SHA1
+		from post_images as pi
+		inner join posts as p
+			on p.id = pi.id
+),
+files as (
+	select board, SHA1, count(*) as refs
+		from refs
+		group by board, SHA1
+)
+select f.board, count(*), sum(f.refs)::bigint,
+		sum(i.size + i.transcodedSize)::bigint, sum(i.thumbSize)::bigint,
+		sum((f.refs - 1) * (i.size + i.transcodedSize + i.thumbSize))::bigint
+	from files as f
+	inner join images as i
+		on i.SHA1 = f.SHA1
+	group by f.board
+	order by f.board
@@ -0,0 +1,23 @@
+with refs as (
+	select SHA1
+		from posts
+		where SHA1 is not null
+	union all
+	select SHA1
+		from post_images
+),
+files as (
+	select SHA1, count(*) as refs
+		from refs
+		group by SHA1
+)
+select count(*), coalesce(sum(f.refs), 0)::bigint,
+		coalesce(sum(i.size + i.transcodedSize), 0)::bigint,
+		coalesce(sum(i.thumbSize), 0)::bigint,
+		coalesce(
+			sum((f.refs - 1) * (i.size + i.transcodedSize + i.thumbSize)),
+			0
+		)::bigint
+	from files as f
+	inner join images as i
+		on i.SHA1 = f.SHA1
@@ -0,0 +1,3 @@
+select log_moderation(10::smallint, board, id, $2::varchar(20))
+	from posts
+	where id = $1
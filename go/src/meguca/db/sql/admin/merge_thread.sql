@@ -0,0 +1,14 @@
+with moved as (
+	update posts
+		set op = $2,
+			board = (select board from threads where id = $2)
+		where op = $1
+		returning SHA1
+)
+update threads
+	set postCtr = postCtr + (select count(*) from moved),
+		imageCtr = imageCtr
+			+ (select count(*) from moved where SHA1 is not null)
+	where id = $2
+	returning log_moderation(7::smallint, board, $1, $3),
+		bump_thread($2, false, false, false)
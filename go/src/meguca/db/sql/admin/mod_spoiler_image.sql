@@ -1,5 +1,10 @@
+with extra as (
+	update post_images
+		set spoiler = $3
+		where id = $1
+)
 update posts
-	set spoiler = true
+	set spoiler = $3
 	where id = $1
 	returning log_moderation(4::smallint, board, $1, $2),
 		bump_thread(op, false, false, false)
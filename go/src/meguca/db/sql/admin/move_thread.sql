@@ -0,0 +1,10 @@
+with moved as (
+	update posts
+		set board = $2
+		where op = $1
+)
+update threads
+	set board = $2
+	where id = $1
+	returning log_moderation(6::smallint, board, $1, $3),
+		bump_thread($1, false, false, false)
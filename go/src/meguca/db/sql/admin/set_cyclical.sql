@@ -0,0 +1,5 @@
+update threads
+	set cyclical = $2, cyclicalCap = $3
+	where id = $1
+	returning log_moderation(8::smallint, board, $1, $4),
+		bump_thread($1, false, false, false)
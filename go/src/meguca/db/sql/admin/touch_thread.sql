@@ -0,0 +1 @@
+select bump_thread($1, false, false, false)
@@ -0,0 +1,2 @@
+delete from flags
+	where board = $1
@@ -0,0 +1,2 @@
+delete from spoilers
+	where board = $1
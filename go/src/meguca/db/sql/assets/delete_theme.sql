@@ -0,0 +1,3 @@
+delete from themes
+	where id = $1
+	returning pg_notify('themes_updated', $1)
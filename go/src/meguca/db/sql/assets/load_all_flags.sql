@@ -0,0 +1,3 @@
+select board, name, data, mime
+	from flags
+	order by board, id
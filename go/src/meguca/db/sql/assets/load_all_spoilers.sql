@@ -0,0 +1,2 @@
+select board, category, data, mime
+	from spoilers
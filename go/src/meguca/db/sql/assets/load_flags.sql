@@ -0,0 +1,4 @@
+select board, name, data, mime
+	from flags
+	where board = $1
+	order by id
@@ -0,0 +1,3 @@
+select board, category, data, mime
+	from spoilers
+	where board = $1
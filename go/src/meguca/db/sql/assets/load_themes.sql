@@ -0,0 +1,3 @@
+select id, data
+	from themes
+	order by id
@@ -0,0 +1,4 @@
+update boards
+	set defaultCSS = $2
+	where defaultCSS = $1
+	returning pg_notify('board_updated', id)
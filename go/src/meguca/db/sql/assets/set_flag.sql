@@ -0,0 +1,2 @@
+insert into flags (board, id, name, data, mime)
+	values ($1, $2, $3, $4, $5)
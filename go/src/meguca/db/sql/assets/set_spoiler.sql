@@ -0,0 +1,2 @@
+insert into spoilers (board, category, data, mime)
+	values ($1, $2, $3, $4)
@@ -0,0 +1,5 @@
+insert into themes (id, data)
+	values ($1, $2)
+	on conflict (id) do update
+		set data = $2
+	returning pg_notify('themes_updated', $1)
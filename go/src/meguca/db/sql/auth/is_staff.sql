@@ -0,0 +1,4 @@
+select exists (
+	select 1 from staff
+		where account = $1
+)
@@ -1,2 +1,10 @@
 select id from threads
-	order by bumpTime desc
+	order by
+		case $1::smallint
+			when 1 then replyTime
+			when 2 then id
+			when 3 then postCtr
+			when 4 then imageCtr
+			else bumpTime
+		end desc,
+		bumpTime desc
@@ -1,5 +1,5 @@
 select t.sticky, t.board, t.postCtr, t.imageCtr, t.replyTime, t.bumpTime,
-		t.subject, t.nonLive, t.locked,
+		t.subject, t.nonLive, t.locked, t.cyclical,
 		p.editing, p.banned, p.spoiler, p.deleted, p.sage, t.id, p.time, p.body,
 		p.flag, p.name, p.trip, p.auth, p.links, p.commands, p.imageName,
 		posterID,
@@ -2,4 +2,11 @@ select id from threads
 	where board = $1
 	order by
 		sticky desc,
+		case $2::smallint
+			when 1 then replyTime
+			when 2 then id
+			when 3 then postCtr
+			when 4 then imageCtr
+			else bumpTime
+		end desc,
 		bumpTime desc
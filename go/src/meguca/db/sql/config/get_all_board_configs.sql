@@ -1,4 +1,6 @@
 select readOnly, textOnly, forcedAnon, disableRobots, flags, NSFW, nonLive,
-		posterIDs,
-		id, defaultCSS, title, notice, rules, eightball, js
+		posterIDs, bumpLimit, imageLimit, postLimit, threadsPerPage,
+		id, defaultCSS, title, notice, rules, eightball, js, css,
+		disabledMarkup, math, maxFiles, allowedTypes,
+		maxSize, stripMetadata, hideFileNames, storageQuota, markupSince
 	from boards
@@ -1,3 +1,8 @@
+with prev as (
+	select math, disabledMarkup
+		from boards
+		where id = $1
+)
 update boards
 	set
 		readOnly = $2,
@@ -13,6 +18,23 @@ update boards
 		notice = $12,
 		rules = $13,
 		eightball = $14,
-		js = $15
+		js = $15,
+		bumpLimit = $16,
+		imageLimit = $17,
+		postLimit = $18,
+		threadsPerPage = $19,
+		css = $20,
+		disabledMarkup = $21,
+		math = $22,
+		maxFiles = $23,
+		allowedTypes = $24,
+		maxSize = $25,
+		stripMetadata = $26,
+		hideFileNames = $27,
+		storageQuota = $28
+	from prev
 	where id = $1
-	returning pg_notify('board_updated', $1)
+	returning pg_notify('board_updated', $1),
+		case when prev.math != $22 or prev.disabledMarkup != $21
+			then pg_notify('board_render_changed', $1)
+		end
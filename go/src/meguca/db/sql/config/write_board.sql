@@ -1,7 +1,12 @@
 insert into boards (
 	id, readOnly, textOnly, forcedAnon, disableRobots, flags, NSFW, nonLive,
 	posterIDs,
-	created, defaultCSS, title,	notice, rules, eightball, js
+	created, defaultCSS, title,	notice, rules, eightball, js,
+	bumpLimit, imageLimit, postLimit, threadsPerPage, css, disabledMarkup,
+	math, maxFiles, allowedTypes, maxSize, stripMetadata, hideFileNames,
+	storageQuota
 )
-	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+		$17, $18, $19, $20, $21, $22, $23, $24, $25,
+		$26, $27, $28, $29)
 	returning pg_notify('board_updated', $1)
@@ -0,0 +1,3 @@
+select data
+	from filter_profiles
+	where token = $1
@@ -0,0 +1,5 @@
+insert into filter_profiles (token, data, expires)
+	values ($1, $2, now() + interval '1 year')
+	on conflict (token) do update
+		set data = $2,
+			expires = now() + interval '1 year'
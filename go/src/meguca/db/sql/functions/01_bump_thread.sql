@@ -12,11 +12,7 @@ create or replace function bump_thread(
 				else postCtr
 			end,
 			bumpTime = case when bump
-				then
-					case when postCtr <= 3000
-						then floor(extract(epoch from now()))
-						else bumpTime
-					end
+				then floor(extract(epoch from now()))
 				else bumpTime
 			end,
 			imageCtr = case when image
@@ -3,13 +3,13 @@ create or replace function insert_thread(
 	nonLive bool,
 	imageCtr bigint,
 	editing bool,
-	spoiler bool,
+	spoiler smallint,
 	id bigint,
 	board text,
 	op bigint,
 	now bigint,
 	body varchar(2000),
-	flag char(2),
+	flag varchar(30),
 	posterID text,
 	name varchar(50),
 	trip char(10),
@@ -0,0 +1,2 @@
+delete from chunked_uploads
+	where id = $1
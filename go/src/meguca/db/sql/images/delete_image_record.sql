@@ -0,0 +1,2 @@
+delete from images
+	where SHA1 = $1
@@ -0,0 +1,2 @@
+delete from transcode_queue
+	where SHA1 = $1
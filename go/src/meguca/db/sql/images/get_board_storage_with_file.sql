@@ -0,0 +1,15 @@
+select coalesce(sum(size + transcodedSize + thumbSize), 0)::bigint
+	from images
+	where SHA1 in (
+		select SHA1
+			from posts
+			where board = $1 and SHA1 is not null
+		union
+		select pi.SHA1
+			from post_images as pi
+			inner join posts as p
+				on p.id = pi.id
+			where p.board = $1
+		union
+		select $2::char(40)
+	)
@@ -0,0 +1,3 @@
+select board, SHA1, size, received
+	from chunked_uploads
+	where id = $1 and expires > now()
@@ -0,0 +1,5 @@
+select * from images
+	where SHA1 = $1
+		or SHA1 = (select image from image_aliases where SHA1 = $1)
+	order by SHA1 = $1 desc
+	limit 1
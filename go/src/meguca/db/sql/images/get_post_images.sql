@@ -0,0 +1,6 @@
+select pi.id, pi.spoiler, pi.name, i.*
+	from post_images as pi
+	inner join images as i
+		on pi.SHA1 = i.SHA1
+	where pi.id = any($1)
+	order by pi.id, pi.index
@@ -0,0 +1,4 @@
+select i.*
+	from transcode_queue as q
+	inner join images as i
+		on i.SHA1 = q.SHA1
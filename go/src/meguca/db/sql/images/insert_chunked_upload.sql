@@ -0,0 +1,9 @@
+insert into chunked_uploads (id, board, SHA1, size, ip, expires)
+	select $1::char(32), $2::text, $3::char(40), $4::bigint, $5::inet,
+			$6::timestamp
+		where (
+			select count(*)
+				from chunked_uploads
+				where ip = $5::inet and expires > now()
+		) < $7
+	returning true
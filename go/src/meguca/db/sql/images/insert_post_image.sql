@@ -0,0 +1,6 @@
+insert into post_images (id, index, SHA1, name, spoiler)
+	values ($1, $2, $3, $4, $5)
+	returning bump_thread(
+		(select op from posts where id = $1),
+		false, false, true
+	)
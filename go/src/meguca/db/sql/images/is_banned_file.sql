@@ -0,0 +1,4 @@
+select exists (
+	select 1 from banned_files
+		where SHA1 = $1 or MD5 = $2
+)
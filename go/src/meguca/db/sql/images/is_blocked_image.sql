@@ -0,0 +1,14 @@
+select exists (
+	select 1
+		from blocked_images
+		where (board = $1 or board = 'all')
+			and (
+				SHA1 = $2
+				or (
+					$3::bigint is not null
+					and length(replace(
+						(phash # $3::bigint)::bit(64)::text, '0', ''
+					)) <= $4
+				)
+			)
+)
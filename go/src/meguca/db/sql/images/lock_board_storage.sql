@@ -0,0 +1,4 @@
+select 1
+	from boards
+	where id = $1
+	for no key update
@@ -0,0 +1,3 @@
+insert into transcode_queue (SHA1)
+	values ($1)
+	on conflict do nothing
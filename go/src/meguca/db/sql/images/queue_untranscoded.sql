@@ -0,0 +1,5 @@
+insert into transcode_queue (SHA1)
+	select SHA1
+		from images
+		where video and not transcoded and fileType = any($1::smallint[])
+	on conflict do nothing
@@ -0,0 +1,3 @@
+update images
+	set thumbSize = $2, transcodedSize = $3
+	where SHA1 = $1
@@ -0,0 +1,3 @@
+update images
+	set transcoded = true, transcodedSize = $2
+	where SHA1 = $1
@@ -1,3 +1,3 @@
 update posts
-	set spoiler = true
+	set spoiler = $2
 	where id = $1
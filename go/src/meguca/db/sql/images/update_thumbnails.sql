@@ -0,0 +1,4 @@
+update images
+	set thumbType = $2, dims = $3, dims2x = $4, catalogDims = $5, phash = $6,
+		thumbSize = $7
+	where SHA1 = $1
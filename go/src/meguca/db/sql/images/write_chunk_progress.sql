@@ -0,0 +1,5 @@
+update chunked_uploads
+	set received = $3,
+		expires = $4
+	where id = $1 and received = $2
+	returning true
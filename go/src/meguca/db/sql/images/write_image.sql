@@ -1,4 +1,6 @@
 insert into images (
-	apng, audio, video, fileType, thumbType, dims, length, size, MD5, SHA1, Title, Artist
+	apng, audio, video, fileType, thumbType, dims, length, size, MD5, SHA1, Title, Artist, phash,
+	contents, dims2x, catalogDims, transcoded, thumbSize
 )
-	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+		$18)
@@ -0,0 +1,4 @@
+insert into image_aliases (SHA1, image)
+	values ($1, $2)
+	on conflict (SHA1) do update
+		set image = excluded.image
@@ -51,15 +51,49 @@ create table images (
 	MD5 char(22) not null,
 	SHA1 char(40) primary key,
 	Title varchar(200) not null,
-	Artist varchar(100) not null
+	Artist varchar(100) not null,
+	phash bigint,
+	contents json,
+	dims2x smallint[2],
+	catalogDims smallint[2],
+	transcoded bool not null default false,
+	thumbSize bigint not null default 0,
+	transcodedSize bigint not null default 0
 );
 
+create table blocked_images (
+	board text not null,
+	SHA1 char(40) not null,
+	phash bigint,
+	by varchar(20) not null,
+	created timestamp default (now() at time zone 'utc'),
+	primary key (board, SHA1)
+);
+
+create table banned_files (
+	SHA1 char(40) primary key,
+	MD5 char(22) not null,
+	by varchar(20) not null,
+	created timestamp default (now() at time zone 'utc')
+);
+create index banned_files_MD5 on banned_files (MD5);
+
 create table image_tokens (
 	token char(86) not null primary key,
 	SHA1 char(40) not null references images on delete cascade,
 	expires timestamp not null
 );
 
+create table transcode_queue (
+	SHA1 char(40) primary key references images on delete cascade
+);
+
+create table image_aliases (
+	SHA1 char(40) primary key,
+	image char(40) not null references images on delete cascade
+);
+create index image_aliases_image on image_aliases (image);
+
 create table boards (
 	readOnly boolean not null,
 	textOnly boolean not null,
@@ -69,6 +103,18 @@ create table boards (
 	NSFW boolean default false,
 	nonLive bool default false,
 	posterIDs bool default false,
+	math bool default false,
+	maxFiles bigint not null default 1,
+	allowedTypes text[] not null default '{}',
+	maxSize bigint not null default 0,
+	storageQuota bigint not null default 0,
+	markupSince bigint not null default 0,
+	stripMetadata text not null default 'default',
+	hideFileNames bool not null default false,
+	bumpLimit bigint not null default 3000,
+	imageLimit bigint not null default 0,
+	postLimit bigint not null default 0,
+	threadsPerPage bigint not null default 15,
 	id text primary key,
 	created timestamp not null,
 	defaultCSS text not null,
@@ -76,6 +122,8 @@ create table boards (
 	notice varchar(500) not null,
 	rules varchar(5000) not null,
 	js varchar(5000) default '',
+	css varchar(10000) default '',
+	disabledMarkup text[] not null default '{}',
 	eightball text[] not null
 );
 
@@ -94,17 +142,68 @@ create table banners (
 	mime text not null
 );
 
+create table spoilers (
+	board text not null references boards on delete cascade,
+	category smallint not null,
+	data bytea not null,
+	mime text not null,
+	primary key (board, category)
+);
+
+create table flags (
+	board text not null references boards on delete cascade,
+	id smallint not null,
+	name varchar(20) not null,
+	data bytea not null,
+	mime text not null
+);
+
 create table loading_animations (
 	board text primary key references boards on delete cascade,
 	data bytea not null,
 	mime text not null
 );
 
+create table themes (
+	id text primary key,
+	data bytea not null
+);
+
+create table link_previews (
+	id char(40) primary key,
+	url text not null,
+	title varchar(200) not null,
+	description varchar(500) not null,
+	thumbnail bytea,
+	thumbnailMime text,
+	expires timestamp not null
+);
+create index link_previews_expires on link_previews (expires);
+
+create table chunked_uploads (
+	id char(32) primary key,
+	board text not null,
+	SHA1 char(40) not null,
+	size bigint not null,
+	received bigint not null default 0,
+	ip inet,
+	expires timestamp not null
+);
+create index chunked_uploads_ip on chunked_uploads (ip);
+
+create table filter_profiles (
+	token char(43) primary key,
+	data json not null,
+	expires timestamp not null
+);
+
 create sequence post_id;
 
 create table threads (
 	sticky boolean default false,
 	nonLive bool default false,
+	cyclical bool default false,
+	cyclicalCap bigint not null default 0,
 	board text not null references boards on delete cascade,
 	id bigint primary key,
 	postCtr bigint not null,
@@ -120,7 +219,7 @@ create index sticky on threads (sticky);
 
 create table posts (
 	editing boolean not null,
-	spoiler boolean,
+	spoiler smallint,
 	deleted boolean,
 	banned boolean,
 	sage boolean,
@@ -129,7 +228,7 @@ create table posts (
 	op bigint not null references threads on delete cascade,
 	time bigint not null,
 	board text not null,
-	flag char(2),
+	flag varchar(30),
 	posterID text,
 	trip char(10),
 	auth varchar(20),
@@ -143,10 +242,21 @@ create table posts (
 	commands json[]
 );
 create index op on posts (op);
+create index posts_board on posts (board);
 create index image on posts (SHA1);
 create index editing on posts (editing);
 create index ip on posts (ip);
 
+create table post_images (
+	id bigint not null references posts on delete cascade,
+	index smallint not null,
+	SHA1 char(40) not null references images on delete cascade,
+	name varchar(200) not null,
+	spoiler smallint not null default 0,
+	primary key (id, index)
+);
+create index post_images_SHA1 on post_images (SHA1);
+
 create table reports (
 	id bigserial primary key,
 	target bigint not null,
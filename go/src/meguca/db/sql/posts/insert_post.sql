@@ -3,4 +3,10 @@ insert into posts (
 		name, trip, auth, password, ip, SHA1, imageName, links, commands, sage
 	)
 	values ($1,	$2,	$3,	$4,	$5,	$6,	$7,	$8,	$9,	$10, $11, $12, $13,	$14, $15, $16, $17, $18, $19)
-	returning bump_thread($5, true, not $19, $15 is not null)
+	returning bump_thread(
+		$5,
+		true,
+		not $19
+			and ($20 = 0 or (select postCtr from threads where id = $5) < $20),
+		$15 is not null
+	)
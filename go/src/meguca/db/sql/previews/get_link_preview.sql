@@ -0,0 +1,3 @@
+select title, description, thumbnail is not null
+	from link_previews
+	where id = $1 and expires > now()
@@ -0,0 +1,3 @@
+select thumbnail, thumbnailMime
+	from link_previews
+	where id = $1 and thumbnail is not null
@@ -0,0 +1,3 @@
+select id, title, description, thumbnail is not null
+	from link_previews
+	where id = any($1) and expires > now()
@@ -0,0 +1,10 @@
+insert into link_previews (
+	id, url, title, description, thumbnail, thumbnailMime, expires
+)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	on conflict (id) do update
+		set title = $3,
+			description = $4,
+			thumbnail = $5,
+			thumbnailMime = $6,
+			expires = $7
@@ -1,4 +1,7 @@
-select id, time, editing, (SHA1 is not null) as hasImg, spoiler from posts
+select id, time, editing, (SHA1 is not null) as hasImg, spoiler,
+		(select count(*) from post_images as pi where pi.id = posts.id)
+			as extraImages
+	from posts
 	where op = $1
 		and time > floor(extract(epoch from now())) - 900
 	order by id asc
@@ -0,0 +1,3 @@
+select postCtr, imageCtr
+	from threads
+	where id = $1
@@ -0,0 +1,4 @@
+select locked, postCtr, imageCtr
+	from threads
+	where id = $1
+	for update
@@ -3,7 +3,7 @@ select insert_thread(
 	$2::bool,
 	$3::bigint,
 	$4::bool,
-	$5::bool,
+	$5::smallint,
 	$6::bigint,
 	$7::text,
 	$8::bigint,
@@ -0,0 +1,4 @@
+update threads
+	set locked = true
+	where id = $1
+	returning pg_notify('thread_locked', board || ':' || id)
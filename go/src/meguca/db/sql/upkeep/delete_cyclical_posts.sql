@@ -0,0 +1,33 @@
+with excess as (
+	select posts.id,
+		row_number() over (partition by posts.op order by posts.id desc) as n,
+		threads.cyclicalCap as cap
+	from posts
+	inner join threads on posts.op = threads.id
+	where threads.cyclical = true
+		and posts.id != posts.op
+		and posts.editing = false
+),
+deleted as (
+	delete from posts
+		where id in (select id from excess where n > cap)
+		returning id, op, SHA1,
+			(select count(*) from post_images as pi
+				where pi.id = posts.id
+			) as extraImages
+),
+counters as (
+	update threads as t
+		set postCtr = t.postCtr - d.posts,
+			imageCtr = t.imageCtr - d.images,
+			replyTime = floor(extract(epoch from now()))
+		from (
+			select op, count(*) as posts,
+				(count(SHA1) + sum(extraImages))::bigint as images
+				from deleted
+				group by op
+		) as d
+		where t.id = d.op
+)
+select id, op
+	from deleted
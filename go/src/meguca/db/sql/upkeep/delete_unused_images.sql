@@ -1,6 +1,7 @@
 delete from images
 	where (
 		(select count(*) from posts where SHA1 = images.SHA1)
+		+ (select count(*) from post_images where SHA1 = images.SHA1)
 		+ (select count(*) from image_tokens where SHA1 = images.SHA1)
 	) = 0
 	returning SHA1, fileType, thumbType
@@ -0,0 +1,3 @@
+delete from chunked_uploads
+	where expires < now()
+	returning id
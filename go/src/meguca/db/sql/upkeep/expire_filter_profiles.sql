@@ -0,0 +1,2 @@
+delete from filter_profiles
+	where expires < now()
@@ -0,0 +1,2 @@
+delete from link_previews
+	where expires < now()
@@ -1,3 +1,4 @@
-select posts.id, bumpTime, postCtr, posts.deleted
+select posts.id, threads.board, bumpTime, postCtr, posts.deleted
 	from threads
 	inner join posts on threads.id = posts.id
+	where threads.cyclical is not true
@@ -102,3 +102,28 @@ func queryBool(id uint64, queryID string) (val bool, err error) {
 func CheckThreadLocked(id uint64) (bool, error) {
 	return queryBool(id, "check_thread_locked")
 }
+
+// GetThreadCounters retrieves the post and image counters of a thread
+func GetThreadCounters(id uint64) (postCtr, imageCtr uint, err error) {
+	err = prepared["get_thread_counters"].QueryRow(id).
+		Scan(&postCtr, &imageCtr)
+	return
+}
+
+// GetThreadPostingState retrieves the locked flag and the post and image
+// counters of a thread. The thread's row is locked until tx ends, so that
+// concurrent post and image insertions are checked against the board's limits
+// one at a time.
+func GetThreadPostingState(tx *sql.Tx, id uint64) (
+	locked bool, postCtr, imageCtr uint, err error,
+) {
+	err = tx.Stmt(prepared["get_thread_posting_state"]).QueryRow(id).
+		Scan(&locked, &postCtr, &imageCtr)
+	return
+}
+
+// LockThread locks a thread, that has reached the post limit of its board
+func LockThread(tx *sql.Tx, id uint64) error {
+	_, err := getStatement(tx, "lock_thread").Exec(id)
+	return err
+}
@@ -35,13 +35,15 @@ func runCleanupTasks() {
 
 func runMinuteTasks() {
 	logError("open post cleanup", closeDanglingPosts())
+	logError("cyclical thread cleanup", deleteCyclicalPosts())
 	logPrepared("expire_image_tokens", "expire_bans")
+	logError("chunked upload cleanup", expireChunkedUploads())
 }
 
 func runHourTasks() {
 	logPrepared(
 		"expire_user_sessions", "remove_identity_info", "expire_mod_log",
-		"expire_reports",
+		"expire_reports", "expire_link_previews", "expire_filter_profiles",
 	)
 	logError("thread cleanup", deleteOldThreads())
 	logError("board cleanup", deleteUnusedBoards())
@@ -122,8 +124,9 @@ func deleteUnusedBoards() error {
 }
 
 // Delete stale threads. Thread retention measured in a bumptime threshold, that
-// is calculated as a function of post count till bump limit with an N days
-// floor and ceiling.
+// is calculated as a function of post count till the board's bump limit with
+// an N days floor and ceiling. Cyclical threads delete their oldest replies
+// instead and never expire.
 func deleteOldThreads() (err error) {
 	conf := config.Get()
 	if !conf.PruneThreads {
@@ -148,15 +151,22 @@ func deleteOldThreads() (err error) {
 		max         = float64(conf.ThreadExpiryMax * 24 * 3600)
 		toDel       = make([]uint64, 0, 16)
 		id, postCtr uint64
+		board       string
 		bumpTime    int64
 		deleted     sql.NullBool
 	)
 	for r.Next() {
-		err = r.Scan(&id, &bumpTime, &postCtr, &deleted)
+		err = r.Scan(&id, &board, &bumpTime, &postCtr, &deleted)
 		if err != nil {
 			return
 		}
-		threshold := min + (-max+min)*math.Pow(float64(postCtr)/3000-1, 3)
+		// Threads on boards without a bump limit never approach it and thus
+		// get the maximum expiry time
+		var progress float64
+		if limit := config.GetBoardConfigs(board).BumpLimit; limit != 0 {
+			progress = float64(postCtr) / float64(limit)
+		}
+		threshold := min + (-max+min)*math.Pow(progress-1, 3)
 		if deleted.Bool {
 			threshold /= 3
 		}
@@ -184,6 +194,44 @@ func deleteOldThreads() (err error) {
 	return tx.Commit()
 }
 
+// Delete the oldest replies of cyclical threads, that exceed the thread's reply
+// cap. Thread counters are updated by the same query.
+func deleteCyclicalPosts() (err error) {
+	r, err := prepared["delete_cyclical_posts"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	type post struct {
+		id, op uint64
+	}
+	posts := make([]post, 0, 16)
+	for r.Next() {
+		var p post
+		err = r.Scan(&p.id, &p.op)
+		if err != nil {
+			return
+		}
+		posts = append(posts, p)
+	}
+	err = r.Err()
+	if err != nil {
+		return
+	}
+
+	// Propagate deletions to connected clients
+	if !IsTest {
+		for _, p := range posts {
+			err = common.DeletePost(p.id, p.op)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return nil
+}
+
 // DeleteBoard deletes a board and all of its contained threads and posts
 func DeleteBoard(board string) error {
 	_, err := prepared["delete_board"].Exec(board)
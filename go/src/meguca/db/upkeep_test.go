@@ -1,9 +1,11 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"meguca/common"
 	"meguca/config"
+	"meguca/imager/assets"
 	. "meguca/test"
 	"testing"
 	"time"
@@ -267,7 +269,11 @@ func TestDeleteOldThreads(t *testing.T) {
 	writeExpiringThreads(t, threadExpiryCases{
 		{1, "a", time.Now().Add(-eightDays)},
 		{2, "a", time.Now()},
+		{3, "a", time.Now().Add(-eightDays)},
 	})
+	if err := SetThreadCyclical(3, true, 2, "admin"); err != nil {
+		t.Fatal(err)
+	}
 
 	t.Run("pruning disabled", func(t *testing.T) {
 		(*config.Get()).PruneThreads = false
@@ -276,6 +282,7 @@ func TestDeleteOldThreads(t *testing.T) {
 		}
 		assertThreadDeleted(t, 1, false)
 		assertThreadDeleted(t, 2, false)
+		assertThreadDeleted(t, 3, false)
 	})
 
 	t.Run("deleted", func(t *testing.T) {
@@ -285,5 +292,83 @@ func TestDeleteOldThreads(t *testing.T) {
 		}
 		assertThreadDeleted(t, 1, true)
 		assertThreadDeleted(t, 2, false)
+		assertThreadDeleted(t, 3, false)
+	})
+}
+
+func TestDeleteCyclicalPosts(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+	writeSampleImage(t)
+
+	// Thread 1 is cyclical and thread 6 is not. Both have 4 replies.
+	for _, op := range [...]uint64{1, 6} {
+		thread := Thread{
+			ID:       op,
+			Board:    "a",
+			PostCtr:  5,
+			ImageCtr: 1,
+		}
+		posts := make([]Post, 5)
+		for i := range posts {
+			posts[i] = Post{
+				StandalonePost: common.StandalonePost{
+					Post: common.Post{
+						ID:   op + uint64(i),
+						Time: time.Now().Unix(),
+					},
+					OP:    op,
+					Board: "a",
+				},
+			}
+		}
+		posts[1].Image = &assets.StdJPEG
+		if err := WriteThread(nil, thread, posts[0]); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range posts[1:] {
+			if err := WritePost(nil, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := SetThreadCyclical(1, true, 2, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleteCyclicalPosts(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("posts", func(t *testing.T) {
+		for id := uint64(1); id <= 10; id++ {
+			_, err := GetPost(id)
+			switch {
+			case id == 2 || id == 3:
+				if err != sql.ErrNoRows {
+					t.Errorf("post %d not deleted: %v", id, err)
+				}
+			case err != nil:
+				t.Errorf("post %d: %s", id, err)
+			}
+		}
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		cases := [...]struct {
+			id                uint64
+			postCtr, imageCtr uint
+		}{
+			{1, 3, 0},
+			{6, 5, 1},
+		}
+		for _, c := range cases {
+			postCtr, imageCtr, err := GetThreadCounters(c.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, postCtr, c.postCtr)
+			AssertDeepEquals(t, imageCtr, c.imageCtr)
+		}
 	})
 }
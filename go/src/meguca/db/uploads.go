@@ -0,0 +1,161 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"meguca/imager/assets"
+	"os"
+	"time"
+)
+
+const (
+	// Time of inactivity, after which an unfinished chunked upload is
+	// discarded
+	chunkedUploadTimeout = time.Hour
+
+	// Maximum number of unfinished chunked uploads per IP
+	maxChunkedUploadsPerIP = 4
+)
+
+// ErrTooManyUploads is returned, when an IP already has the maximum number of
+// unfinished chunked uploads
+var ErrTooManyUploads = errors.New("too many unfinished uploads")
+
+// ChunkedUpload is a file upload split into multiple requests, that is still
+// being received
+type ChunkedUpload struct {
+	// Size of the complete file and number of bytes received so far
+	Size, Received int64
+	ID, Board      string
+
+	// Hash of the complete file as declared by the client
+	SHA1 string
+}
+
+// NewChunkedUpload creates the temporary file of a new chunked upload from ip,
+// registers the upload and returns its ID. Returns ErrTooManyUploads, if ip
+// already has too many unfinished uploads.
+func NewChunkedUpload(board, SHA1, ip string, size int64) (
+	id string, err error,
+) {
+	buf := make([]byte, 16)
+	// Loop in case there is an ID collision
+	for {
+		_, err = rand.Read(buf)
+		if err != nil {
+			return
+		}
+		id = hex.EncodeToString(buf)
+
+		// Create the file first, so no record without a file can exist
+		var f *os.File
+		f, err = os.OpenFile(
+			assets.UploadPath(id),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			0600,
+		)
+		switch {
+		case err == nil:
+			f.Close()
+		case os.IsExist(err):
+			continue
+		default:
+			return
+		}
+
+		var ok bool
+		expires := time.Now().Add(chunkedUploadTimeout)
+		err = prepared["insert_chunked_upload"].
+			QueryRow(
+				id, board, SHA1, size, ip, expires, maxChunkedUploadsPerIP,
+			).
+			Scan(&ok)
+		if err == nil {
+			return
+		}
+		if rmErr := removeUploadFile(id); rmErr != nil {
+			return "", rmErr
+		}
+		switch {
+		case err == sql.ErrNoRows:
+			return "", ErrTooManyUploads
+		case IsConflictError(err):
+			continue
+		default:
+			return "", err
+		}
+	}
+}
+
+// GetChunkedUpload retrieves an unexpired chunked upload by ID
+func GetChunkedUpload(id string) (u ChunkedUpload, err error) {
+	err = prepared["get_chunked_upload"].
+		QueryRow(id).
+		Scan(&u.Board, &u.SHA1, &u.Size, &u.Received)
+	u.ID = id
+	return
+}
+
+// AdvanceChunkedUpload records the reception of a chunk and extends the
+// upload's expiry. Returns false, if the upload has since received other data
+// or does not exist.
+func AdvanceChunkedUpload(id string, from, to int64) (ok bool, err error) {
+	expires := time.Now().Add(chunkedUploadTimeout)
+	err = prepared["write_chunk_progress"].
+		QueryRow(id, from, to, expires).
+		Scan(&ok)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// DeleteChunkedUpload deletes a chunked upload's record and temporary file
+func DeleteChunkedUpload(id string) error {
+	if err := execPrepared("delete_chunked_upload", id); err != nil {
+		return err
+	}
+	return removeUploadFile(id)
+}
+
+// Delete chunked uploads, that have not received data for an hour, and their
+// temporary files
+func expireChunkedUploads() (err error) {
+	r, err := prepared["expire_chunked_uploads"].Query()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	ids := make([]string, 0, 8)
+	for r.Next() {
+		var id string
+		err = r.Scan(&id)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = r.Err()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		err = removeUploadFile(id)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func removeUploadFile(id string) error {
+	err := os.Remove(assets.UploadPath(id))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
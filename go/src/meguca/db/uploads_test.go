@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"meguca/imager/assets"
+	. "meguca/test"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkedUploads(t *testing.T) {
+	assertTableClear(t, "chunked_uploads")
+	defer setupImageDirs(t)()
+
+	SHA1 := GenString(40)
+	id, err := NewChunkedUpload("a", SHA1, "::1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := AdvanceChunkedUpload(id, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("chunk not recorded")
+	}
+
+	// Stale offset
+	ok, err = AdvanceChunkedUpload(id, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("chunk recorded twice")
+	}
+
+	u, err := GetChunkedUpload(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, u, ChunkedUpload{
+		Size:     10,
+		Received: 4,
+		ID:       id,
+		Board:    "a",
+		SHA1:     SHA1,
+	})
+
+	if err := DeleteChunkedUpload(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetChunkedUpload(id); err != sql.ErrNoRows {
+		UnexpectedError(t, err)
+	}
+}
+
+func TestExpireChunkedUploads(t *testing.T) {
+	assertTableClear(t, "chunked_uploads")
+	defer setupImageDirs(t)()
+
+	id, err := NewChunkedUpload("a", GenString(40), "::1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(assets.UploadPath(id), []byte{1, 2, 3}, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t,
+		`update chunked_uploads
+			set expires = now() - interval '1 minute'
+			where id = $1`,
+		id,
+	)
+
+	if err := expireChunkedUploads(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetChunkedUpload(id); err != sql.ErrNoRows {
+		UnexpectedError(t, err)
+	}
+	if _, err := os.Stat(assets.UploadPath(id)); !os.IsNotExist(err) {
+		t.Fatal("temporary file not deleted")
+	}
+}
+
+func TestChunkedUploadLimit(t *testing.T) {
+	assertTableClear(t, "chunked_uploads")
+	defer setupImageDirs(t)()
+
+	for i := 0; i < maxChunkedUploadsPerIP; i++ {
+		_, err := NewChunkedUpload("a", GenString(40), "::1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := NewChunkedUpload("a", GenString(40), "::1", 10)
+	if err != ErrTooManyUploads {
+		UnexpectedError(t, err)
+	}
+
+	// No temporary file is left behind for the rejected upload
+	files, err := ioutil.ReadDir(filepath.Dir(assets.UploadPath("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != maxChunkedUploadsPerIP {
+		t.Fatalf("unexpected number of temporary files: %d", len(files))
+	}
+
+	// Other IPs are not affected
+	if _, err := NewChunkedUpload("a", GenString(40), "::2", 10); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,25 @@
 package imager
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"io"
+	"io/ioutil"
+	"meguca/common"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/bakape/thumbnailer"
 	"github.com/ulikunitz/xz"
 )
 
@@ -15,6 +30,320 @@ const (
 	mimeTarXZ = "application/x-xz"
 )
 
+const (
+	// Maximum amount of data decompressed, while reading an archive. Guards
+	// against decompression bombs.
+	maxArchiveRead = 64 << 20
+
+	// Maximum size of an image inside an archive, that is thumbnailed
+	maxArchiveImageSize = 16 << 20
+
+	// Command line tool from p7zip used for reading 7z archives
+	sevenZip = "7z"
+
+	// Maximum time spent reading a 7z archive. Also bounds decompressing the
+	// files preceding an image in a solid block, which 7z does not output.
+	sevenZipTimeout = 10 * time.Second
+)
+
+var errArchiveReadLimit = errors.New("archive decompression limit reached")
+
+// MIME types of images inside archives, that are thumbnailed
+var archiveImageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	mimeWebP:     true,
+}
+
+// Builds the content listing of an archive and retains the first image found
+// inside it
+type archiveReader struct {
+	triedImage bool
+	read       int64 // Bytes decompressed so far
+	contents   common.ArchiveContents
+	image      []byte
+}
+
+// Decompressed data read from an archive. Counts the read bytes against the
+// limit for the entire archive.
+type archiveData struct {
+	a *archiveReader
+	r io.Reader
+}
+
+func (d archiveData) Read(p []byte) (n int, err error) {
+	left := maxArchiveRead - d.a.read
+	if left <= 0 {
+		return 0, errArchiveReadLimit
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err = d.r.Read(p)
+	d.a.read += int64(n)
+	return
+}
+
+// Wrap a reader of decompressed data to count it against maxArchiveRead
+func (a *archiveReader) decompressed(r io.Reader) io.Reader {
+	return archiveData{a, r}
+}
+
+// Add a file to the listing. Returns false, if the listing is full.
+func (a *archiveReader) add(name string, size int64) bool {
+	if len(a.contents.Files) == common.MaxArchiveFiles {
+		a.contents.Truncated = true
+		return false
+	}
+
+	if !utf8.ValidString(name) {
+		// Invalid bytes are replaced with utf8.RuneError on conversion
+		name = string([]rune(name))
+	}
+	if len(name) > common.MaxLenArchiveFileName {
+		name = name[:common.MaxLenArchiveFileName]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	a.contents.Files = append(a.contents.Files, common.ArchiveFile{
+		Name: name,
+		Size: size,
+	})
+	return true
+}
+
+// Returns, if the file should be read as the image to thumbnail the archive
+// with. Only the first candidate is ever read.
+func (a *archiveReader) wantImage(name string, size int64) bool {
+	if a.triedImage || size <= 0 || size > maxArchiveImageSize {
+		return false
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	default:
+		return false
+	}
+}
+
+// Read an image from an archive. The declared size of the file is not
+// trusted. r must already be counted against maxArchiveRead.
+func (a *archiveReader) readImage(r io.Reader) {
+	a.triedImage = true
+	buf, err := ioutil.ReadAll(io.LimitReader(r, maxArchiveImageSize+1))
+	if err == nil && len(buf) <= maxArchiveImageSize {
+		a.image = buf
+	}
+}
+
+// Thumbnail the first image inside an archive, if any, and record a listing of
+// its contents. Archives, that can not be read, are still accepted without
+// either.
+func processArchive(
+	data []byte,
+	img *common.ImageCommon,
+	opts thumbnailer.Options,
+) (
+	thumb thumbnailer.Thumbnail,
+) {
+	var (
+		a   archiveReader
+		err error
+	)
+	switch img.FileType {
+	case common.ZIP:
+		err = a.readZip(data)
+	case common.SevenZip:
+		err = a.read7z(data)
+	case common.TGZ:
+		var r io.Reader
+		r, err = gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			a.readTar(a.decompressed(r))
+		}
+	case common.TXZ:
+		var r io.Reader
+		r, err = xz.NewReader(bytes.NewReader(data))
+		if err == nil {
+			a.readTar(a.decompressed(r))
+		}
+	}
+	if err != nil {
+		return
+	}
+	img.Contents = &a.contents
+
+	if a.image != nil {
+		opts.AcceptedMimeTypes = archiveImageMimeTypes
+		_, thumb, err = thumbnailer.ProcessBuffer(a.image, opts)
+		if err != nil {
+			thumb = thumbnailer.Thumbnail{}
+		}
+	}
+	return
+}
+
+// Zip archives have a central directory, so listing them requires no
+// decompression
+func (a *archiveReader) readZip(data []byte) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		size := int64(f.UncompressedSize64)
+		if !a.add(f.Name, size) {
+			break
+		}
+		if a.wantImage(f.Name, size) {
+			if rc, err := f.Open(); err == nil {
+				a.readImage(a.decompressed(rc))
+				rc.Close()
+			}
+		}
+	}
+	return nil
+}
+
+// 7z archives store the file listing in their header, which is read with the
+// 7z command line tool. Only the first image candidate is extracted.
+func (a *archiveReader) read7z(data []byte) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sevenZipTimeout)
+	defer cancel()
+
+	f, err := ioutil.TempFile("", "meguca-7z")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return
+	}
+
+	out, err := exec.CommandContext(
+		ctx,
+		sevenZip,
+		"l", "-slt", "--", f.Name(),
+	).Output()
+	if err != nil {
+		return
+	}
+	image := a.parse7zListing(out)
+	if image == "" {
+		return
+	}
+
+	// Disable wildcard matching, so the file name is matched verbatim
+	cmd := exec.CommandContext(
+		ctx,
+		sevenZip,
+		"e", "-so", "-spd", "--", f.Name(), image,
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	a.readImage(a.decompressed(stdout))
+	cancel() // Stop the tool, if the image was not read to the end
+	cmd.Wait()
+	return nil
+}
+
+// Add the files from technical listing output of `7z l -slt` to the contents.
+// Returns the path of the image to thumbnail the archive with, if any.
+func (a *archiveReader) parse7zListing(buf []byte) (image string) {
+	var (
+		inFiles bool
+		name    string
+		size    int64
+		isDir   bool
+		full    bool
+	)
+	flush := func() {
+		if name != "" && !isDir && !full {
+			if !a.add(name, size) {
+				full = true
+			} else if image == "" && a.wantImage(name, size) {
+				image = name
+			}
+		}
+		name, size, isDir = "", 0, false
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		line := s.Text()
+		if !inFiles {
+			// Properties of the archive itself precede the file entries
+			inFiles = strings.HasPrefix(line, "----------")
+			continue
+		}
+		if line == "" {
+			flush()
+			continue
+		}
+		i := strings.Index(line, " = ")
+		if i == -1 {
+			continue
+		}
+		val := line[i+3:]
+		switch line[:i] {
+		case "Path":
+			name = val
+		case "Size":
+			size, _ = strconv.ParseInt(val, 10, 64)
+		case "Folder":
+			isDir = val == "+"
+		case "Attributes":
+			isDir = isDir || strings.HasPrefix(val, "D")
+		}
+	}
+	flush()
+	return
+}
+
+// Tar archives have no index and must be decompressed to be listed. Stops,
+// once maxArchiveRead bytes have been decompressed, and marks the listing as
+// truncated. r must already be counted against maxArchiveRead.
+func (a *archiveReader) readTar(r io.Reader) {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return
+		default:
+			a.contents.Truncated = true
+			return
+		}
+
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			continue
+		}
+		if !a.add(h.Name, h.Size) {
+			return
+		}
+		if a.wantImage(h.Name, h.Size) {
+			a.readImage(tr)
+		}
+	}
+}
+
 // Detect if file is a TAR archive compressed with GZIP
 func detectTarGZ(buf []byte) (mime string, ext string) {
 	if !bytes.HasPrefix(buf, []byte("\x1F\x8B\x08")) {
@@ -1,7 +1,12 @@
 package imager
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"meguca/common"
+	. "meguca/test"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -52,7 +57,12 @@ func TestProcessArchive(t *testing.T) {
 			t.Parallel()
 
 			var img common.ImageCommon
-			_, err := processFile(readSample(t, c.file), &img, dummyOpts)
+			_, _, err := processFile(
+				readSample(t, c.file),
+				&img,
+				dummyOpts,
+				false,
+			)
 			if c.err != "" {
 				if err == nil {
 					t.Fatalf("expected an error")
@@ -66,6 +76,217 @@ func TestProcessArchive(t *testing.T) {
 			}
 
 			assertFileType(t, img.FileType, c.typ)
+			AssertDeepEquals(t, img.Contents, &common.ArchiveContents{
+				Files: []common.ArchiveFile{
+					{
+						Name: "sample.svg",
+						Size: 436,
+					},
+				},
+			})
 		})
 	}
 }
+
+func TestArchiveThumbnail(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	writeFile := func(name string, data []byte) {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("readme.txt", []byte("hello"))
+	writeFile("cover.png", readSample(t, "sample.png"))
+	for i := 0; i < common.MaxArchiveFiles; i++ {
+		writeFile(strconv.Itoa(i)+".txt", nil)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var img common.ImageCommon
+	_, thumb, err := processFile(buf.Bytes(), &img, dummyOpts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileType(t, img.FileType, common.ZIP)
+	assertFileType(t, img.ThumbType, common.PNG)
+	if thumb == nil {
+		t.Fatal("no thumbnail")
+	}
+	c := img.Contents
+	if c == nil {
+		t.Fatal("no contents")
+	}
+	AssertDeepEquals(t, c.Truncated, true)
+	AssertDeepEquals(t, len(c.Files), common.MaxArchiveFiles)
+	AssertDeepEquals(t, c.Files[0], common.ArchiveFile{
+		Name: "readme.txt",
+		Size: 5,
+	})
+}
+
+func TestReadTar(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, h := range [...]tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "dir/a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 3},
+	} {
+		if err := w.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, h.Size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var a archiveReader
+	a.readTar(bytes.NewReader(buf.Bytes()))
+	AssertDeepEquals(t, a.contents, common.ArchiveContents{
+		Files: []common.ArchiveFile{
+			{
+				Name: "dir/a.txt",
+				Size: 3,
+			},
+		},
+	})
+
+	// Truncated archive
+	a = archiveReader{}
+	a.readTar(bytes.NewReader(buf.Bytes()[:600]))
+	AssertDeepEquals(t, a.contents.Truncated, true)
+}
+
+func TestArchiveOnlyFirstImageRead(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range [...]struct {
+		name string
+		data []byte
+	}{
+		{"broken.png", []byte("not an image")},
+		{"cover.png", readSample(t, "sample.png")},
+	} {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var a archiveReader
+	if err := a.readZip(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, a.image, []byte("not an image"))
+	AssertDeepEquals(t, a.read, int64(len("not an image")))
+}
+
+func TestArchiveReadLimit(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	h := tar.Header{
+		Name:     "a.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     1024,
+	}
+	if err := w.WriteHeader(&h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, h.Size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Budget already mostly spent on earlier files
+	a := archiveReader{
+		read: maxArchiveRead - 100,
+	}
+	a.readTar(a.decompressed(bytes.NewReader(buf.Bytes())))
+	AssertDeepEquals(t, a.contents.Truncated, true)
+	AssertDeepEquals(t, a.read, int64(maxArchiveRead))
+}
+
+func TestParse7zListing(t *testing.T) {
+	t.Parallel()
+
+	const listing = `
+7-Zip [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21
+
+Listing archive: /tmp/meguca-7z123
+
+--
+Path = /tmp/meguca-7z123
+Type = 7z
+Physical Size = 1234
+Solid = +
+Blocks = 1
+
+----------
+Path = dir
+Size = 0
+Folder = +
+Attributes = D....
+
+Path = dir/readme.txt
+Size = 5
+Folder = -
+Attributes = ....A
+
+Path = dir/cover.png
+Size = 1000
+Folder = -
+Attributes = ....A
+
+Path = dir/second.png
+Size = 1000
+Folder = -
+Attributes = ....A
+`
+
+	var a archiveReader
+	image := a.parse7zListing([]byte(listing))
+	AssertDeepEquals(t, image, "dir/cover.png")
+	AssertDeepEquals(t, a.contents, common.ArchiveContents{
+		Files: []common.ArchiveFile{
+			{
+				Name: "dir/readme.txt",
+				Size: 5,
+			},
+			{
+				Name: "dir/cover.png",
+				Size: 1000,
+			},
+			{
+				Name: "dir/second.png",
+				Size: 1000,
+			},
+		},
+	})
+}
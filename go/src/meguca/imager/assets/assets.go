@@ -11,19 +11,45 @@ import (
 
 const fileCreationFlags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
 
+// Thumbnail renditions generated for each file
+const (
+	Thumb   = iota // Standard thumbnail
+	Thumb2x        // Double resolution thumbnail for high DPI displays
+	CatalogThumb
+	numRenditions
+)
+
+// Directories the thumbnail renditions are stored in
+var thumbDirs = [numRenditions]string{"thumb", "thumb2x", "catalog"}
+
+// Thumbnails contains the data of each thumbnail rendition of a file. Absent
+// renditions are nil.
+type Thumbnails [numRenditions][]byte
+
+// Size returns the combined size of all present renditions in bytes
+func (t Thumbnails) Size() (n int64) {
+	for _, data := range t {
+		n += int64(len(data))
+	}
+	return
+}
+
 // Only used in tests, but we still need them exported
 var (
 	//  StdJPEG is a JPEG sample image standard struct. Only used in tests.
 	StdJPEG = common.Image{
 		ImageCommon: common.ImageCommon{
-			SHA1:     "012a2f912c9ee93ceb0ccb8684a29ec571990a94",
-			FileType: common.JPEG,
-			Dims:     StdDims["jpeg"],
-			MD5:      "YOQQklgfezKbBXuEAsqopw",
-			Size:     300792,
+			SHA1:        "012a2f912c9ee93ceb0ccb8684a29ec571990a94",
+			FileType:    common.JPEG,
+			Dims:        StdDims["jpeg"],
+			Dims2x:      [2]uint16{0x12c, 0xf3},
+			CatalogDims: [2]uint16{0x64, 0x51},
+			MD5:         "YOQQklgfezKbBXuEAsqopw",
+			Size:        300792,
 		},
-		Name:    "sample.jpg",
-		Spoiler: true,
+		Name:            "sample.jpg",
+		Spoiler:         true,
+		SpoilerCategory: common.SpoilerGeneric,
 	}
 
 	// StdDims contains esulting dimentions after thumbnailing sample images.
@@ -57,6 +83,20 @@ func GetFilePaths(SHA1 string, fileType, thumbType uint8) (paths [2]string) {
 	return
 }
 
+// TranscodedPath generates the file path of the transcoded rendition of a
+// video
+func TranscodedPath(SHA1 string, fileType uint8) string {
+	return filepath.Join(
+		"images",
+		"transcoded",
+		util.ConcatStrings(
+			SHA1,
+			".",
+			common.Extensions[common.TranscodeType(fileType)],
+		),
+	)
+}
+
 // RelativeSourcePath returns an file's source path relative to the root path
 func RelativeSourcePath(fileType uint8, SHA1 string) string {
 	return util.ConcatStrings(
@@ -67,6 +107,15 @@ func RelativeSourcePath(fileType uint8, SHA1 string) string {
 	)
 }
 
+// RenditionPath generates the file path of a thumbnail rendition
+func RenditionPath(SHA1 string, thumbType uint8, rendition int) string {
+	return filepath.Join(
+		"images",
+		thumbDirs[rendition],
+		util.ConcatStrings(SHA1, ".", common.Extensions[thumbType]),
+	)
+}
+
 func relativeThumbPath(thumbType uint8, SHA1 string) string {
 	return util.ConcatStrings(
 		"/assets/images/thumb/",
@@ -99,15 +148,33 @@ func imageRoot() string {
 
 // ThumbPath returns the path to the thumbnail of an image
 func ThumbPath(thumbType uint8, SHA1 string) string {
+	return RenditionURL(thumbType, SHA1, Thumb)
+}
+
+// RenditionURL returns the path to a thumbnail rendition of an image
+func RenditionURL(thumbType uint8, SHA1 string, rendition int) string {
 	return util.ConcatStrings(
 		imageRoot(),
-		"/thumb/",
+		"/",
+		thumbDirs[rendition],
+		"/",
 		SHA1,
 		".",
 		common.Extensions[thumbType],
 	)
 }
 
+// TranscodedURL returns the path to the transcoded rendition of a video
+func TranscodedURL(fileType uint8, SHA1 string) string {
+	return util.ConcatStrings(
+		imageRoot(),
+		"/transcoded/",
+		SHA1,
+		".",
+		common.Extensions[common.TranscodeType(fileType)],
+	)
+}
+
 // SourcePath returns the path to the source file on an image
 func SourcePath(fileType uint8, SHA1 string) string {
 	return util.ConcatStrings(
@@ -119,20 +186,26 @@ func SourcePath(fileType uint8, SHA1 string) string {
 	)
 }
 
-// Write writes file assets to disk
-func Write(SHA1 string, fileType, thumbType uint8, src, thumb []byte) error {
-	paths := GetFilePaths(SHA1, fileType, thumbType)
+// UploadPath returns the path to the temporary file of an unfinished chunked
+// upload. These are kept outside of the publically served image directories.
+func UploadPath(id string) string {
+	return filepath.Join("uploads", id)
+}
 
+// Write writes file assets to disk
+func Write(
+	SHA1 string,
+	fileType, thumbType uint8,
+	src []byte,
+	thumbs Thumbnails,
+) error {
 	ch := make(chan error)
 	go func() {
-		if thumb == nil {
-			ch <- nil
-		} else {
-			ch <- writeFile(paths[1], thumb)
-		}
+		ch <- WriteThumbnails(SHA1, thumbType, thumbs)
 	}()
 
-	for _, err := range [...]error{writeFile(paths[0], src), <-ch} {
+	err := writeFile(GetFilePaths(SHA1, fileType, thumbType)[0], src)
+	for _, err := range [...]error{err, <-ch} {
 		switch {
 		// Ignore files already written by another thread or process
 		case err == nil, os.IsExist(err):
@@ -143,6 +216,29 @@ func Write(SHA1 string, fileType, thumbType uint8, src, thumb []byte) error {
 	return nil
 }
 
+// WriteThumbnails writes all present thumbnail renditions of a file to disk
+func WriteThumbnails(SHA1 string, thumbType uint8, thumbs Thumbnails) error {
+	for i, data := range thumbs {
+		if data == nil {
+			continue
+		}
+		err := writeFile(RenditionPath(SHA1, thumbType, i), data)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTranscoded writes the transcoded rendition of a video to disk
+func WriteTranscoded(SHA1 string, fileType uint8, data []byte) error {
+	err := writeFile(TranscodedPath(SHA1, fileType), data)
+	if os.IsExist(err) {
+		err = nil
+	}
+	return err
+}
+
 // Write a single file to disk with the appropriate permissions and flags
 func writeFile(path string, data []byte) error {
 	file, err := os.OpenFile(path, fileCreationFlags, 0660)
@@ -155,32 +251,74 @@ func writeFile(path string, data []byte) error {
 	return err
 }
 
-// Delete deletes file assets belonging to a single upload
+// Delete deletes file assets belonging to a single upload, including all of
+// its thumbnail and transcoded renditions
 func Delete(SHA1 string, fileType, thumbType uint8) error {
-	for _, path := range GetFilePaths(SHA1, fileType, thumbType) {
-		// Ignore somehow absent images
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+	for _, path := range [...]string{
+		GetFilePaths(SHA1, fileType, thumbType)[0],
+		TranscodedPath(SHA1, fileType),
+	} {
+		if err := remove(path); err != nil {
+			return err
+		}
+	}
+	return DeleteThumbnails(SHA1, thumbType)
+}
+
+// DeleteThumbnails deletes all thumbnail renditions of a file
+func DeleteThumbnails(SHA1 string, thumbType uint8) error {
+	for i := range thumbDirs {
+		if err := remove(RenditionPath(SHA1, thumbType, i)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// ThumbnailsSize returns the combined size of all thumbnail renditions of a
+// file stored on disk in bytes
+func ThumbnailsSize(SHA1 string, thumbType uint8) (n int64, err error) {
+	for i := range thumbDirs {
+		info, err := os.Stat(RenditionPath(SHA1, thumbType, i))
+		switch {
+		case err == nil:
+			n += info.Size()
+		case !os.IsNotExist(err):
+			return 0, err
+		}
+	}
+	return
+}
+
+func remove(path string) error {
+	// Ignore somehow absent images. Not all files have all renditions.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // CreateDirs creates directories for processed image storage
 func CreateDirs() error {
-	for _, dir := range [...]string{"src", "thumb"} {
+	dirs := append([]string{"src", "transcoded"}, thumbDirs[:]...)
+	for _, dir := range dirs {
 		path := filepath.Join("images", dir)
 		if err := os.MkdirAll(path, 0700); err != nil {
 			return err
 		}
 	}
-	return nil
+	return os.MkdirAll("uploads", 0700)
 }
 
 // DeleteDirs recursively deletes the image storage folder. Only used for
 // cleaning up after tests.
 func DeleteDirs() error {
-	return os.RemoveAll("images")
+	for _, dir := range [...]string{"images", "uploads"} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ResetDirs removes all contents from the image storage directories. Only
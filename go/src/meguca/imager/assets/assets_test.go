@@ -133,7 +133,8 @@ func TestWriteAssets(t *testing.T) {
 		{4, 5, 6},
 	}
 
-	if err := Write(name, fileType, thumbType, std[0], std[1]); err != nil {
+	err := Write(name, fileType, thumbType, std[0], Thumbnails{std[1]})
+	if err != nil {
 		t.Fatal(err)
 	}
 
@@ -141,3 +142,73 @@ func TestWriteAssets(t *testing.T) {
 		AssertFileEquals(t, path, std[i])
 	}
 }
+
+func TestWriteAndDeleteRenditions(t *testing.T) {
+	resetDirs(t)
+
+	const (
+		name      = "bar"
+		fileType  = common.WEBM
+		thumbType = common.PNG
+	)
+	thumbs := Thumbnails{{1}, {2}, {3}}
+
+	err := Write(name, fileType, thumbType, []byte{0}, thumbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range thumbs {
+		AssertFileEquals(t, RenditionPath(name, thumbType, i), data)
+	}
+	AssertDeepEquals(
+		t,
+		RenditionPath(name, thumbType, CatalogThumb),
+		filepath.FromSlash("images/catalog/bar.png"),
+	)
+
+	size, err := ThumbnailsSize(name, thumbType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, size, thumbs.Size())
+
+	if err := Delete(name, fileType, thumbType); err != nil {
+		t.Fatal(err)
+	}
+	for i := range thumbs {
+		_, err := os.Stat(RenditionPath(name, thumbType, i))
+		if !os.IsNotExist(err) {
+			UnexpectedError(t, err)
+		}
+	}
+}
+
+func TestWriteAndDeleteTranscoded(t *testing.T) {
+	resetDirs(t)
+
+	const name = "baz"
+	std := []byte{1, 2, 3}
+	if err := WriteTranscoded(name, common.OGG, std); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.FromSlash("images/transcoded/baz.webm")
+	AssertDeepEquals(t, TranscodedPath(name, common.OGG), path)
+	AssertFileEquals(t, path, std)
+
+	if err := Delete(name, common.OGG, common.JPEG); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		UnexpectedError(t, err)
+	}
+}
+
+func TestRenditionURL(t *testing.T) {
+	t.Parallel()
+
+	AssertDeepEquals(
+		t,
+		RenditionURL(common.JPEG, "nyan", Thumb2x),
+		"/assets/images/thumb2x/nyan.jpg",
+	)
+}
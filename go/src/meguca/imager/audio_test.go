@@ -12,7 +12,12 @@ func TestProcessMP3NoCover(t *testing.T) {
 	t.Parallel()
 
 	var img common.ImageCommon
-	_, err := processFile(readSample(t, "sample.mp3"), &img, dummyOpts)
+	_, _, err := processFile(
+		readSample(t, "sample.mp3"),
+		&img,
+		dummyOpts,
+		false,
+	)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -39,7 +44,12 @@ func TestProcessMP3(t *testing.T) {
 	t.Parallel()
 
 	var img common.ImageCommon
-	thumb, err := processFile(readSample(t, "with_cover.mp3"), &img, dummyOpts)
+	_, thumb, err := processFile(
+		readSample(t, "with_cover.mp3"),
+		&img,
+		dummyOpts,
+		false,
+	)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,223 @@
+package imager
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"meguca/auth"
+	"meguca/config"
+	"meguca/db"
+	"meguca/imager/assets"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bakape/thumbnailer"
+)
+
+// Maximum size of a single chunk of a chunked upload
+const maxChunkSize = 8 << 20
+
+var (
+	errInvalidSize      = errors.New("invalid file size")
+	errInvalidSHA1      = errors.New("invalid SHA1 hash")
+	errNoUpload         = errors.New("no such upload")
+	errEmptyChunk       = errors.New("empty chunk")
+	errChunkOffset      = errors.New("chunk offset mismatch")
+	errUploadIncomplete = errors.New("upload incomplete")
+	errHashMismatch     = errors.New("file does not match SHA1 hash")
+)
+
+// Request to start a chunked upload
+type chunkedUploadRequest struct {
+	Size int64  `json:"size"`
+	SHA1 string `json:"sha1"`
+}
+
+// InitChunkedUpload starts a resumable upload of a file sent in multiple
+// chunks. The client sends the size and SHA1 hash of the file and receives an
+// upload ID. The target board is passed in the "board" query parameter.
+func InitChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	var req chunkedUploadRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req)
+	if err != nil {
+		LogError(w, r, 400, err)
+		return
+	}
+
+	board := r.URL.Query().Get("board")
+	switch {
+	case req.Size <= 0:
+		err = errInvalidSize
+	case req.Size > config.MaxUploadSize(board):
+		err = errTooLarge
+	case !isSHA1(req.SHA1):
+		err = errInvalidSHA1
+	}
+	if err != nil {
+		LogError(w, r, 400, err)
+		return
+	}
+	if code, err := checkBannedFile(req.SHA1, ""); err != nil {
+		LogError(w, r, code, err)
+		return
+	}
+
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		LogError(w, r, 400, err)
+		return
+	}
+	id, err := db.NewChunkedUpload(board, req.SHA1, ip, req.Size)
+	switch err {
+	case nil:
+		w.Write([]byte(id))
+	case db.ErrTooManyUploads:
+		LogError(w, r, 429, err)
+	default:
+		LogError(w, r, 500, err)
+	}
+}
+
+// Returns, if s is a hex-encoded SHA1 hash
+func isSHA1(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// ChunkedUploadOffset responds with the number of bytes of a chunked upload
+// received so far. Used for resuming interrupted uploads.
+func ChunkedUploadOffset(w http.ResponseWriter, r *http.Request, id string) {
+	u, ok := getChunkedUpload(w, r, id)
+	if !ok {
+		return
+	}
+	w.Write([]byte(strconv.FormatInt(u.Received, 10)))
+}
+
+// Retrieve a chunked upload and respond with an error, if it does not exist
+func getChunkedUpload(w http.ResponseWriter, r *http.Request, id string) (
+	u db.ChunkedUpload, ok bool,
+) {
+	u, err := db.GetChunkedUpload(id)
+	switch err {
+	case nil:
+		return u, true
+	case sql.ErrNoRows:
+		LogError(w, r, 404, errNoUpload)
+	default:
+		LogError(w, r, 500, err)
+	}
+	return
+}
+
+// UploadChunk writes a chunk of a chunked upload at the offset specified in
+// the "offset" query parameter. Chunks must be sent in order. Responds with
+// the number of bytes received so far.
+func UploadChunk(w http.ResponseWriter, r *http.Request, id string) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		LogError(w, r, 400, err)
+		return
+	}
+	u, ok := getChunkedUpload(w, r, id)
+	if !ok {
+		return
+	}
+	if offset != u.Received {
+		LogError(w, r, 409, errChunkOffset)
+		return
+	}
+
+	limit := u.Size - offset
+	if limit > maxChunkSize {
+		limit = maxChunkSize
+	}
+	buf, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	switch {
+	case err != nil:
+		LogError(w, r, 400, err)
+		return
+	case len(buf) == 0:
+		LogError(w, r, 400, errEmptyChunk)
+		return
+	}
+
+	f, err := os.OpenFile(assets.UploadPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		LogError(w, r, 500, err)
+		return
+	}
+	_, err = f.WriteAt(buf, offset)
+	f.Close()
+	if err != nil {
+		LogError(w, r, 500, err)
+		return
+	}
+
+	// Another request might have written this chunk concurrently
+	received := offset + int64(len(buf))
+	ok, err = db.AdvanceChunkedUpload(id, offset, received)
+	switch {
+	case err != nil:
+		LogError(w, r, 500, err)
+	case !ok:
+		LogError(w, r, 409, errChunkOffset)
+	default:
+		w.Write([]byte(strconv.FormatInt(received, 10)))
+	}
+}
+
+// FinalizeChunkedUpload verifies a completely received chunked upload against
+// its declared SHA1 hash and processes it like a file uploaded in a single
+// request. Responds with an image token or a thumbnailing job ID.
+func FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request, id string) {
+	u, ok := getChunkedUpload(w, r, id)
+	if !ok {
+		return
+	}
+	if u.Received != u.Size {
+		LogError(w, r, 400, errUploadIncomplete)
+		return
+	}
+
+	f, err := os.Open(assets.UploadPath(id))
+	switch {
+	case os.IsNotExist(err): // Finalized concurrently
+		LogError(w, r, 404, errNoUpload)
+		return
+	case err != nil:
+		LogError(w, r, 500, err)
+		return
+	}
+	buf := bytes.NewBuffer(thumbnailer.GetBuffer())
+	_, err = buf.ReadFrom(f)
+	f.Close()
+	data := buf.Bytes()
+	if err == nil {
+		// The upload is consumed regardless of the processing outcome
+		err = db.DeleteChunkedUpload(id)
+	}
+	if err != nil {
+		thumbnailer.ReturnBuffer(data)
+		LogError(w, r, 500, err)
+		return
+	}
+
+	sum := sha1.Sum(data)
+	if hex.EncodeToString(sum[:]) != u.SHA1 {
+		thumbnailer.ReturnBuffer(data)
+		LogError(w, r, 400, errHashMismatch)
+		return
+	}
+
+	code, token, j, err := acceptFile(data, u.Board)
+	serveUploadResult(w, r, code, token, j, err)
+}
@@ -0,0 +1,120 @@
+package imager
+
+import (
+	"bytes"
+	"fmt"
+	"meguca/imager/assets"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsSHA1(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		in    string
+		valid bool
+	}{
+		{assets.StdJPEG.SHA1, true},
+		{assets.StdJPEG.SHA1[:39], false},
+		{"z" + assets.StdJPEG.SHA1[1:], false},
+	}
+	for _, c := range cases {
+		if isSHA1(c.in) != c.valid {
+			t.Errorf("unexpected validity: %s", c.in)
+		}
+	}
+}
+
+// Start a chunked upload and return its ID
+func initChunkedUpload(t *testing.T, size int, SHA1 string) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"size":%d,"sha1":"%s"}`, size, SHA1)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	InitChunkedUpload(rec, req)
+	assertCode(t, rec.Code, 200)
+	return rec.Body.String()
+}
+
+func TestChunkedUpload(t *testing.T) {
+	assertTableClear(t, "images", "chunked_uploads")
+	resetDirs(t)
+
+	data := readSample(t, assets.StdJPEG.Name)
+	id := initChunkedUpload(t, len(data), assets.StdJPEG.SHA1)
+
+	putChunk := func(offset, end int) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			"PUT",
+			fmt.Sprintf("/?offset=%d", offset),
+			bytes.NewReader(data[offset:end]),
+		)
+		UploadChunk(rec, req, id)
+		return rec
+	}
+
+	half := len(data) / 2
+	rec := putChunk(0, half)
+	assertCode(t, rec.Code, 200)
+	if s := rec.Body.String(); s != fmt.Sprint(half) {
+		t.Fatalf("unexpected offset: %s", s)
+	}
+
+	// Retransmitted chunk
+	assertCode(t, putChunk(0, half).Code, 409)
+
+	// Resume from the received offset
+	rec = httptest.NewRecorder()
+	ChunkedUploadOffset(rec, httptest.NewRequest("GET", "/", nil), id)
+	assertCode(t, rec.Code, 200)
+	if s := rec.Body.String(); s != fmt.Sprint(half) {
+		t.Fatalf("unexpected offset: %s", s)
+	}
+
+	// Incomplete
+	rec = httptest.NewRecorder()
+	FinalizeChunkedUpload(rec, httptest.NewRequest("POST", "/", nil), id)
+	assertCode(t, rec.Code, 400)
+
+	assertCode(t, putChunk(half, len(data)).Code, 200)
+
+	progress, restore := captureProgress(t)
+	defer restore()
+	rec = httptest.NewRecorder()
+	FinalizeChunkedUpload(rec, httptest.NewRequest("POST", "/", nil), id)
+	assertCode(t, rec.Code, 202)
+	awaitJob(t, progress, rec.Body.String())
+	getImageRecord(t, assets.StdJPEG.SHA1)
+
+	// Upload is consumed
+	rec = httptest.NewRecorder()
+	ChunkedUploadOffset(rec, httptest.NewRequest("GET", "/", nil), id)
+	assertCode(t, rec.Code, 404)
+}
+
+func TestChunkedUploadHashMismatch(t *testing.T) {
+	assertTableClear(t, "chunked_uploads")
+	resetDirs(t)
+
+	id := initChunkedUpload(t, 3, assets.StdJPEG.SHA1)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		"/?offset=0",
+		bytes.NewReader([]byte{1, 2, 3}),
+	)
+	UploadChunk(rec, req, id)
+	assertCode(t, rec.Code, 200)
+
+	rec = httptest.NewRecorder()
+	FinalizeChunkedUpload(rec, httptest.NewRequest("POST", "/", nil), id)
+	assertCode(t, rec.Code, 400)
+	if s := rec.Body.String(); s != errHashMismatch.Error()+"\n" {
+		t.Fatalf("unexpected body: %s", s)
+	}
+}
@@ -0,0 +1,289 @@
+package imager
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bakape/thumbnailer"
+	"golang.org/x/image/webp"
+)
+
+const (
+	mimeWebP = "image/webp"
+	mimeAVIF = "image/avif"
+	mimeHEIC = "image/heic"
+	mimeHEIF = "image/heif" // Generic HEIF container
+
+	// Command line tool from libheif used for decoding HEIF based formats
+	heifConverter = "heif-convert"
+
+	// Maximum time spent converting a HEIF image
+	heifConversionTimeout = 30 * time.Second
+)
+
+var (
+	errHEIFConversion = errors.New("could not decode HEIF image")
+	errInvalidWebP    = errors.New("invalid WebP image")
+)
+
+// Detect WebP images, including animated ones
+func detectWebP(buf []byte) (string, string) {
+	if len(buf) >= 12 &&
+		bytes.HasPrefix(buf, []byte("RIFF")) &&
+		bytes.Equal(buf[8:12], []byte("WEBP")) {
+		return mimeWebP, "webp"
+	}
+	return "", ""
+}
+
+// Thumbnail a WebP image. Animated images are thumbnailed from their first
+// frame.
+func processWebP(src thumbnailer.Source, opts thumbnailer.Options) (
+	thumbnailer.Source, thumbnailer.Thumbnail, error,
+) {
+	still, width, height, err := firstWebPFrame(src.Data)
+	if err != nil {
+		return src, thumbnailer.Thumbnail{}, err
+	}
+	decoded, err := webp.Decode(bytes.NewReader(still))
+	if err != nil {
+		return src, thumbnailer.Thumbnail{}, err
+	}
+
+	// Reencode losslessly and let the thumbnailer handle scaling as for any
+	// other image
+	var buf bytes.Buffer
+	err = png.Encode(&buf, decoded)
+	if err != nil {
+		return src, thumbnailer.Thumbnail{}, err
+	}
+	res, thumb, err := thumbnailer.ProcessBuffer(buf.Bytes(), opts)
+	if err != nil {
+		return src, thumb, err
+	}
+
+	src.Dims = res.Dims
+	if width != 0 {
+		src.Width = width
+		src.Height = height
+	}
+	src.Mime = mimeWebP
+	src.Extension = "webp"
+	return src, thumb, nil
+}
+
+// Returns a still WebP image, that can be decoded by image/webp. Animated
+// images are reduced to their first frame with the canvas dimensions returned
+// separately. Still images are returned as is with zero dimensions.
+func firstWebPFrame(buf []byte) (still []byte, width, height uint, err error) {
+	if len(buf) < 12 {
+		err = errInvalidWebP
+		return
+	}
+
+	var (
+		animated bool
+		chunks   = buf[12:]
+	)
+	for len(chunks) >= 8 {
+		fourCC := string(chunks[:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		if size < 0 || 8+size > len(chunks) {
+			err = errInvalidWebP
+			return
+		}
+		payload := chunks[8 : 8+size]
+
+		switch fourCC {
+		case "VP8X":
+			if size < 10 {
+				err = errInvalidWebP
+				return
+			}
+			animated = payload[0]&0x02 != 0
+			width = uint(readUint24(payload[4:])) + 1
+			height = uint(readUint24(payload[7:])) + 1
+		case "ANMF":
+			// Frame header is followed by the frame's own ALPH, VP8 or VP8L
+			// chunks
+			if size < 16 {
+				err = errInvalidWebP
+				return
+			}
+			frame := payload[16:]
+			flags := byte(0)
+			if bytes.HasPrefix(frame, []byte("ALPH")) {
+				flags = 0x10
+			}
+			still = wrapWebPFrame(
+				frame,
+				flags,
+				readUint24(payload[6:])+1,
+				readUint24(payload[9:])+1,
+			)
+			return
+		}
+
+		// Chunks are padded to an even size
+		size += size & 1
+		if 8+size > len(chunks) {
+			break
+		}
+		chunks = chunks[8+size:]
+	}
+
+	if animated {
+		err = errInvalidWebP
+		return
+	}
+	return buf, 0, 0, nil
+}
+
+// Wrap the chunks of a single animation frame into an extended format still
+// WebP image
+func wrapWebPFrame(frame []byte, flags byte, width, height uint32) []byte {
+	buf := make([]byte, 0, 30+len(frame))
+	buf = append(buf, "RIFF\x00\x00\x00\x00WEBPVP8X"...)
+	buf = appendUint32(buf, 10)
+	buf = append(buf, flags, 0, 0, 0)
+	buf = appendUint24(buf, width-1)
+	buf = appendUint24(buf, height-1)
+	buf = append(buf, frame...)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(buf)-8))
+	return buf
+}
+
+func readUint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func appendUint24(b []byte, i uint32) []byte {
+	return append(b, byte(i), byte(i>>8), byte(i>>16))
+}
+
+func appendUint32(b []byte, i uint32) []byte {
+	return append(b, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+}
+
+// Returns the MIME type of an image in a HEIF container, if buf is one. These
+// are not supported by the thumbnailer and need to be converted first.
+func detectHEIF(buf []byte) string {
+	if len(buf) < 16 || !bytes.Equal(buf[4:8], []byte("ftyp")) {
+		return ""
+	}
+
+	switch mime := heifBrandMime(buf[8:12]); mime {
+	case "":
+		return ""
+	case mimeHEIF:
+		// Need to check the compatible brands for the actual format
+		size := int(binary.BigEndian.Uint32(buf[:4]))
+		if size > len(buf) {
+			size = len(buf)
+		}
+		for i := 16; i+4 <= size; i += 4 {
+			switch mime := heifBrandMime(buf[i : i+4]); mime {
+			case mimeAVIF, mimeHEIC:
+				return mime
+			}
+		}
+		return mimeHEIC
+	default:
+		return mime
+	}
+}
+
+func heifBrandMime(brand []byte) string {
+	switch string(brand) {
+	case "avif", "avis":
+		return mimeAVIF
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return mimeHEIC
+	case "mif1", "msf1":
+		return mimeHEIF
+	default:
+		return ""
+	}
+}
+
+// Convert an image in a HEIF container to JPEG. Returns
+// thumbnailer.UnsupportedMIMEError, if the converter is not installed.
+func heifToJPEG(data []byte, quality uint8) (jpeg []byte, err error) {
+	if _, err := exec.LookPath(heifConverter); err != nil {
+		return nil, thumbnailer.UnsupportedMIMEError(detectHEIF(data))
+	}
+
+	dir, err := ioutil.TempDir("", "meguca-heif")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "src")
+	err = ioutil.WriteFile(in, data, 0600)
+	if err != nil {
+		return
+	}
+	if quality == 0 {
+		quality = 90
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		heifConversionTimeout,
+	)
+	defer cancel()
+	err = exec.CommandContext(
+		ctx,
+		heifConverter,
+		"-q", strconv.Itoa(int(quality)),
+		in, filepath.Join(dir, "out.jpg"),
+	).Run()
+	switch err.(type) {
+	case nil:
+	case *exec.ExitError:
+		return nil, errHEIFConversion
+	default:
+		return
+	}
+
+	// Files with multiple images produce numbered output files. Use the
+	// first one.
+	out, err := filepath.Glob(filepath.Join(dir, "out*.jpg"))
+	switch {
+	case err != nil:
+		return
+	case len(out) == 0:
+		return nil, errHEIFConversion
+	}
+	sort.Strings(out)
+	return ioutil.ReadFile(out[0])
+}
+
+// Detect Opus audio in an OGG container
+func isOpus(buf []byte) bool {
+	// Identification header packet directly follows the first page's header
+	// and segment table
+	if len(buf) < 27 || !bytes.HasPrefix(buf, []byte("OggS")) {
+		return false
+	}
+	start := 27 + int(buf[26])
+	return len(buf) > start &&
+		bytes.HasPrefix(buf[start:], []byte("OpusHead"))
+}
+
+// Detect MPEG-4 audio files
+func isM4A(buf []byte) bool {
+	return len(buf) >= 12 &&
+		bytes.Equal(buf[4:8], []byte("ftyp")) &&
+		bytes.Equal(buf[8:12], []byte("M4A "))
+}
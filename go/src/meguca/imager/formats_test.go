@@ -0,0 +1,214 @@
+package imager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"meguca/common"
+	"testing"
+)
+
+func TestDetectHEIF(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, mime string
+		brands     []string
+	}{
+		{"HEIC", mimeHEIC, []string{"heic", "mif1", "heic"}},
+		{"AVIF", mimeAVIF, []string{"avif", "mif1", "miaf"}},
+		{"generic AVIF", mimeAVIF, []string{"mif1", "mif1", "avif"}},
+		{"generic HEIC", mimeHEIC, []string{"mif1", "mif1", "heic"}},
+		{"MP4", "", []string{"isom", "isom", "mp41"}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if mime := detectHEIF(ftypBox(c.brands[0], c.brands[1:]...)); mime != c.mime {
+				t.Fatalf("unexpected MIME type: %s : %s", c.mime, mime)
+			}
+		})
+	}
+}
+
+// Construct an ISO BMFF ftyp box with a major brand and a list of compatible
+// brands
+func ftypBox(major string, compatible ...string) []byte {
+	buf := make([]byte, 4, 16+4*len(compatible))
+	buf = append(buf, "ftyp"...)
+	buf = append(buf, major...)
+	buf = append(buf, 0, 0, 0, 0)
+	for _, b := range compatible {
+		buf = append(buf, b...)
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	return buf
+}
+
+func TestIsM4A(t *testing.T) {
+	t.Parallel()
+
+	if !isM4A(ftypBox("M4A ", "M4A ", "mp42", "isom")) {
+		t.Error("M4A not detected")
+	}
+	if isM4A(ftypBox("isom", "isom", "mp41")) {
+		t.Error("MP4 detected as M4A")
+	}
+}
+
+func TestIsOpus(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		file string
+		opus bool
+	}{
+		{"opus.ogg", true},
+		{"no_video.ogg", false},
+		{"sample.mp3", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.file, func(t *testing.T) {
+			t.Parallel()
+
+			if isOpus(readSample(t, c.file)) != c.opus {
+				t.Fatal("unexpected result")
+			}
+		})
+	}
+}
+
+func TestProcessOpus(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		file     string
+		fileType uint8
+	}{
+		{"opus.ogg", common.OPUS},
+		{"opus_theora.ogg", common.OGG},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.file, func(t *testing.T) {
+			t.Parallel()
+
+			var img common.ImageCommon
+			_, _, err := processFile(
+				readSample(t, c.file),
+				&img,
+				dummyOpts,
+				false,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFileType(t, img.FileType, c.fileType)
+		})
+	}
+}
+
+func TestDetectWebP(t *testing.T) {
+	t.Parallel()
+
+	mime, ext := detectWebP(animatedWebP(nil))
+	if mime != mimeWebP || ext != "webp" {
+		t.Fatalf("WebP not detected: %s %s", mime, ext)
+	}
+	if mime, _ := detectWebP(readSample(t, "sample.png")); mime != "" {
+		t.Fatal("PNG detected as WebP")
+	}
+}
+
+func TestFirstWebPFrame(t *testing.T) {
+	t.Parallel()
+
+	t.Run("still", func(t *testing.T) {
+		t.Parallel()
+
+		src := webPFile(webPChunk("VP8L", []byte{0x2f, 1, 2, 3}))
+		still, w, h, err := firstWebPFrame(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(still, src) || w != 0 || h != 0 {
+			t.Fatal("still image modified")
+		}
+	})
+
+	t.Run("animated", func(t *testing.T) {
+		t.Parallel()
+
+		frame := webPChunk("VP8L", []byte{0x2f, 1, 2, 3})
+		still, w, h, err := firstWebPFrame(animatedWebP(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != 300 || h != 200 {
+			t.Fatalf("unexpected canvas dimensions: %dx%d", w, h)
+		}
+
+		std := webPFile(
+			webPChunk("VP8X", []byte{0, 0, 0, 0, 99, 0, 0, 49, 0, 0}),
+			frame,
+		)
+		if !bytes.Equal(still, std) {
+			t.Fatalf("unexpected frame:\n%v\n%v", std, still)
+		}
+	})
+
+	t.Run("animated without frames", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, _, err := firstWebPFrame(animatedWebP(nil))
+		if err != errInvalidWebP {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Construct a 300x200 animated WebP file with a 100x50 first frame. Omits the
+// frame, if nil.
+func animatedWebP(frame []byte) []byte {
+	chunks := [][]byte{
+		webPChunk("VP8X", []byte{0x02, 0, 0, 0, 43, 1, 0, 199, 0, 0}),
+		webPChunk("ANIM", make([]byte, 6)),
+	}
+	if frame != nil {
+		header := []byte{
+			0, 0, 0, // X
+			0, 0, 0, // Y
+			99, 0, 0, // Width - 1
+			49, 0, 0, // Height - 1
+			100, 0, 0, // Duration
+			0, // Flags
+		}
+		chunks = append(chunks, webPChunk("ANMF", append(header, frame...)))
+	}
+	return webPFile(chunks...)
+}
+
+func webPFile(chunks ...[]byte) []byte {
+	buf := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		buf = append(buf, c...)
+	}
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(buf)-8))
+	return buf
+}
+
+func webPChunk(fourCC string, payload []byte) []byte {
+	buf := make([]byte, 0, 8+len(payload)+1)
+	buf = append(buf, fourCC...)
+	buf = appendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	if len(payload)&1 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
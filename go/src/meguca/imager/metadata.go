@@ -0,0 +1,498 @@
+// Stripping of location, device and other identifying metadata from uploaded
+// files
+
+package imager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// JPEG markers
+const (
+	jpegSOI   = 0xD8
+	jpegEOI   = 0xD9
+	jpegSOS   = 0xDA
+	jpegAPP1  = 0xE1
+	jpegAPP2  = 0xE2
+	jpegAPP15 = 0xEF
+	jpegCOM   = 0xFE
+)
+
+// Matroska element IDs
+const (
+	ebmlHeader    = 0x1A45DFA3
+	ebmlSegment   = 0x18538067
+	ebmlTags      = 0x1254C367
+	ebmlVoid      = 0xEC
+	ebmlUnknownSz = 1<<56 - 1
+)
+
+var (
+	errInvalidJPEG = errors.New("invalid JPEG image")
+	errInvalidPNG  = errors.New("invalid PNG image")
+
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// Strip identifying metadata from JPEG and PNG images. EXIF orientation is
+// applied to the image data itself, so the cleaned image displays the same.
+// Returns data unchanged, if it is of a different type or has nothing to strip.
+func stripImageMetadata(data []byte, jpegQuality uint8) ([]byte, error) {
+	switch {
+	case len(data) > 3 && data[0] == 0xFF && data[1] == jpegSOI:
+		return stripJPEG(data, jpegQuality)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	default:
+		return data, nil
+	}
+}
+
+// Strip identifying metadata from MP4 and WebM containers in place. The
+// stripped elements are overwritten with padding, so offsets of media data
+// remain valid. Returns, if the file was modified.
+func stripContainerMetadata(data []byte) bool {
+	switch {
+	case len(data) >= 8 && bytes.Equal(data[4:8], []byte("ftyp")):
+		return stripMP4(data)
+	case len(data) >= 4 && binary.BigEndian.Uint32(data) == ebmlHeader:
+		return stripMatroska(data)
+	default:
+		return false
+	}
+}
+
+// Remove all EXIF, XMP, IPTC and comment segments and any embedded images
+// after the main image. ICC color profiles are retained.
+func stripJPEG(data []byte, quality uint8) ([]byte, error) {
+	var (
+		out         = make([]byte, 0, len(data))
+		icc         [][]byte
+		orientation = 1
+		i           = 2
+		stripped    bool
+	)
+	out = append(out, 0xFF, jpegSOI)
+
+	for {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, errInvalidJPEG
+		}
+		marker := data[i+1]
+		switch {
+		case marker == jpegSOI, marker == jpegEOI:
+			return nil, errInvalidJPEG
+		case marker == 0xFF: // Fill byte
+			i++
+			continue
+		case marker == 0x01, marker >= 0xD0 && marker <= 0xD7: // No length
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end <= i+3 || end > len(data) {
+			return nil, errInvalidJPEG
+		}
+		seg := data[i:end]
+
+		switch {
+		case marker == jpegSOS:
+			// Entropy-coded data and any further scans follow. Drop anything
+			// appended after the end of the image, like the embedded previews
+			// and depth maps of some cameras.
+			rest := data[i:]
+			j := bytes.Index(rest[len(seg):], []byte{0xFF, jpegEOI})
+			if j != -1 {
+				n := len(seg) + j + 2
+				stripped = stripped || n != len(rest)
+				rest = rest[:n]
+			}
+			out = append(out, rest...)
+			if !stripped {
+				return data, nil
+			}
+			if orientation > 1 {
+				return reorientJPEG(out, icc, orientation, quality)
+			}
+			return out, nil
+		case marker == jpegAPP1:
+			if o := exifOrientation(seg[4:]); o != 0 {
+				orientation = o
+			}
+			stripped = true
+		case marker == jpegAPP2 && isICCProfile(seg):
+			icc = append(icc, seg)
+			out = append(out, seg...)
+		case marker >= jpegAPP2 && marker <= jpegAPP15, marker == jpegCOM:
+			stripped = true
+		default:
+			out = append(out, seg...)
+		}
+		i = end
+	}
+}
+
+func isICCProfile(seg []byte) bool {
+	return bytes.HasPrefix(seg[4:], []byte("ICC_PROFILE\x00"))
+}
+
+// Decode a JPEG image, apply its EXIF orientation and reencode it
+func reorientJPEG(data []byte, icc [][]byte, orientation int, quality uint8) (
+	[]byte, error,
+) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if quality == 0 {
+		quality = 90
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, orient(src, orientation), &jpeg.Options{
+		Quality: int(quality),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Retain the color profile
+	enc := buf.Bytes()
+	out := make([]byte, 0, len(enc))
+	out = append(out, enc[:2]...)
+	for _, seg := range icc {
+		out = append(out, seg...)
+	}
+	return append(out, enc[2:]...), nil
+}
+
+// Returns the orientation value of an EXIF APP1 segment payload or 0, if none
+func exifOrientation(b []byte) int {
+	if !bytes.HasPrefix(b, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	return tiffOrientation(b[6:])
+}
+
+// Read the orientation tag from the first IFD of TIFF structured EXIF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	off := int(order.Uint32(tiff[4:]))
+	if off < 8 || off+2 > len(tiff) {
+		return 0
+	}
+	n := int(order.Uint16(tiff[off:]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 { // Orientation
+			o := int(order.Uint16(tiff[e+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// Transform an image according to an EXIF orientation value
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	if orientation <= 1 || orientation > 8 {
+		return rgba
+	}
+
+	dw, dh := w, h
+	if orientation >= 5 { // Rotated by 90 degrees
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180 degrees
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Rotated 90 degrees clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90 degrees counterclockwise
+				dx, dy = y, w-1-x
+			}
+			si := rgba.PixOffset(x, y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):], rgba.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// Remove textual, timestamp and EXIF chunks from a PNG image
+func stripPNG(data []byte) ([]byte, error) {
+	var (
+		out         = make([]byte, 0, len(data))
+		orientation int
+		stripped    bool
+	)
+	out = append(out, pngSignature...)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errInvalidPNG
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end < i+12 || end > len(data) {
+			return nil, errInvalidPNG
+		}
+
+		switch string(data[i+4 : i+8]) {
+		case "IEND":
+			// Drop any data appended after the image
+			out = append(out, data[i:end]...)
+			stripped = stripped || end != len(data)
+			i = len(data)
+			continue
+		case "eXIf":
+			orientation = tiffOrientation(data[i+8 : end-4])
+			stripped = true
+		case "tEXt", "zTXt", "iTXt", "tIME":
+			stripped = true
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	switch {
+	case !stripped:
+		return data, nil
+	case orientation > 1:
+		src, err := png.Decode(bytes.NewReader(out))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = png.Encode(&buf, orient(src, orientation))
+		return buf.Bytes(), err
+	default:
+		return out, nil
+	}
+}
+
+// Overwrite user data and metadata boxes of an MP4 file, that can contain GPS
+// coordinates and device information, with free space boxes
+func stripMP4(data []byte) (stripped bool) {
+	for _, box := range mp4Boxes(data) {
+		switch string(box[4:8]) {
+		case "meta", "uuid":
+			stripped = freeMP4Box(box) || stripped
+		case "moov":
+			for _, child := range mp4Boxes(mp4Payload(box)) {
+				switch string(child[4:8]) {
+				case "udta", "meta":
+					stripped = freeMP4Box(child) || stripped
+				case "trak":
+					for _, c := range mp4Boxes(mp4Payload(child)) {
+						switch string(c[4:8]) {
+						case "udta", "meta":
+							stripped = freeMP4Box(c) || stripped
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// Split a sequence of MP4 boxes
+func mp4Boxes(b []byte) (boxes [][]byte) {
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b))
+		switch size {
+		case 0: // Extends to end of file
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+		}
+		if size < 8 || size > uint64(len(b)) {
+			return
+		}
+		boxes = append(boxes, b[:size])
+		b = b[size:]
+	}
+	return
+}
+
+// Returns the contents of an MP4 box without its header
+func mp4Payload(box []byte) []byte {
+	if binary.BigEndian.Uint32(box) == 1 { // 64 bit size
+		return box[16:]
+	}
+	return box[8:]
+}
+
+// Turn an MP4 box into a zeroed free space box
+func freeMP4Box(box []byte) bool {
+	if string(box[4:8]) == "free" {
+		return false
+	}
+	copy(box[4:8], "free")
+	zero(mp4Payload(box))
+	return true
+}
+
+// Overwrite the tags of a Matroska file, that can contain location and
+// device information, with void elements
+func stripMatroska(data []byte) bool {
+	for i := 0; i < len(data); {
+		id, idLen := readEBMLID(data[i:])
+		if idLen == 0 {
+			return false
+		}
+		size, sizeLen := readEBMLSize(data[i+idLen:])
+		if sizeLen == 0 {
+			return false
+		}
+		start := i + idLen + sizeLen
+
+		if id == ebmlSegment {
+			end := len(data)
+			if size != ebmlUnknownSz && size < uint64(end-start) {
+				end = start + int(size)
+			}
+			return stripMatroskaSegment(data[start:end])
+		}
+		if size == ebmlUnknownSz || size > uint64(len(data)-start) {
+			return false
+		}
+		i = start + int(size)
+	}
+	return false
+}
+
+func stripMatroskaSegment(data []byte) (stripped bool) {
+	for i := 0; i < len(data); {
+		id, idLen := readEBMLID(data[i:])
+		if idLen == 0 {
+			return
+		}
+		size, sizeLen := readEBMLSize(data[i+idLen:])
+		if sizeLen == 0 || size == ebmlUnknownSz {
+			return
+		}
+		end := uint64(i+idLen+sizeLen) + size
+		if end > uint64(len(data)) {
+			return
+		}
+		if id == ebmlTags && voidEBMLElement(data[i:end]) {
+			stripped = true
+		}
+		i = int(end)
+	}
+	return
+}
+
+// Read an EBML element ID including its length marker bits
+func readEBMLID(b []byte) (id uint32, n int) {
+	if len(b) == 0 || b[0] == 0 {
+		return
+	}
+	n = 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 4 || n > len(b) {
+		return 0, 0
+	}
+	for _, c := range b[:n] {
+		id = id<<8 | uint32(c)
+	}
+	return
+}
+
+// Read an EBML element data size. Unknown sizes are returned as
+// ebmlUnknownSz.
+func readEBMLSize(b []byte) (size uint64, n int) {
+	if len(b) == 0 || b[0] == 0 {
+		return
+	}
+	n = 1
+	mask := byte(0x80)
+	for ; b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > len(b) {
+		return 0, 0
+	}
+	size = uint64(b[0] & (mask - 1))
+	allOnes := size == uint64(mask-1)
+	for _, c := range b[1:n] {
+		size = size<<8 | uint64(c)
+		allOnes = allOnes && c == 0xFF
+	}
+	if allOnes {
+		size = ebmlUnknownSz
+	}
+	return
+}
+
+// Overwrite an EBML element with a zeroed void element of the same length
+func voidEBMLElement(el []byte) bool {
+	total := len(el)
+	for n := 8; n >= 1; n-- {
+		size := total - 1 - n
+		if size < 0 || uint64(size) >= 1<<(7*uint(n))-1 {
+			continue
+		}
+		zero(el)
+		el[0] = ebmlVoid
+		v := uint64(size) | 1<<(7*uint(n))
+		for i := n; i >= 1; i-- {
+			el[i] = byte(v)
+			v >>= 8
+		}
+		return true
+	}
+	return false
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,168 @@
+package imager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	. "meguca/test"
+	"testing"
+)
+
+func TestStripJPEG(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := buf.Bytes()
+
+	// Insert an EXIF segment rotating the image by 90 degrees and a comment.
+	// Append a trailing embedded preview.
+	data := append([]byte{}, enc[:2]...)
+	data = append(data, jpegSegment(jpegAPP1, exifData(6))...)
+	data = append(data, jpegSegment(jpegCOM, []byte("Taken by Anon"))...)
+	data = append(data, enc[2:]...)
+	data = append(data, 0xFF, jpegSOI, 0xFF, jpegEOI)
+
+	res, err := stripImageMetadata(data, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range [...]string{"Exif", "Taken by Anon"} {
+		if bytes.Contains(res, []byte(s)) {
+			t.Fatalf("metadata not stripped: %s", s)
+		}
+	}
+
+	conf, err := jpeg.DecodeConfig(bytes.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, [2]int{conf.Width, conf.Height}, [2]int{2, 4})
+
+	// Nothing to strip
+	clean, err := stripImageMetadata(enc, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertBufferEquals(t, clean, enc)
+}
+
+// Construct a JPEG segment with a marker and payload
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// Construct an EXIF APP1 payload with an orientation tag
+func exifData(orientation uint16) []byte {
+	b := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 16)
+	binary.BigEndian.PutUint16(entry, 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	return append(b, entry...)
+}
+
+func TestStripPNG(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := buf.Bytes()
+
+	// Insert a text chunk before IEND
+	iend := len(enc) - 12
+	data := append([]byte{}, enc[:iend]...)
+	data = append(data, pngChunk("tEXt", []byte("Author\x00Anon"))...)
+	data = append(data, enc[iend:]...)
+
+	res, err := stripImageMetadata(data, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertBufferEquals(t, res, enc)
+}
+
+// Construct a PNG chunk. The CRC is left empty.
+func pngChunk(typ string, payload []byte) []byte {
+	c := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(c, uint32(len(payload)))
+	c = append(c, typ...)
+	c = append(c, payload...)
+	return append(c, 0, 0, 0, 0)
+}
+
+func TestStripMP4(t *testing.T) {
+	t.Parallel()
+
+	udta := mp4Box("udta", []byte("+51.5074-000.1278/"))
+	mvhd := mp4Box("mvhd", []byte{1, 2, 3, 4})
+	data := ftypBox("isom", "isom", "mp41")
+	data = append(data, mp4Box("moov", append(mvhd, udta...))...)
+	size := len(data)
+
+	if !stripContainerMetadata(data) {
+		t.Fatal("not stripped")
+	}
+	AssertDeepEquals(t, len(data), size)
+	if bytes.Contains(data, []byte("+51.5074")) {
+		t.Fatal("location not stripped")
+	}
+	if !bytes.Contains(data, mvhd) {
+		t.Fatal("movie header modified")
+	}
+	if !bytes.Contains(data, []byte("free")) {
+		t.Fatal("no free box")
+	}
+
+	// Already stripped
+	if stripContainerMetadata(data) {
+		t.Fatal("stripped twice")
+	}
+}
+
+// Construct an MP4 box
+func mp4Box(typ string, payload []byte) []byte {
+	b := make([]byte, 4, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	b = append(b, typ...)
+	return append(b, payload...)
+}
+
+func TestStripMatroska(t *testing.T) {
+	t.Parallel()
+
+	tags := []byte{0x12, 0x54, 0xC3, 0x67, 0x85, 'h', 'e', 'l', 'l', 'o'}
+	info := []byte{0x15, 0x49, 0xA9, 0x66, 0x80}
+	data := []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80} // Empty EBML header
+	data = append(data, 0x18, 0x53, 0x80, 0x67,
+		0x80|byte(len(tags)+len(info)))
+	tagsStart := len(data)
+	data = append(data, tags...)
+	data = append(data, info...)
+	size := len(data)
+
+	if !stripContainerMetadata(data) {
+		t.Fatal("not stripped")
+	}
+	AssertDeepEquals(t, len(data), size)
+	if bytes.Contains(data, []byte("hello")) {
+		t.Fatal("tags not stripped")
+	}
+	AssertBufferEquals(t, data[size-len(info):], info)
+
+	id, n := readEBMLID(data[tagsStart:])
+	AssertDeepEquals(t, id, uint32(ebmlVoid))
+	elSize, m := readEBMLSize(data[tagsStart+n:])
+	AssertDeepEquals(t, n+m+int(elSize), len(tags))
+}
@@ -0,0 +1,79 @@
+package imager
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg" // Thumbnail decoders
+	_ "image/png"
+)
+
+// Dimensions of the grayscale grid a perceptual hash is computed from. Each
+// row produces 8 bits by comparing adjacent cells.
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+var errEmptyImage = errors.New("empty image")
+
+// Compute a 64 bit difference hash (dHash) of an encoded thumbnail. The image
+// is downscaled to a 9x8 grayscale grid and each bit records, if brightness
+// increases between two horizontally adjacent cells. Rescaled, recompressed or
+// slightly color-adjusted copies of an image produce hashes within a small
+// Hamming distance of each other.
+func perceptualHash(thumb []byte) (hash uint64, err error) {
+	src, _, err := image.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		return
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		err = errEmptyImage
+		return
+	}
+
+	// Average luminance of each cell
+	var grid [hashHeight][hashWidth]float64
+	for y := 0; y < hashHeight; y++ {
+		y0, y1 := cellBounds(b.Min.Y, h, y, hashHeight)
+		for x := 0; x < hashWidth; x++ {
+			x0, x1 := cellBounds(b.Min.X, w, x, hashWidth)
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, _ := src.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) +
+						0.114*float64(bl)
+				}
+			}
+			grid[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if grid[y][x] < grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return
+}
+
+// Returns the source pixel range of cell i out of n along an axis of length
+// l starting at min. Each cell spans at least one pixel.
+func cellBounds(min, l, i, n int) (start, end int) {
+	start = min + i*l/n
+	end = min + (i+1)*l/n
+	if end <= start {
+		end = start + 1
+	}
+	if end > min+l {
+		end = min + l
+		start = end - 1
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package imager
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+	"testing"
+)
+
+// Generate a 150x100 image with a diagonal gradient and a dark square
+func testImage(invert bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 150, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 150; x++ {
+			v := uint8((x + y) * 255 / 250)
+			if x > 40 && x < 80 && y > 30 && y < 70 {
+				v /= 4
+			}
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var w bytes.Buffer
+	err := jpeg.Encode(&w, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Bytes()
+}
+
+func mustHash(t *testing.T, buf []byte) uint64 {
+	t.Helper()
+	h, err := perceptualHash(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestPerceptualHash(t *testing.T) {
+	t.Parallel()
+
+	src := testImage(false)
+	std := mustHash(t, encodeJPEG(t, src, 90))
+	if std == 0 {
+		t.Fatal("empty hash")
+	}
+
+	var w bytes.Buffer
+	if err := png.Encode(&w, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half-size copy
+	small := image.NewRGBA(image.Rect(0, 0, 75, 50))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 75; x++ {
+			small.Set(x, y, src.At(x*2, y*2))
+		}
+	}
+
+	cases := [...]struct {
+		name    string
+		buf     []byte
+		similar bool
+	}{
+		{"lossless", w.Bytes(), true},
+		{"recompressed", encodeJPEG(t, src, 20), true},
+		{"rescaled", encodeJPEG(t, small, 90), true},
+		{"different", encodeJPEG(t, testImage(true), 90), false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			dist := bits.OnesCount64(std ^ mustHash(t, c.buf))
+			if c.similar && dist > 6 {
+				t.Fatalf("distance too large: %d", dist)
+			}
+			if !c.similar && dist < 20 {
+				t.Fatalf("distance too small: %d", dist)
+			}
+		})
+	}
+}
+
+func TestPerceptualHashInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := perceptualHash([]byte("not an image")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,314 @@
+package imager
+
+import (
+	"errors"
+	"log"
+	"meguca/auth"
+	"meguca/common"
+	"meguca/config"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bakape/thumbnailer"
+)
+
+// Stages of a thumbnailing job reported to the uploader
+const (
+	jobQueued uint8 = iota
+	jobProcessing
+	jobDone
+	jobFailed
+)
+
+const (
+	// Maximum number of jobs waiting for a free worker. Further uploads are
+	// rejected, until the queue drains.
+	maxQueuedJobs = 64
+
+	// Maximum total size of the files of jobs waiting for a free worker.
+	// Queued files are kept in memory, so this bounds the memory used by the
+	// queue.
+	maxQueuedBytes = 256 << 20
+
+	// Time to keep the result of a finished job for retrieval
+	jobResultTTL = time.Minute
+
+	// Maximum time to block a job result request for
+	jobResultTimeout = 30 * time.Second
+)
+
+var (
+	errQueueFull   = errors.New("thumbnailing queue full")
+	errJobNotFound = errors.New("thumbnailing job not found")
+
+	// Guards the number of running thumbnailing jobs, the jobs waiting for a
+	// worker, in order of arrival, and the total size of their files
+	queueMu     sync.Mutex
+	running     int
+	queued      []*waiter
+	queuedBytes int
+
+	// Asynchronous jobs by ID
+	jobsMu sync.Mutex
+	jobs   = make(map[string]*job)
+
+	// Sends a message to the websocket client with the passed ID and IP.
+	// Overridable in tests.
+	sendToClient = func(ip, clientID string, msg []byte) {
+		if clientID == "" {
+			return
+		}
+		if cl := common.GetByIPAndID(ip, clientID); cl != nil {
+			cl.Send(msg)
+		}
+	}
+)
+
+// Job waiting in the queue for a free worker
+type waiter struct {
+	size   int
+	ready  chan struct{}
+	report func(status uint8, position int)
+}
+
+// Thumbnailing job of an uploaded file, that is not yet stored on the server
+type job struct {
+	id, board, ip string
+
+	// ID of the uploader's websocket client, that is sent progress reports
+	clientID string
+
+	data []byte
+	img  common.ImageCommon
+
+	// Closed, when the job is finished and the result fields are set
+	done  chan struct{}
+	code  int
+	token string
+	err   error
+}
+
+// Progress report of a thumbnailing job sent to the uploader's websocket
+// client. Token is only set after the file has been successfully processed.
+type jobProgress struct {
+	Status   uint8  `json:"status"`
+	Position int    `json:"position,omitempty"`
+	ID       string `json:"id"`
+	Token    string `json:"token,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func newJob(data []byte, img common.ImageCommon, board string) (
+	*job, error,
+) {
+	id, err := auth.RandomID(16)
+	if err != nil {
+		return nil, err
+	}
+	return &job{
+		id:    id,
+		board: board,
+		data:  data,
+		img:   img,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Maximum number of concurrently running thumbnailing jobs
+func workerCount() int {
+	if n := int(config.Get().ThumbnailWorkers); n != 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+// Reserve a worker slot or, if none is free, a position in the queue. Returns
+// a nil channel in the first case or one, that is closed, once a worker slot
+// has been assigned, in the second. report is called with the position in the
+// queue on enqueueing and each time the queue advances. size is the size of
+// the job's file. If limit is set and the queue is full or a file of this size
+// would exceed the total size limit of the queue, returns errQueueFull.
+func reserveWorker(
+	report func(status uint8, position int),
+	size int,
+	limit bool,
+) (
+	<-chan struct{}, error,
+) {
+	queueMu.Lock()
+	if running < workerCount() && len(queued) == 0 {
+		running++
+		queueMu.Unlock()
+		return nil, nil
+	}
+	if limit && (len(queued) >= maxQueuedJobs ||
+		queuedBytes+size > maxQueuedBytes) {
+		queueMu.Unlock()
+		return nil, errQueueFull
+	}
+	w := &waiter{
+		size:   size,
+		ready:  make(chan struct{}),
+		report: report,
+	}
+	queued = append(queued, w)
+	queuedBytes += size
+	position := len(queued)
+	queueMu.Unlock()
+
+	if report != nil {
+		report(jobQueued, position)
+	}
+	return w.ready, nil
+}
+
+// Block until a worker slot is free. Not subject to the queue limits, but
+// counts towards the total size of queued files.
+func acquireWorker(report func(status uint8, position int), size int) {
+	ready, _ := reserveWorker(report, size, false)
+	if ready != nil {
+		<-ready
+	}
+}
+
+// Free a worker slot, assign free slots to queued jobs and report the new
+// positions of jobs still in the queue
+func releaseWorker() {
+	queueMu.Lock()
+	running--
+
+	// Loop, because the worker count might have been raised in the meantime
+	started := 0
+	for running < workerCount() && len(queued) != 0 {
+		close(queued[0].ready)
+		queuedBytes -= queued[0].size
+		queued = queued[1:]
+		running++
+		started++
+	}
+	var remaining []*waiter
+	if started != 0 {
+		remaining = append(remaining, queued...)
+	}
+	queueMu.Unlock()
+
+	for i, w := range remaining {
+		if w.report != nil {
+			w.report(jobQueued, i+1)
+		}
+	}
+}
+
+// Thumbnail the file in the worker pool and return an image token on success.
+// Blocks until the job has been processed.
+func (j *job) process() (int, string, error) {
+	defer thumbnailer.ReturnBuffer(j.data)
+
+	acquireWorker(nil, len(j.data))
+	defer releaseWorker()
+	return newThumbnail(j.data, j.img, j.board)
+}
+
+// Queue the file for thumbnailing in the worker pool and register the job for
+// result retrieval. The progress and result are reported to the uploader's
+// websocket client. Returns errQueueFull, if the queue is full.
+func (j *job) start() error {
+	report := func(status uint8, position int) {
+		j.notify(jobProgress{
+			Status:   status,
+			Position: position,
+		})
+	}
+	ready, err := reserveWorker(report, len(j.data), true)
+	if err != nil {
+		thumbnailer.ReturnBuffer(j.data)
+		return err
+	}
+
+	jobsMu.Lock()
+	jobs[j.id] = j
+	jobsMu.Unlock()
+
+	go func() {
+		defer thumbnailer.ReturnBuffer(j.data)
+
+		if ready != nil {
+			<-ready
+		}
+		report(jobProcessing, 0)
+		j.code, j.token, j.err = newThumbnail(j.data, j.img, j.board)
+		releaseWorker()
+		j.finish()
+	}()
+	return nil
+}
+
+// Report the result of the job to the uploader and schedule its removal from
+// the job registry
+func (j *job) finish() {
+	close(j.done)
+	time.AfterFunc(jobResultTTL, func() {
+		jobsMu.Lock()
+		delete(jobs, j.id)
+		jobsMu.Unlock()
+	})
+
+	if j.err != nil {
+		if j.code >= 500 && !isTest {
+			log.Printf("thumbnailing error: %s: %s\n", j.ip, j.err)
+		}
+		j.notify(jobProgress{
+			Status: jobFailed,
+			Error:  j.err.Error(),
+		})
+		return
+	}
+	j.notify(jobProgress{
+		Status: jobDone,
+		Token:  j.token,
+	})
+}
+
+// Send a progress report to the uploader
+func (j *job) notify(p jobProgress) {
+	p.ID = j.id
+	msg, err := common.EncodeMessage(common.MessageUploadProgress, p)
+	if err != nil {
+		log.Printf("thumbnailing: %s\n", err)
+		return
+	}
+	sendToClient(j.ip, j.clientID, msg)
+}
+
+// UploadJobResult responds with the image token of a finished asynchronous
+// thumbnailing job. Blocks for a limited time, if the job is not finished
+// yet, and responds with 202, if it still is not. Only the uploader's IP can
+// retrieve the result.
+func UploadJobResult(w http.ResponseWriter, r *http.Request, id string) {
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		LogError(w, r, 400, err)
+		return
+	}
+	jobsMu.Lock()
+	j := jobs[id]
+	jobsMu.Unlock()
+	if j == nil || j.ip != ip {
+		LogError(w, r, 404, errJobNotFound)
+		return
+	}
+
+	select {
+	case <-j.done:
+	case <-time.After(jobResultTimeout):
+		w.WriteHeader(202)
+		return
+	}
+	if j.err != nil {
+		LogError(w, r, j.code, j.err)
+		return
+	}
+	w.Write([]byte(j.token))
+}
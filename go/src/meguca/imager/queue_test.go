@@ -0,0 +1,222 @@
+package imager
+
+import (
+	"encoding/json"
+	"meguca/common"
+	"meguca/config"
+	. "meguca/test"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Redirect progress reports of thumbnailing jobs to a channel. Call restore to
+// revert.
+func captureProgress(t *testing.T) (ch <-chan jobProgress, restore func()) {
+	t.Helper()
+
+	c := make(chan jobProgress, 8)
+	old := sendToClient
+	sendToClient = func(_, _ string, msg []byte) {
+		typ, _ := strconv.Atoi(string(msg[:2]))
+		if common.MessageType(typ) != common.MessageUploadProgress {
+			t.Errorf("unexpected message type: %d", typ)
+			return
+		}
+		var p jobProgress
+		if err := json.Unmarshal(msg[2:], &p); err != nil {
+			t.Error(err)
+			return
+		}
+		c <- p
+	}
+	return c, func() {
+		sendToClient = old
+	}
+}
+
+// Read progress reports of a job until it is finished and return the final
+// report
+func awaitJob(t *testing.T, progress <-chan jobProgress, id string) (
+	p jobProgress,
+) {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case p = <-progress:
+		case <-timeout:
+			t.Fatal("timed out waiting for thumbnailing job")
+		}
+		if id != "" && p.ID != id {
+			t.Fatalf("unexpected job ID: %s : %s", id, p.ID)
+		}
+		switch p.Status {
+		case jobFailed:
+			t.Fatal(p.Error)
+		case jobDone:
+			return
+		}
+	}
+}
+
+// Set the number of thumbnailing workers. Call restore to revert.
+func setWorkerCount(n uint) (restore func()) {
+	old := *config.Get()
+	conf := old
+	conf.ThumbnailWorkers = n
+	config.Set(conf)
+	return func() {
+		config.Set(old)
+	}
+}
+
+func TestWorkerPoolLimit(t *testing.T) {
+	defer setWorkerCount(2)()
+
+	var (
+		wg               sync.WaitGroup
+		mu               sync.Mutex
+		concurrent, peak int
+		queued           int
+		release          = make(chan struct{})
+		allStarted       = make(chan struct{}, 4)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			acquireWorker(func(status uint8, _ int) {
+				if status == jobQueued {
+					mu.Lock()
+					queued++
+					mu.Unlock()
+				}
+			}, 0)
+			mu.Lock()
+			concurrent++
+			if concurrent > peak {
+				peak = concurrent
+			}
+			mu.Unlock()
+			allStarted <- struct{}{}
+
+			<-release
+			mu.Lock()
+			concurrent--
+			mu.Unlock()
+			releaseWorker()
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		<-allStarted
+	}
+	select {
+	case <-allStarted:
+		t.Fatal("worker limit exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	wg.Wait()
+
+	if peak != 2 {
+		t.Fatalf("unexpected peak concurrency: %d", peak)
+	}
+	if queued != 2 {
+		t.Fatalf("unexpected number of queued jobs: %d", queued)
+	}
+}
+
+func TestQueuePositions(t *testing.T) {
+	defer setWorkerCount(1)()
+
+	ready, err := reserveWorker(nil, 0, true)
+	if err != nil || ready != nil {
+		t.Fatalf("worker not reserved: %v", err)
+	}
+
+	// Queue 2 jobs and record the positions reported to the second one
+	var (
+		mu        sync.Mutex
+		positions []int
+	)
+	first, err := reserveWorker(nil, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := reserveWorker(func(status uint8, pos int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status == jobQueued {
+			positions = append(positions, pos)
+		}
+	}, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	releaseWorker()
+	<-first
+	releaseWorker()
+	<-second
+	releaseWorker()
+
+	mu.Lock()
+	defer mu.Unlock()
+	AssertDeepEquals(t, positions, []int{2, 1})
+}
+
+func TestQueueFull(t *testing.T) {
+	defer setWorkerCount(1)()
+
+	if _, err := reserveWorker(nil, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	waiting := make([]<-chan struct{}, maxQueuedJobs)
+	for i := range waiting {
+		ready, err := reserveWorker(nil, 0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waiting[i] = ready
+	}
+
+	if _, err := reserveWorker(nil, 0, true); err != errQueueFull {
+		UnexpectedError(t, err)
+	}
+
+	// Drain the queue
+	for _, ready := range waiting {
+		releaseWorker()
+		<-ready
+	}
+	releaseWorker()
+}
+
+func TestQueueFullBytes(t *testing.T) {
+	defer setWorkerCount(1)()
+
+	if _, err := reserveWorker(nil, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := reserveWorker(nil, maxQueuedBytes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reserveWorker(nil, 1, true); err != errQueueFull {
+		UnexpectedError(t, err)
+	}
+
+	// Drain the queue
+	releaseWorker()
+	<-ready
+	releaseWorker()
+
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	AssertDeepEquals(t, queuedBytes, 0)
+}
@@ -0,0 +1,305 @@
+package imager
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"meguca/common"
+	"meguca/config"
+	"meguca/db"
+	"meguca/imager/assets"
+	"os"
+	"sync"
+
+	"github.com/bakape/thumbnailer"
+	"golang.org/x/image/draw"
+)
+
+// Build thumbnailing options from the current server configuration
+func thumbnailOptions() thumbnailer.Options {
+	conf := config.Get()
+	return thumbnailer.Options{
+		JPEGQuality: conf.JPEGQuality,
+		MaxSourceDims: thumbnailer.Dims{
+			Width:  uint(conf.MaxWidth),
+			Height: uint(conf.MaxHeight),
+		},
+		ThumbDims: thumbnailer.Dims{
+			Width:  uint(conf.ThumbWidth),
+			Height: uint(conf.ThumbHeight),
+		},
+		AcceptedMimeTypes: allowedMimeTypes,
+	}
+}
+
+// Bounding box of catalog thumbnails from the current server configuration
+func catalogThumbDims() thumbnailer.Dims {
+	conf := config.Get()
+	return thumbnailer.Dims{
+		Width:  uint(conf.CatalogThumbWidth),
+		Height: uint(conf.CatalogThumbHeight),
+	}
+}
+
+// Generate the double resolution and catalog renditions of a file's thumbnail
+// produced by processFile. The double resolution rendition is only generated,
+// if the source is larger than the standard thumbnail, and the catalog
+// rendition only, if the standard thumbnail does not fit the catalog bounding
+// box.
+func generateRenditions(
+	data, thumb []byte,
+	img *common.ImageCommon,
+	opts thumbnailer.Options,
+	catalog thumbnailer.Dims,
+) (
+	thumbs assets.Thumbnails,
+	err error,
+) {
+	thumbs[assets.Thumb] = thumb
+	if thumb == nil {
+		return
+	}
+
+	// Only files with a source image, that was downscaled to fit the
+	// thumbnail, benefit from a higher resolution thumbnail
+	if img.Dims[0] > img.Dims[2] || img.Dims[1] > img.Dims[3] {
+		thumbs[assets.Thumb2x], err = thumbnail2x(data, img, opts)
+		if err != nil {
+			return
+		}
+	}
+
+	// Downscale from the highest resolution available
+	src := thumbs[assets.Thumb2x]
+	if src == nil {
+		src = thumb
+	}
+	w, h := fitDims(
+		uint(img.Dims[2]),
+		uint(img.Dims[3]),
+		catalog.Width,
+		catalog.Height,
+	)
+	if w == uint(img.Dims[2]) && h == uint(img.Dims[3]) {
+		return
+	}
+	thumbs[assets.CatalogThumb], err = scaleThumbnail(
+		src,
+		img.ThumbType,
+		w, h,
+		opts.JPEGQuality,
+	)
+	if err != nil {
+		return
+	}
+	img.CatalogDims = [2]uint16{uint16(w), uint16(h)}
+	return
+}
+
+// Thumbnail the file again with double the thumbnail dimensions
+func thumbnail2x(
+	data []byte,
+	img *common.ImageCommon,
+	opts thumbnailer.Options,
+) (
+	[]byte, error,
+) {
+	if img.FileType == common.AVIF {
+		var err error
+		data, err = heifToJPEG(data, opts.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts.ThumbDims.Width *= 2
+	opts.ThumbDims.Height *= 2
+	_, thumb, err := thumbnailer.ProcessBuffer(data, opts)
+	switch err {
+	case nil:
+	case thumbnailer.ErrNoCoverArt:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	if thumb.Data == nil {
+		return nil, nil
+	}
+
+	// The source might not be much larger than the standard thumbnail or
+	// the thumbnail type might differ
+	larger := thumb.Width > uint(img.Dims[2]) ||
+		thumb.Height > uint(img.Dims[3])
+	if !larger || thumb.IsPNG != (img.ThumbType == common.PNG) {
+		thumbnailer.ReturnBuffer(thumb.Data)
+		return nil, nil
+	}
+	img.Dims2x = [2]uint16{uint16(thumb.Width), uint16(thumb.Height)}
+	return thumb.Data, nil
+}
+
+// Fit the dimensions into a bounding box, preserving the aspect ratio
+func fitDims(w, h, maxW, maxH uint) (uint, uint) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	scale := float64(maxW) / float64(w)
+	if s := float64(maxH) / float64(h); s < scale {
+		scale = s
+	}
+	w = uint(float64(w)*scale + 0.5)
+	h = uint(float64(h)*scale + 0.5)
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+	return w, h
+}
+
+// Downscale an encoded thumbnail and encode it with the same thumbnail type
+func scaleThumbnail(thumb []byte, thumbType uint8, w, h uint, quality uint8) (
+	[]byte, error,
+) {
+	src, _, err := image.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if thumbType == common.PNG {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: int(quality)})
+	}
+	return buf.Bytes(), err
+}
+
+// RegenerateThumbnails regenerates the thumbnails and their renditions of all
+// stored files from their source files with the current thumbnail
+// configuration. Files are processed in the thumbnailing worker pool.
+// Failures of individual files are logged and do not abort the process.
+func RegenerateThumbnails() error {
+	var (
+		wg            sync.WaitGroup
+		mu            sync.Mutex
+		total, failed int
+		opts, catalog = thumbnailOptions(), catalogThumbDims()
+	)
+	err := db.ForEachImage(func(img common.ImageCommon) error {
+		total++
+		acquireWorker(nil, 0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer releaseWorker()
+
+			err := regenerateFileThumbnails(img, opts, catalog)
+			if err != nil {
+				log.Printf("thumbnail regeneration: %s: %s\n", img.SHA1, err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+	log.Printf(
+		"regenerated thumbnails of %d files, %d failed\n",
+		total-failed, failed,
+	)
+	return err
+}
+
+// RecountStorage reads the sizes of the thumbnails and transcoded renditions of
+// all stored files from disk and records them for storage accounting. Files
+// stored before storage accounting was introduced are not counted otherwise.
+func RecountStorage() error {
+	var total, failed int
+	err := db.ForEachImage(func(img common.ImageCommon) error {
+		total++
+		err := recountFileStorage(img)
+		if err != nil {
+			log.Printf("storage recount: %s: %s\n", img.SHA1, err)
+			failed++
+		}
+		return nil
+	})
+	log.Printf(
+		"recounted storage of %d files, %d failed\n",
+		total-failed, failed,
+	)
+	return err
+}
+
+// Read the sizes of the thumbnails and transcoded rendition of a stored file
+// and record them
+func recountFileStorage(img common.ImageCommon) error {
+	thumbSize, err := assets.ThumbnailsSize(img.SHA1, img.ThumbType)
+	if err != nil {
+		return err
+	}
+	var transcodedSize int64
+	if img.Transcoded {
+		info, err := os.Stat(assets.TranscodedPath(img.SHA1, img.FileType))
+		switch {
+		case err == nil:
+			transcodedSize = info.Size()
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+	return db.SetStorageSizes(img.SHA1, thumbSize, transcodedSize)
+}
+
+// Regenerate the thumbnail renditions of a single stored file
+func regenerateFileThumbnails(
+	img common.ImageCommon,
+	opts thumbnailer.Options,
+	catalog thumbnailer.Dims,
+) error {
+	path := assets.GetFilePaths(img.SHA1, img.FileType, img.ThumbType)[0]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Start with a clean record, so no stale thumbnail data is kept
+	regen := common.ImageCommon{SHA1: img.SHA1}
+	_, thumb, err := processFile(data, &regen, opts, false)
+	if err != nil {
+		return err
+	}
+	thumbs, err := generateRenditions(data, thumb, &regen, opts, catalog)
+	defer returnThumbnails(thumbs)
+	if err != nil {
+		return err
+	}
+
+	err = assets.DeleteThumbnails(img.SHA1, img.ThumbType)
+	if err != nil {
+		return err
+	}
+	err = assets.WriteThumbnails(img.SHA1, regen.ThumbType, thumbs)
+	if err != nil {
+		return err
+	}
+	return db.UpdateThumbnails(regen, thumbs.Size())
+}
+
+// Return thumbnail buffers allocated by the thumbnailer to its pool
+func returnThumbnails(thumbs assets.Thumbnails) {
+	for _, i := range [...]int{assets.Thumb, assets.Thumb2x} {
+		if thumbs[i] != nil {
+			thumbnailer.ReturnBuffer(thumbs[i])
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package imager
+
+import (
+	"bytes"
+	"image"
+	"meguca/common"
+	"meguca/imager/assets"
+	. "meguca/test"
+	"testing"
+
+	"github.com/bakape/thumbnailer"
+)
+
+func TestFitDims(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name       string
+		in, out    [2]uint
+		maxW, maxH uint
+	}{
+		{"fits", [2]uint{80, 60}, [2]uint{80, 60}, 100, 100},
+		{"wide", [2]uint{150, 121}, [2]uint{100, 81}, 100, 100},
+		{"tall", [2]uint{121, 150}, [2]uint{81, 100}, 100, 100},
+		{"narrow box", [2]uint{150, 150}, [2]uint{50, 50}, 50, 100},
+		{"sliver", [2]uint{150, 1}, [2]uint{100, 1}, 100, 100},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			w, h := fitDims(c.in[0], c.in[1], c.maxW, c.maxH)
+			AssertDeepEquals(t, [2]uint{w, h}, c.out)
+		})
+	}
+}
+
+func TestGenerateRenditions(t *testing.T) {
+	t.Parallel()
+
+	data := readSample(t, "sample.jpg")
+	opts := thumbnailer.Options{
+		ThumbDims: thumbnailer.Dims{
+			Width:  150,
+			Height: 150,
+		},
+		JPEGQuality: 90,
+	}
+	var img common.ImageCommon
+	_, thumb, err := processFile(data, &img, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbs, err := generateRenditions(data, thumb, &img, opts,
+		thumbnailer.Dims{Width: 100, Height: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	AssertDeepEquals(t, img.Dims2x, assets.StdJPEG.Dims2x)
+	AssertDeepEquals(t, img.CatalogDims, assets.StdJPEG.CatalogDims)
+	for i, dims := range [...][2]uint16{
+		{img.Dims[2], img.Dims[3]},
+		img.Dims2x,
+		img.CatalogDims,
+	} {
+		conf, _, err := image.DecodeConfig(bytes.NewReader(thumbs[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(
+			t,
+			[2]uint16{uint16(conf.Width), uint16(conf.Height)},
+			dims,
+		)
+	}
+}
+
+func TestNoRenditions(t *testing.T) {
+	t.Parallel()
+
+	// Text thumbnails have no source dimensions and fit the catalog
+	data := []byte("foo\nbar\n")
+	var img common.ImageCommon
+	_, thumb, err := processFile(data, &img, dummyOpts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbs, err := generateRenditions(data, thumb, &img, dummyOpts,
+		thumbnailer.Dims{Width: 150, Height: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	AssertDeepEquals(t, thumbs, assets.Thumbnails{thumb})
+	AssertDeepEquals(t, img.Dims2x, [2]uint16{})
+	AssertDeepEquals(t, img.CatalogDims, [2]uint16{})
+}
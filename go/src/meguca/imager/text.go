@@ -1,11 +1,28 @@
 package imager
 
 import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
 	"unicode/utf8"
+
+	"github.com/bakape/thumbnailer"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
 )
 
 const mimeText = "text/plain"
 
+// Dimensions of a character of the font text thumbnails are rendered with
+const (
+	textCharWidth  = 7
+	textLineHeight = 13
+	textPadding    = 2
+)
+
 // Detect any arbitrary text-like file
 func detectText(buf []byte) (mime, ext string) {
 	if utf8.Valid(buf) {
@@ -13,3 +30,92 @@ func detectText(buf []byte) (mime, ext string) {
 	}
 	return
 }
+
+// Render the first lines of a text file into a thumbnail
+func processText(src thumbnailer.Source, opts thumbnailer.Options) (
+	thumbnailer.Source, thumbnailer.Thumbnail, error,
+) {
+	width := int(opts.ThumbDims.Width)
+	height := int(opts.ThumbDims.Height)
+
+	// Render at least one character, even if the thumbnail is smaller
+	maxCols := (width - 2*textPadding) / textCharWidth
+	if maxCols < 1 {
+		maxCols = 1
+	}
+	maxLines := (height - 2*textPadding) / textLineHeight
+	if maxLines < 1 {
+		maxLines = 1
+	}
+	lines := textThumbnailLines(src.Data, maxCols, maxLines)
+
+	// Shrink thumbnails of short files to their content
+	if h := len(lines)*textLineHeight + 2*textPadding; h < height {
+		height = h
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.ZP, draw.Src)
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.Black,
+		Face: basicfont.Face7x13,
+	}
+	for i, l := range lines {
+		d.Dot = fixed.P(
+			textPadding,
+			textPadding+i*textLineHeight+basicfont.Face7x13.Ascent,
+		)
+		d.DrawString(l)
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return src, thumbnailer.Thumbnail{}, err
+	}
+	opts.AcceptedMimeTypes = map[string]bool{"image/png": true}
+	_, thumb, err := thumbnailer.ProcessBuffer(buf.Bytes(), opts)
+	return src, thumb, err
+}
+
+// Split the start of a text file into at most maxLines lines of at most
+// maxCols characters. Tabs are expanded and control characters removed.
+func textThumbnailLines(text []byte, maxCols, maxLines int) []string {
+	lines := make([]string, 0, maxLines)
+	for len(text) != 0 && len(lines) < maxLines {
+		var line []byte
+		if i := bytes.IndexByte(text, '\n'); i != -1 {
+			line, text = text[:i], text[i+1:]
+		} else {
+			line, text = text, nil
+		}
+
+		var (
+			b    bytes.Buffer
+			cols int
+		)
+		for _, r := range string(line) {
+			if cols == maxCols {
+				break
+			}
+			switch {
+			case r == '\t':
+				for j := 0; j < 4 && cols < maxCols; j++ {
+					b.WriteByte(' ')
+					cols++
+				}
+			case r < ' ', r == utf8.RuneError:
+			default:
+				b.WriteRune(r)
+				cols++
+			}
+		}
+		lines = append(lines, b.String())
+	}
+
+	// Trim trailing empty lines
+	for len(lines) != 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,79 @@
+package imager
+
+import (
+	"meguca/common"
+	. "meguca/test"
+	"testing"
+)
+
+func TestTextThumbnail(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("package main\n\nfunc main() {\n\tprintln(\"ＳＨＩＴ\")\n}\n")
+	var img common.ImageCommon
+	_, thumb, err := processFile(data, &img, dummyOpts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileType(t, img.FileType, common.TXT)
+	assertFileType(t, img.ThumbType, common.PNG)
+	if thumb == nil {
+		t.Fatal("no thumbnail")
+	}
+	AssertDeepEquals(t, img.Dims, [4]uint16{0, 0, 150, 5*13 + 4})
+	AssertDeepEquals(t, img.PHash, uint64(0))
+}
+
+func TestSmallTextThumbnail(t *testing.T) {
+	t.Parallel()
+
+	opts := dummyOpts
+	opts.ThumbDims.Width = common.MinThumbSize
+	opts.ThumbDims.Height = common.MinThumbSize
+	var img common.ImageCommon
+	_, thumb, err := processFile([]byte("foo\nbar"), &img, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb == nil {
+		t.Fatal("no thumbnail")
+	}
+}
+
+func TestTextThumbnailLines(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		out      []string
+	}{
+		{
+			name: "empty",
+			out:  []string{},
+		},
+		{
+			name: "tabs and control characters",
+			in:   "\tfoo\r\n\x07bar",
+			out:  []string{"    foo", "bar"},
+		},
+		{
+			name: "truncated",
+			in:   "0123456789\na\nb\nc",
+			out:  []string{"01234567", "a", "b"},
+		},
+		{
+			name: "trailing empty lines",
+			in:   "a\n\n \n",
+			out:  []string{"a"},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			AssertDeepEquals(t, textThumbnailLines([]byte(c.in), 8, 3), c.out)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import "github.com/bakape/thumbnailer"
 
 func init() {
 	for _, fn := range [...]thumbnailer.MatcherFunc{
+		detectWebP,
 		detect7z,
 		detectZip,
 		detectTarGZ,
@@ -13,10 +14,12 @@ func init() {
 		thumbnailer.RegisterMatcher(fn)
 	}
 	for _, m := range [...]string{
-		mimeZip, mime7Zip, mimeTarGZ, mimeTarXZ, mimeText,
+		mimeZip, mime7Zip, mimeTarGZ, mimeTarXZ,
 	} {
 		thumbnailer.RegisterProcessor(m, noopProcessor)
 	}
+	thumbnailer.RegisterProcessor(mimeWebP, processWebP)
+	thumbnailer.RegisterProcessor(mimeText, processText)
 }
 
 // Does nothing.
@@ -18,6 +18,12 @@ func TestImageProcessing(t *testing.T) {
 		MaxWidth:    2000,
 		MaxHeight:   2000,
 		JPEGQuality: 80,
+		Public: config.Public{
+			ThumbWidth:         150,
+			ThumbHeight:        150,
+			CatalogThumbWidth:  100,
+			CatalogThumbHeight: 100,
+		},
 	})
 
 	cases := [...]struct {
@@ -37,7 +43,7 @@ func TestImageProcessing(t *testing.T) {
 			t.Parallel()
 
 			var img common.ImageCommon
-			thumb, err := processFile(
+			_, thumb, err := processFile(
 				readSample(t, "sample."+c.ext),
 				&img,
 				thumbnailer.Options{
@@ -47,6 +53,7 @@ func TestImageProcessing(t *testing.T) {
 					},
 					JPEGQuality: 90,
 				},
+				false,
 			)
 			if err != nil {
 				t.Fatal(err)
@@ -0,0 +1,321 @@
+package imager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"meguca/common"
+	"meguca/config"
+	"meguca/db"
+	"meguca/imager/assets"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Command line tools used for probing and transcoding video
+	ffmpeg  = "ffmpeg"
+	ffprobe = "ffprobe"
+
+	// Maximum duration of probing and transcoding a single video
+	transcodeTimeout = 30 * time.Minute
+
+	// Maximum number of videos waiting to be transcoded
+	transcodeQueueSize = 256
+)
+
+var (
+	errTranscodeTooLarge = errors.New("transcoded file too large")
+
+	// Videos waiting to be transcoded
+	transcodeQueue     chan common.ImageCommon
+	startTranscodeOnce sync.Once
+
+	// File types of videos, that are transcoded
+	transcodedTypes = []uint8{common.MP4, common.WEBM, common.OGG}
+)
+
+// Stream of a video file as reported by ffprobe
+type probedStream struct {
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Profile   string `json:"profile"`
+	PixFmt    string `json:"pix_fmt"`
+}
+
+// Queue a freshly stored video to be transcoded in the background, if
+// transcoding is enabled and the video is within the configured limits.
+// Whether the video actually needs transcoding is determined by the worker.
+// The queue is persisted in the database, so videos not transcoded before a
+// restart are resumed with ResumeTranscoding.
+func queueTranscode(img common.ImageCommon) {
+	if !shouldTranscode(img) {
+		return
+	}
+	if err := db.QueueTranscode(img.SHA1); err != nil {
+		log.Printf("transcoding: %s: %s\n", img.SHA1, err)
+		return
+	}
+
+	startTranscodeOnce.Do(startTranscodeWorkers)
+	select {
+	case transcodeQueue <- img:
+	default:
+		log.Printf("transcoding: queue full: deferring %s\n", img.SHA1)
+	}
+}
+
+// Returns, if transcoding is enabled and the file is a video within the
+// configured limits
+func shouldTranscode(img common.ImageCommon) bool {
+	conf := config.Get()
+	if !conf.Transcode || !img.Video {
+		return false
+	}
+	supported := false
+	for _, t := range transcodedTypes {
+		supported = supported || img.FileType == t
+	}
+	if !supported {
+		return false
+	}
+	max := conf.MaxTranscodeLength
+	return max == 0 || uint(img.Length) <= max
+}
+
+// ResumeTranscoding queues videos, that were not transcoded before the server
+// was last stopped. Videos are fed to the workers in the background.
+func ResumeTranscoding() error {
+	if !config.Get().Transcode {
+		return nil
+	}
+	images, err := db.GetQueuedTranscodes()
+	if err != nil || len(images) == 0 {
+		return err
+	}
+
+	startTranscodeOnce.Do(startTranscodeWorkers)
+	go func() {
+		for _, img := range images {
+			if shouldTranscode(img) {
+				transcodeQueue <- img
+			} else if err := db.DequeueTranscode(img.SHA1); err != nil {
+				log.Printf("transcoding: %s: %s\n", img.SHA1, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// QueueUntranscoded queues all stored videos, that were not transcoded, for
+// transcoding. They are transcoded in the background, once the server is
+// started. Videos exceeding the configured limits are dropped from the queue
+// then.
+func QueueUntranscoded() error {
+	n, err := db.QueueUntranscoded(transcodedTypes)
+	if err != nil {
+		return err
+	}
+	log.Printf("queued %d videos for transcoding\n", n)
+	return nil
+}
+
+// Start the transcoding worker pool
+func startTranscodeWorkers() {
+	transcodeQueue = make(chan common.ImageCommon, transcodeQueueSize)
+	n := int(config.Get().TranscodeWorkers)
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go func() {
+			for img := range transcodeQueue {
+				processTranscode(img)
+			}
+		}()
+	}
+}
+
+// Transcode a queued video and remove it from the persisted queue. Videos
+// stay queued, if the command line tools are missing, so they are retried
+// after a restart.
+func processTranscode(img common.ImageCommon) {
+	for _, cmd := range [...]string{ffmpeg, ffprobe} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			log.Printf("transcoding: %s: %s\n", img.SHA1, err)
+			return
+		}
+	}
+
+	if err := transcode(img); err != nil {
+		log.Printf("transcoding: %s: %s\n", img.SHA1, err)
+	}
+	if err := db.DequeueTranscode(img.SHA1); err != nil {
+		log.Printf("transcoding: %s: %s\n", img.SHA1, err)
+	}
+}
+
+// Transcode a stored video to a browser-safe format, if it is not one
+// already, and record the transcoded rendition
+func transcode(img common.ImageCommon) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), transcodeTimeout)
+	defer cancel()
+
+	src := assets.GetFilePaths(img.SHA1, img.FileType, img.ThumbType)[0]
+	streams, err := probeStreams(ctx, src)
+	if err != nil {
+		return
+	}
+	if isWebSafe(img.FileType, streams) {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "meguca-transcode")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	conf := config.Get()
+	maxSize := int64(conf.MaxTranscodeSize) << 20
+	typ := common.TranscodeType(img.FileType)
+	out := filepath.Join(dir, "out."+common.Extensions[typ])
+	err = exec.CommandContext(
+		ctx,
+		ffmpeg,
+		transcodeArgs(src, out, typ, conf.MaxTranscodeLength, maxSize)...,
+	).Run()
+	if err != nil {
+		return
+	}
+
+	data, err := ioutil.ReadFile(out)
+	switch {
+	case err != nil:
+		return
+	case maxSize != 0 && int64(len(data)) >= maxSize:
+		// Output was cut off by the file size limit
+		return errTranscodeTooLarge
+	}
+	err = assets.WriteTranscoded(img.SHA1, img.FileType, data)
+	if err != nil {
+		return
+	}
+	return db.SetTranscoded(img.SHA1, int64(len(data)))
+}
+
+// Read the codecs of all streams of a file with ffprobe
+func probeStreams(ctx context.Context, path string) ([]probedStream, error) {
+	out, err := exec.CommandContext(
+		ctx,
+		ffprobe,
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name,profile,pix_fmt",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(out)
+}
+
+func parseProbe(buf []byte) ([]probedStream, error) {
+	var res struct {
+		Streams []probedStream `json:"streams"`
+	}
+	err := json.Unmarshal(buf, &res)
+	return res.Streams, err
+}
+
+// Returns, if all video and audio streams of a file can be played by all
+// major browsers
+func isWebSafe(fileType uint8, streams []probedStream) bool {
+	for _, s := range streams {
+		switch s.CodecType {
+		case "video":
+			if !isWebSafeVideo(fileType, s) {
+				return false
+			}
+		case "audio":
+			switch s.CodecName {
+			case "aac", "mp3", "opus", "vorbis":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isWebSafeVideo(fileType uint8, s probedStream) bool {
+	switch s.PixFmt {
+	case "yuv420p", "yuvj420p":
+	default:
+		return false
+	}
+	switch fileType {
+	case common.MP4:
+		if s.CodecName != "h264" {
+			return false
+		}
+		switch s.Profile {
+		case "Baseline", "Constrained Baseline", "Main", "High":
+			return true
+		}
+		return false
+	case common.WEBM:
+		return s.CodecName == "vp8" || s.CodecName == "vp9"
+	default:
+		return false
+	}
+}
+
+// Build the ffmpeg arguments for transcoding a video to the target file type.
+// Output longer than maxLength seconds or larger than maxSize bytes is cut
+// off. Zero values disable the limits.
+func transcodeArgs(
+	src, out string,
+	fileType uint8,
+	maxLength uint,
+	maxSize int64,
+) []string {
+	args := []string{
+		"-nostdin", "-v", "error", "-y",
+		"-i", src,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-map_metadata", "-1", "-sn", "-dn",
+		// Even dimensions are required by the YUV 4:2:0 encoders
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-pix_fmt", "yuv420p",
+	}
+	if maxLength != 0 {
+		args = append(args, "-t", strconv.FormatUint(uint64(maxLength), 10))
+	}
+	if maxSize != 0 {
+		args = append(args, "-fs", strconv.FormatInt(maxSize, 10))
+	}
+	if fileType == common.MP4 {
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+			"-profile:v", "high",
+			"-c:a", "aac", "-b:a", "128k",
+			"-movflags", "+faststart",
+			"-f", "mp4",
+		)
+	} else {
+		args = append(args,
+			"-c:v", "libvpx-vp9", "-crf", "32", "-b:v", "0",
+			"-deadline", "good", "-cpu-used", "4", "-row-mt", "1",
+			"-c:a", "libopus", "-b:a", "96k",
+			"-f", "webm",
+		)
+	}
+	return append(args, out)
+}
@@ -0,0 +1,185 @@
+package imager
+
+import (
+	"meguca/common"
+	. "meguca/test"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	t.Parallel()
+
+	streams, err := parseProbe([]byte(`{
+		"programs": [],
+		"streams": [
+			{
+				"codec_name": "hevc",
+				"profile": "Main 10",
+				"codec_type": "video",
+				"pix_fmt": "yuv420p10le"
+			},
+			{
+				"codec_name": "aac",
+				"profile": "LC",
+				"codec_type": "audio"
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, streams, []probedStream{
+		{
+			CodecType: "video",
+			CodecName: "hevc",
+			Profile:   "Main 10",
+			PixFmt:    "yuv420p10le",
+		},
+		{
+			CodecType: "audio",
+			CodecName: "aac",
+			Profile:   "LC",
+		},
+	})
+}
+
+func TestIsWebSafe(t *testing.T) {
+	t.Parallel()
+
+	h264 := probedStream{
+		CodecType: "video",
+		CodecName: "h264",
+		Profile:   "High",
+		PixFmt:    "yuv420p",
+	}
+	aac := probedStream{
+		CodecType: "audio",
+		CodecName: "aac",
+	}
+	with := func(s probedStream, fn func(*probedStream)) probedStream {
+		fn(&s)
+		return s
+	}
+
+	cases := [...]struct {
+		name     string
+		fileType uint8
+		streams  []probedStream
+		safe     bool
+	}{
+		{"H.264", common.MP4, []probedStream{h264, aac}, true},
+		{
+			"HEVC",
+			common.MP4,
+			[]probedStream{
+				with(h264, func(s *probedStream) {
+					s.CodecName = "hevc"
+					s.Profile = "Main"
+				}),
+			},
+			false,
+		},
+		{
+			"H.264 4:4:4",
+			common.MP4,
+			[]probedStream{
+				with(h264, func(s *probedStream) {
+					s.Profile = "High 4:4:4 Predictive"
+					s.PixFmt = "yuv444p"
+				}),
+			},
+			false,
+		},
+		{
+			"AC-3 audio",
+			common.MP4,
+			[]probedStream{
+				h264,
+				with(aac, func(s *probedStream) {
+					s.CodecName = "ac3"
+				}),
+			},
+			false,
+		},
+		{
+			"VP9",
+			common.WEBM,
+			[]probedStream{
+				with(h264, func(s *probedStream) {
+					s.CodecName = "vp9"
+					s.Profile = "Profile 0"
+				}),
+				with(aac, func(s *probedStream) {
+					s.CodecName = "opus"
+				}),
+			},
+			true,
+		},
+		{
+			"AV1",
+			common.WEBM,
+			[]probedStream{
+				with(h264, func(s *probedStream) {
+					s.CodecName = "av1"
+				}),
+			},
+			false,
+		},
+		{
+			"Theora",
+			common.OGG,
+			[]probedStream{
+				with(h264, func(s *probedStream) {
+					s.CodecName = "theora"
+				}),
+			},
+			false,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			AssertDeepEquals(t, isWebSafe(c.fileType, c.streams), c.safe)
+		})
+	}
+}
+
+func TestTranscodeArgs(t *testing.T) {
+	t.Parallel()
+
+	args := transcodeArgs("in.ogg", "out.webm", common.WEBM, 60, 1<<20)
+	for _, pair := range [...][2]string{
+		{"-i", "in.ogg"},
+		{"-t", "60"},
+		{"-fs", "1048576"},
+		{"-c:v", "libvpx-vp9"},
+		{"-f", "webm"},
+	} {
+		if !hasArgPair(args, pair) {
+			t.Errorf("argument missing: %v", pair)
+		}
+	}
+	AssertDeepEquals(t, args[len(args)-1], "out.webm")
+
+	args = transcodeArgs("in.mp4", "out.mp4", common.MP4, 0, 0)
+	for _, a := range args {
+		if a == "-t" || a == "-fs" {
+			t.Errorf("unexpected limit: %s", a)
+		}
+	}
+	if !hasArgPair(args, [2]string{"-c:v", "libx264"}) {
+		t.Error("not H.264")
+	}
+}
+
+// Returns, if the arguments contain a flag followed by its value
+func hasArgPair(args []string, pair [2]string) bool {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == pair[0] && args[i+1] == pair[1] {
+			return true
+		}
+	}
+	return false
+}
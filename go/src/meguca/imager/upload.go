@@ -15,6 +15,7 @@ import (
 	"meguca/common"
 	"meguca/config"
 	"meguca/db"
+	"meguca/imager/assets"
 	"net/http"
 	"strconv"
 	"time"
@@ -40,6 +41,7 @@ var (
 		mimeZip:           common.ZIP,
 		"audio/x-flac":    common.FLAC,
 		mimeText:          common.TXT,
+		mimeWebP:          common.WEBP,
 	}
 
 	// MIME types from thumbnailer to accept
@@ -58,29 +60,74 @@ var (
 		mimeTarXZ:         true,
 		"audio/x-flac":    true,
 		mimeText:          true,
+		mimeWebP:          true,
 	}
 
-	errTooLarge = errors.New("file too large")
-	isTest      bool
+	errTooLarge       = errors.New("file too large")
+	errBlockedImage   = errors.New("image is blocked")
+	errBannedFile     = errors.New("file is banned")
+	errTypeNotAllowed = errors.New("file type not allowed on this board")
+	isTest            bool
 )
 
-// NewImageUpload  handles the clients' image (or other file) upload request
+// NewImageUpload  handles the clients' image (or other file) upload request.
+// The target board is passed in the "board" query parameter.
+//
+// Files already stored on the server are responded to with an image token
+// immediately. Otherwise the file is thumbnailed asynchronously and the
+// response has status 202 and contains a job ID. The resulting image token is
+// retrieved with UploadJobResult. If the ID of the uploader's websocket client
+// is passed in the "client" query parameter, progress and the result are also
+// sent to that client. Responds with 503, if the thumbnailing queue is full.
 func NewImageUpload(w http.ResponseWriter, r *http.Request) {
+	board := r.URL.Query().Get("board")
+
 	// Limit data received to the maximum uploaded file size limit
-	r.Body = http.MaxBytesReader(w, r.Body, int64(config.Get().MaxSize<<20))
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxUploadSize(board))
 
-	code, id, err := ParseUpload(r)
-	if err != nil {
+	code, token, j, err := acceptUpload(r, board)
+	serveUploadResult(w, r, code, token, j, err)
+}
+
+// Respond with an image token or start an asynchronous thumbnailing job and
+// respond with its ID
+func serveUploadResult(
+	w http.ResponseWriter,
+	r *http.Request,
+	code int,
+	token string,
+	j *job,
+	err error,
+) {
+	switch {
+	case err != nil:
 		LogError(w, r, code, err)
+		return
+	case j == nil: // Already thumbnailed
+		w.Write([]byte(token))
+		return
+	}
+
+	j.ip, err = auth.GetIP(r)
+	if err != nil {
+		thumbnailer.ReturnBuffer(j.data)
+		LogError(w, r, 400, err)
+		return
+	}
+	j.clientID = r.URL.Query().Get("client")
+	if err := j.start(); err != nil {
+		LogError(w, r, 503, err)
+		return
 	}
-	w.Write([]byte(id))
+	w.WriteHeader(202)
+	w.Write([]byte(j.id))
 }
 
 // UploadImageHash attempts to skip image upload, if the file has already
 // been thumbnailed and is stored on the server. The client sends an SHA1 hash
 // of the file it wants to upload. The server looks up, if such a file is
 // thumbnailed. If yes, generates and sends a new image allocation token to
-// the client.
+// the client. The target board is passed in the "board" query parameter.
 func UploadImageHash(w http.ResponseWriter, req *http.Request) {
 	buf, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, 40))
 	if err != nil {
@@ -89,7 +136,13 @@ func UploadImageHash(w http.ResponseWriter, req *http.Request) {
 	}
 	hash := string(buf)
 
-	_, err = db.GetImage(hash)
+	// The MD5 hash is not known before upload
+	if code, err := checkBannedFile(hash, ""); err != nil {
+		LogError(w, req, code, err)
+		return
+	}
+
+	img, err := db.GetImageByUploadHash(hash)
 	switch err {
 	case nil:
 	case sql.ErrNoRows:
@@ -98,8 +151,21 @@ func UploadImageHash(w http.ResponseWriter, req *http.Request) {
 		LogError(w, req, 500, err)
 		return
 	}
+	if code, err := checkBannedAlias(hash, img); err != nil {
+		LogError(w, req, code, err)
+		return
+	}
+	if code, err := checkBlocked(img); err != nil {
+		LogError(w, req, code, err)
+		return
+	}
+	board := req.URL.Query().Get("board")
+	if code, err := checkBoardRestrictions(board, img); err != nil {
+		LogError(w, req, code, err)
+		return
+	}
 
-	token, err := db.NewImageToken(hash)
+	token, err := db.NewImageToken(img.SHA1)
 	if err != nil {
 		LogError(w, req, 500, err)
 	}
@@ -119,39 +185,143 @@ func LogError(w http.ResponseWriter, r *http.Request, code int, err error) {
 	}
 }
 
-// ParseUpload parses the upload form. Separate function for cleaner error
-// handling and reusability. Returns the HTTP status code of the response and an
-// error, if any.
-func ParseUpload(req *http.Request) (int, string, error) {
-	if err := parseUploadForm(req); err != nil {
-		return 400, "", err
+// ParseUpload parses the upload form and thumbnails the file in the worker
+// pool, blocking until it is processed. board is the board the file is
+// uploaded to. Returns the HTTP status code of the response, an image token and
+// an error, if any.
+func ParseUpload(req *http.Request, board string) (int, string, error) {
+	code, token, j, err := acceptUpload(req, board)
+	if err != nil || j == nil {
+		return code, token, err
+	}
+	return j.process()
+}
+
+// Read, hash and validate the uploaded file. Returns an image token, if the
+// file is already stored on the server, or a thumbnailing job otherwise.
+func acceptUpload(req *http.Request, board string) (
+	code int, token string, j *job, err error,
+) {
+	if err = parseUploadForm(req, board); err != nil {
+		code = 400
+		return
 	}
 
 	file, _, err := req.FormFile("image")
 	if err != nil {
-		return 400, "", err
+		code = 400
+		return
 	}
 	defer file.Close()
 
 	buf := bytes.NewBuffer(thumbnailer.GetBuffer())
 	_, err = buf.ReadFrom(file)
 	if err != nil {
-		return 500, "", err
+		code = 500
+		return
+	}
+	return acceptFile(buf.Bytes(), board)
+}
+
+// Validate a received file. Returns an image token, if the file is already
+// stored on the server, or a thumbnailing job otherwise. Ownership of data is
+// passed to the job, if any.
+func acceptFile(data []byte, board string) (
+	code int, token string, j *job, err error,
+) {
+	defer func() {
+		if j == nil {
+			thumbnailer.ReturnBuffer(data)
+		}
+	}()
+	if int64(len(data)) > config.MaxUploadSize(board) {
+		return 400, "", nil, errTooLarge
 	}
-	data := buf.Bytes()
-	defer thumbnailer.ReturnBuffer(data)
 
 	sum := sha1.Sum(data)
 	SHA1 := hex.EncodeToString(sum[:])
-	img, err := db.GetImage(SHA1)
+	md5Sum := md5.Sum(data)
+	MD5 := base64.RawURLEncoding.EncodeToString(md5Sum[:])
+	if code, err = checkBannedFile(SHA1, MD5); err != nil {
+		return
+	}
+
+	img, err := db.GetImageByUploadHash(SHA1)
 	switch err {
 	case nil: // Already have a thumbnail
-		return newImageToken(SHA1)
+		if code, err = checkBannedAlias(SHA1, img); err != nil {
+			return
+		}
+		if code, err = checkBlocked(img); err != nil {
+			return
+		}
+		if code, err = checkBoardRestrictions(board, img); err != nil {
+			return
+		}
+		code, token, err = newImageToken(img.SHA1)
+		return
 	case sql.ErrNoRows:
 		img.SHA1 = SHA1
-		return newThumbnail(data, img)
+		j, err = newJob(data, img, board)
+		if err != nil {
+			code = 500
+			return
+		}
+		return 200, "", j, nil
 	default:
-		return 500, "", err
+		return 500, "", nil, err
+	}
+}
+
+// Reject files banned by their SHA1 or MD5 hash
+func checkBannedFile(SHA1, MD5 string) (int, error) {
+	banned, err := db.IsBannedFile(SHA1, MD5)
+	switch {
+	case err != nil:
+		return 500, err
+	case banned:
+		return 403, errBannedFile
+	default:
+		return 200, nil
+	}
+}
+
+// Reject files stored under a different hash than the uploaded file's, that
+// are banned by the hash of the stored file
+func checkBannedAlias(SHA1 string, img common.ImageCommon) (int, error) {
+	if img.SHA1 == SHA1 {
+		return 200, nil
+	}
+	return checkBannedFile(img.SHA1, img.MD5)
+}
+
+// Reject images on the global blocklist. Board-specific blocklists are checked,
+// when the image is inserted into a post.
+func checkBlocked(img common.ImageCommon) (int, error) {
+	blocked, err := db.IsBlockedImage("all", img)
+	switch {
+	case err != nil:
+		return 500, err
+	case blocked:
+		return 403, errBlockedImage
+	default:
+		return 200, nil
+	}
+}
+
+// Reject file types not allowed on the target board and files exceeding its
+// size limit
+func checkBoardRestrictions(board string, img common.ImageCommon) (int, error) {
+	switch {
+	case !common.IsAllowedFileType(
+		config.GetBoardConfigs(board).AllowedTypes,
+		img.FileType,
+	):
+		return 400, errTypeNotAllowed
+	case int64(img.Size) > config.MaxUploadSize(board):
+		return 400, errTooLarge
+	default:
+		return 200, nil
 	}
 }
 
@@ -165,12 +335,12 @@ func newImageToken(SHA1 string) (int, string, error) {
 }
 
 // Parse and validate the form of the upload request
-func parseUploadForm(req *http.Request) error {
+func parseUploadForm(req *http.Request, board string) error {
 	length, err := strconv.ParseUint(req.Header.Get("Content-Length"), 10, 64)
 	if err != nil {
 		return err
 	}
-	if length > uint64(config.Get().MaxSize<<20) {
+	if length > uint64(config.MaxUploadSize(board)) {
 		return errTooLarge
 	}
 	return req.ParseMultipartForm(0)
@@ -178,31 +348,50 @@ func parseUploadForm(req *http.Request) error {
 
 // Create a new thumbnail, commit its resources to the DB and filesystem, and
 // pass the image data to the client.
-func newThumbnail(data []byte, img common.ImageCommon) (int, string, error) {
+func newThumbnail(data []byte, img common.ImageCommon, board string) (
+	int, string, error,
+) {
 	conf := config.Get()
-	thumb, err := processFile(data, &img, thumbnailer.Options{
-		JPEGQuality: conf.JPEGQuality,
-		MaxSourceDims: thumbnailer.Dims{
-			Width:  uint(conf.MaxWidth),
-			Height: uint(conf.MaxHeight),
-		},
-		ThumbDims: thumbnailer.Dims{
-			Width:  150,
-			Height: 150,
-		},
-		AcceptedMimeTypes: allowedMimeTypes,
-	})
+	uploadedSHA1 := img.SHA1
+
+	// HEIC is not displayable in most browsers. Store a JPEG conversion of the
+	// file under its own hash instead.
+	if detectHEIF(data) == mimeHEIC {
+		var err error
+		data, err = heifToJPEG(data, conf.JPEGQuality)
+		switch err.(type) {
+		case nil:
+		case thumbnailer.UnsupportedMIMEError:
+			return 400, "", err
+		default:
+			if err == errHEIFConversion {
+				return 400, "", err
+			}
+			return 500, "", err
+		}
+		sum := sha1.Sum(data)
+		img.SHA1 = hex.EncodeToString(sum[:])
+	}
+
+	opts := thumbnailOptions()
+	data, thumb, err := processFile(data, &img, opts,
+		config.StripMetadata(board))
 	switch err.(type) {
 	case nil:
 	case thumbnailer.UnsupportedMIMEError:
 		return 400, "", err
 	default:
-		return 500, "", err
+		switch err {
+		case errHEIFConversion, errInvalidWebP, errInvalidJPEG,
+			errInvalidPNG:
+			return 400, "", err
+		default:
+			return 500, "", err
+		}
 	}
+	thumbs := assets.Thumbnails{thumb}
 	defer func() {
-		if thumb != nil {
-			thumbnailer.ReturnBuffer(thumb)
-		}
+		returnThumbnails(thumbs)
 	}()
 
 	// Some media has retardedly long meta strings. Just truncate them, instead
@@ -214,22 +403,93 @@ func newThumbnail(data []byte, img common.ImageCommon) (int, string, error) {
 		img.Title = img.Title[:200]
 	}
 
-	if err := db.AllocateImage(data, thumb, img); err != nil {
+	if img.SHA1 != uploadedSHA1 {
+		// The file was modified by conversion or stripping its metadata.
+		// The resulting file might be banned or already stored on the
+		// server.
+		if code, err := checkBannedFile(img.SHA1, img.MD5); err != nil {
+			return code, "", err
+		}
+		stored, err := db.GetImage(img.SHA1)
+		switch err {
+		case nil:
+			if code, err := checkBlocked(stored); err != nil {
+				return code, "", err
+			}
+			if code, err := checkBoardRestrictions(board, stored); err != nil {
+				return code, "", err
+			}
+			err := db.WriteImageAlias(uploadedSHA1, stored.SHA1)
+			if err != nil {
+				return 500, "", err
+			}
+			return newImageToken(stored.SHA1)
+		case sql.ErrNoRows:
+		default:
+			return 500, "", err
+		}
+	}
+	if code, err := checkBlocked(img); err != nil {
+		return code, "", err
+	}
+	if code, err := checkBoardRestrictions(board, img); err != nil {
+		return code, "", err
+	}
+
+	thumbs, err = generateRenditions(data, thumb, &img, opts,
+		catalogThumbDims())
+	if err != nil {
 		return 500, "", err
 	}
+	if err := db.AllocateImage(data, thumbs, img); err != nil {
+		return 500, "", err
+	}
+	if img.SHA1 != uploadedSHA1 {
+		// Let further uploads of the original file be deduplicated by its
+		// hash
+		if err := db.WriteImageAlias(uploadedSHA1, img.SHA1); err != nil {
+			return 500, "", err
+		}
+	}
+	queueTranscode(img)
 	return newImageToken(img.SHA1)
 }
 
-// Separate function for easier testability
+// Separate function for easier testability. If strip is set, location, device
+// and other identifying metadata is removed from the file and the SHA1 hash of
+// the cleaned file is recorded. Returns the file to be stored and its
+// thumbnail.
 func processFile(
 	data []byte,
 	img *common.ImageCommon,
 	opts thumbnailer.Options,
+	strip bool,
 ) (
-	thumbData []byte,
+	srcData, thumbData []byte,
 	err error,
 ) {
-	src, thumb, err := thumbnailer.ProcessBuffer(data, opts)
+	if strip {
+		// Before thumbnailing, so the thumbnail matches the orientation of
+		// the cleaned image
+		data, err = stripImageMetadata(data, opts.JPEGQuality)
+		if err != nil {
+			return
+		}
+	}
+	srcData = data
+
+	// The thumbnailer can not decode AVIF. Thumbnail a JPEG conversion, but
+	// keep the original as the source file.
+	toProcess := data
+	heif := detectHEIF(data)
+	if heif == mimeAVIF {
+		toProcess, err = heifToJPEG(data, opts.JPEGQuality)
+		if err != nil {
+			return
+		}
+	}
+
+	src, thumb, err := thumbnailer.ProcessBuffer(toProcess, opts)
 	switch err {
 	case nil:
 	case thumbnailer.ErrNoCoverArt:
@@ -238,18 +498,42 @@ func processFile(
 		return
 	}
 
-	thumbData = thumb.Data
-
 	img.FileType = mimeTypes[src.Mime]
-	if img.FileType == common.PNG {
+	switch img.FileType {
+	case common.PNG:
 		img.APNG = apngdetector.Detect(data)
+	case common.JPEG:
+		if heif == mimeAVIF {
+			img.FileType = common.AVIF
+		}
+	case common.OGG:
+		if !src.HasVideo && isOpus(data) {
+			img.FileType = common.OPUS
+		}
+	case common.MP4:
+		if !src.HasVideo && isM4A(data) {
+			img.FileType = common.M4A
+		}
+	case common.ZIP, common.SevenZip, common.TGZ, common.TXZ:
+		thumb = processArchive(data, img, opts)
 	}
+	thumbData = thumb.Data
 	if thumb.Data == nil {
 		img.ThumbType = common.NoFile
 	} else if thumb.IsPNG {
 		img.ThumbType = common.PNG
 	}
 
+	if strip {
+		switch img.FileType {
+		case common.MP4, common.WEBM:
+			// After thumbnailing, so media titles can still be read
+			stripContainerMetadata(data)
+		}
+		sum := sha1.Sum(data)
+		img.SHA1 = hex.EncodeToString(sum[:])
+	}
+
 	img.Audio = src.HasAudio
 	img.Video = src.HasVideo
 	img.Length = uint32(src.Length / time.Second)
@@ -266,5 +550,12 @@ func processFile(
 	sum := md5.Sum(data)
 	img.MD5 = base64.RawURLEncoding.EncodeToString(sum[:])
 
+	// Files, that can not be hashed, are still accepted. They can only be
+	// blocked by their exact SHA1 hash. Rendered text thumbnails all look
+	// alike and are not hashed.
+	if thumb.Data != nil && img.FileType != common.TXT {
+		img.PHash, _ = perceptualHash(thumb.Data)
+	}
+
 	return
 }
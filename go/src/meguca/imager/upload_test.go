@@ -130,7 +130,7 @@ func TestInvalidContentLengthHeader(t *testing.T) {
 		"Content-Length": "KAWFEE",
 	})
 
-	err := parseUploadForm(req)
+	err := parseUploadForm(req, "")
 	if s := fmt.Sprint(err); !strings.Contains(s, "invalid syntax") {
 		UnexpectedError(t, err)
 	}
@@ -143,7 +143,7 @@ func TestUploadTooLarge(t *testing.T) {
 	req := newRequest(t, b, w)
 	req.Header.Set("Content-Length", "1048577")
 
-	if err := parseUploadForm(req); err != errTooLarge {
+	if err := parseUploadForm(req, ""); err != errTooLarge {
 		UnexpectedError(t, err)
 	}
 }
@@ -156,7 +156,7 @@ func TestInvalidForm(t *testing.T) {
 		"Content-Type":   "GWEEN TEA",
 	})
 
-	if parseUploadForm(req) == nil {
+	if parseUploadForm(req, "") == nil {
 		t.Fatal("expected an error")
 	}
 }
@@ -166,7 +166,7 @@ func TestSuccessfulFormParse(t *testing.T) {
 	req := newRequest(t, b, w)
 	req.Header.Set("Content-Length", "1024")
 
-	if err := parseUploadForm(req); err != nil {
+	if err := parseUploadForm(req, ""); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -175,12 +175,32 @@ func TestNewThumbnail(t *testing.T) {
 	assertTableClear(t, "images")
 	resetDirs(t)
 
+	progress, restore := captureProgress(t)
+	defer restore()
+
 	req := newJPEGRequest(t)
 	rec := httptest.NewRecorder()
 	NewImageUpload(rec, req)
+	assertCode(t, rec.Code, 202)
+
+	id := rec.Body.String()
+	if p := awaitJob(t, progress, id); p.Token == "" {
+		t.Fatal("no image token")
+	}
+
+	// Token is also retrievable over HTTP by the uploader
+	rec = httptest.NewRecorder()
+	UploadJobResult(rec, httptest.NewRequest("GET", "/", nil), id)
 	assertCode(t, rec.Code, 200)
+	if rec.Body.String() == "" {
+		t.Fatal("no image token")
+	}
 
 	img := getImageRecord(t, assets.StdJPEG.SHA1)
+	if img.PHash == 0 {
+		t.Fatal("no perceptual hash")
+	}
+	img.PHash = 0
 	AssertDeepEquals(t, img, assets.StdJPEG.ImageCommon)
 	assertFiles(t, "sample.jpg", assets.StdJPEG.SHA1, common.JPEG, common.JPEG)
 }
@@ -199,7 +219,7 @@ func TestAPNGThumbnailing(t *testing.T) {
 			}
 			data := readSample(t, "sample."+ext)
 
-			if _, _, err := newThumbnail(data, img); err != nil {
+			if _, _, err := newThumbnail(data, img, ""); err != nil {
 				t.Fatal(err)
 			}
 
@@ -215,7 +235,7 @@ func TestNoImageUploaded(t *testing.T) {
 	req := newRequest(t, b, w)
 	req.Header.Set("Content-Length", "300792")
 
-	code, _, err := ParseUpload(req)
+	code, _, err := ParseUpload(req, "")
 	if err != http.ErrMissingFile {
 		UnexpectedError(t, err)
 	}
@@ -228,7 +248,7 @@ func TestThumbNailReuse(t *testing.T) {
 
 	for i := 1; i <= 2; i++ {
 		req := newJPEGRequest(t)
-		code, _, err := ParseUpload(req)
+		code, _, err := ParseUpload(req, "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -243,7 +263,7 @@ func TestUploadImageHash(t *testing.T) {
 	std := assets.StdJPEG
 
 	req := newJPEGRequest(t)
-	code, _, err := ParseUpload(req)
+	code, _, err := ParseUpload(req, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -289,3 +309,44 @@ func TestErrorPassing(t *testing.T) {
 		t.Errorf("unexpected body: `%s`", s)
 	}
 }
+
+func TestCheckBoardRestrictions(t *testing.T) {
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "r",
+		BoardPublic: config.BoardPublic{
+			AllowedTypes: []string{"png"},
+			MaxSize:      1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name     string
+		fileType uint8
+		size     int
+		code     int
+		err      error
+	}{
+		{"allowed", common.PNG, 1 << 10, 200, nil},
+		{"type not allowed", common.JPEG, 1 << 10, 400, errTypeNotAllowed},
+		{"too large", common.PNG, 1<<20 + 1, 400, errTooLarge},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, err := checkBoardRestrictions("r", common.ImageCommon{
+				FileType: c.fileType,
+				Size:     c.size,
+			})
+			assertCode(t, code, c.code)
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
@@ -31,7 +31,12 @@ func TestProcessWebm(t *testing.T) {
 			t.Parallel()
 
 			var img common.ImageCommon
-			thumb, err := processFile(readSample(t, c.name), &img, dummyOpts)
+			_, thumb, err := processFile(
+				readSample(t, c.name),
+				&img,
+				dummyOpts,
+				false,
+			)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -112,10 +117,11 @@ func TestProcessOGG(t *testing.T) {
 			t.Parallel()
 
 			var img common.ImageCommon
-			thumb, err := processFile(
+			_, thumb, err := processFile(
 				readSample(t, c.file+".ogg"),
 				&img,
 				dummyOpts,
+				false,
 			)
 			if err != c.err {
 				t.Fatal(err)
@@ -193,10 +199,11 @@ func TestProcessMP4(t *testing.T) {
 			t.Parallel()
 
 			var img common.ImageCommon
-			thumb, err := processFile(
+			_, thumb, err := processFile(
 				readSample(t, c.file+".mp4"),
 				&img,
 				dummyOpts,
+				false,
 			)
 			if err != c.err {
 				t.Fatal(err)
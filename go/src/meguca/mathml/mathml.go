@@ -0,0 +1,460 @@
+// Package mathml converts a subset of TeX math notation to MathML for
+// rendering formulas in posts without any client-side or external processing
+package mathml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLen is the maximum length of a formula's source
+	MaxLen = 1000
+
+	// Maximum nesting depth of groups
+	maxDepth = 32
+)
+
+var (
+	ErrTooLong = errors.New("formula too long")
+	ErrTooDeep = errors.New("formula nested too deeply")
+
+	errUnbalanced   = errors.New("unbalanced braces")
+	errMissingArg   = errors.New("missing argument")
+	errDoubleScript = errors.New("double subscript or superscript")
+	errDelimiter    = errors.New("invalid delimiter")
+)
+
+// Characters rendered as <mo> operators
+const operatorChars = "+-=<>()[]|,./*!:;?'"
+
+// Render converts TeX math notation to a MathML <math> element. display
+// specifies, if the formula is rendered as a separate block or inline with the
+// surrounding text.
+func Render(tex string, display bool) ([]byte, error) {
+	if len(tex) > MaxLen {
+		return nil, ErrTooLong
+	}
+
+	p := parser{
+		src:     tex,
+		display: display,
+	}
+	inner, err := p.parseList(0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var w bytes.Buffer
+	w.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		w.WriteString(` display="block"`)
+	}
+	w.WriteString(`><semantics><mrow>`)
+	w.WriteString(inner)
+	w.WriteString(`</mrow><annotation encoding="application/x-tex">`)
+	w.WriteString(html.EscapeString(tex))
+	w.WriteString(`</annotation></semantics></math>`)
+	return w.Bytes(), nil
+}
+
+// Recursive descent TeX parser, that produces MathML
+type parser struct {
+	display bool
+	depth   int
+	pos     int
+	src     string
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// Returns, if the unparsed source starts with s
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+// Parse a list of elements until the closing byte is consumed. A closer of 0
+// parses until the end of the source. If untilRight is true, parsing stops
+// before a \right command.
+func (p *parser) parseList(closer byte, untilRight bool) (string, error) {
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+	if p.depth > maxDepth {
+		return "", ErrTooDeep
+	}
+
+	var w bytes.Buffer
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			if closer != 0 || untilRight {
+				return "", errUnbalanced
+			}
+			return w.String(), nil
+		}
+
+		switch b := p.src[p.pos]; {
+		case closer != 0 && b == closer:
+			p.pos++
+			return w.String(), nil
+		case b == '}':
+			return "", errUnbalanced
+		case untilRight && p.hasPrefix(`\right`):
+			return w.String(), nil
+		}
+
+		el, err := p.parseScripted()
+		if err != nil {
+			return "", err
+		}
+		w.WriteString(el)
+	}
+}
+
+// Parse an element with optional subscript and superscript
+func (p *parser) parseScripted() (string, error) {
+	base, large, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		b := p.src[p.pos]
+		if b != '^' && b != '_' {
+			break
+		}
+		p.pos++
+
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", err
+		}
+		target := &sup
+		if b == '_' {
+			target = &sub
+		}
+		if *target != "" {
+			return "", errDoubleScript
+		}
+		*target = arg
+	}
+
+	// Limits of large operators are placed above and below in display mode
+	under, over, both := "msub", "msup", "msubsup"
+	if large && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return wrap(both, base+sub+sup), nil
+	case sub != "":
+		return wrap(under, base+sub), nil
+	case sup != "":
+		return wrap(over, base+sup), nil
+	default:
+		return base, nil
+	}
+}
+
+// Parse a command argument. This is either a braced group or a single token.
+func (p *parser) parseArg() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", errMissingArg
+	}
+
+	switch b := p.src[p.pos]; {
+	case b == '{':
+		p.pos++
+		inner, err := p.parseList('}', false)
+		if err != nil {
+			return "", err
+		}
+		return wrap("mrow", inner), nil
+	case b >= '0' && b <= '9':
+		// Only a single digit is consumed, like in TeX
+		p.pos++
+		return wrap("mn", string(b)), nil
+	case b == '}' || b == '^' || b == '_':
+		return "", errMissingArg
+	default:
+		el, _, err := p.parseAtom()
+		return el, err
+	}
+}
+
+// Parse a single element without scripts. large specifies, if the element is a
+// large operator.
+func (p *parser) parseAtom() (el string, large bool, err error) {
+	b := p.src[p.pos]
+	switch {
+	case b == '^' || b == '_':
+		// Script without a base
+		return "<mrow></mrow>", false, nil
+	case b == '{':
+		p.pos++
+		var inner string
+		inner, err = p.parseList('}', false)
+		el = wrap("mrow", inner)
+	case b == '\\':
+		p.pos++
+		el, large, err = p.parseCommand()
+	case isDigit(b) || b == '.' && p.pos+1 < len(p.src) &&
+		isDigit(p.src[p.pos+1]):
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		el = wrap("mn", p.src[start:p.pos])
+	case b < utf8.RuneSelf && unicode.IsLetter(rune(b)):
+		p.pos++
+		el = wrap("mi", string(b))
+	case b == '~':
+		p.pos++
+		el = `<mspace width="0.333em"/>`
+	case b == '-':
+		p.pos++
+		el = wrap("mo", "−")
+	case b == '\'':
+		p.pos++
+		el = wrap("mo", "′")
+	case strings.IndexByte(operatorChars, b) != -1:
+		p.pos++
+		el = wrap("mo", html.EscapeString(string(b)))
+	case b >= utf8.RuneSelf:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		s := html.EscapeString(string(r))
+		if unicode.IsLetter(r) {
+			el = wrap("mi", s)
+		} else {
+			el = wrap("mo", s)
+		}
+	default:
+		err = fmt.Errorf("unexpected character: %q", b)
+	}
+	return
+}
+
+// Read the name of a command after the backslash
+func (p *parser) readCommand() (string, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos != start {
+		return p.src[start:p.pos], nil
+	}
+
+	// Single non-letter character command
+	if p.pos >= len(p.src) || p.src[p.pos] >= utf8.RuneSelf {
+		return "", errors.New("invalid command")
+	}
+	p.pos++
+	return p.src[start:p.pos], nil
+}
+
+// Parse a command after the backslash
+func (p *parser) parseCommand() (el string, large bool, err error) {
+	name, err := p.readCommand()
+	if err != nil {
+		return
+	}
+
+	if s, ok := symbols[name]; ok {
+		switch s.typ {
+		case identifier, function:
+			el = wrap("mi", s.value)
+		case operator:
+			el = wrap("mo", html.EscapeString(s.value))
+		case largeOperator:
+			el = wrap("mo", s.value)
+			large = true
+		}
+		return
+	}
+	if width, ok := spaces[name]; ok {
+		el = fmt.Sprintf(`<mspace width="%s"/>`, width)
+		return
+	}
+	if variant, ok := fonts[name]; ok {
+		var arg string
+		arg, err = p.parseArg()
+		el = fmt.Sprintf(`<mstyle mathvariant="%s">%s</mstyle>`, variant, arg)
+		return
+	}
+	if a, ok := accents[name]; ok {
+		var arg string
+		arg, err = p.parseArg()
+		if a.under {
+			el = fmt.Sprintf(`<munder accentunder="true">%s<mo>%s</mo></munder>`,
+				arg, a.value)
+		} else {
+			el = fmt.Sprintf(`<mover accent="true">%s<mo>%s</mo></mover>`,
+				arg, a.value)
+		}
+		return
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		el, err = p.parseArgs(2, "mfrac")
+	case "binom":
+		el, err = p.parseArgs(2, `mfrac linethickness="0"`)
+		el = "<mrow><mo>(</mo>" + el + "<mo>)</mo></mrow>"
+	case "sqrt":
+		el, err = p.parseRoot()
+	case "text", "textrm", "mbox":
+		var text string
+		text, err = p.readBraced()
+		el = wrap("mtext", html.EscapeString(text))
+	case "operatorname":
+		var text string
+		text, err = p.readBraced()
+		el = wrap("mi", html.EscapeString(text))
+	case "left":
+		el, err = p.parseFenced()
+	default:
+		err = fmt.Errorf("unknown command: \\%s", name)
+	}
+	return
+}
+
+// Parse n arguments and wrap them in a tag
+func (p *parser) parseArgs(n int, tag string) (string, error) {
+	var w bytes.Buffer
+	for i := 0; i < n; i++ {
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", err
+		}
+		w.WriteString(arg)
+	}
+	return wrap(tag, w.String()), nil
+}
+
+// Parse a square root with an optional index
+func (p *parser) parseRoot() (string, error) {
+	p.skipSpace()
+	if !p.hasPrefix("[") {
+		return p.parseArgs(1, "msqrt")
+	}
+
+	p.pos++
+	index, err := p.parseList(']', false)
+	if err != nil {
+		return "", err
+	}
+	arg, err := p.parseArg()
+	if err != nil {
+		return "", err
+	}
+	return wrap("mroot", arg+wrap("mrow", index)), nil
+}
+
+// Parse a \left ... \right fenced group
+func (p *parser) parseFenced() (string, error) {
+	open, err := p.readDelimiter()
+	if err != nil {
+		return "", err
+	}
+	inner, err := p.parseList(0, true)
+	if err != nil {
+		return "", err
+	}
+	p.pos += len(`\right`)
+	closer, err := p.readDelimiter()
+	if err != nil {
+		return "", err
+	}
+	return wrap("mrow", open+inner+closer), nil
+}
+
+// Read a fence delimiter for \left or \right
+func (p *parser) readDelimiter() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", errDelimiter
+	}
+
+	b := p.src[p.pos]
+	switch {
+	case b == '.':
+		// Empty delimiter
+		p.pos++
+		return "", nil
+	case strings.IndexByte("()[]|/", b) != -1:
+		p.pos++
+		return fence(string(b)), nil
+	case b == '\\':
+		p.pos++
+		name, err := p.readCommand()
+		if err != nil {
+			return "", err
+		}
+		s, ok := symbols[name]
+		if !ok || s.typ != operator {
+			return "", errDelimiter
+		}
+		return fence(html.EscapeString(s.value)), nil
+	default:
+		return "", errDelimiter
+	}
+}
+
+// Read the raw text contents of a braced argument
+func (p *parser) readBraced() (string, error) {
+	p.skipSpace()
+	if !p.hasPrefix("{") {
+		return "", errMissingArg
+	}
+	p.pos++
+	i := strings.IndexByte(p.src[p.pos:], '}')
+	if i == -1 {
+		return "", errUnbalanced
+	}
+	text := p.src[p.pos : p.pos+i]
+	p.pos += i + 1
+	return text, nil
+}
+
+func wrap(tag, inner string) string {
+	name := tag
+	if i := strings.IndexByte(tag, ' '); i != -1 {
+		name = tag[:i]
+	}
+	return "<" + tag + ">" + inner + "</" + name + ">"
+}
+
+func fence(s string) string {
+	return `<mo fence="true">` + s + `</mo>`
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,147 @@
+package mathml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in, out string
+	}{
+		{"empty", "", ""},
+		{
+			"identifiers and operators",
+			"a + b = c",
+			"<mi>a</mi><mo>+</mo><mi>b</mi><mo>=</mo><mi>c</mi>",
+		},
+		{"number", "3.14", "<mn>3.14</mn>"},
+		{"minus", "-1", "<mo>−</mo><mn>1</mn>"},
+		{"escaping", "a < b", "<mi>a</mi><mo>&lt;</mo><mi>b</mi>"},
+		{"symbol", `\alpha \leq \infty`, "<mi>α</mi><mo>≤</mo><mi>∞</mi>"},
+		{"superscript", "x^2", "<msup><mi>x</mi><mn>2</mn></msup>"},
+		{
+			"single digit script",
+			"x^23",
+			"<msup><mi>x</mi><mn>2</mn></msup><mn>3</mn>",
+		},
+		{
+			"grouped script",
+			"x^{23}",
+			"<msup><mi>x</mi><mrow><mn>23</mn></mrow></msup>",
+		},
+		{
+			"subscript and superscript",
+			"x_i^2",
+			"<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>",
+		},
+		{
+			"inline sum",
+			`\sum_{i=0}^n`,
+			"<msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>0</mn></mrow>" +
+				"<mi>n</mi></msubsup>",
+		},
+		{
+			"fraction",
+			`\frac{1}{x}`,
+			"<mfrac><mrow><mn>1</mn></mrow><mrow><mi>x</mi></mrow></mfrac>",
+		},
+		{
+			"square root",
+			`\sqrt{x}`,
+			"<msqrt><mrow><mi>x</mi></mrow></msqrt>",
+		},
+		{
+			"nth root",
+			`\sqrt[3]{x}`,
+			"<mroot><mrow><mi>x</mi></mrow><mrow><mn>3</mn></mrow></mroot>",
+		},
+		{
+			"text",
+			`\text{if <x>}`,
+			"<mtext>if &lt;x&gt;</mtext>",
+		},
+		{
+			"font",
+			`\mathbb{R}`,
+			`<mstyle mathvariant="double-struck"><mrow><mi>R</mi></mrow></mstyle>`,
+		},
+		{
+			"accent",
+			`\vec v`,
+			`<mover accent="true"><mi>v</mi><mo>→</mo></mover>`,
+		},
+		{
+			"fence",
+			`\left( x \right.`,
+			`<mrow><mo fence="true">(</mo><mi>x</mi></mrow>`,
+		},
+		{"space", `\quad`, `<mspace width="1em"/>`},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := Render(c.in, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			std := `<math xmlns="http://www.w3.org/1998/Math/MathML">` +
+				`<semantics><mrow>` + c.out + `</mrow>` +
+				`<annotation encoding="application/x-tex">`
+			if s := string(res); !strings.HasPrefix(s, std) {
+				t.Fatalf("unexpected output:\n%s\n%s", std, s)
+			}
+		})
+	}
+}
+
+func TestRenderDisplay(t *testing.T) {
+	t.Parallel()
+
+	res, err := Render(`\sum_i^n`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `<math xmlns="http://www.w3.org/1998/Math/MathML"` +
+		` display="block"><semantics><mrow>` +
+		`<munderover><mo>∑</mo><mi>i</mi><mi>n</mi></munderover></mrow>` +
+		`<annotation encoding="application/x-tex">\sum_i^n</annotation>` +
+		`</semantics></math>`
+	if s := string(res); s != std {
+		t.Fatalf("unexpected output:\n%s\n%s", std, s)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+	}{
+		{"unclosed group", "{x"},
+		{"unopened group", "x}"},
+		{"unknown command", `\foo`},
+		{"missing argument", `\frac{1}`},
+		{"double superscript", "x^2^3"},
+		{"missing right", `\left( x`},
+		{"invalid delimiter", `\left x \right)`},
+		{"invalid character", "a & b"},
+		{"too deep", strings.Repeat("{", 40) + strings.Repeat("}", 40)},
+		{"too long", strings.Repeat("x", MaxLen+1)},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := Render(c.in, false); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
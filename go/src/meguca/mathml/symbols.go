@@ -0,0 +1,229 @@
+package mathml
+
+// Element types of symbol commands
+const (
+	identifier    = iota // <mi>
+	operator             // <mo>
+	largeOperator        // <mo> with limits placed above and below in display mode
+	function             // Upright <mi> function name, like sin or log
+)
+
+type symbol struct {
+	typ   int
+	value string
+}
+
+// Commands, that map directly to a single symbol
+var symbols = map[string]symbol{
+	// Lowercase Greek
+	"alpha":      {identifier, "α"},
+	"beta":       {identifier, "β"},
+	"gamma":      {identifier, "γ"},
+	"delta":      {identifier, "δ"},
+	"epsilon":    {identifier, "ϵ"},
+	"varepsilon": {identifier, "ε"},
+	"zeta":       {identifier, "ζ"},
+	"eta":        {identifier, "η"},
+	"theta":      {identifier, "θ"},
+	"vartheta":   {identifier, "ϑ"},
+	"iota":       {identifier, "ι"},
+	"kappa":      {identifier, "κ"},
+	"lambda":     {identifier, "λ"},
+	"mu":         {identifier, "μ"},
+	"nu":         {identifier, "ν"},
+	"xi":         {identifier, "ξ"},
+	"pi":         {identifier, "π"},
+	"varpi":      {identifier, "ϖ"},
+	"rho":        {identifier, "ρ"},
+	"varrho":     {identifier, "ϱ"},
+	"sigma":      {identifier, "σ"},
+	"varsigma":   {identifier, "ς"},
+	"tau":        {identifier, "τ"},
+	"upsilon":    {identifier, "υ"},
+	"phi":        {identifier, "ϕ"},
+	"varphi":     {identifier, "φ"},
+	"chi":        {identifier, "χ"},
+	"psi":        {identifier, "ψ"},
+	"omega":      {identifier, "ω"},
+
+	// Uppercase Greek
+	"Gamma":   {identifier, "Γ"},
+	"Delta":   {identifier, "Δ"},
+	"Theta":   {identifier, "Θ"},
+	"Lambda":  {identifier, "Λ"},
+	"Xi":      {identifier, "Ξ"},
+	"Pi":      {identifier, "Π"},
+	"Sigma":   {identifier, "Σ"},
+	"Upsilon": {identifier, "Υ"},
+	"Phi":     {identifier, "Φ"},
+	"Psi":     {identifier, "Ψ"},
+	"Omega":   {identifier, "Ω"},
+
+	// Miscellaneous identifiers
+	"infty":    {identifier, "∞"},
+	"partial":  {identifier, "∂"},
+	"nabla":    {identifier, "∇"},
+	"hbar":     {identifier, "ℏ"},
+	"ell":      {identifier, "ℓ"},
+	"emptyset": {identifier, "∅"},
+	"aleph":    {identifier, "ℵ"},
+	"Re":       {identifier, "ℜ"},
+	"Im":       {identifier, "ℑ"},
+
+	// Binary operators
+	"pm":       {operator, "±"},
+	"mp":       {operator, "∓"},
+	"times":    {operator, "×"},
+	"div":      {operator, "÷"},
+	"cdot":     {operator, "⋅"},
+	"ast":      {operator, "∗"},
+	"circ":     {operator, "∘"},
+	"bullet":   {operator, "∙"},
+	"cap":      {operator, "∩"},
+	"cup":      {operator, "∪"},
+	"wedge":    {operator, "∧"},
+	"land":     {operator, "∧"},
+	"vee":      {operator, "∨"},
+	"lor":      {operator, "∨"},
+	"oplus":    {operator, "⊕"},
+	"otimes":   {operator, "⊗"},
+	"setminus": {operator, "∖"},
+
+	// Relations
+	"leq":            {operator, "≤"},
+	"le":             {operator, "≤"},
+	"geq":            {operator, "≥"},
+	"ge":             {operator, "≥"},
+	"neq":            {operator, "≠"},
+	"ne":             {operator, "≠"},
+	"approx":         {operator, "≈"},
+	"equiv":          {operator, "≡"},
+	"sim":            {operator, "∼"},
+	"simeq":          {operator, "≃"},
+	"cong":           {operator, "≅"},
+	"propto":         {operator, "∝"},
+	"ll":             {operator, "≪"},
+	"gg":             {operator, "≫"},
+	"in":             {operator, "∈"},
+	"notin":          {operator, "∉"},
+	"ni":             {operator, "∋"},
+	"subset":         {operator, "⊂"},
+	"subseteq":       {operator, "⊆"},
+	"supset":         {operator, "⊃"},
+	"supseteq":       {operator, "⊇"},
+	"perp":           {operator, "⊥"},
+	"parallel":       {operator, "∥"},
+	"mid":            {operator, "∣"},
+	"to":             {operator, "→"},
+	"rightarrow":     {operator, "→"},
+	"leftarrow":      {operator, "←"},
+	"gets":           {operator, "←"},
+	"Rightarrow":     {operator, "⇒"},
+	"Leftarrow":      {operator, "⇐"},
+	"implies":        {operator, "⟹"},
+	"iff":            {operator, "⟺"},
+	"leftrightarrow": {operator, "↔"},
+	"Leftrightarrow": {operator, "⇔"},
+	"mapsto":         {operator, "↦"},
+	"forall":         {operator, "∀"},
+	"exists":         {operator, "∃"},
+	"neg":            {operator, "¬"},
+	"lnot":           {operator, "¬"},
+
+	// Delimiters and punctuation
+	"langle": {operator, "⟨"},
+	"rangle": {operator, "⟩"},
+	"lfloor": {operator, "⌊"},
+	"rfloor": {operator, "⌋"},
+	"lceil":  {operator, "⌈"},
+	"rceil":  {operator, "⌉"},
+	"{":      {operator, "{"},
+	"}":      {operator, "}"},
+	"|":      {operator, "‖"},
+	"ldots":  {operator, "…"},
+	"dots":   {operator, "…"},
+	"cdots":  {operator, "⋯"},
+	"vdots":  {operator, "⋮"},
+	"ddots":  {operator, "⋱"},
+	"prime":  {operator, "′"},
+
+	// Large operators
+	"sum":    {largeOperator, "∑"},
+	"prod":   {largeOperator, "∏"},
+	"coprod": {largeOperator, "∐"},
+	"int":    {largeOperator, "∫"},
+	"iint":   {largeOperator, "∬"},
+	"iiint":  {largeOperator, "∭"},
+	"oint":   {largeOperator, "∮"},
+	"bigcup": {largeOperator, "⋃"},
+	"bigcap": {largeOperator, "⋂"},
+	"lim":    {largeOperator, "lim"},
+	"max":    {largeOperator, "max"},
+	"min":    {largeOperator, "min"},
+	"sup":    {largeOperator, "sup"},
+	"inf":    {largeOperator, "inf"},
+
+	// Functions
+	"sin":    {function, "sin"},
+	"cos":    {function, "cos"},
+	"tan":    {function, "tan"},
+	"cot":    {function, "cot"},
+	"sec":    {function, "sec"},
+	"csc":    {function, "csc"},
+	"arcsin": {function, "arcsin"},
+	"arccos": {function, "arccos"},
+	"arctan": {function, "arctan"},
+	"sinh":   {function, "sinh"},
+	"cosh":   {function, "cosh"},
+	"tanh":   {function, "tanh"},
+	"log":    {function, "log"},
+	"ln":     {function, "ln"},
+	"lg":     {function, "lg"},
+	"exp":    {function, "exp"},
+	"det":    {function, "det"},
+	"dim":    {function, "dim"},
+	"ker":    {function, "ker"},
+	"deg":    {function, "deg"},
+	"gcd":    {function, "gcd"},
+	"arg":    {function, "arg"},
+}
+
+// Horizontal spacing commands and their widths
+var spaces = map[string]string{
+	",":     "0.167em",
+	":":     "0.222em",
+	";":     "0.278em",
+	"!":     "-0.167em",
+	" ":     "0.333em",
+	"quad":  "1em",
+	"qquad": "2em",
+}
+
+// Font variant commands and the mathvariant attribute they map to
+var fonts = map[string]string{
+	"mathbb":   "double-struck",
+	"mathbf":   "bold",
+	"mathit":   "italic",
+	"mathrm":   "normal",
+	"mathcal":  "script",
+	"mathfrak": "fraktur",
+	"mathsf":   "sans-serif",
+	"mathtt":   "monospace",
+}
+
+// Accents placed over or under their argument
+var accents = map[string]struct {
+	under bool
+	value string
+}{
+	"hat":       {false, "^"},
+	"widehat":   {false, "^"},
+	"bar":       {false, "¯"},
+	"overline":  {false, "¯"},
+	"vec":       {false, "→"},
+	"dot":       {false, "˙"},
+	"ddot":      {false, "¨"},
+	"tilde":     {false, "~"},
+	"widetilde": {false, "~"},
+	"underline": {true, "_"},
+}
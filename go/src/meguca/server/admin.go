@@ -25,8 +25,9 @@ const (
 	// Consider anything bigger an attack.
 	jsonLimit = 1 << 15
 
-	maxAnswers      = 100  // Maximum number of eightball answers
-	maxEightballLen = 2000 // Total chars in eightball
+	maxAnswers        = 100  // Maximum number of eightball answers
+	maxEightballLen   = 2000 // Total chars in eightball
+	maxThreadsPerPage = 100  // Maximum threads on a board index page
 )
 
 var (
@@ -37,11 +38,26 @@ var (
 	errRulesTooLong     = common.ErrTooLong("rules")
 	errReasonTooLong    = common.ErrTooLong("reason")
 	errJSTooLong        = common.ErrTooLong("custom JavaScript")
+	errCSSTooLong       = common.ErrTooLong("custom CSS")
+	errUnsafeCSS        = errors.New("custom CSS contains forbidden content")
+	errInvalidMarkup    = errors.New("invalid markup type")
+	errInvalidFileType  = errors.New("invalid file type")
+	errTooManyThreads   = errors.New("too many threads per page")
+	errTooManyFiles     = errors.New("too many files per post")
+	errFileSizeTooLarge = errors.New("file size limit too large")
+	errInvalidMetadata  = errors.New("invalid metadata stripping setting")
+	errInvalidSpoiler   = errors.New("invalid spoiler category")
 	errInvalidBoardName = errors.New("invalid board name")
 	errBoardNameTaken   = errors.New("board name taken")
 	errAccessDenied     = errors.New("access denied")
+	errInvalidCSRFToken = errors.New("invalid CSRF token")
 	errNoReason         = errors.New("no reason provided")
 	errNoDuration       = errors.New("no ban duration provided")
+	errNotThread        = errors.New("post is not a thread")
+	errSelfMerge        = errors.New("can not merge thread into itself")
+	errInvalidSHA1      = errors.New("invalid SHA1 hash")
+	errCyclicalCap      = errors.New("cyclical thread reply cap too large")
+	errThumbTooSmall    = errors.New("thumbnail dimensions too small")
 
 	boardNameValidation = regexp.MustCompile(`^[a-z0-9]{1,10}$`)
 )
@@ -181,24 +197,79 @@ func validateBoardConfigs(
 		err = errTitleTooLong
 	case len(conf.Js) > common.MaxLenCustomJS:
 		err = errJSTooLong
+	case len(conf.CSS) > common.MaxLenCustomCSS:
+		err = errCSSTooLong
+	case !isSafeCSS(conf.CSS):
+		err = errUnsafeCSS
+	case conf.ThreadsPerPage > maxThreadsPerPage:
+		err = errTooManyThreads
+	case conf.MaxFiles > common.MaxNumFiles:
+		err = errTooManyFiles
+	case conf.MaxSize > common.MaxBoardFileSize:
+		err = errFileSizeTooLarge
+	case !common.IsTheme(conf.DefaultCSS):
+		err = errors.New("invalid default theme")
+	case !isValidMarkup(conf.DisabledMarkup):
+		err = errInvalidMarkup
+	case !isValidFileTypes(conf.AllowedTypes):
+		err = errInvalidFileType
+	case !isValidMetadataSetting(conf.StripMetadata):
+		err = errInvalidMetadata
 	}
-	if err == nil {
-		matched := false
-		for _, t := range common.Themes {
-			if conf.DefaultCSS == t {
-				matched = true
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 %s", err), 400)
+		return false
+	}
+
+	return true
+}
+
+// Returns, if s is a valid board metadata stripping setting
+func isValidMetadataSetting(s string) bool {
+	switch s {
+	case "", config.MetadataDefault, config.MetadataStrip, config.MetadataKeep:
+		return true
+	}
+	return false
+}
+
+// Returns, if all entries are valid markup types
+func isValidMarkup(markup []string) bool {
+	if len(markup) > len(common.MarkupTypes) {
+		return false
+	}
+	for _, m := range markup {
+		valid := false
+		for _, t := range common.MarkupTypes {
+			if m == t {
+				valid = true
 				break
 			}
 		}
-		if !matched {
-			err = errors.New("invalid default theme")
+		if !valid {
+			return false
 		}
 	}
-	if err != nil {
-		http.Error(w, fmt.Sprintf("400 %s", err), 400)
+	return true
+}
+
+// Returns, if all entries are known file type extensions
+func isValidFileTypes(types []string) bool {
+	if len(types) > len(common.Extensions) {
 		return false
 	}
-
+	for _, t := range types {
+		valid := false
+		for _, ext := range common.Extensions {
+			if t == ext {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return false
+		}
+	}
 	return true
 }
 
@@ -310,9 +381,12 @@ func createBoard(w http.ResponseWriter, r *http.Request) {
 			BoardPublic: config.BoardPublic{
 				Title:      msg.Title,
 				DefaultCSS: config.Get().DefaultCSS,
+				BumpLimit:  config.DefaultBumpLimit,
+				MaxFiles:   1,
 			},
-			ID:        msg.ID,
-			Eightball: config.EightballDefaults,
+			ID:             msg.ID,
+			ThreadsPerPage: config.DefaultThreadsPerPage,
+			Eightball:      config.EightballDefaults,
 		},
 	})
 	switch {
@@ -344,11 +418,32 @@ func configureServer(w http.ResponseWriter, r *http.Request) {
 	if !decodeJSON(w, r, &msg) || !isAdmin(w, r) {
 		return
 	}
+	if err := validateServerConfigs(msg); err != nil {
+		text400(w, err)
+		return
+	}
 	if err := db.WriteConfigs(msg); err != nil {
 		text500(w, r, err)
 	}
 }
 
+// Validate server configuration values, that can not be processed, if
+// invalid
+func validateServerConfigs(conf config.Configs) error {
+	dims := [...]uint16{
+		conf.ThumbWidth,
+		conf.ThumbHeight,
+		conf.CatalogThumbWidth,
+		conf.CatalogThumbHeight,
+	}
+	for _, d := range dims {
+		if d < common.MinThumbSize {
+			return errThumbTooSmall
+		}
+	}
+	return nil
+}
+
 // Delete a board owned by the client
 func deleteBoard(w http.ResponseWriter, r *http.Request) {
 	var msg boardActionRequest
@@ -406,9 +501,19 @@ func moderatePosts(
 	fn func(id uint64, userID string) error,
 ) {
 	var ids []uint64
-	if !decodeJSON(w, r, &ids) {
-		return
+	if decodeJSON(w, r, &ids) {
+		moderatePostIDs(w, r, ids, level, fn)
 	}
+}
+
+// Moderate posts by ID and stop on the first error
+func moderatePostIDs(
+	w http.ResponseWriter,
+	r *http.Request,
+	ids []uint64,
+	level auth.ModerationLevel,
+	fn func(id uint64, userID string) error,
+) {
 	for _, id := range ids {
 		ok := moderatePost(w, r, id, auth.Janitor, func(userID string) error {
 			return fn(id, userID)
@@ -424,9 +529,28 @@ func deleteImage(w http.ResponseWriter, r *http.Request) {
 	moderatePosts(w, r, auth.Janitor, db.DeleteImage)
 }
 
-// Spoiler image as a moderator
+// Spoiler images as a moderator with the specified spoiler category. Defaults
+// to common.SpoilerGeneric.
 func modSpoilerImage(w http.ResponseWriter, r *http.Request) {
-	moderatePosts(w, r, auth.Janitor, db.ModSpoilerImage)
+	var msg struct {
+		Category uint8
+		IDs      []uint64
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	if msg.Category == common.NoSpoiler {
+		msg.Category = common.SpoilerGeneric
+	}
+	if !common.IsValidSpoiler(msg.Category) {
+		text400(w, errInvalidSpoiler)
+		return
+	}
+
+	moderatePostIDs(w, r, msg.IDs, auth.Janitor,
+		func(id uint64, userID string) error {
+			return db.ModSpoilerImage(id, msg.Category, userID)
+		})
 }
 
 // Ban a specific IP from a specific board
@@ -488,22 +612,114 @@ func ban(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Apply bans
-	expires := time.Now().Add(time.Duration(msg.Duration) * time.Minute)
+	applyBans(w, r, byBoard, msg.Reason, creds.UserID, msg.Duration)
+}
+
+// Ban the authors of posts grouped by board for duration minutes and redirect
+// any banned connected clients. Returns false, if an error was sent to the
+// client.
+func applyBans(
+	w http.ResponseWriter,
+	r *http.Request,
+	byBoard map[string][]uint64,
+	reason, by string,
+	duration uint64,
+) bool {
+	expires := time.Now().Add(time.Duration(duration) * time.Minute)
 	for board, ids := range byBoard {
-		ips, err := db.Ban(board, msg.Reason, creds.UserID, expires, ids...)
+		ips, err := db.Ban(board, reason, by, expires, ids...)
 		if err != nil {
 			text500(w, r, err)
-			return
+			return false
 		}
 
 		// Redirect all banned connected clients to the /all/ board
 		for ip := range ips {
 			for _, cl := range common.GetByIPAndBoard(ip, board) {
-				cl.Redirect("all")
+				cl.Redirect("all", 0)
 			}
 		}
 	}
+	return true
+}
+
+// Delete the images of posts from all posts on any board and ban the files
+// from being uploaded again. Affects all boards, so only available to the
+// admin account.
+func banFile(w http.ResponseWriter, r *http.Request) {
+	var ids []uint64
+	if !decodeJSON(w, r, &ids) {
+		return
+	}
+	creds, ok := isLoggedIn(w, r)
+	switch {
+	case !ok:
+		return
+	case creds.UserID != "admin":
+		text403(w, errAccessDenied)
+		return
+	}
+	for _, id := range ids {
+		switch err := db.BanFile(id, creds.UserID); err {
+		case nil:
+		case sql.ErrNoRows:
+			text400(w, err)
+			return
+		default:
+			text500(w, r, err)
+			return
+		}
+	}
+}
+
+// Add the images of posts to the blocklist of their boards or the global
+// blocklist
+func blockImage(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Global bool
+		IDs    []uint64
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	creds, ok := isLoggedIn(w, r)
+	switch {
+	case !ok:
+		return
+	case msg.Global && creds.UserID != "admin":
+		text403(w, errAccessDenied)
+		return
+	}
+
+	boards := make(map[uint64]string, len(msg.IDs))
+	for _, id := range msg.IDs {
+		if msg.Global {
+			boards[id] = "all"
+			continue
+		}
+
+		board, err := db.GetPostBoard(id)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			text400(w, err)
+			return
+		default:
+			text500(w, r, err)
+			return
+		}
+		if _, ok := canPerform(w, r, board, auth.Moderator, nil); !ok {
+			return
+		}
+		boards[id] = board
+	}
+
+	for id, board := range boards {
+		if err := db.BlockImage(board, id, creds.UserID); err != nil {
+			text500(w, r, err)
+			return
+		}
+	}
 }
 
 // Send a textual message to all connected clients
@@ -595,6 +811,187 @@ func getSameIPPosts(w http.ResponseWriter, r *http.Request) {
 	serveJSON(w, r, "", posts)
 }
 
+// Serve all posts referencing a file as JSON
+func getImagePosts(w http.ResponseWriter, r *http.Request) {
+	_, _, posts, ok := imagePostsByLevel(w, r, auth.Janitor)
+	if ok {
+		serveJSON(w, r, "", posts)
+	}
+}
+
+// Serve all posts referencing a file as an HTML listing with mass moderation
+// forms
+func imagePostsList(w http.ResponseWriter, r *http.Request) {
+	SHA1, creds, posts, ok := imagePostsByLevel(w, r, auth.Janitor)
+	if ok {
+		csrf := auth.CSRFToken(creds.Session)
+		html := []byte(templates.ImagePosts(SHA1, csrf, posts))
+		serveHTML(w, r, "", html, nil)
+	}
+}
+
+// Read the posts referencing the file specified by the "sha1" URL parameter,
+// that are on boards the client has at least the passed moderation level on.
+// Only available to staff members. Returns false, if an error was sent to the
+// client.
+func imagePostsByLevel(
+	w http.ResponseWriter,
+	r *http.Request,
+	level auth.ModerationLevel,
+) (
+	SHA1 string, creds auth.SessionCreds,
+	posts []common.ImageBoardPosts, ok bool,
+) {
+	SHA1 = extractParam(r, "sha1")
+	if !sha1Regexp.MatchString(SHA1) {
+		text400(w, errInvalidSHA1)
+		return
+	}
+	creds, ok = isLoggedIn(w, r)
+	if !ok {
+		return
+	}
+	ok = false
+	isStaff, err := db.IsStaff(creds.UserID)
+	switch {
+	case err != nil:
+		text500(w, r, err)
+		return
+	case !isStaff:
+		text403(w, errAccessDenied)
+		return
+	}
+
+	all, err := db.GetImagePosts(SHA1)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	posts = make([]common.ImageBoardPosts, 0, len(all))
+	for _, b := range all {
+		can, err := db.CanPerform(creds.UserID, b.Board, level)
+		switch {
+		case err != nil:
+			text500(w, r, err)
+			return
+		case can:
+			posts = append(posts, b)
+		}
+	}
+	ok = true
+	return
+}
+
+// Check the CSRF token in the "csrf" field of a parsed form matches the
+// client's login session. Returns false, if an error was sent to the client.
+func checkCSRFToken(
+	w http.ResponseWriter,
+	r *http.Request,
+	creds auth.SessionCreds,
+) bool {
+	if !auth.CheckCSRFToken(creds.Session, r.Form.Get("csrf")) {
+		text403(w, errInvalidCSRFToken)
+		return false
+	}
+	return true
+}
+
+// Delete all posts referencing a file on boards the client can moderate. The
+// form must contain the CSRF token of the client's session in the "csrf"
+// field.
+func deleteImagePosts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, jsonLimit)
+	if err := r.ParseForm(); err != nil {
+		text400(w, err)
+		return
+	}
+	SHA1, creds, posts, ok := imagePostsByLevel(w, r, auth.Janitor)
+	if !ok || !checkCSRFToken(w, r, creds) {
+		return
+	}
+	for _, b := range posts {
+		for _, t := range b.Threads {
+			for _, id := range t.Posts {
+				switch err := db.DeletePost(id, creds.UserID); err {
+				case nil, sql.ErrNoRows:
+				default:
+					text500(w, r, err)
+					return
+				}
+			}
+		}
+	}
+	http.Redirect(w, r, "/html/image-posts/"+SHA1, 303)
+}
+
+// Ban the authors of all posts referencing a file on boards the client can
+// moderate. The ban reason and duration in minutes are read from the
+// "reason" and "duration" form fields and the CSRF token of the client's
+// session from the "csrf" field.
+func banImagePosts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, jsonLimit)
+	err := r.ParseForm()
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	reason := r.Form.Get("reason")
+	duration, _ := strconv.ParseUint(r.Form.Get("duration"), 10, 64)
+	switch {
+	case len(reason) > common.MaxLenReason:
+		text400(w, errReasonTooLong)
+		return
+	case reason == "":
+		text400(w, errNoReason)
+		return
+	case duration == 0:
+		text400(w, errNoDuration)
+		return
+	}
+
+	SHA1, creds, posts, ok := imagePostsByLevel(w, r, auth.Moderator)
+	if !ok || !checkCSRFToken(w, r, creds) {
+		return
+	}
+	byBoard := make(map[string][]uint64, len(posts))
+	for _, b := range posts {
+		for _, t := range b.Threads {
+			byBoard[b.Board] = append(byBoard[b.Board], t.Posts...)
+		}
+	}
+	if applyBans(w, r, byBoard, reason, creds.UserID, duration) {
+		http.Redirect(w, r, "/html/image-posts/"+SHA1, 303)
+	}
+}
+
+// Serve the disk space used by the files of each board and the server in
+// total as JSON. Only available to the admin account.
+func serveStorageUsage(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	rep, err := db.GetStorageUsage()
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	serveJSON(w, r, "", rep)
+}
+
+// Render the disk space used by the files of each board and the server in
+// total. Only available to the admin account.
+func storageUsagePage(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	rep, err := db.GetStorageUsage()
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	serveHTML(w, r, "", []byte(templates.StorageUsage(rep)), nil)
+}
+
 // Set the sticky flag of a thread
 func setThreadSticky(w http.ResponseWriter, r *http.Request) {
 	handleBoolRequest(w, r, func(id uint64, val bool, _ string) error {
@@ -636,6 +1033,122 @@ func setThreadLock(w http.ResponseWriter, r *http.Request) {
 	handleBoolRequest(w, r, db.SetThreadLock)
 }
 
+// Set a thread to delete its oldest replies instead of expiring. Cap sets the
+// number of replies the thread retains and defaults to
+// common.DefaultCyclicalCap.
+func setThreadCyclical(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID  uint64
+		Val bool
+		Cap uint
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	switch {
+	case msg.Cap == 0:
+		msg.Cap = common.DefaultCyclicalCap
+	case msg.Cap > common.MaxCyclicalCap:
+		text400(w, errCyclicalCap)
+		return
+	}
+
+	board, userID, ok := canModeratePost(w, r, msg.ID, auth.Moderator)
+	if !ok || !assertIsOP(w, r, msg.ID, board) {
+		return
+	}
+
+	err := db.SetThreadCyclical(msg.ID, msg.Val, msg.Cap, userID)
+	if err != nil {
+		text500(w, r, err)
+	}
+}
+
+// Assert the post is the OP of a thread on the specified board
+func assertIsOP(
+	w http.ResponseWriter,
+	r *http.Request,
+	id uint64,
+	board string,
+) bool {
+	valid, err := db.ValidateOP(id, board)
+	switch {
+	case err != nil:
+		text500(w, r, err)
+		return false
+	case !valid:
+		text400(w, errNotThread)
+		return false
+	default:
+		return true
+	}
+}
+
+// Move a thread and all its posts to a different board
+func moveThread(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID    uint64
+		Board string
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	if !auth.IsNonMetaBoard(msg.Board) {
+		text400(w, errInvalidBoardName)
+		return
+	}
+	board, userID, ok := canModeratePost(w, r, msg.ID, auth.Moderator)
+	if !ok || !assertIsOP(w, r, msg.ID, board) {
+		return
+	}
+	if _, ok := canPerform(w, r, msg.Board, auth.Moderator, nil); !ok {
+		return
+	}
+
+	if err := db.MoveThread(msg.ID, msg.Board, userID); err != nil {
+		text500(w, r, err)
+		return
+	}
+	clearThreadCache(msg.ID, board, msg.Board)
+
+	// Redirect all clients synced to the thread to its new board
+	for _, cl := range feeds.GetByThread(msg.ID) {
+		cl.Redirect(msg.Board, 0)
+	}
+}
+
+// Merge all posts of a thread into another thread and delete the former
+func mergeThread(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID, Target uint64
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	if msg.ID == msg.Target {
+		text400(w, errSelfMerge)
+		return
+	}
+	board, userID, ok := canModeratePost(w, r, msg.ID, auth.Moderator)
+	if !ok ||
+		!assertIsOP(w, r, msg.ID, board) ||
+		!assertIsOP(w, r, msg.Target, board) {
+		return
+	}
+
+	if err := db.MergeThread(msg.ID, msg.Target, userID); err != nil {
+		text500(w, r, err)
+		return
+	}
+
+	// The source thread's records are cleared on the thread deletion
+	// notification
+	clearThreadCache(msg.Target, board)
+	for _, cl := range feeds.GetByThread(msg.ID) {
+		cl.Redirect(board, msg.Target)
+	}
+}
+
 // Render list of bans on a board with unban links for authenticated staff
 func banList(w http.ResponseWriter, r *http.Request) {
 	board := extractParam(r, "board")
@@ -8,9 +8,11 @@ import (
 	"meguca/common"
 	"meguca/config"
 	"meguca/db"
+	"meguca/imager/assets"
 	. "meguca/test"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -181,6 +183,66 @@ func TestValidateBoardConfigs(t *testing.T) {
 			},
 			errTitleTooLong,
 		},
+		{
+			"custom CSS too long",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS: "moe",
+				},
+				CSS: GenString(common.MaxLenCustomCSS + 1),
+			},
+			errCSSTooLong,
+		},
+		{
+			"unsafe custom CSS",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS: "moe",
+				},
+				CSS: `body { background: url("https://example.com/a.png"); }`,
+			},
+			errUnsafeCSS,
+		},
+		{
+			"invalid markup type",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS:     "moe",
+					DisabledMarkup: []string{"bold", "blink"},
+				},
+			},
+			errInvalidMarkup,
+		},
+		{
+			"invalid file type",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS:   "moe",
+					AllowedTypes: []string{"flac", "exe"},
+				},
+			},
+			errInvalidFileType,
+		},
+		{
+			"file size limit too large",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS: "moe",
+					MaxSize:    common.MaxBoardFileSize + 1,
+				},
+			},
+			errFileSizeTooLarge,
+		},
+		{
+			"invalid metadata stripping setting",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					DefaultCSS: "moe",
+				},
+				StripMetadata: "always",
+			},
+			errInvalidMetadata,
+		},
 	}
 
 	for i := range cases {
@@ -375,6 +437,51 @@ func TestServePrivateServerConfigs(t *testing.T) {
 	}
 }
 
+func TestServeStorageUsage(t *testing.T) {
+	assertTableClear(t, "accounts", "boards", "images")
+	writeSampleUser(t)
+	writeAdminAccount(t)
+
+	cases := [...]struct {
+		name string
+		auth.SessionCreds
+		code int
+		err  error
+	}{
+		{
+			name:         "not admin",
+			SessionCreds: sampleLoginCreds,
+			code:         403,
+			err:          errAccessDenied,
+		},
+		{
+			name:         "admin",
+			SessionCreds: adminLoginCreds,
+			code:         200,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/storage-usage", nil)
+			setLoginCookies(req, c.SessionCreds)
+			router.ServeHTTP(rec, req)
+
+			assertError(t, rec, c.code, c.err)
+			if c.err == nil {
+				std := common.StorageReport{
+					Boards: []common.StorageUsage{},
+				}
+				assertBody(t, rec, string(marshalJSON(t, std)))
+			}
+		})
+	}
+}
+
 func writeAdminAccount(t *testing.T) {
 	t.Helper()
 
@@ -412,6 +519,29 @@ func TestServerConfigSetting(t *testing.T) {
 	AssertDeepEquals(t, conf, std)
 }
 
+func TestServerConfigThumbnailSize(t *testing.T) {
+	assertTableClear(t, "accounts")
+	if err := db.WriteConfigs(config.Defaults); err != nil {
+		t.Fatal(err)
+	}
+	writeAdminAccount(t)
+
+	msg := config.Defaults
+	msg.ThumbHeight = common.MinThumbSize - 1
+	rec, req := newJSONPair(t, "/api/configure-server", msg)
+	setLoginCookies(req, adminLoginCreds)
+	router.ServeHTTP(rec, req)
+
+	assertCode(t, rec, 400)
+	assertBody(t, rec, fmt.Sprintf("400 %s\n", errThumbTooSmall))
+
+	conf, err := db.GetConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, conf, config.Defaults)
+}
+
 func TestDeleteBoard(t *testing.T) {
 	assertTableClear(t, "accounts", "boards")
 	writeSampleUser(t)
@@ -529,6 +659,161 @@ func TestDeletePost(t *testing.T) {
 	}
 }
 
+func TestImagePosts(t *testing.T) {
+	assertTableClear(t, "accounts", "boards", "images", "bans")
+	writeSampleBoard(t)
+	writeSampleUser(t)
+	writeSampleBoardOwner(t)
+
+	cConfigs := db.BoardConfigs{
+		BoardConfigs: config.BoardConfigs{
+			ID:        "c",
+			Eightball: []string{"yes"},
+		},
+	}
+	err := db.WriteBoard(nil, cConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.SetBoardConfigs(cConfigs.BoardConfigs); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteImage(nil, assets.StdJPEG.ImageCommon); err != nil {
+		t.Fatal(err)
+	}
+
+	// One thread with the image on a board owned by the user and one on a
+	// board, the user has no access rights to
+	for _, id := range [...]uint64{1, 3} {
+		board := "a"
+		if id == 3 {
+			board = "c"
+		}
+		thread := db.Thread{
+			ID:    id,
+			Board: board,
+		}
+		op := db.Post{
+			StandalonePost: common.StandalonePost{
+				Board: board,
+				Post: common.Post{
+					ID:    id,
+					Image: &assets.StdJPEG,
+				},
+				OP: id,
+			},
+			IP: "::1",
+		}
+		if err := db.WriteThread(nil, thread, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	url := "/api/image-posts/" + assets.StdJPEG.SHA1
+	csrf := auth.CSRFToken(sampleLoginCreds.Session)
+	postForm := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setLoginCookies(req, sampleLoginCreds)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("invalid SHA1", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/image-posts/abc", nil)
+		setLoginCookies(req, sampleLoginCreds)
+		router.ServeHTTP(rec, req)
+		assertError(t, rec, 400, errInvalidSHA1)
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		router.ServeHTTP(rec, req)
+		assertError(t, rec, 403, errAccessDenied)
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		setLoginCookies(req, sampleLoginCreds)
+		router.ServeHTTP(rec, req)
+		assertCode(t, rec, 200)
+		std := []common.ImageBoardPosts{
+			{
+				Board: "a",
+				Threads: []common.ImageThreadPosts{
+					{
+						ID:    1,
+						Posts: []uint64{1},
+					},
+				},
+			},
+		}
+		assertBody(t, rec, string(marshalJSON(t, std)))
+	})
+
+	t.Run("mass ban without CSRF token", func(t *testing.T) {
+		rec := postForm(url+"/ban", "reason=spam&duration=60")
+		assertError(t, rec, 403, errInvalidCSRFToken)
+
+		bans, err := db.GetBoardBans("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, len(bans), 0)
+	})
+
+	t.Run("mass ban", func(t *testing.T) {
+		rec := postForm(url+"/ban", "reason=spam&duration=60&csrf="+csrf)
+		assertCode(t, rec, 303)
+
+		for board, count := range map[string]int{"a": 1, "c": 0} {
+			bans, err := db.GetBoardBans(board)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bans) != count {
+				t.Fatalf("unexpected ban count on /%s/: %d", board, len(bans))
+			}
+			if count != 0 {
+				AssertDeepEquals(t, bans[0].ForPost, uint64(1))
+				AssertDeepEquals(t, bans[0].Reason, "spam")
+			}
+		}
+	})
+
+	t.Run("mass delete without CSRF token", func(t *testing.T) {
+		rec := postForm(url+"/delete", "csrf="+auth.CSRFToken(genSession()))
+		assertError(t, rec, 403, errInvalidCSRFToken)
+
+		post, err := db.GetPost(1)
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case post.Deleted:
+			t.Fatal("post deleted")
+		}
+	})
+
+	t.Run("mass delete", func(t *testing.T) {
+		rec := postForm(url+"/delete", "csrf="+csrf)
+		assertCode(t, rec, 303)
+
+		for id, deleted := range map[uint64]bool{1: true, 3: false} {
+			post, err := db.GetPost(id)
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case post.Deleted != deleted:
+				LogUnexpected(t, post.Deleted, deleted)
+			}
+		}
+	})
+}
+
 func writeSampleThread(t *testing.T) {
 	t.Helper()
 
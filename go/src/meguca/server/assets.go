@@ -2,16 +2,22 @@ package server
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"meguca/assets"
 	"meguca/auth"
 	"meguca/common"
 	"meguca/db"
+	"meguca/templates"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bakape/thumbnailer"
@@ -31,8 +37,25 @@ var (
 
 	// Path to the service worker script. Overrideable in tests.
 	workerPath = getWorkerPath()
+
+	flagNameRegexp = regexp.MustCompile(
+		fmt.Sprintf(`^[\w\-]{1,%d}$`, common.MaxLenFlagName),
+	)
+	sha1Regexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
 )
 
+func init() {
+	// Upload formats missing from the MIME type tables of many systems
+	for ext, typ := range map[string]string{
+		".webp": "image/webp",
+		".avif": "image/avif",
+		".opus": "audio/ogg",
+		".m4a":  "audio/mp4",
+	} {
+		mime.AddExtensionType(ext, typ)
+	}
+}
+
 func getWorkerPath() string {
 	return filepath.FromSlash(webRoot + "/js/scripts/worker.js")
 }
@@ -56,6 +79,46 @@ func serveImages(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, path, time.Time{}, file)
 }
 
+// Render an uploaded text file with line numbers and syntax highlighting. The
+// name the file was posted with is passed in the "name" query parameter and
+// selects the highlighting language by its extension.
+func serveTextViewer(w http.ResponseWriter, r *http.Request) {
+	SHA1 := extractParam(r, "sha1")
+	if !sha1Regexp.MatchString(SHA1) {
+		text404(w)
+		return
+	}
+	img, err := db.GetImage(SHA1)
+	switch {
+	case err == sql.ErrNoRows, err == nil && img.FileType != common.TXT:
+		text404(w)
+		return
+	case err != nil:
+		text500(w, r, err)
+		return
+	}
+
+	ext := common.Extensions[common.TXT]
+	text, err := ioutil.ReadFile(
+		filepath.Join(imageWebRoot, "src", SHA1+"."+ext),
+	)
+	switch {
+	case os.IsNotExist(err):
+		text404(w)
+		return
+	case err != nil:
+		text500(w, r, err)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = SHA1 + "." + ext
+	}
+	html := templates.TextViewer(name, resolveTheme(r, "all"), text)
+	serveHTML(w, r, "", []byte(html), nil)
+}
+
 func cleanJoin(a, b string) string {
 	return filepath.Clean(filepath.Join(a, b))
 }
@@ -144,6 +207,121 @@ func setBanners(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Set the custom flag set of a board. Flag names are taken from the uploaded
+// file names.
+func setFlags(w http.ResponseWriter, r *http.Request) {
+	board, ok := parseAssetForm(w, r, common.MaxNumFlags)
+	if !ok {
+		return
+	}
+
+	var (
+		opts = thumbnailer.Options{
+			MaxSourceDims: thumbnailer.Dims{
+				Width:  64,
+				Height: 64,
+			},
+			ThumbDims: thumbnailer.Dims{
+				Width:  64,
+				Height: 64,
+			},
+			AcceptedMimeTypes: map[string]bool{
+				"image/jpeg": true,
+				"image/png":  true,
+				"image/gif":  true,
+			},
+		}
+		flags = make([]assets.Flag, 0, common.MaxNumFlags)
+		names = make(map[string]bool, common.MaxNumFlags)
+		files = r.MultipartForm.File["flags"]
+	)
+	for i := 0; i < common.MaxNumFlags && i < len(files); i++ {
+		h := files[i]
+		name := strings.TrimSuffix(h.Filename, filepath.Ext(h.Filename))
+		switch {
+		case !flagNameRegexp.MatchString(name):
+			sendFileError(w, h, "invalid flag name")
+			return
+		case names[name]:
+			sendFileError(w, h, "duplicate flag name")
+			return
+		}
+		names[name] = true
+
+		file, err := h.Open()
+		if err != nil {
+			sendFileError(w, h, err.Error())
+			return
+		}
+		out, ok := readAssetFile(w, r, file, h, opts)
+		if !ok {
+			return
+		}
+		defer thumbnailer.ReturnBuffer(out.Data)
+		flags = append(flags, assets.Flag{
+			File: out,
+			Name: name,
+		})
+	}
+
+	if err := db.SetFlags(board, flags); err != nil {
+		text500(w, r, err)
+	}
+}
+
+// Set the custom spoiler images of a board. Each spoiler category is uploaded
+// in a file field named after the category. Categories without a file use the
+// default spoiler image.
+func setSpoilers(w http.ResponseWriter, r *http.Request) {
+	board, ok := parseAssetForm(w, r, uint(len(common.SpoilerCategories)-1))
+	if !ok {
+		return
+	}
+
+	var (
+		opts = thumbnailer.Options{
+			MaxSourceDims: thumbnailer.Dims{
+				Width:  150,
+				Height: 150,
+			},
+			ThumbDims: thumbnailer.Dims{
+				Width:  150,
+				Height: 150,
+			},
+			AcceptedMimeTypes: map[string]bool{
+				"image/jpeg": true,
+				"image/png":  true,
+				"image/gif":  true,
+			},
+		}
+		files = make(map[uint8]assets.File, len(common.SpoilerCategories))
+	)
+	for c, name := range common.SpoilerCategories {
+		if uint8(c) == common.NoSpoiler {
+			continue
+		}
+		file, h, err := r.FormFile(name)
+		switch err {
+		case nil:
+		case http.ErrMissingFile:
+			continue
+		default:
+			text400(w, err)
+			return
+		}
+		out, ok := readAssetFile(w, r, file, h, opts)
+		if !ok {
+			return
+		}
+		defer thumbnailer.ReturnBuffer(out.Data)
+		files[uint8(c)] = out
+	}
+
+	if err := db.SetSpoilers(board, files); err != nil {
+		text500(w, r, err)
+	}
+}
+
 // Parse form for uploading file assets for a board.
 // maxSize specifies maximum number of common.MaxAssetSize to accept.
 // If ok == false, caller should return.
@@ -292,6 +470,34 @@ func serveAssetFromMemory(
 	w.Write(f.Data)
 }
 
+// Serve board-specific custom flag image files
+func serveFlag(w http.ResponseWriter, r *http.Request) {
+	f, ok := assets.Flags.Get(extractParam(r, "board"), extractParam(r, "name"))
+	if !ok {
+		text404(w)
+		return
+	}
+	serveAssetFromMemory(w, r, f)
+}
+
+// Serve board-specific spoiler image of a spoiler category. Falls back to the
+// default spoiler image, if the board has no custom image for the category.
+func serveSpoiler(w http.ResponseWriter, r *http.Request) {
+	c, err := strconv.ParseUint(extractParam(r, "category"), 10, 8)
+	if err != nil || uint8(c) == common.NoSpoiler ||
+		!common.IsValidSpoiler(uint8(c)) {
+		text404(w)
+		return
+	}
+
+	f, ok := assets.Spoilers.Get(extractParam(r, "board"), uint8(c))
+	if !ok {
+		serveFile(w, r, filepath.FromSlash(webRoot+"/spoil/default.jpg"))
+		return
+	}
+	serveAssetFromMemory(w, r, f)
+}
+
 // Serve board-specific loading animation
 func serveLoadingAnimation(w http.ResponseWriter, r *http.Request) {
 	serveAssetFromMemory(w, r, assets.Loading.Get(extractParam(r, "board")))
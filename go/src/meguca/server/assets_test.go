@@ -2,6 +2,8 @@ package server
 
 import (
 	"io/ioutil"
+	"meguca/assets"
+	"meguca/common"
 	"path/filepath"
 	"testing"
 )
@@ -55,3 +57,41 @@ func TestImageServer(t *testing.T) {
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 404)
 }
+
+func TestServeSpoiler(t *testing.T) {
+	t.Parallel()
+
+	assets.Spoilers.Set("a", map[uint8]assets.File{
+		common.SpoilerNSFW: {
+			Data: []byte("nsfw"),
+			Mime: "image/png",
+		},
+	})
+
+	cases := [...]struct {
+		name, url string
+		code      int
+		body      string
+	}{
+		{"custom", "/assets/spoilers/a/2", 200, "nsfw"},
+		{"default", "/assets/spoilers/a/1", 200, "default spoiler\n"},
+		{"no custom spoilers", "/assets/spoilers/b/3", 200, "default spoiler\n"},
+		{"no spoiler", "/assets/spoilers/a/0", 404, ""},
+		{"invalid category", "/assets/spoilers/a/4", 404, ""},
+		{"not a number", "/assets/spoilers/a/nsfw", 404, ""},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec, req := newPair(c.url)
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, c.code)
+			if c.code == 200 {
+				assertBody(t, rec, c.body)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"meguca/cache"
@@ -11,6 +12,7 @@ import (
 	"meguca/db"
 	"meguca/templates"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -71,21 +73,27 @@ var boardCache = cache.FrontEnd{
 	GetFresh: func(k cache.Key) (interface{}, error) {
 		// Get thread IDs in the right order
 		var (
-			ids []uint64
-			err error
+			ids  []uint64
+			err  error
+			sort = common.SortMode(k.Sort)
 		)
 		if k.Board == "all" {
-			ids, err = db.GetAllThreadsIDs()
+			ids, err = db.GetAllThreadsIDs(sort)
 		} else {
-			ids, err = db.GetThreadIDs(k.Board)
+			ids, err = db.GetThreadIDs(k.Board, sort)
 		}
 		if err != nil {
 			return nil, err
 		}
 
+		perPage := int(config.GetBoardConfigs(k.Board).ThreadsPerPage)
+		if perPage == 0 {
+			perPage = config.DefaultThreadsPerPage
+		}
+
 		// Get data and JSON for these views and paginate
 		var (
-			pages = make([]pageStore, 0, len(ids)/15+1)
+			pages = make([]pageStore, 0, len(ids)/perPage+1)
 			page  pageStore
 		)
 		closePage := func() {
@@ -107,12 +115,12 @@ var boardCache = cache.FrontEnd{
 
 		for i, id := range ids {
 			// Start a new page
-			if i%15 == 0 {
+			if i%perPage == 0 {
 				closePage()
 				page = pageStore{
 					pageNumber: len(pages),
 					json:       append(make([]byte, 0, 1<<10), '['),
-					data:       make(common.Board, 0, 15),
+					data:       make(common.Board, 0, perPage),
 				}
 			}
 
@@ -199,47 +207,188 @@ var boardPageCache = cache.FrontEnd{
 	},
 }
 
+// For individual pages of a board catalog
+var catalogPageCache = cache.FrontEnd{
+	GetCounter: func(k cache.Key) (uint64, error) {
+		// Get the counter of the parent catalog
+		k.Page = -1
+		k.Sort = 0
+		_, _, ctr, err := cache.GetJSONAndData(k, catalogCache)
+		return ctr, err
+	},
+
+	GetFresh: func(k cache.Key) (interface{}, error) {
+		i := int(k.Page)
+		mode := common.SortMode(k.Sort)
+		k.Page = -1
+		k.Sort = 0 // All sort modes share the same catalog
+		_, data, _, err := cache.GetJSONAndData(k, catalogCache)
+		if err != nil {
+			return nil, err
+		}
+		b := sortCatalog(data.(common.Board), k.Board, mode)
+		return catalogPage(b, i)
+	},
+
+	EncodeJSON: func(data interface{}) ([]byte, error) {
+		return data.(pageStore).json, nil
+	},
+
+	RenderHTML: func(data interface{}, json []byte) []byte {
+		return []byte(templates.CatalogThreads(data.(pageStore).data, json))
+	},
+}
+
+// Sort the threads of a board catalog in the same order as the board index
+// with the sort mode. Catalogs are retrieved sorted by bump time, so for other
+// sort modes a sorted copy is returned.
+func sortCatalog(b common.Board, board string, mode common.SortMode) (
+	sorted common.Board,
+) {
+	if mode == common.SortByBump {
+		return b
+	}
+
+	key := func(t *common.Thread) int64 {
+		switch mode {
+		case common.SortByLastReply:
+			return t.ReplyTime
+		case common.SortByCreation:
+			return int64(t.ID)
+		case common.SortByReplyCount:
+			return int64(t.PostCtr)
+		case common.SortByFileCount:
+			return int64(t.ImageCtr)
+		default:
+			return t.BumpTime
+		}
+	}
+	sorted = append(make(common.Board, 0, len(b)), b...)
+
+	// Stable, so threads with equal keys stay sorted by bump time
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := &sorted[i], &sorted[j]
+		if board != "all" && a.Sticky != b.Sticky {
+			return a.Sticky
+		}
+		return key(a) > key(b)
+	})
+	return sorted
+}
+
+// Split a board catalog into pages of config.ThreadsPerCatalogPage threads and
+// return the page with index i
+func catalogPage(b common.Board, i int) (p pageStore, err error) {
+	const perPage = config.ThreadsPerCatalogPage
+
+	total := (len(b) + perPage - 1) / perPage
+	if total == 0 { // Empty board
+		total = 1
+	}
+	if i > total-1 {
+		err = errPageOverflow
+		return
+	}
+
+	start := i * perPage
+	end := start + perPage
+	if end > len(b) {
+		end = len(b)
+	}
+	p = pageStore{
+		pageNumber: i,
+		pageTotal:  total,
+		data:       append(make(common.Board, 0, end-start), b[start:end]...),
+	}
+	p.json, err = json.Marshal(p.data)
+	return
+}
+
 // Returns arguments for accessing the board page JSON/HTML cache
 func boardCacheArgs(r *http.Request, board string, catalog bool) (
 	k cache.Key, f cache.FrontEnd,
 ) {
 	var page int64
-	if !catalog {
-		p, err := strconv.ParseUint(r.URL.Query().Get("page"), 10, 64)
-		if err == nil {
-			page = int64(p)
-		}
+	p, err := strconv.ParseUint(r.URL.Query().Get("page"), 10, 64)
+	if err == nil {
+		page = int64(p)
 	}
 
 	k = cache.BoardKey(board, page, !catalog)
+	k.Sort = uint8(parseSortMode(r.URL.Query().Get("sort")))
 	if catalog {
-		f = catalogCache
+		f = catalogPageCache
 	} else {
 		f = boardPageCache
 	}
 	return
 }
 
+// Parse a thread sort mode from its string representation. Defaults to sorting
+// by bump time.
+func parseSortMode(s string) common.SortMode {
+	for i, m := range common.SortModes {
+		if s == m {
+			return common.SortMode(i)
+		}
+	}
+	return common.SortByBump
+}
+
 // Start cache upkeep proccesses. Requires a ready DB connection.
-func listenToThreadDeletion() error {
-	return db.Listen("thread_deleted", func(msg string) (err error) {
-		split := strings.Split(msg, ":")
-		if len(split) != 2 {
-			return fmt.Errorf("unparsable thread deletion message: '%s'", msg)
-		}
-		board := split[0]
-		id, err := strconv.ParseUint(split[1], 10, 64)
+func listenToThreadUpdates() (err error) {
+	for _, e := range [...]string{"thread_deleted", "thread_locked"} {
+		err = db.Listen(e, clearThreadCacheByMessage)
 		if err != nil {
 			return
 		}
+	}
+	return
+}
 
-		// Clear all cache records associated with a thread
-		for _, i := range [...]int{0, 5, 100} {
-			cache.Delete(cache.ThreadKey(id, i))
-		}
-		cache.DeleteByBoard(board)
-		cache.DeleteByBoard("all")
+// Clear cached post HTML of a board's threads and pages, when a configuration
+// change affects how post bodies are rendered
+func listenToBoardRenderChanges() error {
+	return db.Listen("board_render_changed", clearBoardCache)
+}
 
-		return nil
-	})
+// Clear all cache records of a board and its threads
+func clearBoardCache(board string) error {
+	ids, err := db.GetThreadIDs(board, common.SortByBump)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		clearThreadCache(id)
+	}
+	cache.DeleteByBoard(board)
+	return nil
+}
+
+// Clear the cache records of a thread from a "board:id" notification message
+func clearThreadCacheByMessage(msg string) (err error) {
+	split := strings.Split(msg, ":")
+	if len(split) != 2 {
+		return fmt.Errorf("unparsable thread update message: '%s'", msg)
+	}
+	board := split[0]
+	id, err := strconv.ParseUint(split[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	clearThreadCache(id, board)
+	return nil
+}
+
+// Clear all cache records associated with a thread and the boards it is, or
+// was, listed on
+func clearThreadCache(id uint64, boards ...string) {
+	for _, i := range [...]int{0, 5, 100} {
+		cache.Delete(cache.ThreadKey(id, i))
+	}
+	for _, b := range boards {
+		cache.DeleteByBoard(b)
+	}
+	cache.DeleteByBoard("all")
 }
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"meguca/common"
+	"meguca/config"
+	. "meguca/test"
+	"testing"
+)
+
+func TestParseSortMode(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		in  string
+		out common.SortMode
+	}{
+		{"", common.SortByBump},
+		{"bump", common.SortByBump},
+		{"lastReply", common.SortByLastReply},
+		{"creation", common.SortByCreation},
+		{"replyCount", common.SortByReplyCount},
+		{"fileCount", common.SortByFileCount},
+		{"foo", common.SortByBump},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.in, func(t *testing.T) {
+			t.Parallel()
+			if s := parseSortMode(c.in); s != c.out {
+				t.Fatalf("unexpected sort mode: %d : %d", c.out, s)
+			}
+		})
+	}
+}
+
+func TestCatalogPage(t *testing.T) {
+	t.Parallel()
+
+	const perPage = config.ThreadsPerCatalogPage
+	b := make(common.Board, perPage+1)
+	for i := range b {
+		b[i].ID = uint64(i + 1)
+	}
+
+	cases := [...]struct {
+		name        string
+		board       common.Board
+		page        int
+		first, len  int
+		total       int
+		errOverflow bool
+	}{
+		{
+			name:  "empty board",
+			page:  0,
+			total: 1,
+		},
+		{
+			name:  "first page",
+			board: b,
+			page:  0,
+			first: 1,
+			len:   perPage,
+			total: 2,
+		},
+		{
+			name:  "last page",
+			board: b,
+			page:  1,
+			first: perPage + 1,
+			len:   1,
+			total: 2,
+		},
+		{
+			name:        "overflow",
+			board:       b,
+			page:        2,
+			errOverflow: true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := catalogPage(c.board, c.page)
+			if c.errOverflow {
+				if err != errPageOverflow {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.pageNumber != c.page || p.pageTotal != c.total {
+				t.Fatalf(
+					"unexpected page: %d/%d : %d/%d",
+					c.page, c.total, p.pageNumber, p.pageTotal,
+				)
+			}
+			if len(p.data) != c.len {
+				t.Fatalf("unexpected thread count: %d : %d", c.len, len(p.data))
+			}
+			if c.len != 0 && p.data[0].ID != uint64(c.first) {
+				t.Fatalf("unexpected first thread: %d : %d", c.first, p.data[0].ID)
+			}
+			if c.len == 0 && string(p.json) != "[]" {
+				t.Fatalf("unexpected JSON: %s", p.json)
+			}
+		})
+	}
+}
+
+func TestSortCatalog(t *testing.T) {
+	t.Parallel()
+
+	// Sorted by bump time, as retrieved from the database
+	b := common.Board{
+		{
+			Sticky:   true,
+			PostCtr:  1,
+			BumpTime: 1,
+			Post:     common.Post{ID: 1},
+		},
+		{
+			PostCtr:  2,
+			BumpTime: 4,
+			Post:     common.Post{ID: 2},
+		},
+		{
+			PostCtr:  5,
+			BumpTime: 3,
+			Post:     common.Post{ID: 3},
+		},
+		{
+			PostCtr:  2,
+			BumpTime: 2,
+			Post:     common.Post{ID: 4},
+		},
+	}
+
+	cases := [...]struct {
+		name, board string
+		mode        common.SortMode
+		order       []uint64
+	}{
+		{"bump", "a", common.SortByBump, []uint64{1, 2, 3, 4}},
+		{"reply count", "a", common.SortByReplyCount, []uint64{1, 3, 2, 4}},
+		{"creation", "a", common.SortByCreation, []uint64{1, 4, 3, 2}},
+		{"all board", "all", common.SortByReplyCount, []uint64{3, 2, 4, 1}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sorted := sortCatalog(b, c.board, c.mode)
+			order := make([]uint64, len(sorted))
+			for i, thread := range sorted {
+				order[i] = thread.ID
+			}
+			AssertDeepEquals(t, order, c.order)
+		})
+	}
+
+	if b[1].ID != 2 {
+		t.Fatal("catalog modified in place")
+	}
+}
@@ -0,0 +1,162 @@
+// Custom board stylesheets and admin-uploaded themes
+
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"meguca/assets"
+	"meguca/auth"
+	"meguca/common"
+	"meguca/db"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	errInvalidThemeName = errors.New("invalid theme name")
+	errBuiltinTheme     = errors.New("can not overwrite built-in theme")
+	errInvalidCSS       = errors.New("stylesheet is not valid UTF-8")
+
+	themeNameRegexp = regexp.MustCompile(`^[a-z0-9_\-]{1,20}$`)
+
+	cssComment = regexp.MustCompile(`/\*[\s\S]*?(?:\*/|$)`)
+	cssEscape  = regexp.MustCompile(`\\[0-9a-fA-F]{1,6}[ \t\r\n\f]?`)
+	cssURL     = regexp.MustCompile(`url\s*\(\s*['"]?\s*([^'")\s]*)`)
+	cssScheme  = regexp.MustCompile(`^[a-z][a-z0-9+.\-]*:`)
+	unsafeCSS  = regexp.MustCompile(
+		`@import|expression\s*\(|javascript:|vbscript:|behavior\s*:` +
+			`|-moz-binding|['"(]\s*(?:(?:https?|ftp):)?//`,
+	)
+)
+
+// Reports, if custom board CSS is safe to serve. Rejects anything, that can
+// execute scripts or load resources from other origins.
+func isSafeCSS(css string) bool {
+	if css == "" {
+		return true
+	}
+
+	// Normalize the stylesheet, so the checks can not be bypassed with
+	// comments, escape sequences or casing
+	css = cssComment.ReplaceAllString(css, "")
+	css = cssEscape.ReplaceAllStringFunc(css, func(s string) string {
+		n, err := strconv.ParseUint(strings.TrimSpace(s[1:]), 16, 32)
+		if err != nil || n == 0 || n > unicode.MaxRune {
+			return ""
+		}
+		return string(rune(n))
+	})
+	css = strings.ToLower(strings.Replace(css, `\`, "", -1))
+
+	if unsafeCSS.MatchString(css) {
+		return false
+	}
+	for _, m := range cssURL.FindAllStringSubmatch(css, -1) {
+		u := m[1]
+		if cssScheme.MatchString(u) && !strings.HasPrefix(u, "data:image/") {
+			return false
+		}
+	}
+	return true
+}
+
+// Serve either a board's custom stylesheet or a theme. Both share the same
+// path prefix with the static CSS files, so they are all routed here.
+func serveCSS(w http.ResponseWriter, r *http.Request) {
+	file := extractParam(r, "file")
+	if strings.ContainsRune(file, '.') {
+		if strings.HasSuffix(file, ".css") {
+			f := assets.Themes.Get(strings.TrimSuffix(file, ".css"))
+			if f.Data != nil {
+				serveAssetFromMemory(w, r, f)
+				return
+			}
+		}
+		serveFile(w, r, cleanJoin(webRoot, "css/"+file))
+		return
+	}
+
+	if !auth.IsNonMetaBoard(file) {
+		text404(w)
+		return
+	}
+	serveAssetFromMemory(w, r, assets.CSS.Get(file))
+}
+
+// Create or overwrite a custom theme. Only accessible to the admin account.
+func setTheme(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, common.MaxAssetSize)
+	if err := r.ParseMultipartForm(0); err != nil {
+		text400(w, err)
+		return
+	}
+	if !isAdmin(w, r) {
+		return
+	}
+
+	name := r.Form.Get("name")
+	switch {
+	case !themeNameRegexp.MatchString(name):
+		text400(w, errInvalidThemeName)
+		return
+	case isBuiltinTheme(name):
+		text400(w, errBuiltinTheme)
+		return
+	}
+
+	file, h, err := r.FormFile("css")
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(file)
+	switch {
+	case err != nil:
+		text500(w, r, err)
+		return
+	case buf.Len() > common.MaxAssetSize:
+		sendFileError(w, h, "too large")
+		return
+	case !utf8.Valid(buf.Bytes()):
+		text400(w, errInvalidCSS)
+		return
+	}
+
+	if err := db.SetTheme(name, buf.Bytes()); err != nil {
+		text500(w, r, err)
+	}
+}
+
+// Delete a custom theme. Only accessible to the admin account.
+func deleteTheme(w http.ResponseWriter, r *http.Request) {
+	var name string
+	if !decodeJSON(w, r, &name) || !isAdmin(w, r) {
+		return
+	}
+
+	switch err := db.DeleteTheme(name); err {
+	case nil:
+	case sql.ErrNoRows:
+		text404(w)
+	default:
+		text500(w, r, err)
+	}
+}
+
+func isBuiltinTheme(name string) bool {
+	for _, t := range common.Themes {
+		if name == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestIsSafeCSS(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		safe     bool
+	}{
+		{"empty", "", true},
+		{"plain", "body { color: red; }", true},
+		{"local url", "body { background: url(/assets/banners/a/0); }", true},
+		{"data url", `body { background: url("data:image/png;base64,AA=="); }`, true},
+		{"import", `@import "foo.css";`, false},
+		{"import with comment", `@im/**/port "foo.css";`, false},
+		{"escaped import", `@\69mport "foo.css";`, false},
+		{"remote url", "body { background: url(https://example.com/a.png); }", false},
+		{"protocol-relative url", "body { background: url('//example.com'); }", false},
+		{"javascript url", "body { background: url(JavaScript:alert(1)); }", false},
+		{"expression", "body { width: expression(alert(1)); }", false},
+		{"binding", "body { -moz-binding: url(/a.xml#b); }", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if s := isSafeCSS(c.in); s != c.safe {
+				t.Fatalf("unexpected result: %v : %v", c.safe, s)
+			}
+		})
+	}
+}
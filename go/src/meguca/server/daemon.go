@@ -18,6 +18,12 @@ func init() {
 		switch arg {
 		case "debug":
 			startServer()
+		case "regenerate-thumbnails":
+			regenerateThumbnails()
+		case "recount-storage":
+			recountStorage()
+		case "queue-transcodes":
+			queueTranscodes()
 		case "stop":
 			killDaemon()
 			fallthrough
@@ -0,0 +1,259 @@
+// Server-side post and thread filtering for HTML pages
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"meguca/auth"
+	"meguca/common"
+	"meguca/db"
+	"meguca/util"
+	"net/http"
+	"time"
+)
+
+// Name of the cookie, that stores the filter profile token
+const filterCookie = "filterToken"
+
+var (
+	errTooManyFilters = errors.New("too many filters")
+	errFilterTooLong  = common.ErrTooLong("filter")
+)
+
+// Filter profile converted to sets for fast lookup
+type postFilter struct {
+	threads                         map[uint64]bool
+	names, trips, posterIDs, images map[string]bool
+}
+
+func newPostFilter(f common.FilterProfile) postFilter {
+	pf := postFilter{
+		threads:   make(map[uint64]bool, len(f.Threads)),
+		names:     toSet(f.Names),
+		trips:     toSet(f.Tripcodes),
+		posterIDs: toSet(f.PosterIDs),
+		images:    toSet(f.Images),
+	}
+	for _, id := range f.Threads {
+		pf.threads[id] = true
+	}
+	return pf
+}
+
+func toSet(s []string) map[string]bool {
+	set := make(map[string]bool, len(s))
+	for _, v := range s {
+		set[v] = true
+	}
+	return set
+}
+
+// Returns, if the post matches any filter
+func (f postFilter) hides(p common.Post) bool {
+	switch {
+	case p.Name != "" && f.names[p.Name],
+		p.Trip != "" && f.trips[p.Trip],
+		p.PosterID != "" && f.posterIDs[p.PosterID],
+		p.Image != nil && f.images[p.Image.SHA1]:
+		return true
+	}
+	for _, img := range p.Images {
+		if f.images[img.SHA1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove hidden replies from a thread. The thread's OP is never removed.
+func (f postFilter) filterThread(t common.Thread) common.Thread {
+	posts := make([]common.Post, 0, len(t.Posts))
+	for _, p := range t.Posts {
+		if !f.hides(p) {
+			posts = append(posts, p)
+		}
+	}
+	t.Posts = posts
+	return t
+}
+
+// Remove hidden threads and replies from a board page or catalog
+func (f postFilter) filterBoard(b common.Board) common.Board {
+	filtered := make(common.Board, 0, len(b))
+	for _, t := range b {
+		if !f.threads[t.ID] && !f.hides(t.Post) {
+			filtered = append(filtered, f.filterThread(t))
+		}
+	}
+	return filtered
+}
+
+// Retrieve the filter profile of the client, if any. hash is empty, if the
+// client has no filters set.
+func getPostFilter(r *http.Request) (f postFilter, hash string, err error) {
+	token := filterToken(r)
+	if token == "" {
+		return
+	}
+
+	p, err := db.GetFilterProfile(token)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		err = nil
+		return
+	default:
+		return
+	}
+	if isEmptyProfile(p) {
+		return
+	}
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	return newPostFilter(p), util.HashBuffer(buf), nil
+}
+
+// Read the filter profile token from the client's cookies
+func filterToken(r *http.Request) string {
+	c, err := r.Cookie(filterCookie)
+	if err != nil || len(c.Value) != common.LenFilterToken {
+		return ""
+	}
+	return c.Value
+}
+
+func isEmptyProfile(p common.FilterProfile) bool {
+	return len(p.Threads) == 0 &&
+		len(p.Names) == 0 &&
+		len(p.Tripcodes) == 0 &&
+		len(p.PosterIDs) == 0 &&
+		len(p.Images) == 0
+}
+
+func validateFilterProfile(p common.FilterProfile) error {
+	if len(p.Threads) > common.MaxNumFilters {
+		return errTooManyFilters
+	}
+	for _, arr := range [...][]string{
+		p.Names, p.Tripcodes, p.PosterIDs, p.Images,
+	} {
+		if len(arr) > common.MaxNumFilters {
+			return errTooManyFilters
+		}
+		for _, s := range arr {
+			if len(s) > common.MaxLenFilter {
+				return errFilterTooLong
+			}
+		}
+	}
+	return nil
+}
+
+// Filter profile of the client and the CSRF token required to change it. The
+// token is derived from the client's filter profile token, which other sites
+// can not read.
+type filterMessage struct {
+	Profile common.FilterProfile `json:"profile"`
+	CSRF    string               `json:"csrf"`
+}
+
+// Set the cookie with the client's filter profile token. http.Cookie only
+// supports the SameSite attribute since Go 1.11, so it is appended manually.
+func setFilterCookie(w http.ResponseWriter, token string, expires time.Time) {
+	c := http.Cookie{
+		Name:     filterCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+	}
+	w.Header().Add("Set-Cookie", c.String()+"; SameSite=Lax")
+}
+
+// Check the CSRF token of a filter profile change request
+func checkFilterCSRF(w http.ResponseWriter, token, csrf string) bool {
+	if token == "" || !auth.CheckCSRFToken(token, csrf) {
+		text403(w, errInvalidCSRFToken)
+		return false
+	}
+	return true
+}
+
+// Serve the client's filter profile and the CSRF token for changing it.
+// Assigns a profile token to clients without one. The profile itself is only
+// stored, once changed.
+func serveFilters(w http.ResponseWriter, r *http.Request) {
+	var (
+		p     common.FilterProfile
+		err   error
+		token = filterToken(r)
+	)
+	if token == "" {
+		token, err = auth.RandomID(32)
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+		setFilterCookie(w, token, time.Now().AddDate(1, 0, 0))
+	} else {
+		p, err = db.GetFilterProfile(token)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			p = common.FilterProfile{}
+		default:
+			text500(w, r, err)
+			return
+		}
+	}
+	serveJSON(w, r, "", filterMessage{
+		Profile: p,
+		CSRF:    auth.CSRFToken(token),
+	})
+}
+
+// Overwrite the client's filter profile. The client must have retrieved its
+// profile token and the CSRF token from serveFilters first.
+func setFilters(w http.ResponseWriter, r *http.Request) {
+	var msg filterMessage
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	token := filterToken(r)
+	if !checkFilterCSRF(w, token, msg.CSRF) {
+		return
+	}
+	if err := validateFilterProfile(msg.Profile); err != nil {
+		text400(w, err)
+		return
+	}
+
+	if err := db.WriteFilterProfile(token, msg.Profile); err != nil {
+		text500(w, r, err)
+		return
+	}
+	setFilterCookie(w, token, time.Now().AddDate(1, 0, 0))
+}
+
+// Delete the client's filter profile. Only the CSRF token is read from the
+// request.
+func clearFilters(w http.ResponseWriter, r *http.Request) {
+	var msg filterMessage
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	token := filterToken(r)
+	if !checkFilterCSRF(w, token, msg.CSRF) {
+		return
+	}
+	if err := db.DeleteFilterProfile(token); err != nil {
+		text500(w, r, err)
+		return
+	}
+	setFilterCookie(w, "", time.Unix(0, 0))
+}
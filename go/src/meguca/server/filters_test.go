@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"meguca/auth"
+	"meguca/common"
+	"meguca/config"
+	. "meguca/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostFilter(t *testing.T) {
+	t.Parallel()
+
+	f := newPostFilter(common.FilterProfile{
+		Threads:   []uint64{2},
+		Names:     []string{"spammer"},
+		Tripcodes: []string{"abcd"},
+		PosterIDs: []string{"xyz"},
+		Images:    []string{"deadbeef"},
+	})
+
+	thread := func(id uint64, op common.Post, replies ...common.Post) common.Thread {
+		op.ID = id
+		return common.Thread{
+			Post:  op,
+			Posts: replies,
+		}
+	}
+	board := common.Board{
+		thread(1, common.Post{},
+			common.Post{ID: 10, Name: "spammer"},
+			common.Post{ID: 11, Name: "anon"},
+			common.Post{ID: 12, Trip: "abcd"},
+			common.Post{ID: 13, PosterID: "xyz"},
+			common.Post{
+				ID: 14,
+				Image: &common.Image{
+					ImageCommon: common.ImageCommon{
+						SHA1: "deadbeef",
+					},
+				},
+			},
+			common.Post{
+				ID: 15,
+				Images: []common.Image{
+					{
+						ImageCommon: common.ImageCommon{
+							SHA1: "deadbeef",
+						},
+					},
+				},
+			},
+		),
+		thread(2, common.Post{}),
+		thread(3, common.Post{Name: "spammer"}),
+		thread(4, common.Post{Trip: "efgh"}),
+	}
+
+	res := f.filterBoard(board)
+	AssertDeepEquals(t, len(res), 2)
+	AssertDeepEquals(t, res[0].ID, uint64(1))
+	AssertDeepEquals(t, res[1].ID, uint64(4))
+	AssertDeepEquals(t, len(res[0].Posts), 1)
+	AssertDeepEquals(t, res[0].Posts[0].ID, uint64(11))
+
+	// Source data is shared with the cache and must not be modified
+	AssertDeepEquals(t, len(board[0].Posts), 6)
+
+	// OP is kept on thread pages
+	op := thread(3, common.Post{Name: "spammer"})
+	AssertDeepEquals(t, f.filterThread(op).ID, uint64(3))
+}
+
+func TestValidateFilterProfile(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   common.FilterProfile
+		err  error
+	}{
+		{
+			name: "valid",
+			in: common.FilterProfile{
+				Threads: []uint64{1},
+				Names:   []string{"name"},
+			},
+		},
+		{
+			name: "too many threads",
+			in: common.FilterProfile{
+				Threads: make([]uint64, common.MaxNumFilters+1),
+			},
+			err: errTooManyFilters,
+		},
+		{
+			name: "too many names",
+			in: common.FilterProfile{
+				Names: make([]string, common.MaxNumFilters+1),
+			},
+			err: errTooManyFilters,
+		},
+		{
+			name: "too long",
+			in: common.FilterProfile{
+				Tripcodes: []string{
+					strings.Repeat("a", common.MaxLenFilter+1),
+				},
+			},
+			err: errFilterTooLong,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			AssertDeepEquals(t, validateFilterProfile(c.in), c.err)
+		})
+	}
+}
+
+func TestFilterCSRF(t *testing.T) {
+	if err := config.Set(config.Defaults); err != nil {
+		t.Fatal(err)
+	}
+	token := strings.Repeat("a", common.LenFilterToken)
+
+	cases := [...]struct {
+		name, url, cookie, csrf string
+	}{
+		{"set without cookie", "/api/set-filters", "", auth.CSRFToken(token)},
+		{"set with wrong token", "/api/set-filters", token, "foo"},
+		{"clear without CSRF token", "/api/clear-filters", token, ""},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			rec, req := newJSONPair(t, c.url, filterMessage{CSRF: c.csrf})
+			if c.cookie != "" {
+				req.AddCookie(&http.Cookie{
+					Name:  filterCookie,
+					Value: c.cookie,
+				})
+			}
+			router.ServeHTTP(rec, req)
+			assertError(t, rec, 403, errInvalidCSRFToken)
+		})
+	}
+}
+
+func TestServeFiltersCookie(t *testing.T) {
+	if err := config.Set(config.Defaults); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	serveFilters(rec, httptest.NewRequest("GET", "/json/filters", nil))
+	assertCode(t, rec, 200)
+
+	set := rec.Header().Get("Set-Cookie")
+	for _, attr := range [...]string{"HttpOnly", "SameSite=Lax"} {
+		if !strings.Contains(set, attr) {
+			t.Errorf("cookie without %s: %s", attr, set)
+		}
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != filterCookie {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	var msg filterMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, auth.CheckCSRFToken(cookies[0].Value, msg.CSRF), true)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"meguca/auth"
 	"meguca/cache"
 	"meguca/common"
@@ -60,22 +61,43 @@ func boardHTML(w http.ResponseWriter, r *http.Request, b string, catalog bool) {
 		return
 	}
 
+	filter, filterHash, err := getPostFilter(r)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+
 	_, hash := config.GetClient()
-	etag := formatEtag(ctr, hash, pos)
+	etag := formatEtag(ctr, hash+filterHash, pos)
 	if checkClientEtag(w, r, etag) {
 		return
 	}
 
-	var n, total int
-	if !catalog {
-		p := data.(pageStore)
-		n = p.pageNumber
-		total = p.pageTotal
+	// Rerender the cached data without any hidden threads and posts
+	if filterHash != "" {
+		b := filter.filterBoard(data.(pageStore).data)
+		json, err := json.Marshal(b)
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+		if catalog {
+			html = []byte(templates.CatalogThreads(b, json))
+		} else {
+			html = []byte(templates.IndexThreads(b, json))
+		}
+	}
+
+	// Carry the thread sort mode over to the links of other pages
+	var sort string
+	if s := parseSortMode(r.URL.Query().Get("sort")); s != common.SortByBump {
+		sort = common.SortModes[s]
 	}
 
+	p := data.(pageStore)
 	html = templates.Board(
-		b, resolveTheme(r, b),
-		n, total,
+		b, resolveTheme(r, b), sort,
+		p.pageNumber, p.pageTotal,
 		pos,
 		r.URL.Query().Get("minimal") == "true", catalog,
 		html,
@@ -86,12 +108,8 @@ func boardHTML(w http.ResponseWriter, r *http.Request, b string, catalog bool) {
 // Resolve theme to render in accordance to client and board settings.
 // Needed to prevent Flash Of Unstyled Content.
 func resolveTheme(r *http.Request, board string) string {
-	if c, err := r.Cookie("theme"); err == nil {
-		for _, t := range common.Themes {
-			if c.Value == t {
-				return c.Value
-			}
-		}
+	if c, err := r.Cookie("theme"); err == nil && common.IsTheme(c.Value) {
+		return c.Value
 	}
 	if board == "all" {
 		return config.Get().DefaultCSS
@@ -119,14 +137,29 @@ func threadHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, filterHash, err := getPostFilter(r)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+
 	_, hash := config.GetClient()
-	etag := formatEtag(ctr, hash, pos)
+	etag := formatEtag(ctr, hash+filterHash, pos)
 	if checkClientEtag(w, r, etag) {
 		return
 	}
 
 	b := extractParam(r, "board")
 	thread := data.(common.Thread)
+	if filterHash != "" {
+		thread = filter.filterThread(thread)
+		json, err := json.Marshal(thread)
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+		html = []byte(templates.ThreadPosts(thread, json))
+	}
 	html = templates.Thread(
 		id,
 		b, thread.Subject, resolveTheme(r, b),
@@ -270,6 +303,14 @@ func loadingAnimationForm(w http.ResponseWriter, r *http.Request) {
 	staticTemplate(w, r, templates.LoadingAnimationForm)
 }
 
+func spoilerSettingForm(w http.ResponseWriter, r *http.Request) {
+	staticTemplate(w, r, templates.SpoilerForm)
+}
+
+func flagSettingForm(w http.ResponseWriter, r *http.Request) {
+	staticTemplate(w, r, templates.FlagForm)
+}
+
 // Render the captcha for noscript browsers
 func noscriptCaptcha(w http.ResponseWriter, r *http.Request) {
 	ip, err := auth.GetIP(r)
@@ -11,6 +11,7 @@ import (
 	"meguca/cache"
 	"meguca/db"
 	"meguca/geoip"
+	"meguca/imager"
 	"meguca/imager/assets"
 	"meguca/lang"
 	"meguca/templates"
@@ -37,6 +38,13 @@ var (
 		"restart": "combination of stop + start",
 		"debug":   "start server in debug mode without daemonizing (default)",
 		"help":    "print this help text",
+		"regenerate-thumbnails": "regenerate all thumbnails with the " +
+			"current thumbnail configuration. Run with the server stopped.",
+		"recount-storage": "record the disk space used by the thumbnails " +
+			"and transcoded videos of all stored files. Run with the server " +
+			"stopped.",
+		"queue-transcodes": "queue all stored videos, that are not " +
+			"transcoded yet, for transcoding on the next server start",
 	}
 )
 
@@ -94,6 +102,12 @@ func Start() {
 		switch arg {
 		case "debug", "start":
 			startServer()
+		case "regenerate-thumbnails":
+			regenerateThumbnails()
+		case "recount-storage":
+			recountStorage()
+		case "queue-transcodes":
+			queueTranscodes()
 		case "init": // For internal use only
 			os.Exit(0)
 		default:
@@ -114,7 +128,10 @@ func printUsage() {
 	} else {
 		arguments["debug"] = `alias of "start"`
 	}
-	toPrint = append(toPrint, []string{"debug", "help"}...)
+	toPrint = append(toPrint, []string{
+		"debug", "regenerate-thumbnails", "recount-storage",
+		"queue-transcodes", "help",
+	}...)
 
 	help := new(bytes.Buffer)
 	for _, arg := range toPrint {
@@ -138,10 +155,37 @@ func startServer() {
 		}
 	}
 	load(db.LoadDB, assets.CreateDirs, geoip.Load)
-	load(lang.Load, listenToThreadDeletion)
-	load(templates.Compile)
+	load(lang.Load, listenToThreadUpdates, listenToBoardRenderChanges)
+	load(templates.Compile, imager.ResumeTranscoding)
 
 	if err := startWebServer(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// Record the disk space used by the renditions of all stored files and exit
+func recountStorage() {
+	if err := util.Waterfall(db.LoadDB, imager.RecountStorage); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Queue all stored videos, that are not transcoded yet, for transcoding and
+// exit
+func queueTranscodes() {
+	if err := util.Waterfall(db.LoadDB, imager.QueueUntranscoded); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Regenerate the thumbnails of all stored files and exit
+func regenerateThumbnails() {
+	err := util.Waterfall(
+		db.LoadDB,
+		assets.CreateDirs,
+		imager.RegenerateThumbnails,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
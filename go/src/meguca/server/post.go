@@ -58,8 +58,10 @@ func createThread(w http.ResponseWriter, r *http.Request) {
 func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 	req websockets.ReplyCreationRequest, ok bool,
 ) {
-	maxSize := config.Get().MaxSize<<20 + jsonLimit
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSize))
+	// The target board is only known after parsing the form. Board-specific
+	// limits are checked by imager.ParseUpload().
+	maxSize := config.LargestUploadSize() + jsonLimit
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
 	err := r.ParseMultipartForm(0)
 	if err != nil {
 		text400(w, err)
@@ -75,7 +77,7 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 	switch err {
 	case nil:
 		var code int
-		code, token, err = imager.ParseUpload(r)
+		code, token, err = imager.ParseUpload(r, r.Form.Get("board"))
 		if err != nil {
 			imager.LogError(w, r, code, err)
 			return
@@ -92,6 +94,7 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 		Name: f.Get("name"),
 		Body: f.Get("body"),
 		Sage: f.Get("sage") == "on",
+		Flag: f.Get("flag"),
 		Captcha: auth.Captcha{
 			CaptchaID: f.Get("captchaID"),
 			Solution:  f.Get("captcha"),
@@ -101,10 +104,13 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 		req.SessionCreds = extractLoginCreds(r)
 	}
 	if token != "" {
+		// Spoiler checkboxes send "on" and category selects the category
+		category, _ := strconv.ParseUint(f.Get("spoiler"), 10, 8)
 		req.Image = websockets.ImageRequest{
-			Spoiler: f.Get("spoiler") == "on",
-			Token:   token,
-			Name:    header.Filename,
+			Spoiler:         f.Get("spoiler") == "on",
+			SpoilerCategory: uint8(category),
+			Token:           token,
+			Name:            header.Filename,
 		}
 	}
 
@@ -0,0 +1,44 @@
+// Link previews and their proxied thumbnails
+
+package server
+
+import (
+	"database/sql"
+	"meguca/db"
+	"meguca/unfurl"
+	"meguca/util"
+	"net/http"
+	"regexp"
+)
+
+var previewIDRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Serve a link preview as JSON for client-side rendering. Responds with 404,
+// if no preview is available yet.
+func serveLinkPreview(w http.ResponseWriter, r *http.Request) {
+	p, ok := unfurl.Get(r.URL.Query().Get("url"), 0, "")
+	if !ok {
+		text404(w)
+		return
+	}
+	serveJSON(w, r, "", p)
+}
+
+// Serve the proxied thumbnail of a link preview
+func serveLinkPreviewThumbnail(w http.ResponseWriter, r *http.Request) {
+	id := extractParam(r, "id")
+	if !previewIDRegexp.MatchString(id) {
+		text404(w)
+		return
+	}
+
+	switch f, err := db.GetLinkPreviewThumbnail(id); err {
+	case nil:
+		f.Hash = util.HashBuffer(f.Data)
+		serveAssetFromMemory(w, r, f)
+	case sql.ErrNoRows:
+		text404(w)
+	default:
+		text500(w, r, err)
+	}
+}
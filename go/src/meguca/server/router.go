@@ -96,8 +96,12 @@ func createRouter() http.Handler {
 	html.GET("/assign-staff/:board", staffAssignmentForm)
 	html.GET("/set-banners", bannerSettingForm)
 	html.GET("/set-loading", loadingAnimationForm)
+	html.GET("/set-spoilers", spoilerSettingForm)
+	html.GET("/set-flags", flagSettingForm)
 	html.GET("/bans/:board", banList)
 	html.GET("/mod-log/:board", modLog)
+	html.GET("/image-posts/:sha1", imagePostsList)
+	html.GET("/storage-usage", storageUsagePage)
 	html.GET("/report/:id", reportForm)
 	html.GET("/reports/:board", reportList)
 
@@ -117,12 +121,23 @@ func createRouter() http.Handler {
 	json.GET("/board-config/:board", serveBoardConfigs)
 	json.GET("/board-list", serveBoardList)
 	json.GET("/ip-count", serveIPCount)
+	json.GET("/link-preview", serveLinkPreview)
+	json.GET("/filters", serveFilters)
 
 	// Internal API
 	api := r.NewGroup("/api")
 	api.GET("/socket", websockets.Handler)
 	api.POST("/upload", imager.NewImageUpload)
 	api.POST("/upload-hash", imager.UploadImageHash)
+	api.GET("/upload-job/:id", uploadHandler(imager.UploadJobResult))
+	api.POST("/chunked-upload", imager.InitChunkedUpload)
+	api.GET("/chunked-upload/:id", uploadHandler(
+		imager.ChunkedUploadOffset,
+	))
+	api.PUT("/chunked-upload/:id", uploadHandler(imager.UploadChunk))
+	api.POST("/chunked-upload/:id/finalize", uploadHandler(
+		imager.FinalizeChunkedUpload,
+	))
 	api.POST("/create-thread", createThread)
 	api.POST("/create-reply", createReply)
 	api.POST("/register", register)
@@ -140,15 +155,30 @@ func createRouter() http.Handler {
 	api.POST("/delete-image", deleteImage)
 	api.POST("/spoiler-image", modSpoilerImage)
 	api.POST("/ban", ban)
+	api.POST("/block-image", blockImage)
+	api.POST("/ban-file", banFile)
 	api.POST("/notification", sendNotification)
 	api.POST("/assign-staff", assignStaff)
 	api.POST("/same-IP/:id", getSameIPPosts)
+	api.GET("/image-posts/:sha1", getImagePosts)
+	api.POST("/image-posts/:sha1/delete", deleteImagePosts)
+	api.POST("/image-posts/:sha1/ban", banImagePosts)
+	api.GET("/storage-usage", serveStorageUsage)
 	api.POST("/sticky", setThreadSticky)
 	api.POST("/lock-thread", setThreadLock)
+	api.POST("/cyclical-thread", setThreadCyclical)
+	api.POST("/move-thread", moveThread)
+	api.POST("/merge-thread", mergeThread)
 	api.POST("/unban/:board", unban)
 	api.POST("/set-banners", setBanners)
 	api.POST("/set-loading", setLoadingAnimation)
+	api.POST("/set-spoilers", setSpoilers)
+	api.POST("/set-flags", setFlags)
+	api.POST("/set-theme", setTheme)
+	api.POST("/delete-theme", deleteTheme)
 	api.POST("/report", report)
+	api.POST("/set-filters", setFilters)
+	api.POST("/clear-filters", clearFilters)
 
 	// Captcha API
 	captcha := api.NewGroup("/captcha")
@@ -164,7 +194,12 @@ func createRouter() http.Handler {
 	assets := r.NewGroup("/assets")
 	assets.GET("/banners/:board/:id", serveBanner)
 	assets.GET("/loading/:board", serveLoadingAnimation)
+	assets.GET("/spoilers/:board/:category", serveSpoiler)
+	assets.GET("/custom-flags/:board/:name", serveFlag)
+	assets.GET("/link-previews/:id", serveLinkPreviewThumbnail)
+	assets.GET("/css/:file", serveCSS)
 	assets.GET("/images/*path", serveImages)
+	assets.GET("/text/:sha1", serveTextViewer)
 	assets.GET("/*path", serveAssets)
 	r.GET("/worker.js", serveWorker)
 
@@ -176,6 +211,16 @@ func createRouter() http.Handler {
 	return h
 }
 
+// Pass the chunked upload or thumbnailing job ID URL parameter to an upload
+// handler
+func uploadHandler(
+	fn func(http.ResponseWriter, *http.Request, string),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r, extractParam(r, "id"))
+	}
+}
+
 // Redirects to / requests to /all/ board
 func redirectToDefault(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/all/", 301)
@@ -3,7 +3,11 @@ package templates
 import (
 	"html"
 	"meguca/common"
+	"meguca/config"
+	"meguca/imager/assets"
 	"meguca/lang"
+	"meguca/util"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -20,6 +24,12 @@ type articleContext struct {
 // Map of all backlinks on a page
 type backlinks map[uint64]map[uint64]uint64
 
+// Returns the path to a board's spoiler image of a spoiler category
+func spoilerPath(board string, category uint8) string {
+	return "/assets/spoilers/" + board + "/" +
+		strconv.FormatUint(uint64(category), 10)
+}
+
 // Returns image name with proper extension
 func imageName(fileType uint8, name string) string {
 	ext := common.Extensions[fileType]
@@ -30,6 +40,13 @@ func imageName(fileType uint8, name string) string {
 	return html.EscapeString(string(append(buf, ext...)))
 }
 
+// Returns the path to the syntax highlighted viewer of a text file
+func textViewerPath(img common.Image) string {
+	name := img.Name + "." + common.Extensions[common.TXT]
+	return util.ConcatStrings("/assets/text/", img.SHA1, "?name=",
+		url.QueryEscape(name))
+}
+
 // Renders the post creation time field
 func formatTime(sec int64) string {
 	ln := lang.Get().Common.Time
@@ -85,15 +102,62 @@ func readableFileSize(s int) string {
 	}
 }
 
+// Factor, by which reply thumbnails are rendered smaller than OP thumbnails
+const replyThumbScale = 0.8333
+
+// Returns the bounding box of rendered thumbnails. large is set for thread OPs.
+func thumbBounds(large bool) (w, h uint16) {
+	conf := config.Get()
+	w, h = conf.ThumbWidth, conf.ThumbHeight
+	if !large {
+		// Rounded, so the default 150 px box results in 125 px
+		w = uint16(float32(w)*replyThumbScale + 0.5)
+		h = uint16(float32(h)*replyThumbScale + 0.5)
+	}
+	return
+}
+
 // Correct thumbnail dimensions for smaller reply thumbnails
 func correctDims(large bool, w, h uint16) (string, string) {
-	if !large && (w > 125 || h > 125) {
-		w = uint16(float32(w) * 0.8333)
-		h = uint16(float32(h) * 0.8333)
+	if !large {
+		if bw, bh := thumbBounds(false); w > bw || h > bh {
+			w = uint16(float32(w) * replyThumbScale)
+			h = uint16(float32(h) * replyThumbScale)
+		}
 	}
+	return formatDims(w, h)
+}
+
+// Returns the dimensions of spoiler images and file type icons, that fill the
+// thumbnail bounding box
+func placeholderDims(large bool) (string, string) {
+	return formatDims(thumbBounds(large))
+}
+
+// Returns the dimensions of spoiler images on catalog pages
+func catalogPlaceholderDims() (string, string) {
+	conf := config.Get()
+	return formatDims(conf.CatalogThumbWidth, conf.CatalogThumbHeight)
+}
+
+func formatDims(w, h uint16) (string, string) {
 	return strconv.FormatUint(uint64(w), 10), strconv.FormatUint(uint64(h), 10)
 }
 
+// Returns the dimensions and path of the thumbnail shown on catalog pages.
+// Falls back to the standard thumbnail, if the file has no catalog rendition.
+func catalogThumbnail(img common.ImageCommon) (w, h, src string) {
+	dims := [2]uint16{img.Dims[2], img.Dims[3]}
+	rendition := assets.Thumb
+	if img.CatalogDims[0] != 0 {
+		dims = img.CatalogDims
+		rendition = assets.CatalogThumb
+	}
+	return strconv.FormatUint(uint64(dims[0]), 10),
+		strconv.FormatUint(uint64(dims[1]), 10),
+		assets.RenditionURL(img.ThumbType, img.SHA1, rendition)
+}
+
 // Extract reverse links to linked posts on a page
 func extractBacklinks(cap int, threads ...common.Thread) backlinks {
 	bls := make(backlinks, cap)
@@ -5,6 +5,7 @@ import (
 	"html"
 	"meguca/common"
 	"meguca/config"
+	"meguca/mathml"
 	"meguca/util"
 	"net/url"
 	"regexp"
@@ -67,13 +68,29 @@ var (
 type bodyContext struct {
 	index bool     // Rendered for an index page
 	state struct { // Body parser state
-		spoiler, quote, code bool
-		newlines             uint
-		iDice                int
+		spoiler, quote, code, heading bool
+		newlines                      uint
+		iDice                         int
+
+		// Currently open inline markup tags, outermost first
+		markup []markupType
+
+		// Language of a fenced code block, if a hint was provided
+		codeLang *language
+
+		// Line number of the current line in a fenced code block and, if it
+		// has already been written
+		codeLine     int
+		codeNumbered bool
+
+		// Lexer state between lines of a code block
+		codeState codeState
 	}
 	common.Post
-	OP    uint64
-	board string
+	OP             uint64
+	board          string
+	disabledMarkup uint8 // Bitmask of markup types disabled on the board
+	math           bool  // Render math tags
 	quicktemplate.Writer
 }
 
@@ -85,12 +102,20 @@ func streambody(
 	board string,
 	index bool,
 ) {
+	conf := config.GetBoardConfigs(board)
 	c := bodyContext{
-		index:  index,
-		Post:   p,
-		OP:     op,
-		board:  board,
-		Writer: *w,
+		index:          index,
+		Post:           p,
+		OP:             op,
+		board:          board,
+		disabledMarkup: disabledMarkup(conf.DisabledMarkup),
+		math:           conf.Math,
+		Writer:         *w,
+	}
+	if p.Time < conf.MarkupSince {
+		// Keep posts created before markup was introduced rendering as they
+		// were written
+		c.disabledMarkup = allMarkupDisabled
 	}
 
 	var fn func(string)
@@ -102,6 +127,10 @@ func streambody(
 
 	for i, l := range strings.Split(c.Body, "\n") {
 		c.state.quote = false
+		if c.state.codeLang != nil {
+			c.state.codeLine++
+			c.state.codeNumbered = false
+		}
 
 		// Prevent successive empty lines
 		if i != 0 && c.state.newlines < 2 {
@@ -113,9 +142,15 @@ func streambody(
 		}
 
 		c.state.newlines = 0
-		if l[0] == '>' {
+		switch {
+		case l[0] == '>':
 			c.string("<em>")
 			c.state.quote = true
+		case !c.state.code && c.markupEnabled(markupHeading) &&
+			strings.HasPrefix(l, "# "):
+			c.string(`<span class="heading">`)
+			c.state.heading = true
+			l = l[2:]
 		}
 		if c.state.spoiler {
 			c.string("<del>")
@@ -123,12 +158,20 @@ func streambody(
 
 		fn(l)
 
+		// Inline markup does not span lines
+		c.closeMarkup()
+		c.state.markup = c.state.markup[:0]
+
 		if c.state.spoiler {
 			c.string("</del>")
 		}
 		if c.state.quote {
 			c.string("</em>")
 		}
+		if c.state.heading {
+			c.string("</span>")
+			c.state.heading = false
+		}
 	}
 }
 
@@ -142,6 +185,12 @@ func (c *bodyContext) escape(s string) {
 	c.E().S(s)
 }
 
+// Escape and write a single byte
+func (c *bodyContext) escapeByte(b byte) {
+	buf := [1]byte{b}
+	c.E().SZ(buf[:])
+}
+
 // Write a byte without heap allocations or escaping
 func (c *bodyContext) byte(b byte) {
 	buf := [1]byte{b}
@@ -153,14 +202,23 @@ func (c *bodyContext) parseTerminatedLine(line string) {
 	c.parseCode(line, (*c).parseFragment)
 }
 
-// Detect code tags
+// Detect code tags. Fences with three backticks are accepted as well.
 func (c *bodyContext) parseCode(frag string, fn func(string)) {
 	for {
 		i := strings.Index(frag, "``")
 		if i != -1 {
 			c.formatCode(frag[:i], fn)
 			frag = frag[i+2:]
+			if len(frag) != 0 && frag[0] == '`' {
+				frag = frag[1:]
+			}
 			c.state.code = !c.state.code
+			c.state.codeState = codeState{}
+			if c.state.code {
+				frag = c.parseLanguageHint(frag)
+			} else {
+				c.state.codeLang = nil
+			}
 		} else {
 			c.formatCode(frag, fn)
 			break
@@ -168,17 +226,90 @@ func (c *bodyContext) parseCode(frag string, fn func(string)) {
 	}
 }
 
+// Detect a language hint, that takes up the rest of the line after an opening
+// code tag, and start a fenced code block. Returns the remaining fragment to
+// parse.
+func (c *bodyContext) parseLanguageHint(frag string) string {
+	lang, ok := languages[strings.ToLower(strings.TrimSpace(frag))]
+	if !ok {
+		return frag
+	}
+	c.state.codeLang = lang
+	c.state.codeLine = 0
+	return ""
+}
+
 func (c *bodyContext) formatCode(frag string, fn func(string)) {
-	if c.state.code {
-		// Strip quotes
-		for len(frag) != 0 && frag[0] == '>' {
-			c.string(`&gt;`)
-			frag = frag[1:]
+	if !c.state.code {
+		c.parseMath(frag, fn)
+		return
+	}
+
+	if c.state.codeLang != nil {
+		if frag == "" {
+			return
 		}
-		c.N().Z(highlightSyntax(frag))
-	} else {
-		c.parseSpoilers(frag, fn)
+		if !c.state.codeNumbered {
+			c.string(`<span class="ms-line">`)
+			c.string(strconv.Itoa(c.state.codeLine))
+			c.string(`</span>`)
+			c.state.codeNumbered = true
+		}
+	}
+
+	// Strip quotes
+	for len(frag) != 0 && frag[0] == '>' {
+		c.string(`&gt;`)
+		frag = frag[1:]
 	}
+	c.N().Z(highlightSyntax(frag, c.state.codeLang, &c.state.codeState))
+}
+
+// Render math tags, if enabled on the board, and call parseSpoilers() on the
+// remaining parts. Both tags of a formula must be on the same line.
+func (c *bodyContext) parseMath(frag string, fn func(string)) {
+	for c.math {
+		start, tag := nextMathTag(frag)
+		if start == -1 {
+			break
+		}
+		openTag := "[" + tag + "]"
+		closeTag := "[/" + tag + "]"
+		src := frag[start+len(openTag):]
+		end := strings.Index(src, closeTag)
+		if end == -1 {
+			break
+		}
+		src = src[:end]
+
+		c.parseSpoilers(frag[:start], fn)
+		buf, err := mathml.Render(src, tag == "eqn")
+		if err != nil {
+			// Write invalid formulas as is
+			c.string(`<span class="math-error" title="`)
+			c.escape(err.Error())
+			c.string(`">`)
+			c.escape(openTag + src + closeTag)
+			c.string(`</span>`)
+		} else {
+			c.N().Z(buf)
+		}
+		frag = frag[start+len(openTag)+end+len(closeTag):]
+	}
+	c.parseSpoilers(frag, fn)
+}
+
+// Find the first opening math tag in frag. Returns -1 as the index, if none
+// found.
+func nextMathTag(frag string) (int, string) {
+	i, tag := -1, ""
+	for _, t := range [...]string{"math", "eqn"} {
+		j := strings.Index(frag, "["+t+"]")
+		if j != -1 && (i == -1 || j < i) {
+			i, tag = j, t
+		}
+	}
+	return i, tag
 }
 
 // Injects spoiler tags and calls fn on the remaining parts
@@ -187,6 +318,7 @@ func (c *bodyContext) parseSpoilers(frag string, fn func(string)) {
 		i := strings.Index(frag, "**")
 		if i != -1 {
 			fn(frag[:i])
+			c.closeMarkup()
 			if c.state.quote {
 				c.string("</em>")
 			}
@@ -198,6 +330,7 @@ func (c *bodyContext) parseSpoilers(frag string, fn func(string)) {
 			if c.state.quote {
 				c.string("<em>")
 			}
+			c.reopenMarkup()
 
 			c.state.spoiler = !c.state.spoiler
 			frag = frag[i+2:]
@@ -260,7 +393,7 @@ func (c *bodyContext) parseFragment(frag string) {
 				word = "privilege"
 			}
 		}
-		c.escape(word)
+		c.formatWord(word)
 
 	end:
 		// Write trailing punctuation, if any
@@ -342,6 +475,65 @@ func (c *bodyContext) parseURL(bit string) {
 		c.string(`</a>`)
 	default:
 		c.newTabLink(s, s)
+		c.linkPreview(s)
+	}
+}
+
+// Render a preview of an external URL, if available. Previews are generated
+// server-side and their thumbnails proxied, so they also work without
+// JavaScript.
+func (c *bodyContext) linkPreview(url string) {
+	if common.GetLinkPreview == nil {
+		return
+	}
+	p, ok := common.GetLinkPreview(url, c.OP, c.board)
+	if !ok {
+		return
+	}
+
+	c.string(`<a rel="noreferrer" class="link-preview" href="`)
+	c.escape(url)
+	c.string(`" target="_blank">`)
+	if p.Thumbnail {
+		c.string(`<img src="/assets/link-previews/`)
+		c.string(p.ID)
+		c.string(`" loading="lazy">`)
+	}
+	c.string(`<strong>`)
+	c.escape(p.Title)
+	c.string(`</strong>`)
+	if p.Description != "" {
+		c.string(`<span>`)
+		c.escape(p.Description)
+		c.string(`</span>`)
+	}
+	c.string(`</a>`)
+}
+
+// Load the link previews of all URLs in the threads' posts with a single
+// query before rendering them
+func prefetchLinkPreviews(threads ...common.Thread) {
+	if common.PrefetchLinkPreviews == nil {
+		return
+	}
+
+	var urls []string
+	extract := func(body string) {
+		for _, w := range strings.Fields(body) {
+			_, w, _ = util.SplitPunctuationString(w)
+			if strings.HasPrefix(w, "http") {
+				urls = append(urls, w)
+			}
+		}
+	}
+	for _, t := range threads {
+		extract(t.Body)
+		for _, p := range t.Posts {
+			extract(p.Body)
+		}
+	}
+	if len(urls) != 0 {
+		common.PrefetchLinkPreviews(urls)
 	}
 }
 
@@ -461,7 +653,47 @@ func (c *bodyContext) writeInvalidCommand(s string) {
 
 // Parse a line that is still being edited
 func (c *bodyContext) parseOpenLine(line string) {
-	c.parseCode(line, func(s string) {
-		c.escape(s)
-	})
+	c.parseCode(line, c.parseOpenFragment)
+}
+
+// Parse a line fragment of a post, that is still being edited. Links and
+// commands are not rendered until the line is terminated, but inline markup is
+// rendered the same as in parseFragment().
+func (c *bodyContext) parseOpenFragment(frag string) {
+	for i, word := range strings.Split(frag, " ") {
+		if i != 0 {
+			c.byte(' ')
+		}
+
+		lead, word, trail := util.SplitPunctuationString(word)
+		if lead != 0 {
+			c.escapeByte(lead)
+		}
+		if isSpecialWord(word) {
+			c.escape(word)
+		} else {
+			c.formatWord(word)
+		}
+		if trail != 0 {
+			c.escapeByte(trail)
+		}
+	}
+}
+
+// Returns, if word is a link, URL or hash command. These are not subject to
+// inline markup.
+func isSpecialWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	switch word[0] {
+	case '>':
+		return linkRegexp.MatchString(word) ||
+			referenceRegexp.MatchString(word)
+	case '#':
+		return common.CommandRegexp.MatchString(word)
+	default:
+		pre, ok := urlPrefixes[word[0]]
+		return ok && strings.HasPrefix(word, pre)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"meguca/common"
 	"meguca/config"
 	. "meguca/test"
+	"strings"
 	"testing"
 
 	"github.com/valyala/quicktemplate"
@@ -71,6 +72,53 @@ func TestRenderBody(t *testing.T) {
 			in:   "**foo",
 			out:  "<del>foo</del>",
 		},
+		{
+			name: "nested inline markup",
+			in:   "__foo //bar__ baz//",
+			out:  "<b>foo <i>bar</i></b><i> baz</i>",
+		},
+		{
+			name: "inline markup closed at line end",
+			in:   "==foo\nbar",
+			out:  `<span class="heavy">foo</span><br>bar`,
+		},
+		{
+			name: "inline markup in spoiler",
+			in:   "%%foo **bar%% baz**",
+			out:  "<u>foo </u><del><u>bar</u> baz</del>",
+		},
+		{
+			name:    "open post inline markup",
+			in:      "~~foo~~ (bar)",
+			out:     "<s>foo</s> (bar)",
+			editing: true,
+		},
+		{
+			name: "heading",
+			in:   "# foo\nbar",
+			out:  `<span class="heading">foo</span><br>bar`,
+		},
+		{
+			name: "inline code tag",
+			in:   "``foo(a)``",
+			out:  `<code class="code-tag"><span class="ms-function">foo</span>(a)</code>`,
+		},
+		{
+			name: "fenced code with language hint",
+			in:   "```go\nx := 1\n```",
+			out: `<br><span class="ms-line">1</span><code class="code-tag">x ` +
+				`<span class="ms-operator">:</span>` +
+				`<span class="ms-operator">=</span> ` +
+				`<span class="ms-number">1</span></code><br>`,
+		},
+		{
+			name: "fenced diff",
+			in:   "``diff\n-a\n+b\n``",
+			out: `<br><span class="ms-line">1</span><code class="code-tag">` +
+				`<span class="ms-deleted">-a</span></code>` +
+				`<br><span class="ms-line">2</span><code class="code-tag">` +
+				`<span class="ms-inserted">+b</span></code><br>`,
+		},
 		{
 			name:    "trailing empty open line",
 			in:      "foo\n",
@@ -315,3 +363,200 @@ func TestRenderBody(t *testing.T) {
 		})
 	}
 }
+
+func TestDisabledMarkup(t *testing.T) {
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "b",
+		BoardPublic: config.BoardPublic{
+			DisabledMarkup: []string{"bold", "heading"},
+		},
+	})
+
+	buf := quicktemplate.AcquireByteBuffer()
+	defer quicktemplate.ReleaseByteBuffer(buf)
+	w := quicktemplate.AcquireWriter(buf)
+	defer quicktemplate.ReleaseWriter(w)
+
+	p := common.Post{
+		Body: "# __foo__ ~~bar~~",
+	}
+	streambody(w, p, 1, "b", false)
+
+	const std = "# __foo__ <s>bar</s>"
+	if s := string(buf.B); s != std {
+		LogUnexpected(t, std, s)
+	}
+}
+
+func TestMarkupSince(t *testing.T) {
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "c",
+		BoardPublic: config.BoardPublic{
+			MarkupSince: 1000,
+		},
+	})
+
+	cases := [...]struct {
+		name string
+		time int64
+		out  string
+	}{
+		{"before", 999, "# __foo__ //bar//"},
+		{"after", 1000, `<span class="heading"><b>foo</b> <i>bar</i></span>`},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			buf := quicktemplate.AcquireByteBuffer()
+			defer quicktemplate.ReleaseByteBuffer(buf)
+			w := quicktemplate.AcquireWriter(buf)
+			defer quicktemplate.ReleaseWriter(w)
+
+			p := common.Post{
+				Time: c.time,
+				Body: "# __foo__ //bar//",
+			}
+			streambody(w, p, 1, "c", false)
+
+			if s := string(buf.B); s != c.out {
+				LogUnexpected(t, c.out, s)
+			}
+		})
+	}
+}
+
+func TestRenderMath(t *testing.T) {
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "m",
+		BoardPublic: config.BoardPublic{
+			Math: true,
+		},
+	})
+
+	const (
+		open  = `<math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><mrow>`
+		block = `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">` +
+			`<semantics><mrow>`
+		annotation = `</mrow><annotation encoding="application/x-tex">`
+		end        = `</annotation></semantics></math>`
+	)
+
+	cases := [...]struct {
+		name, in, out, board string
+	}{
+		{
+			name:  "disabled",
+			in:    "[math]x[/math]",
+			out:   "[math]x[/math]",
+			board: "a",
+		},
+		{
+			name: "inline",
+			in:   "a [math]x^2[/math] b",
+			out: "a " + open + "<msup><mi>x</mi><mn>2</mn></msup>" + annotation +
+				"x^2" + end + " b",
+		},
+		{
+			name: "display",
+			in:   "[eqn]x[/eqn]",
+			out:  block + "<mi>x</mi>" + annotation + "x" + end,
+		},
+		{
+			name: "multiple",
+			in:   "[math]x[/math][eqn]y[/eqn]",
+			out: open + "<mi>x</mi>" + annotation + "x" + end +
+				block + "<mi>y</mi>" + annotation + "y" + end,
+		},
+		{
+			name: "spoilers not applied inside",
+			in:   "[math]a**b[/math]",
+			out: open + "<mi>a</mi><mo>*</mo><mo>*</mo><mi>b</mi>" +
+				annotation + "a**b" + end,
+		},
+		{
+			name: "unclosed",
+			in:   "[math]x",
+			out:  "[math]x",
+		},
+		{
+			name: "mismatched tags",
+			in:   "[math]x[/eqn]",
+			out:  "[math]x[/eqn]",
+		},
+		{
+			name: "invalid",
+			in:   `[math]\foo[/math]`,
+			out: `<span class="math-error" title="unknown command: \foo">` +
+				`[math]\foo[/math]</span>`,
+		},
+		{
+			name: "in code tags",
+			in:   "``[math]x``",
+			out:  `<code class="code-tag">[math]x</code>`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			board := c.board
+			if board == "" {
+				board = "m"
+			}
+
+			buf := quicktemplate.AcquireByteBuffer()
+			defer quicktemplate.ReleaseByteBuffer(buf)
+			w := quicktemplate.AcquireWriter(buf)
+			defer quicktemplate.ReleaseWriter(w)
+
+			streambody(w, common.Post{Body: c.in}, 1, board, false)
+			if s := string(buf.B); !strings.HasPrefix(s, c.out) {
+				LogUnexpected(t, c.out, s)
+			}
+		})
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	common.GetLinkPreview = func(url string, op uint64, board string) (
+		common.LinkPreview, bool,
+	) {
+		if url != "https://example.com" || op != 1 || board != "a" {
+			return common.LinkPreview{}, false
+		}
+		return common.LinkPreview{
+			Thumbnail:   true,
+			ID:          "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+			Title:       "Foo & bar",
+			Description: "<baz>",
+		}, true
+	}
+	defer func() {
+		common.GetLinkPreview = nil
+	}()
+
+	buf := quicktemplate.AcquireByteBuffer()
+	defer quicktemplate.ReleaseByteBuffer(buf)
+	w := quicktemplate.AcquireWriter(buf)
+	defer quicktemplate.ReleaseWriter(w)
+
+	p := common.Post{
+		Body: "https://example.com https://example.org",
+	}
+	streambody(w, p, 1, "a", false)
+
+	const std = `<a rel="noreferrer" href="https://example.com" target="_blank">` +
+		`https://example.com</a>` +
+		`<a rel="noreferrer" class="link-preview" href="https://example.com" ` +
+		`target="_blank"><img src="/assets/link-previews/` +
+		`da39a3ee5e6b4b0d3255bfef95601890afd80709" loading="lazy">` +
+		`<strong>Foo &amp; bar</strong><span>&lt;baz&gt;</span></a> ` +
+		`<a rel="noreferrer" href="https://example.org" target="_blank">` +
+		`https://example.org</a>`
+	if s := string(buf.B); s != std {
+		LogUnexpected(t, std, s)
+	}
+}
@@ -1,15 +1,8 @@
 package templates
 
-import "bytes"
-
-type tokenType uint8
-
-const (
-	unmatched tokenType = iota
-	word
-	quoted
-	doubleQuoted
-	comment
+import (
+	"bytes"
+	"strings"
 )
 
 const (
@@ -17,8 +10,22 @@ const (
 	functionHeader = "<span class=\"ms-function\">"
 	stringHeader   = "<span class=\"ms-string\">"
 	commentHeader  = "<span class=\"ms-comment\">"
+	numberHeader   = "<span class=\"ms-number\">"
+	typeHeader     = "<span class=\"ms-type\">"
+	insertedHeader = "<span class=\"ms-inserted\">"
+	deletedHeader  = "<span class=\"ms-deleted\">"
+	hunkHeader     = "<span class=\"ms-hunk\">"
 )
 
+// Lexer state carried between the lines of a multiline code block
+type codeState struct {
+	// Closing delimiter of an unterminated string or comment
+	closer string
+
+	// Unterminated token is a comment or a string, that can span lines
+	comment, multiline bool
+}
+
 var keywords = map[string]bool{
 	"NULL":         true,
 	"NaN":          true,
@@ -211,9 +218,9 @@ type codeWriter struct {
 	bytes.Buffer
 }
 
-func (w *codeWriter) escape(buf []byte) {
-	for _, b := range buf {
-		w.escapeByte(b)
+func (w *codeWriter) escape(s string) {
+	for i := 0; i < len(s); i++ {
+		w.escapeByte(s[i])
 	}
 }
 
@@ -238,103 +245,149 @@ func (w *codeWriter) escapeByte(b byte) {
 	}
 }
 
-func highlightSyntax(text string) []byte {
+// Highlight a single line of code. lang specifies the language to use for
+// lexing. nil selects the generic lexer. st carries multiline comments and
+// strings between consecutive lines.
+func highlightSyntax(text string, lang *language, st *codeState) []byte {
 	var w codeWriter
 	w.WriteString(`<code class="code-tag">`)
 
-	buf := []byte(text)
-	token := make([]byte, 0, 64)
-	typ := unmatched
-	var prev, next byte
+	switch {
+	case lang == nil:
+		lang = &genericLanguage
+	case lang.diff:
+		w.highlightDiff(text)
+		w.WriteString("</code>")
+		return w.Bytes()
+	}
 
-	for i := 0; i < len(buf); i++ {
-		b := buf[i]
-		if i != len(buf)-1 {
-			next = buf[i+1]
+	i := 0
+	if st.closer != "" {
+		// Resume comment or string from the previous line
+		if st.comment {
+			w.WriteString(commentHeader)
 		} else {
-			next = 0
+			w.WriteString(stringHeader)
 		}
+		i = w.delimited(text, 0, st)
+	}
 
-		switch typ {
-		case unmatched:
-			switch b {
-			case '/':
-				if next == '/' {
-					typ = comment
-					w.WriteString(commentHeader)
-					w.WriteString(`//`)
-					i++
-				} else {
-					w.wrapOperator(b)
-				}
-			case '#':
-				typ = comment
-				w.WriteString(commentHeader)
-				w.WriteByte(b)
-			case '\'':
-				typ = quoted
-				w.WriteString(stringHeader)
-				w.WriteString("&#39;")
-			case '"':
-				typ = doubleQuoted
-				w.WriteString(stringHeader)
-				w.WriteString("&#34;")
-			default:
-				switch {
-				case operators[b]:
-					w.wrapOperator(b)
-				case isWordByte(b):
-					typ = word
-					token = append(token, b)
-				default:
-					w.escapeByte(b)
-				}
+	for i < len(text) {
+		b := text[i]
+		switch {
+		case lang.isLineComment(text[i:]):
+			w.WriteString(commentHeader)
+			w.escape(text[i:])
+			w.close()
+			i = len(text)
+		case lang.isBlockComment(text[i:]):
+			open := lang.blockComment[0]
+			w.WriteString(commentHeader)
+			w.escape(open)
+			*st = codeState{
+				closer:  lang.blockComment[1],
+				comment: true,
 			}
-		case word:
-			token = append(token, b)
-			if !isWordByte(next) {
-				switch {
-				case next == '(':
-					w.WriteString(functionHeader)
-					w.escape(token)
-					w.close()
-				case keywords[string(token)]:
-					w.WriteString(operatorHeader)
-					w.Write(token)
-					w.close()
-				default:
-					w.escape(token)
-				}
-				typ = unmatched
-				token = token[0:0]
-			}
-		case quoted:
+			i = w.delimited(text, i+len(open), st)
+		case strings.IndexByte(lang.quotes, b) != -1:
+			w.WriteString(stringHeader)
 			w.escapeByte(b)
-			if b == '\'' && prev != '\\' {
-				w.close()
-				typ = unmatched
+			*st = codeState{
+				closer:    string(b),
+				multiline: strings.IndexByte(lang.multilineQuotes, b) != -1,
 			}
-		case doubleQuoted:
-			w.escapeByte(b)
-			if b == '"' && prev != '\\' {
-				w.close()
-				typ = unmatched
+			i = w.delimited(text, i+1, st)
+		case operators[b]:
+			w.wrapOperator(b)
+			i++
+		case isWordByte(b):
+			j := i + 1
+			for j < len(text) && isWordByte(text[j]) {
+				j++
 			}
-		case comment:
+			w.word(text[i:j], lang, j < len(text) && text[j] == '(')
+			i = j
+		default:
 			w.escapeByte(b)
+			i++
+		}
+	}
+
+	w.WriteString("</code>")
+	return w.Bytes()
+}
+
+// Write a string or comment body starting at i up to and including the
+// closing delimiter in st and return the position after it. If the closing
+// delimiter is not found, the rest of the line is consumed.
+func (w *codeWriter) delimited(text string, i int, st *codeState) int {
+	for j := i; j < len(text); j++ {
+		if !strings.HasPrefix(text[j:], st.closer) {
+			continue
+		}
+		// Strings can escape their closing quote
+		if !st.comment && j != 0 && text[j-1] == '\\' {
+			continue
 		}
 
-		prev = b
+		end := j + len(st.closer)
+		w.escape(text[i:end])
+		w.close()
+		*st = codeState{}
+		return end
 	}
 
-	if typ == word {
-		w.escape(token)
+	w.escape(text[i:])
+	w.close()
+	if !st.comment && !st.multiline {
+		*st = codeState{}
 	}
-	if typ != unmatched {
-		w.close()
+	return len(text)
+}
+
+// Write a word token, wrapping it according to its class
+func (w *codeWriter) word(word string, lang *language, isCall bool) {
+	key := word
+	if lang.caseInsensitive {
+		key = strings.ToLower(word)
 	}
-	w.WriteString("</code>")
-	return w.Bytes()
+
+	var header string
+	switch {
+	case isCall:
+		header = functionHeader
+	case lang.keywords[key]:
+		header = operatorHeader
+	case lang.types[key]:
+		header = typeHeader
+	case lang.numbers && word[0] >= '0' && word[0] <= '9':
+		header = numberHeader
+	default:
+		w.escape(word)
+		return
+	}
+	w.WriteString(header)
+	w.escape(word)
+	w.close()
+}
+
+// Highlight a line of a unified diff
+func (w *codeWriter) highlightDiff(text string) {
+	var header string
+	switch {
+	case strings.HasPrefix(text, "@@"):
+		header = hunkHeader
+	case strings.HasPrefix(text, "+"):
+		header = insertedHeader
+	case strings.HasPrefix(text, "-"):
+		header = deletedHeader
+	default:
+		w.escape(text)
+		return
+	}
+	w.WriteString(header)
+	w.escape(text)
+	w.close()
 }
 
 // close open tag
@@ -35,6 +35,10 @@ type inputSpec struct {
 	ID, Pattern, Autocomplete              string
 	Options                                []string
 	Val                                    interface{}
+
+	// Retrieves select options at render time, if the options can change
+	// while the server is running. Overrides Options.
+	GetOptions func() []string
 }
 
 // Returns a copy of s, that will render wrapped indside a label
@@ -162,7 +166,12 @@ func (w *formWriter) sel(spec inputSpec) {
 		val = spec.Val.(string)
 	}
 
-	for _, o := range spec.Options {
+	options := spec.Options
+	if spec.GetOptions != nil {
+		options = spec.GetOptions()
+	}
+
+	for _, o := range options {
 		w.N().S("<option")
 		w.attr("value", o)
 		if o == val {
@@ -0,0 +1,248 @@
+package templates
+
+import (
+	"path"
+	"strings"
+)
+
+// Lexer definition of a programming language for syntax highlighting
+type language struct {
+	// Highlight lines as a unified diff instead of lexing
+	diff bool
+
+	// Highlight number literals
+	numbers bool
+
+	// Keywords and types are matched case-insensitively
+	caseInsensitive bool
+
+	// Characters that open and close a string literal. Those in
+	// multilineQuotes may span multiple lines.
+	quotes, multilineQuotes string
+
+	// Prefixes that start a comment, that spans the rest of the line
+	lineComments []string
+
+	// Opening and closing delimiters of a block comment
+	blockComment [2]string
+
+	keywords, types map[string]bool
+}
+
+// Returns, if s starts with a line comment
+func (l *language) isLineComment(s string) bool {
+	for _, p := range l.lineComments {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns, if s starts with a block comment
+func (l *language) isBlockComment(s string) bool {
+	return l.blockComment[0] != "" && strings.HasPrefix(s, l.blockComment[0])
+}
+
+// Used for code tags without a language hint
+var genericLanguage = language{
+	quotes:       `'"`,
+	lineComments: []string{"//", "#"},
+	keywords:     keywords,
+}
+
+// Languages by name and alias, that can be specified as a hint right after an
+// opening code tag
+var languages = map[string]*language{
+	"go":         &goLanguage,
+	"golang":     &goLanguage,
+	"python":     &pythonLanguage,
+	"py":         &pythonLanguage,
+	"js":         &jsLanguage,
+	"javascript": &jsLanguage,
+	"c":          &cLanguage,
+	"rust":       &rustLanguage,
+	"rs":         &rustLanguage,
+	"sh":         &shellLanguage,
+	"bash":       &shellLanguage,
+	"shell":      &shellLanguage,
+	"sql":        &sqlLanguage,
+	"diff":       &diffLanguage,
+	"patch":      &diffLanguage,
+}
+
+// File extensions of languages, that differ from their names and aliases
+var extensionLanguages = map[string]*language{
+	"h":   &cLanguage,
+	"mjs": &jsLanguage,
+	"ts":  &jsLanguage,
+	"zsh": &shellLanguage,
+}
+
+// Select the language of an uploaded text file by the original extension
+// preceding ".txt" in its name. Returns nil, if the language is unknown.
+func fileLanguage(name string) *language {
+	ext := path.Ext(strings.TrimSuffix(name, ".txt"))
+	if ext == "" {
+		return nil
+	}
+	ext = strings.ToLower(ext[1:])
+	if l := extensionLanguages[ext]; l != nil {
+		return l
+	}
+	return languages[ext]
+}
+
+var (
+	goLanguage = language{
+		numbers:         true,
+		quotes:          "'\"`",
+		multilineQuotes: "`",
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		keywords: toSet(
+			"break", "case", "chan", "const", "continue", "default", "defer",
+			"else", "fallthrough", "for", "func", "go", "goto", "if", "import",
+			"interface", "map", "package", "range", "return", "select",
+			"struct", "switch", "type", "var", "nil", "true", "false", "iota",
+		),
+		types: toSet(
+			"bool", "byte", "complex64", "complex128", "error", "float32",
+			"float64", "int", "int8", "int16", "int32", "int64", "rune",
+			"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		),
+	}
+
+	pythonLanguage = language{
+		numbers:      true,
+		quotes:       `'"`,
+		lineComments: []string{"#"},
+		keywords: toSet(
+			"False", "None", "True", "and", "as", "assert", "async", "await",
+			"break", "class", "continue", "def", "del", "elif", "else",
+			"except", "finally", "for", "from", "global", "if", "import", "in",
+			"is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return",
+			"try", "while", "with", "yield", "self",
+		),
+		types: toSet(
+			"bool", "bytearray", "bytes", "complex", "dict", "float",
+			"frozenset", "int", "list", "object", "set", "str", "tuple",
+		),
+	}
+
+	jsLanguage = language{
+		numbers:         true,
+		quotes:          "'\"`",
+		multilineQuotes: "`",
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		keywords: toSet(
+			"async", "await", "break", "case", "catch", "class", "const",
+			"continue", "debugger", "default", "delete", "do", "else",
+			"export", "extends", "false", "finally", "for", "function", "if",
+			"import", "in", "instanceof", "let", "new", "null", "of",
+			"return", "static", "super", "switch", "this", "throw", "true",
+			"try", "typeof", "undefined", "var", "void", "while", "with",
+			"yield", "NaN", "Infinity",
+		),
+		types: toSet(
+			"Array", "ArrayBuffer", "Boolean", "Date", "Error", "Function",
+			"Map", "Number", "Object", "Promise", "RegExp", "Set", "String",
+			"Symbol", "WeakMap", "WeakSet",
+		),
+	}
+
+	cLanguage = language{
+		numbers:      true,
+		quotes:       `'"`,
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		keywords: toSet(
+			"auto", "break", "case", "const", "continue", "default", "do",
+			"else", "enum", "extern", "for", "goto", "if", "inline",
+			"register", "restrict", "return", "sizeof", "static", "struct",
+			"switch", "typedef", "union", "volatile", "while", "NULL",
+			"true", "false",
+		),
+		types: toSet(
+			"bool", "char", "double", "float", "int", "long", "short",
+			"signed", "unsigned", "void", "size_t", "ssize_t", "int8_t",
+			"int16_t", "int32_t", "int64_t", "uint8_t", "uint16_t",
+			"uint32_t", "uint64_t", "intptr_t", "uintptr_t", "FILE",
+		),
+	}
+
+	// Single quotes are not strings in Rust, as they are also used for
+	// lifetimes
+	rustLanguage = language{
+		numbers:         true,
+		quotes:          `"`,
+		multilineQuotes: `"`,
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		keywords: toSet(
+			"as", "async", "await", "break", "const", "continue", "crate",
+			"dyn", "else", "enum", "extern", "false", "fn", "for", "if",
+			"impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub",
+			"ref", "return", "self", "Self", "static", "struct", "super",
+			"trait", "true", "type", "unsafe", "use", "where", "while",
+		),
+		types: toSet(
+			"bool", "char", "f32", "f64", "i8", "i16", "i32", "i64", "i128",
+			"isize", "str", "u8", "u16", "u32", "u64", "u128", "usize", "Box",
+			"Option", "Result", "String", "Vec",
+		),
+	}
+
+	shellLanguage = language{
+		numbers:         true,
+		quotes:          `'"`,
+		multilineQuotes: `'"`,
+		lineComments:    []string{"#"},
+		keywords: toSet(
+			"case", "do", "done", "elif", "else", "esac", "fi", "for",
+			"function", "if", "in", "select", "then", "until", "while",
+			"break", "continue", "export", "local", "readonly", "return",
+			"shift", "source", "unset",
+		),
+	}
+
+	sqlLanguage = language{
+		numbers:         true,
+		caseInsensitive: true,
+		quotes:          `'"`,
+		lineComments:    []string{"--"},
+		blockComment:    [2]string{"/*", "*/"},
+		keywords: toSet(
+			"add", "all", "alter", "and", "as", "asc", "begin", "between", "by",
+			"case", "check", "column", "commit", "constraint", "create",
+			"default", "delete", "desc", "distinct", "drop", "else", "end",
+			"exists", "foreign", "from", "full", "group", "having", "if", "in",
+			"index", "inner", "insert", "into", "is", "join", "key", "left",
+			"like", "limit", "not", "null", "offset", "on", "or", "order",
+			"outer", "primary", "references", "returning", "right",
+			"rollback", "select", "set", "table", "then", "union", "unique",
+			"update", "values", "view", "when", "where", "with", "true",
+			"false",
+		),
+		types: toSet(
+			"bigint", "bool", "boolean", "bytea", "char", "date", "decimal",
+			"float", "inet", "int", "integer", "json", "jsonb", "numeric",
+			"real", "serial", "smallint", "text", "time", "timestamp",
+			"varchar",
+		),
+	}
+
+	diffLanguage = language{
+		diff: true,
+	}
+)
+
+// Create a set from a list of strings
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
@@ -0,0 +1,117 @@
+// Inline post body formatting
+
+package templates
+
+import "meguca/common"
+
+// Markup types in the same order as common.MarkupTypes
+type markupType uint8
+
+const (
+	markupBold markupType = iota
+	markupItalic
+	markupStrikethrough
+	markupUnderline
+	markupHeavy
+	markupHeading
+)
+
+// Inline markup types are toggled by a doubled marker byte
+var inlineMarkup = [...]struct {
+	marker      byte
+	open, close string
+}{
+	markupBold:          {'_', "<b>", "</b>"},
+	markupItalic:        {'/', "<i>", "</i>"},
+	markupStrikethrough: {'~', "<s>", "</s>"},
+	markupUnderline:     {'%', "<u>", "</u>"},
+	markupHeavy:         {'=', `<span class="heavy">`, "</span>"},
+}
+
+// Bitmask with all markup types disabled
+const allMarkupDisabled = 1<<uint(len(common.MarkupTypes)) - 1
+
+// Returns a bitmask of the disabled markup types
+func disabledMarkup(disabled []string) (mask uint8) {
+	for _, m := range disabled {
+		for i, t := range common.MarkupTypes {
+			if m == t {
+				mask |= 1 << uint(i)
+			}
+		}
+	}
+	return
+}
+
+// Returns, if the markup type is enabled for this post
+func (c *bodyContext) markupEnabled(t markupType) bool {
+	return c.disabledMarkup&(1<<uint(t)) == 0
+}
+
+// Find the first enabled inline markup marker in s. Returns -1 as the index,
+// if none found.
+func (c *bodyContext) nextMarker(s string) (int, markupType) {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != s[i+1] {
+			continue
+		}
+		for t, m := range inlineMarkup {
+			if m.marker == s[i] && c.markupEnabled(markupType(t)) {
+				return i, markupType(t)
+			}
+		}
+	}
+	return -1, 0
+}
+
+// Escape and write a word, converting inline markup markers into tags
+func (c *bodyContext) formatWord(word string) {
+	for {
+		i, t := c.nextMarker(word)
+		if i == -1 {
+			c.escape(word)
+			return
+		}
+		c.escape(word[:i])
+		c.toggleMarkup(t)
+		word = word[i+2:]
+	}
+}
+
+// Open or close an inline markup tag. Tags are always kept properly nested:
+// closing a tag, that is not the innermost one, closes the tags opened after
+// it and reopens them after.
+func (c *bodyContext) toggleMarkup(t markupType) {
+	open := c.state.markup
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i] != t {
+			continue
+		}
+
+		for j := len(open) - 1; j >= i; j-- {
+			c.string(inlineMarkup[open[j]].close)
+		}
+		for _, t := range open[i+1:] {
+			c.string(inlineMarkup[t].open)
+		}
+		c.state.markup = append(open[:i], open[i+1:]...)
+		return
+	}
+
+	c.string(inlineMarkup[t].open)
+	c.state.markup = append(open, t)
+}
+
+// Close all open inline markup tags, innermost first
+func (c *bodyContext) closeMarkup() {
+	for i := len(c.state.markup) - 1; i >= 0; i-- {
+		c.string(inlineMarkup[c.state.markup[i]].close)
+	}
+}
+
+// Reopen inline markup tags closed with closeMarkup()
+func (c *bodyContext) reopenMarkup() {
+	for _, t := range c.state.markup {
+		c.string(inlineMarkup[t].open)
+	}
+}
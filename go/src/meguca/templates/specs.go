@@ -4,6 +4,7 @@ package templates
 
 import (
 	"meguca/common"
+	"meguca/config"
 )
 
 // NOTE: After adding inputSpec structs with new ID fields, be sure to add the
@@ -24,9 +25,9 @@ var (
 	sageSpec         = inputSpec{ID: "sage"}
 	staffTitleSpec   = inputSpec{ID: "staffTitle"}
 	defaultThemeSpec = inputSpec{
-		ID:      "defaultCSS",
-		Type:    _select,
-		Options: common.Themes,
+		ID:         "defaultCSS",
+		Type:       _select,
+		GetOptions: common.GetThemes,
 	}
 )
 
@@ -122,6 +123,50 @@ var specs = map[string][]inputSpec{
 		{ID: "flags"},
 		{ID: "NSFW"},
 		{ID: "posterIDs"},
+		{ID: "math"},
+		{ID: "hideFileNames"},
+		{
+			ID:   "bumpLimit",
+			Type: _number,
+		},
+		{
+			ID:   "imageLimit",
+			Type: _number,
+		},
+		{
+			ID:   "postLimit",
+			Type: _number,
+		},
+		{
+			ID:   "maxFiles",
+			Type: _number,
+			Min:  1,
+			Max:  common.MaxNumFiles,
+		},
+		{
+			ID:   "maxSize",
+			Type: _number,
+			Max:  common.MaxBoardFileSize,
+		},
+		{
+			ID:   "storageQuota",
+			Type: _number,
+		},
+		{
+			ID:   "stripMetadata",
+			Type: _select,
+			Options: []string{
+				config.MetadataDefault,
+				config.MetadataStrip,
+				config.MetadataKeep,
+			},
+		},
+		{
+			ID:   "threadsPerPage",
+			Type: _number,
+			Min:  1,
+			Max:  100,
+		},
 		{
 			ID:        "title",
 			Type:      _string,
@@ -145,12 +190,28 @@ var specs = map[string][]inputSpec{
 			Type:      _array,
 			MaxLength: common.MaxLenEightball,
 		},
+		{
+			ID:        "disabledMarkup",
+			Type:      _array,
+			MaxLength: 20,
+		},
+		{
+			ID:        "allowedTypes",
+			Type:      _array,
+			MaxLength: 10,
+		},
 		{
 			ID:        "js",
 			Type:      _textarea,
 			Rows:      5,
 			MaxLength: common.MaxLenCustomJS,
 		},
+		{
+			ID:        "css",
+			Type:      _textarea,
+			Rows:      5,
+			MaxLength: common.MaxLenCustomCSS,
+		},
 	},
 	"createBoard": {
 		{
@@ -255,6 +316,64 @@ var specs = map[string][]inputSpec{
 			ID:   "links",
 			Type: _map,
 		},
+		{
+			ID:        "previewDomains",
+			Type:      _array,
+			MaxLength: 253,
+		},
+		{
+			ID:   "blockedImageDistance",
+			Type: _number,
+			Max:  64,
+		},
+		{
+			ID:   "thumbnailWorkers",
+			Type: _number,
+			Max:  256,
+		},
+		{ID: "stripMetadata"},
+		{
+			ID:       "thumbWidth",
+			Type:     _number,
+			Min:      common.MinThumbSize,
+			Max:      500,
+			Required: true,
+		},
+		{
+			ID:       "thumbHeight",
+			Type:     _number,
+			Min:      common.MinThumbSize,
+			Max:      500,
+			Required: true,
+		},
+		{
+			ID:       "catalogThumbWidth",
+			Type:     _number,
+			Min:      common.MinThumbSize,
+			Max:      500,
+			Required: true,
+		},
+		{
+			ID:       "catalogThumbHeight",
+			Type:     _number,
+			Min:      common.MinThumbSize,
+			Max:      500,
+			Required: true,
+		},
+		{ID: "transcode"},
+		{
+			ID:   "maxTranscodeLength",
+			Type: _number,
+		},
+		{
+			ID:   "maxTranscodeSize",
+			Type: _number,
+		},
+		{
+			ID:   "transcodeWorkers",
+			Type: _number,
+			Max:  64,
+		},
 	},
 }
 
@@ -280,12 +399,15 @@ var optionSpecs = [...][]inputSpec{
 		{ID: "workModeToggle"},
 		{ID: "autogif"},
 		{ID: "spoilers"},
+		{ID: "nsfwSpoilers"},
+		{ID: "goreSpoilers"},
+		{ID: "blurSpoilers"},
 		{ID: "replyRight"},
 		{ID: "horizontalPosting"},
 		{
-			ID:      "theme",
-			Type:    _select,
-			Options: common.Themes,
+			ID:         "theme",
+			Type:       _select,
+			GetOptions: common.GetThemes,
 		},
 		{ID: "userBG"},
 		{
@@ -37,9 +37,10 @@ func Compile() error {
 }
 
 // Board renders board page HTML for noscript browsers. withIndex specifies, if
-// the rendered board page should be embedded in the index page
+// the rendered board page should be embedded in the index page. sort is the
+// thread sort mode to preserve in pagination links.
 func Board(
-	b, theme string,
+	b, theme, sort string,
 	page, total int,
 	pos auth.ModerationLevel,
 	minimal, catalog bool,
@@ -49,7 +50,7 @@ func Board(
 	title := html.EscapeString(fmt.Sprintf("/%s/ - %s", b, conf.Title))
 	html := renderBoard(
 		threadHTML,
-		b, title,
+		b, title, sort,
 		conf,
 		page, total,
 		pos,
@@ -0,0 +1,22 @@
+package templates
+
+import "strings"
+
+// Split an uploaded text file into lines for rendering in the text viewer
+func splitTextLines(text []byte) []string {
+	s := strings.Replace(string(text), "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Highlight a line of an uploaded text file. Files of unknown language are
+// only escaped.
+func highlightTextLine(line string, lang *language, st *codeState) []byte {
+	if lang != nil {
+		return highlightSyntax(line, lang, st)
+	}
+	var w codeWriter
+	w.WriteString(`<code class="code-tag">`)
+	w.escape(line)
+	w.WriteString("</code>")
+	return w.Bytes()
+}
@@ -0,0 +1,52 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileLanguage(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		lang *language
+	}{
+		{"notes.txt", nil},
+		{"v1.2.txt", nil},
+		{"main.go.txt", &goLanguage},
+		{"LIB.H.txt", &cLanguage},
+		{"index.ts.txt", &jsLanguage},
+		{"fix.patch.txt", &diffLanguage},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if l := fileLanguage(c.name); l != c.lang {
+				t.Fatalf("unexpected language: %p : %p", c.lang, l)
+			}
+		})
+	}
+}
+
+func TestTextViewer(t *testing.T) {
+	t.Parallel()
+
+	html := TextViewer("main.go.txt", "moe",
+		[]byte("package main\r\n\r\n// <b>\r\n"))
+	for _, s := range [...]string{
+		`<title>main.go.txt</title>`,
+		`<td class="line-number">3</td>`,
+		`<span class="ms-operator">package</span>`,
+		`<span class="ms-comment">// &lt;b&gt;</span>`,
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("%s not found in %s", s, html)
+		}
+	}
+	if strings.Contains(html, `<td class="line-number">4</td>`) {
+		t.Error("trailing empty line rendered")
+	}
+}
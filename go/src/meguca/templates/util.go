@@ -24,10 +24,12 @@ func CalculateOmit(t common.Thread) (int, int) {
 		if t.Image != nil {
 			imgOmit--
 		}
+		imgOmit -= uint32(len(t.Images))
 		for _, p := range t.Posts {
 			if p.Image != nil {
 				imgOmit--
 			}
+			imgOmit -= uint32(len(p.Images))
 		}
 	}
 	return omit, int(imgOmit)
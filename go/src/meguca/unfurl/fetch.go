@@ -0,0 +1,365 @@
+// Fetching and parsing of preview metadata
+
+package unfurl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"meguca/assets"
+	"meguca/common"
+	"meguca/config"
+	"meguca/util"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bakape/thumbnailer"
+)
+
+const (
+	userAgent = "Mozilla/5.0 (compatible; meguca link preview)"
+
+	// Maximum number of bytes read from a page. Metadata is in the <head> at
+	// the top of the page, so the rest is simply discarded.
+	maxPageSize = 512 << 10
+
+	maxOEmbedSize = 64 << 10
+	maxImageSize  = 5 << 20
+	maxRedirects  = 5
+)
+
+var (
+	errNoMetadata       = errors.New("no preview metadata")
+	errTooLarge         = errors.New("file too large")
+	errTooManyRedirects = errors.New("too many redirects")
+	errInvalidScheme    = errors.New("invalid URL scheme")
+	errForbiddenAddress = errors.New("forbidden address")
+
+	tagRegexp   = regexp.MustCompile(`(?is)<(meta|link)\s([^>]*)>`)
+	attrRegexp  = regexp.MustCompile(`(?s)([\w:\-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+	// Address ranges, that must never be connected to. Prevents previews from
+	// being used to probe the server's internal network. Includes the NAT64
+	// and 6to4 ranges, which embed IPv4 addresses.
+	forbiddenNets = parseCIDRs(
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+		"169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4", "::/128", "::1/128",
+		"64:ff9b::/96", "2002::/16", "fc00::/7", "fe80::/10", "ff00::/8",
+	)
+
+	dialer = &net.Dialer{
+		Timeout: 5 * time.Second,
+	}
+
+	client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:           dialPublic,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Second,
+			MaxIdleConns:          16,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errTooManyRedirects
+			}
+			return checkScheme(req.URL)
+		},
+	}
+)
+
+// Metadata parsed from a page
+type metadata struct {
+	title, description, image, oEmbed string
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// Refuse connecting to loopback, private and other non-public addresses. The
+// host is resolved here and the checked address dialed directly, so the DNS
+// response can not change in between. Also applies to any redirects.
+func dialPublic(ctx context.Context, network, address string) (
+	net.Conn, error,
+) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if !isPublicIP(a.IP) {
+			return nil, errForbiddenAddress
+		}
+	}
+	address = net.JoinHostPort(addrs[0].IP.String(), port)
+	return dialer.DialContext(ctx, network, address)
+}
+
+func isPublicIP(ip net.IP) bool {
+	for _, n := range forbiddenNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errInvalidScheme
+	}
+	return nil
+}
+
+// Fetch a URL and generate its preview and thumbnail
+func fetch(u string) (p common.LinkPreview, thumb assets.File, err error) {
+	page, base, err := get(u, maxPageSize, "text/html")
+	if err != nil {
+		return
+	}
+	m := parseMetadata(page)
+
+	// Fill in any missing fields from the oEmbed endpoint, if any
+	if m.oEmbed != "" && (m.title == "" || m.image == "") {
+		if o, err := fetchOEmbed(resolve(base, m.oEmbed)); err == nil {
+			setIfEmpty(&m.title, o.title)
+			setIfEmpty(&m.description, o.description)
+			setIfEmpty(&m.image, o.image)
+		}
+	}
+
+	if m.title == "" {
+		err = errNoMetadata
+		return
+	}
+	p.Title = truncate(m.title, common.MaxLenPreviewTitle)
+	p.Description = truncate(m.description, common.MaxLenPreviewDescription)
+
+	// Previews without thumbnails are still valid
+	if m.image != "" {
+		if t, err := fetchThumbnail(resolve(base, m.image)); err == nil {
+			thumb = t
+			p.Thumbnail = true
+		}
+	}
+
+	return
+}
+
+// Fetch a resource and read up to limit bytes of it. Returns the final URL
+// after any redirects.
+func get(u string, limit int64, accept string) (
+	buf []byte, final *url.URL, err error,
+) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return
+	}
+	if err = checkScheme(req.URL); err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("unexpected response status: %s", res.Status)
+		return
+	}
+
+	buf, err = ioutil.ReadAll(io.LimitReader(res.Body, limit))
+	final = res.Request.URL
+	return
+}
+
+// Resolve a possibly relative URL against the page URL
+func resolve(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// Parse Open Graph, Twitter card and oEmbed discovery metadata from the
+// <head> of an HTML page
+func parseMetadata(page []byte) (m metadata) {
+	if i := bytes.Index(bytes.ToLower(page), []byte("</head>")); i != -1 {
+		page = page[:i]
+	}
+
+	for _, tag := range tagRegexp.FindAllSubmatch(page, -1) {
+		attrs := parseAttributes(tag[2])
+		switch strings.ToLower(string(tag[1])) {
+		case "meta":
+			key := attrs["property"]
+			if key == "" {
+				key = attrs["name"]
+			}
+			val := attrs["content"]
+			switch strings.ToLower(key) {
+			case "og:title", "twitter:title":
+				setIfEmpty(&m.title, val)
+			case "og:description", "twitter:description", "description":
+				setIfEmpty(&m.description, val)
+			case "og:image", "og:image:url", "twitter:image":
+				setIfEmpty(&m.image, val)
+			}
+		case "link":
+			if strings.ToLower(attrs["type"]) == "application/json+oembed" {
+				setIfEmpty(&m.oEmbed, attrs["href"])
+			}
+		}
+	}
+
+	if m.title == "" {
+		if t := titleRegexp.FindSubmatch(page); t != nil {
+			m.title = clean(string(t[1]))
+		}
+	}
+	return
+}
+
+// Parse the attributes of an HTML tag. Attribute names are lowercased and
+// values unescaped.
+func parseAttributes(s []byte) map[string]string {
+	attrs := make(map[string]string, 4)
+	for _, m := range attrRegexp.FindAllSubmatch(s, -1) {
+		key := strings.ToLower(string(m[1]))
+		var val []byte
+		for _, v := range m[2:] {
+			if v != nil {
+				val = v
+				break
+			}
+		}
+		attrs[key] = clean(string(val))
+	}
+	return attrs
+}
+
+// Fetch preview metadata from an oEmbed endpoint
+func fetchOEmbed(u string) (m metadata, err error) {
+	buf, _, err := get(u, maxOEmbedSize, "application/json")
+	if err != nil {
+		return
+	}
+
+	var res struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	err = json.Unmarshal(buf, &res)
+	if err != nil {
+		return
+	}
+	m = metadata{
+		title:       clean(res.Title),
+		description: clean(res.AuthorName),
+		image:       res.ThumbnailURL,
+	}
+	return
+}
+
+// Fetch an image and generate a thumbnail from it
+func fetchThumbnail(u string) (f assets.File, err error) {
+	buf, _, err := get(u, maxImageSize+1, "image/*")
+	if err != nil {
+		return
+	}
+	if len(buf) > maxImageSize {
+		err = errTooLarge
+		return
+	}
+
+	conf := config.Get()
+	_, thumb, err := thumbnailer.ProcessBuffer(buf, thumbnailer.Options{
+		JPEGQuality: conf.JPEGQuality,
+		MaxSourceDims: thumbnailer.Dims{
+			Width:  uint(conf.MaxWidth),
+			Height: uint(conf.MaxHeight),
+		},
+		ThumbDims: thumbnailer.Dims{
+			Width:  150,
+			Height: 150,
+		},
+		AcceptedMimeTypes: map[string]bool{
+			"image/jpeg": true,
+			"image/png":  true,
+			"image/gif":  true,
+		},
+	})
+	if err != nil {
+		return
+	}
+	if thumb.Data == nil {
+		err = errNoMetadata
+		return
+	}
+	defer thumbnailer.ReturnBuffer(thumb.Data)
+
+	// Copy out of the pooled buffer
+	f.Data = append([]byte(nil), thumb.Data...)
+	if thumb.IsPNG {
+		f.Mime = "image/png"
+	} else {
+		f.Mime = "image/jpeg"
+	}
+	f.Hash = util.HashBuffer(f.Data)
+	return
+}
+
+func setIfEmpty(dst *string, val string) {
+	if *dst == "" {
+		*dst = val
+	}
+}
+
+// Unescape HTML entities and collapse whitespace
+func clean(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// Truncate a string to at most n characters without splitting any runes.
+// Invalid UTF-8 is replaced.
+func truncate(s string, n int) string {
+	if !utf8.ValidString(s) {
+		// Invalid bytes are replaced with utf8.RuneError on conversion
+		s = string([]rune(s))
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
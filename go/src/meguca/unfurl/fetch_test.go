@@ -0,0 +1,129 @@
+package unfurl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "meguca/test"
+)
+
+func TestParseMetadata(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		out      metadata
+	}{
+		{"empty", "", metadata{}},
+		{
+			"title tag",
+			"<html><head><title>\n  Foo &amp;\tbar </title></head></html>",
+			metadata{title: "Foo & bar"},
+		},
+		{
+			"open graph",
+			`<head>
+				<title>ignored</title>
+				<meta property="og:title" content="Foo">
+				<META PROPERTY='og:description' CONTENT='Bar &lt;3'>
+				<meta property=og:image content=/img.png>
+			</head>`,
+			metadata{
+				title:       "Foo",
+				description: "Bar <3",
+				image:       "/img.png",
+			},
+		},
+		{
+			"twitter card fallback",
+			`<meta name="twitter:title" content="Foo">
+			<meta name="description" content="Bar">`,
+			metadata{
+				title:       "Foo",
+				description: "Bar",
+			},
+		},
+		{
+			"oEmbed discovery",
+			`<link rel="alternate" type="application/json+oembed"
+				href="https://example.com/oembed?url=foo">`,
+			metadata{oEmbed: "https://example.com/oembed?url=foo"},
+		},
+		{
+			"body ignored",
+			`<head></head><body><meta property="og:title" content="Foo"></body>`,
+			metadata{},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			AssertDeepEquals(t, parseMetadata([]byte(c.in)), c.out)
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::7f00:1", false},
+		{"2002:7f00:1::1", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.ip, func(t *testing.T) {
+			t.Parallel()
+			if p := isPublicIP(net.ParseIP(c.ip)); p != c.public {
+				t.Fatalf("unexpected result: %v : %v", c.public, p)
+			}
+		})
+	}
+}
+
+func TestRefuseInternalAddress(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(`<title>internal</title>`))
+		},
+	))
+	defer s.Close()
+
+	_, _, err := fetch(s.URL)
+	if err == nil || !strings.Contains(err.Error(), errForbiddenAddress.Error()) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	if s := truncate("abc", 3); s != "abc" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+	if s := truncate("абвгд", 3); s != "аб…" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
@@ -0,0 +1,260 @@
+// Package unfurl generates previews of external URLs linked in posts from
+// their Open Graph and oEmbed metadata. Previews are fetched in the
+// background, stored in the database and their thumbnails are proxied, so
+// clients never contact third parties directly.
+package unfurl
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"meguca/cache"
+	"meguca/common"
+	"meguca/config"
+	"meguca/db"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Time to keep fetched previews for
+	previewTTL = 24 * time.Hour
+
+	// Time to wait before retrying URLs, that failed to produce a preview
+	failureTTL = time.Hour
+
+	// Time to keep previews in memory, before checking the database again
+	memoryTTL = 10 * time.Minute
+
+	// Maximum number of previews kept in memory
+	maxCached = 1 << 12
+
+	// Number of concurrent fetching goroutines
+	numWorkers = 4
+)
+
+var (
+	mu       sync.RWMutex
+	previews = make(map[string]entry, 64)
+
+	// URLs currently queued or being fetched
+	pending = make(map[string]bool)
+
+	queue     = make(chan request, 256)
+	startOnce sync.Once
+)
+
+// Needed to avoid cyclic imports for the 'templates' package
+func init() {
+	common.GetLinkPreview = Get
+	common.PrefetchLinkPreviews = Prefetch
+}
+
+// Preview of a URL cached in memory
+type entry struct {
+	ok      bool // Preview is available
+	expires time.Time
+	preview common.LinkPreview
+}
+
+func newEntry(p common.LinkPreview) entry {
+	return entry{
+		ok:      p.Title != "",
+		expires: time.Now().Add(memoryTTL),
+		preview: p,
+	}
+}
+
+// Request to fetch a URL linked in a thread
+type request struct {
+	op    uint64
+	board string
+	url   string
+}
+
+// Get retrieves a preview of a URL linked in thread op on board from memory.
+// Never blocks on the database, so it is safe to call during rendering. If
+// no preview is available, the URL is queued for loading or fetching and false
+// is returned. Once loaded, the thread's cached HTML is cleared. Expired
+// previews are still returned, while being refreshed.
+func Get(u string, op uint64, board string) (common.LinkPreview, bool) {
+	if !IsAllowed(u) {
+		return common.LinkPreview{}, false
+	}
+
+	mu.RLock()
+	e, ok := previews[u]
+	mu.RUnlock()
+	if !ok || time.Now().After(e.expires) {
+		enqueue(request{
+			op:    op,
+			board: board,
+			url:   u,
+		})
+	}
+	return e.preview, e.ok
+}
+
+// Prefetch loads the stored previews of all allowed URLs, that are not cached
+// in memory yet, with a single database query. Call before rendering posts to
+// avoid them being rendered without previews.
+func Prefetch(urls []string) {
+	byID := make(map[string]string, len(urls))
+	now := time.Now()
+	mu.RLock()
+	for _, u := range urls {
+		if e, ok := previews[u]; ok && now.Before(e.expires) {
+			continue
+		}
+		if IsAllowed(u) {
+			byID[ID(u)] = u
+		}
+	}
+	mu.RUnlock()
+	if len(byID) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	found, err := db.GetLinkPreviews(ids)
+	if err != nil {
+		log.Printf("link preview: prefetch: %s", err)
+		return
+	}
+	for _, p := range found {
+		store(byID[p.ID], newEntry(p))
+	}
+}
+
+// ID returns the hex-encoded SHA1 hash of a URL, that is used to identify its
+// preview
+func ID(u string) string {
+	sum := sha1.Sum([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAllowed returns, if u is an HTTP(S) URL on one of the domains previews are
+// enabled for, or their subdomains
+func IsAllowed(u string) bool {
+	domains := config.Get().PreviewDomains
+	if len(domains) == 0 {
+		return false
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store a preview in memory. If the limit is reached, an arbitrary entry is
+// evicted.
+func store(u string, e entry) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(previews) >= maxCached {
+		for k := range previews {
+			delete(previews, k)
+			break
+		}
+	}
+	previews[u] = e
+}
+
+// Queue a URL for fetching, unless already queued. Drops the request, if the
+// queue is full. It will simply be requested again on the next render.
+func enqueue(req request) {
+	startOnce.Do(func() {
+		for i := 0; i < numWorkers; i++ {
+			go work()
+		}
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if pending[req.url] {
+		return
+	}
+	select {
+	case queue <- req:
+		pending[req.url] = true
+	default:
+	}
+}
+
+// Fetch queued URLs and store their previews
+func work() {
+	for req := range queue {
+		if err := process(req); err != nil {
+			log.Printf("link preview: %s: %s", req.url, err)
+		}
+
+		mu.Lock()
+		delete(pending, req.url)
+		mu.Unlock()
+	}
+}
+
+func process(req request) (err error) {
+	// Already stored by this or another server instance
+	switch p, err := db.GetLinkPreview(ID(req.url)); err {
+	case nil:
+		mu.RLock()
+		prev, ok := previews[req.url]
+		mu.RUnlock()
+		store(req.url, newEntry(p))
+		if !ok || prev.preview != p {
+			clearThreadCache(req, p)
+		}
+		return nil
+	case sql.ErrNoRows:
+	default:
+		return err
+	}
+
+	p, thumb, err := fetch(req.url)
+	ttl := previewTTL
+	if err != nil {
+		// Still record the failure, so the URL is not fetched again on each
+		// render
+		log.Printf("link preview: %s: %s", req.url, err)
+		ttl = failureTTL
+	}
+	p.ID = ID(req.url)
+
+	err = db.WriteLinkPreview(req.url, p, thumb, ttl)
+	if err != nil {
+		return
+	}
+	store(req.url, newEntry(p))
+	clearThreadCache(req, p)
+	return
+}
+
+// Rerender the thread the URL was linked in, if a preview is now available
+func clearThreadCache(req request, p common.LinkPreview) {
+	if req.op == 0 || p.Title == "" {
+		return
+	}
+	for _, lastN := range [...]int{0, 5, 100} {
+		cache.Delete(cache.ThreadKey(req.op, lastN))
+	}
+	cache.DeleteByBoard(req.board)
+	cache.DeleteByBoard("all")
+}
@@ -0,0 +1,37 @@
+package unfurl
+
+import (
+	"meguca/config"
+	"testing"
+)
+
+func TestIsAllowed(t *testing.T) {
+	config.Set(config.Configs{
+		Public: config.Public{
+			PreviewDomains: []string{"example.com", "Foo.org"},
+		},
+	})
+	defer config.Set(config.Configs{})
+
+	cases := [...]struct {
+		name, url string
+		allowed   bool
+	}{
+		{"domain", "https://example.com/foo", true},
+		{"subdomain", "http://www.example.com", true},
+		{"case insensitive", "https://FOO.org/bar", true},
+		{"other domain", "https://example.net", false},
+		{"suffix only", "https://notexample.com", false},
+		{"port", "https://example.com:8080/", true},
+		{"scheme", "ftp://example.com/foo", false},
+		{"invalid", "http://[::1", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if a := IsAllowed(c.url); a != c.allowed {
+				t.Fatalf("unexpected result: %v : %v", c.allowed, a)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ var clients = ClientMap{
 
 func init() {
 	common.GetByIPAndBoard = GetByIPAndBoard
+	common.GetByIPAndID = GetByIPAndID
 }
 
 // ClientMap is a thread-safe store for all clients connected to this server
@@ -108,6 +109,34 @@ func GetByIPAndBoard(ip, board string) []common.Client {
 	return cls
 }
 
+// GetByIPAndID retrieves a Client by its IP and the random ID it passed on
+// connection. Returns nil, if none found.
+func GetByIPAndID(ip, id string) common.Client {
+	clients.RLock()
+	defer clients.RUnlock()
+
+	for cl := range clients.clients {
+		if cl.IP() == ip && cl.ID() == id {
+			return cl
+		}
+	}
+	return nil
+}
+
+// GetByThread retrieves all Clients synchronised to a thread
+func GetByThread(op uint64) []common.Client {
+	clients.RLock()
+	defer clients.RUnlock()
+
+	cls := make([]common.Client, 0, 16)
+	for cl, sync := range clients.clients {
+		if sync.op == op {
+			cls = append(cls, cl)
+		}
+	}
+	return cls
+}
+
 // All returns all currently connected clients
 func All() []common.Client {
 	clients.RLock()
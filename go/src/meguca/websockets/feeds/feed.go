@@ -16,12 +16,15 @@ const (
 	deletePost
 	ban
 	deleteImage
+	insertExtraImage
 )
 
 type postMessage struct {
 	typ postMessageType
-	id  uint64
-	msg []byte
+	// Spoiler category of spoilerImage messages
+	spoiler uint8
+	id      uint64
+	msg     []byte
 }
 
 type postCreationMessage struct {
@@ -37,9 +40,11 @@ type postBodyModMessage struct {
 }
 
 type openPostCacheEntry struct {
-	hasImage, spoilered bool
-	created             int64
-	body                []byte
+	hasImage    bool
+	spoiler     uint8
+	extraImages int
+	created     int64
+	body        []byte
 }
 
 // A feed with synchronization logic of a certain thread
@@ -84,10 +89,11 @@ func (f *Feed) Start() (err error) {
 	for _, p := range recent {
 		f.recent[p.ID] = p.Time
 		f.open[p.ID] = openPostCacheEntry{
-			hasImage:  p.HasImage,
-			spoilered: p.Spoilered,
-			created:   p.Time,
-			body:      p.Body,
+			hasImage:    p.HasImage,
+			spoiler:     p.Spoiler,
+			extraImages: p.ExtraImages,
+			created:     p.Time,
+			body:        p.Body,
 		}
 	}
 
@@ -195,9 +201,13 @@ func (f *Feed) Start() (err error) {
 					p := f.open[msg.id]
 					p.hasImage = true
 					f.open[msg.id] = p
+				case insertExtraImage:
+					p := f.open[msg.id]
+					p.extraImages++
+					f.open[msg.id] = p
 				case spoilerImage:
 					p := f.open[msg.id]
-					p.spoilered = true
+					p.spoiler = msg.spoiler
 					f.open[msg.id] = p
 				case ban:
 					f.banned = append(f.banned, msg.id)
@@ -259,8 +269,13 @@ func (f *Feed) genSyncMessage() []byte {
 		if p.hasImage {
 			b = append(b, `,"hasImage":true`...)
 		}
-		if p.spoilered {
-			b = append(b, `,"spoilered":true`...)
+		if p.spoiler != common.NoSpoiler {
+			b = append(b, `,"spoilered":true,"spoilerCategory":`...)
+			b = strconv.AppendUint(b, uint64(p.spoiler), 10)
+		}
+		if p.extraImages != 0 {
+			b = append(b, `,"extraImages":`...)
+			b = strconv.AppendInt(b, int64(p.extraImages), 10)
 		}
 		b = append(b, '}')
 	}
@@ -315,6 +330,12 @@ func (f *Feed) InsertImage(id uint64, msg []byte) {
 	f._sendPostMessage(insertImage, id, msg)
 }
 
+// Insert an additional image into an already allocated post, that already has
+// an image
+func (f *Feed) InsertExtraImage(id uint64, msg []byte) {
+	f._sendPostMessage(insertExtraImage, id, msg)
+}
+
 // Small helper method
 func (f *Feed) _sendPostMessage(typ postMessageType, id uint64, msg []byte) {
 	f.sendPostMessage <- postMessage{
@@ -328,8 +349,13 @@ func (f *Feed) ClosePost(id uint64, msg []byte) {
 	f._sendPostMessage(closePost, id, msg)
 }
 
-func (f *Feed) SpoilerImage(id uint64, msg []byte) {
-	f._sendPostMessage(spoilerImage, id, msg)
+func (f *Feed) SpoilerImage(id uint64, category uint8, msg []byte) {
+	f.sendPostMessage <- postMessage{
+		typ:     spoilerImage,
+		spoiler: category,
+		id:      id,
+		msg:     msg,
+	}
 }
 
 func (f *Feed) banPost(id uint64, msg []byte) {
@@ -144,16 +144,25 @@ func DeleteImage(id, op uint64) error {
 }
 
 // Propagate a message about an image being spoilered
-func SpoilerImage(id, op uint64) error {
-	msg, err := common.EncodeMessage(common.MessageSpoiler, id)
+func SpoilerImage(id, op uint64, category uint8) error {
+	msg, err := EncodeSpoilerMessage(id, category)
 	if err != nil {
 		return err
 	}
 	return sendIfExists(op, func(f *Feed) {
-		f.SpoilerImage(id, msg)
+		f.SpoilerImage(id, category, msg)
 	})
 }
 
+// EncodeSpoilerMessage encodes a message about the image of a post being
+// spoilered with the specified spoiler category
+func EncodeSpoilerMessage(id uint64, category uint8) ([]byte, error) {
+	return common.EncodeMessage(
+		common.MessageSpoiler,
+		[2]uint64{id, uint64(category)},
+	)
+}
+
 // Remove all existing feeds and clients. Used only in tests.
 func Clear() {
 	feeds.mu.Lock()
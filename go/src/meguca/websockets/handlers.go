@@ -42,7 +42,7 @@ func (c *Client) runHandler(typ common.MessageType, msg []byte) error {
 		// No operation message handler. Used as a one way pseudo-ping.
 		return nil
 	case common.MessageSpoiler:
-		return c.spoilerImage()
+		return c.spoilerImage(data)
 	default:
 		return errInvalidPayload(msg)
 	}
@@ -7,12 +7,14 @@ import (
 
 // Data of a post currently being written to by a Client
 type openPost struct {
-	hasImage, isSpoilered bool
-	len, lines            int
-	id, op                uint64
-	time                  int64
-	body                  []byte
-	board                 string
+	hasImage    bool
+	spoiler     uint8
+	len, lines  int
+	extraImages int
+	id, op      uint64
+	time        int64
+	body        []byte
+	board       string
 }
 
 // Initialize a new open post from a post struct
@@ -28,8 +30,9 @@ func (o *openPost) init(p common.StandalonePost) {
 	o.countLines()
 	if p.Image != nil {
 		o.hasImage = true
-		o.isSpoilered = p.Image.Spoiler
+		o.spoiler = p.Image.SpoilerCategory
 	}
+	o.extraImages = len(p.Images)
 }
 
 // Count amount of lines in the post body
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"errors"
+	"meguca/assets"
 	"meguca/auth"
 	"meguca/common"
 	"meguca/config"
@@ -11,6 +12,7 @@ import (
 	"meguca/geoip"
 	"meguca/parser"
 	"meguca/websockets/feeds"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -19,10 +21,18 @@ import (
 )
 
 var (
-	errReadOnly          = errors.New("read only board")
-	errInvalidImageToken = errors.New("invalid image token")
-	errImageNameTooLong  = errors.New("image name too long")
-	errNoTextOrImage     = errors.New("no text or image")
+	errReadOnly           = errors.New("read only board")
+	errInvalidImageToken  = errors.New("invalid image token")
+	errImageNameTooLong   = errors.New("image name too long")
+	errBlockedImage       = errors.New("image is blocked")
+	errFileTypeNotAllowed = errors.New("file type not allowed on this board")
+	errFileTooLarge       = errors.New("file too large")
+	errStorageQuota       = errors.New("board storage quota exceeded")
+	errNoTextOrImage      = errors.New("no text or image")
+	errThreadLocked       = errors.New("thread is locked")
+	errImageLimit         = errors.New("thread image limit reached")
+	errInvalidFlag        = errors.New("invalid flag")
+	errInvalidSpoiler     = errors.New("invalid spoiler category")
 )
 
 // ThreadCreationRequest contains data for creating a new thread
@@ -39,13 +49,23 @@ type ReplyCreationRequest struct {
 	Image      ImageRequest
 	auth.SessionCreds
 	auth.Captcha
-	Name, Password, Body string
+	Name, Password, Body, Flag string
 }
 
-// ImageRequest contains data for allocating an image
+// ImageRequest contains data for allocating an image. Spoiler without a
+// SpoilerCategory selects common.SpoilerGeneric.
 type ImageRequest struct {
-	Spoiler     bool
-	Token, Name string
+	Spoiler         bool
+	SpoilerCategory uint8
+	Token, Name     string
+}
+
+// Returns the requested spoiler category of the image
+func (r ImageRequest) spoiler() uint8 {
+	if r.Spoiler && r.SpoilerCategory == common.NoSpoiler {
+		return common.SpoilerGeneric
+	}
+	return r.SpoilerCategory
 }
 
 // CreateThread creates a new tread and writes it to the database.
@@ -99,7 +119,9 @@ func CreateThread(req ThreadCreationRequest, ip string) (
 	hasImage := !conf.TextOnly && req.Image.Token != "" && req.Image.Name != ""
 	if hasImage {
 		img := req.Image
-		post.Image, err = getImage(tx, img.Token, img.Name, img.Spoiler)
+		post.Image, err = getImage(
+			tx, req.Board, img.Token, img.Name, img.spoiler(),
+		)
 		if err != nil {
 			return
 		}
@@ -162,16 +184,6 @@ func CreatePost(
 		return
 	}
 
-	// Assert thread is not locked
-	locked, err := db.CheckThreadLocked(op)
-	switch {
-	case err != nil:
-		return
-	case locked:
-		err = errors.New("thread is locked")
-		return
-	}
-
 	// Disable live updates, if thread is non-live
 	if req.Open {
 		var disabled bool
@@ -200,6 +212,20 @@ func CreatePost(
 	}
 	defer db.RollbackOnError(tx, &err)
 
+	// Assert thread is not locked and within the board's post and image
+	// limits. Locks the thread's row until the end of the transaction.
+	locked, postCtr, imageCtr, err := db.GetThreadPostingState(tx, op)
+	switch {
+	case err != nil:
+		return
+	case locked, conf.PostLimit != 0 && postCtr >= conf.PostLimit:
+		err = errThreadLocked
+		return
+	case hasImage && conf.ImageLimit != 0 && imageCtr >= conf.ImageLimit:
+		err = errImageLimit
+		return
+	}
+
 	post.ID, err = db.NewPostID(tx)
 	if err != nil {
 		return
@@ -207,7 +233,9 @@ func CreatePost(
 
 	if hasImage {
 		img := req.Image
-		post.Image, err = getImage(tx, img.Token, img.Name, img.Spoiler)
+		post.Image, err = getImage(
+			tx, board, img.Token, img.Name, img.spoiler(),
+		)
 		if err != nil {
 			return
 		}
@@ -223,7 +251,26 @@ func CreatePost(
 		return
 	}
 
+	// Lock the thread, once the post limit is reached
+	lock := conf.PostLimit != 0 && postCtr+1 >= conf.PostLimit
+	if lock {
+		err = db.LockThread(tx, op)
+		if err != nil {
+			return
+		}
+	}
+
 	err = tx.Commit()
+	if err != nil || !lock {
+		return
+	}
+
+	// Disable post creation on any clients synced to the thread
+	lockMsg, err := common.EncodeMessage(common.MessageLockThread, op)
+	if err != nil {
+		return
+	}
+	feeds.SendTo(op, lockMsg)
 	return
 }
 
@@ -328,7 +375,15 @@ func constructPost(
 		}
 	}
 
-	if conf.Flags {
+	// Custom board flags take precedence over GeoIP country flags
+	switch {
+	case req.Flag != "":
+		if _, ok := assets.Flags.Get(conf.ID, req.Flag); !ok {
+			err = errInvalidFlag
+			return
+		}
+		post.Flag = common.CustomFlagPrefix + req.Flag
+	case conf.Flags:
 		post.Flag = geoip.LookUp(ip)
 	}
 
@@ -395,13 +450,17 @@ func constructPost(
 }
 
 // Performs some validations and retrieves processed image data by token ID.
-// Embeds spoiler and image name in result struct. The last extension is
-// stripped from the name.
-func getImage(tx *sql.Tx, token, name string, spoiler bool) (
+// Embeds spoiler category and image name in result struct. The last extension
+// is stripped from the name. Images on the board's blocklist and file types not
+// allowed on the board are rejected.
+func getImage(tx *sql.Tx, board, token, name string, spoiler uint8) (
 	img *common.Image, err error,
 ) {
-	if len(name) > 200 {
+	switch {
+	case len(name) > 200:
 		return nil, errImageNameTooLong
+	case !common.IsValidSpoiler(spoiler):
+		return nil, errInvalidSpoiler
 	}
 
 	imgCommon, err := db.UseImageToken(tx, token)
@@ -413,18 +472,55 @@ func getImage(tx *sql.Tx, token, name string, spoiler bool) (
 		return nil, err
 	}
 
+	blocked, err := db.IsBlockedImage(board, imgCommon)
+	switch {
+	case err != nil:
+		return nil, err
+	case blocked:
+		return nil, errBlockedImage
+	}
+	conf := config.GetBoardConfigs(board)
+	if !common.IsAllowedFileType(conf.AllowedTypes, imgCommon.FileType) {
+		return nil, errFileTypeNotAllowed
+	}
+	if int64(imgCommon.Size) > config.MaxUploadSize(board) {
+		return nil, errFileTooLarge
+	}
+	if quota := uint64(conf.StorageQuota) << 20; quota != 0 {
+		// Files already posted on the board do not use any more space
+		size, err := db.BoardStorageWithFile(tx, board, imgCommon.SHA1)
+		switch {
+		case err != nil:
+			return nil, err
+		case size > quota:
+			return nil, errStorageQuota
+		}
+	}
+
 	// Trim on the last dot in the file name, but also strip for .tar.gz and
 	// .tar.xz as special cases.
+	var ext string
 	if i := strings.LastIndexByte(name, '.'); i != -1 {
-		name = name[:i]
+		name, ext = name[:i], name[i:]
 	}
 	if strings.HasSuffix(name, ".tar") {
 		name = name[:len(name)-4]
 	}
+	if conf.HideFileNames {
+		name = strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond),
+			10)
+	}
 
-	return &common.Image{
+	// Text files retain their original extension. It selects the language of
+	// the syntax highlighted viewer.
+	if imgCommon.FileType == common.TXT && !strings.EqualFold(ext, ".txt") {
+		name += ext
+	}
+
+	img = &common.Image{
 		ImageCommon: imgCommon,
-		Spoiler:     spoiler,
 		Name:        name,
-	}, nil
+	}
+	img.SetSpoiler(spoiler)
+	return img, nil
 }
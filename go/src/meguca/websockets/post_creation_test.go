@@ -1,6 +1,7 @@
 package websockets
 
 import (
+	"meguca/assets"
 	"meguca/common"
 	"meguca/config"
 	"meguca/db"
@@ -104,9 +105,10 @@ func testCreateThread(t *testing.T) {
 			ID:   6,
 			Name: "name",
 			Image: &common.Image{
-				Spoiler:     true,
-				ImageCommon: stdJPEG,
-				Name:        "foo",
+				Spoiler:         true,
+				SpoilerCategory: common.SpoilerGeneric,
+				ImageCommon:     stdJPEG,
+				Name:            "foo",
 			},
 		},
 		Posts: []common.Post{},
@@ -225,7 +227,7 @@ func TestGetInvalidImage(t *testing.T) {
 			}
 			defer db.RollbackOnError(tx, &err)
 
-			_, err = getImage(tx, c.token, c.name, false)
+			_, err = getImage(tx, "a", c.token, c.name, common.NoSpoiler)
 			if err != c.err {
 				UnexpectedError(t, err)
 			}
@@ -238,6 +240,57 @@ func TestGetInvalidImage(t *testing.T) {
 	}
 }
 
+func TestStorageQuota(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+
+	img := stdJPEG
+	img.SHA1 = GenString(40)
+	img.Size = 2 << 20
+	if err := db.WriteImage(nil, img); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name  string
+		quota uint
+		err   error
+	}{
+		{"no quota", 0, nil},
+		{"within quota", 3, nil},
+		{"quota exceeded", 1, errStorageQuota},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.ClearBoards()
+			_, err := config.SetBoardConfigs(config.BoardConfigs{
+				ID:           "a",
+				StorageQuota: c.quota,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := db.NewImageToken(img.SHA1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx, err := db.StartTransaction()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			_, err = getImage(tx, "a", token, "foo.jpeg", common.NoSpoiler)
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
+
 func TestClosePreviousPostOnCreation(t *testing.T) {
 	feeds.Clear()
 	assertTableClear(t, "boards")
@@ -331,9 +384,9 @@ func TestPostCreation(t *testing.T) {
 		Body:     "Δ",
 		Password: "123",
 		Image: ImageRequest{
-			Name:    "foo.jpeg",
-			Token:   token,
-			Spoiler: true,
+			Name:            "foo.jpeg",
+			Token:           token,
+			SpoilerCategory: common.SpoilerNSFW,
 		},
 	}
 
@@ -349,9 +402,10 @@ func TestPostCreation(t *testing.T) {
 			ID:      6,
 			Body:    "Δ",
 			Image: &common.Image{
-				Name:        "foo",
-				Spoiler:     true,
-				ImageCommon: stdJPEG,
+				Name:            "foo",
+				Spoiler:         true,
+				SpoilerCategory: common.SpoilerNSFW,
+				ImageCommon:     stdJPEG,
 			},
 		},
 		OP:    1,
@@ -377,14 +431,14 @@ func TestPostCreation(t *testing.T) {
 	AssertDeepEquals(t, thread.ImageCtr, uint32(2))
 
 	AssertDeepEquals(t, cl.post, openPost{
-		id:          6,
-		op:          1,
-		time:        stdPost.Time,
-		board:       "a",
-		len:         1,
-		hasImage:    true,
-		isSpoilered: true,
-		body:        []byte("Δ"),
+		id:       6,
+		op:       1,
+		time:     stdPost.Time,
+		board:    "a",
+		len:      1,
+		hasImage: true,
+		spoiler:  common.SpoilerNSFW,
+		body:     []byte("Δ"),
 	})
 }
 
@@ -550,3 +604,88 @@ func TestPostCreationForcedAnon(t *testing.T) {
 		t.Fatal("not anonymous")
 	}
 }
+
+func TestPostLimitAutoLock(t *testing.T) {
+	feeds.Clear()
+	prepareForPostCreation(t)
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostLimit: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	registerClient(t, cl, 1, "a")
+	defer cl.Close(nil)
+
+	req := ReplyCreationRequest{
+		Body:     "a",
+		Password: "123",
+	}
+	if err := cl.insertPost(marshalJSON(t, req)); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := db.CheckThreadLocked(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("thread not locked")
+	}
+
+	err = cl.insertPost(marshalJSON(t, req))
+	if err != errThreadLocked {
+		UnexpectedError(t, err)
+	}
+}
+
+func TestPostCreationCustomFlag(t *testing.T) {
+	feeds.Clear()
+	prepareForPostCreation(t)
+	setBoardConfigs(t, true)
+	assets.Flags.Set("a", []assets.Flag{
+		{
+			File: assets.File{
+				Data: []byte{1, 2, 3},
+				Mime: "image/png",
+			},
+			Name: "pirate",
+		},
+	})
+	defer assets.Flags.Set("a", nil)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	registerClient(t, cl, 1, "a")
+	defer cl.Close(nil)
+
+	req := ReplyCreationRequest{
+		Body:     "a",
+		Password: "123",
+		Flag:     "ninja",
+	}
+	err := cl.insertPost(marshalJSON(t, req))
+	if err != errInvalidFlag {
+		UnexpectedError(t, err)
+	}
+
+	req.Flag = "pirate"
+	if err := cl.insertPost(marshalJSON(t, req)); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := db.GetPost(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, post.Flag, common.CustomFlagPrefix+"pirate")
+}
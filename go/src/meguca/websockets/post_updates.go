@@ -9,6 +9,7 @@ import (
 	"meguca/db"
 	"meguca/parser"
 	"meguca/util"
+	"meguca/websockets/feeds"
 	"time"
 	"unicode/utf8"
 )
@@ -274,7 +275,14 @@ func (c *Client) insertImage(data []byte) (err error) {
 		return
 	case !has:
 		return errNoPostOpen
-	case c.post.hasImage:
+	}
+
+	conf := config.GetBoardConfigs(c.post.board)
+	maxFiles := int(conf.MaxFiles)
+	if maxFiles == 0 {
+		maxFiles = 1
+	}
+	if c.post.hasImage && 1+c.post.extraImages >= maxFiles {
 		return errHasImage
 	}
 
@@ -284,7 +292,7 @@ func (c *Client) insertImage(data []byte) (err error) {
 		return
 	}
 
-	if config.GetBoardConfigs(c.post.board).TextOnly {
+	if conf.TextOnly {
 		return errTextOnly
 	}
 
@@ -294,14 +302,33 @@ func (c *Client) insertImage(data []byte) (err error) {
 	}
 	defer db.RollbackOnError(tx, &err)
 
-	img, err := getImage(tx, req.Token, req.Name, req.Spoiler)
+	if conf.ImageLimit != 0 {
+		var imageCtr uint
+		_, _, imageCtr, err = db.GetThreadPostingState(tx, c.post.op)
+		switch {
+		case err != nil:
+			return
+		case imageCtr >= conf.ImageLimit:
+			return errImageLimit
+		}
+	}
+
+	img, err := getImage(
+		tx, c.post.board, req.Token, req.Name, req.spoiler(),
+	)
 	if err != nil {
 		return
 	}
-	c.post.hasImage = true
-	c.post.isSpoilered = req.Spoiler
 
-	err = db.InsertImage(tx, c.post.id, *img)
+	// The first image is stored on the post itself. Any further ones are
+	// attached at increasing indices.
+	var index int
+	if c.post.hasImage {
+		index = 1 + c.post.extraImages
+		err = db.InsertPostImage(tx, c.post.id, index, *img)
+	} else {
+		err = db.InsertImage(tx, c.post.id, *img)
+	}
 	if err != nil {
 		return
 	}
@@ -309,24 +336,47 @@ func (c *Client) insertImage(data []byte) (err error) {
 	if err != nil {
 		return
 	}
+	if index == 0 {
+		c.post.hasImage = true
+		c.post.spoiler = img.SpoilerCategory
+	} else {
+		c.post.extraImages++
+	}
 
 	msg, err := common.EncodeMessage(common.MessageInsertImage, struct {
-		ID uint64 `json:"id"`
+		ID    uint64 `json:"id"`
+		Index int    `json:"index,omitempty"`
 		common.Image
 	}{
 		ID:    c.post.id,
+		Index: index,
 		Image: *img,
 	})
 	if err != nil {
 		return
 	}
-	c.feed.InsertImage(c.post.id, msg)
+	if index == 0 {
+		c.feed.InsertImage(c.post.id, msg)
+	} else {
+		c.feed.InsertExtraImage(c.post.id, msg)
+	}
 
 	return c.incrementSpamScore(auth.ImageScore)
 }
 
-// Spoiler an already inserted image in an unclosed post
-func (c *Client) spoilerImage() (err error) {
+// Spoiler an already inserted image in an unclosed post. The message
+// optionally contains the spoiler category. Defaults to
+// common.SpoilerGeneric.
+func (c *Client) spoilerImage(data []byte) (err error) {
+	var category uint8
+	err = decodeMessage(data, &category)
+	if err != nil {
+		return
+	}
+	if category == common.NoSpoiler {
+		category = common.SpoilerGeneric
+	}
+
 	has, err := c.hasPost()
 	switch {
 	case err != nil:
@@ -335,19 +385,22 @@ func (c *Client) spoilerImage() (err error) {
 		return errNoPostOpen
 	case !c.post.hasImage:
 		return errors.New("post does not have an image")
-	case c.post.isSpoilered:
+	case c.post.spoiler != common.NoSpoiler:
 		return errors.New("already spoilered")
+	case !common.IsValidSpoiler(category):
+		return errInvalidSpoiler
 	}
 
-	err = db.SpoilerImage(c.post.id)
+	err = db.SpoilerImage(c.post.id, category)
 	if err != nil {
 		return
 	}
-	msg, err := common.EncodeMessage(common.MessageSpoiler, c.post.id)
+	msg, err := feeds.EncodeSpoilerMessage(c.post.id, category)
 	if err != nil {
 		return
 	}
-	c.feed.SpoilerImage(c.post.id, msg)
+	c.post.spoiler = category
+	c.feed.SpoilerImage(c.post.id, category, msg)
 
 	return
 }
@@ -2,6 +2,7 @@ package websockets
 
 import (
 	"meguca/common"
+	"meguca/config"
 	"meguca/db"
 	. "meguca/test"
 	"meguca/websockets/feeds"
@@ -677,6 +678,78 @@ func TestInsertImage(t *testing.T) {
 	}
 }
 
+func TestInsertExtraImage(t *testing.T) {
+	feeds.Clear()
+	assertTableClear(t, "boards", "images")
+	writeSampleBoard(t)
+	writeSampleThread(t)
+	writeSampleImage(t)
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			MaxFiles: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := db.Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:    2,
+				Image: &common.Image{ImageCommon: stdJPEG},
+			},
+			Board: "a",
+			OP:    1,
+		},
+	}
+	if err := db.WritePost(nil, post); err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	registerClient(t, cl, 1, "a")
+	cl.post = openPost{
+		id:       2,
+		board:    "a",
+		op:       1,
+		time:     time.Now().Unix(),
+		hasImage: true,
+	}
+
+	insert := func() error {
+		token, err := db.NewImageToken(stdJPEG.SHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := ImageRequest{
+			Name:  "foo.jpeg",
+			Token: token,
+		}
+		return cl.insertImage(marshalJSON(t, req))
+	}
+
+	if err := insert(); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, cl.post.extraImages, 1)
+
+	p, err := db.GetPost(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, len(p.Images), 1)
+
+	// Board limit reached
+	if err := insert(); err != errHasImage {
+		UnexpectedError(t, err)
+	}
+}
+
 func writeSampleImage(t *testing.T) {
 	t.Helper()
 	if err := db.WriteImage(nil, stdJPEG); err != nil {
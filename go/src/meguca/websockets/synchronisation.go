@@ -23,6 +23,12 @@ type syncRequest struct {
 	Board  string
 }
 
+// Target of a client redirect. Thread is 0 for board pages.
+type redirectRequest struct {
+	Board  string `json:"board"`
+	Thread uint64 `json:"thread,omitempty"`
+}
+
 type reclaimRequest struct {
 	ID       uint64
 	Password string
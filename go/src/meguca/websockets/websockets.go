@@ -60,12 +60,15 @@ type Client struct {
 	conn *websocket.Conn
 	// Client IP
 	ip string
+	// Random ID passed by the client on connection. Used to address messages
+	// to a specific browser tab.
+	id string
 	// Internal message receiver channel
 	receive chan receivedMessage
 	// Only used to pass messages from the Send method.
 	sendExternal chan []byte
-	// Redirect client to target board
-	redirect chan string
+	// Redirect client to target board or thread
+	redirect chan redirectRequest
 	// Close the client and free all used resources
 	close chan error
 }
@@ -106,9 +109,10 @@ func newClient(conn *websocket.Conn, req *http.Request) (*Client, error) {
 	}
 	return &Client{
 		ip:       ip,
+		id:       req.URL.Query().Get("id"),
 		close:    make(chan error, 2),
 		receive:  make(chan receivedMessage),
-		redirect: make(chan string),
+		redirect: make(chan redirectRequest),
 		// Allows for ~60 seconds of messages, until the buffer overflows.
 		// A larger gap is more acceptable to shitty connections and mobile
 		// phones, especially while uploading.
@@ -153,12 +157,12 @@ func (c *Client) listenerLoop() error {
 			if err := c.handleMessage(msg.typ, msg.msg); err != nil {
 				return err
 			}
-		case board := <-c.redirect:
-			err := c.sendMessage(common.MessageRedirect, board)
+		case req := <-c.redirect:
+			err := c.sendMessage(common.MessageRedirect, req)
 			if err != nil {
 				return err
 			}
-			if err := c.registerSync(0, board); err != nil {
+			if err := c.registerSync(0, req.Board); err != nil {
 				return err
 			}
 		}
@@ -330,10 +334,10 @@ func (c *Client) hasPost() (bool, error) {
 }
 
 // Redirect closes any open posts and forces the client to sync to the target
-// board
-func (c *Client) Redirect(board string) {
+// board. If thread is not 0, the client navigates to that thread on the board.
+func (c *Client) Redirect(board string, thread uint64) {
 	select {
-	case c.redirect <- board:
+	case c.redirect <- redirectRequest{board, thread}:
 	default:
 	}
 }
@@ -343,3 +347,9 @@ func (c *Client) Redirect(board string) {
 func (c *Client) IP() string {
 	return c.ip
 }
+
+// ID returns the random ID passed by the client on connection, if any.
+// Thread-safe, as the ID is never written to after assignment.
+func (c *Client) ID() string {
+	return c.id
+}